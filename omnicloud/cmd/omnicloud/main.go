@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -123,6 +124,13 @@ func main() {
 		// Continue anyway - migrations may have already been run
 	}
 
+	// Decode the content titles of compositions indexed before titles were decoded
+	if n, err := database.BackfillDCPCompositionTitles(); err != nil {
+		log.Printf("Warning: could not decode composition titles: %v", err)
+	} else if n > 0 {
+		log.Printf("Decoded content titles of %d composition(s)", n)
+	}
+
 	// Seed default admin user (only if no users exist)
 	if err := database.SeedDefaultUser("martyn", "Cinema200"); err != nil {
 		log.Printf("Warning: could not seed default user: %v", err)
@@ -213,6 +221,10 @@ func main() {
 			}
 		}
 		tracker = torrentpkg.NewTracker(database.DB, 60, announceHost)
+		// Bring back the swarms of the last run so seeders are handed out before they re-announce
+		if err := tracker.RestoreSwarms(); err != nil {
+			log.Printf("Warning: failed to restore tracker swarms: %v", err)
+		}
 		torrentClient.SetTracker(tracker)
 		go func() {
 			addr := fmt.Sprintf(":%d", cfg.TrackerPort)
@@ -277,13 +289,14 @@ func main() {
 	scanHandler.GetIndexer().SetTorrentQueue(queueManager)
 	go scanHandler.StartScanWorker(scanRequests, stopChan)
 
-	// Start filesystem watcher
-	fsWatcher, err := watcher.NewWatcher(cfg.ScanPath, scanRequests)
+	// Start filesystem watcher (follows the library locations the periodic scanner resolves)
+	fsWatcher, err := watcher.NewWatcher([]string{cfg.ScanPath}, scanRequests)
 	if err != nil {
 		log.Printf("WARNING: Failed to create filesystem watcher: %v (continuing without live file watching)", err)
 	} else {
 		if err := fsWatcher.Start(); err != nil {
 			log.Printf("WARNING: Failed to start filesystem watcher: %v (continuing without live file watching)", err)
+			fsWatcher = nil
 		} else {
 			defer fsWatcher.Stop()
 		}
@@ -293,14 +306,35 @@ func main() {
 	periodicScanner := scanner.NewPeriodicScanner(cfg.ScanPath, cfg.ScanInterval, database, serverID)
 	periodicScanner.GetIndexer().SetTorrentQueue(queueManager)
 	defer periodicScanner.Stop()
+	if fsWatcher != nil {
+		periodicScanner.SetLibraryListener(func(paths []string) {
+			fsWatcher.SetLocations(paths)
+		})
+	}
 
 	// Start API server (pass our server ID and scan trigger for Rescan in UI)
-	triggerScan := func() { go periodicScanner.RunFullScan() }
+	triggerScan := func(full bool) { go periodicScanner.RunScan(full) }
 	apiServer := api.NewServer(database, cfg.APIPort, cfg.RegistrationKey, &serverID, triggerScan, cfg.TrackerPort)
 	if tracker != nil {
 		apiServer.RegisterTracker(tracker)
 	}
 
+	// PKL hash verification: runs in-process for packages held by this server,
+	// or on request of the main server (verify_package command) in client mode
+	packageVerifier := scanner.NewPackageVerifier()
+	packageVerifier.SetVolumeLocator(periodicScanner.VolumesFor)
+	apiServer.RegisterLocalVerifier(packageVerifier.Verify)
+
+	// Library locations of this server edited through the API are followed without a restart
+	apiServer.RegisterLibraryReloader(periodicScanner.RefreshLibraries)
+
+	// Watcher events for one volume of a multi-volume delivery are resolved by a full scan
+	scanHandler.SetFullScanTrigger(func() {
+		if !periodicScanner.IsScanning() {
+			triggerScan(false)
+		}
+	})
+
 	// Initialize WebSocket hub for main server
 	var wsHub *ws.Hub
 	if cfg.IsMainServer() {
@@ -308,6 +342,26 @@ func main() {
 		go wsHub.Run()
 		apiServer.RegisterWebSocketHub(wsHub)
 		log.Println("WebSocket hub started for client connections")
+
+		// Evaluate space reclamation policies periodically
+		go apiServer.RunReclamation(ctx)
+
+		// Push transfers and commands to connected clients again periodically, so clients
+		// check held transfers for space again and unanswered pushes are retried
+		go apiServer.RunTransferDispatch(ctx)
+
+		// Release the next waves of distribution campaigns as earlier ones complete
+		go apiServer.RunCampaigns(ctx)
+
+		// Predict whether transfers with a delivery deadline make it, and follow this
+		// server's own bandwidth calendar
+		go apiServer.RunDeadlineMonitor(ctx)
+		go torrentClient.RunBandwidthSchedule(ctx, func() (*torrentpkg.BandwidthSchedule, error) {
+			return apiServer.BandwidthSchedule(serverID)
+		})
+
+		// Close verification runs whose client never reported back
+		go apiServer.RunVerificationTimeouts(ctx)
 	}
 
 	go func() {
@@ -421,6 +475,16 @@ func main() {
 				torrentDownloadDir,
 			)
 
+			// Deleted content is quarantined in the library location it was deleted from
+			transferProcessor.SetLibraryLocator(periodicScanner.LibraryPaths)
+
+			// Heartbeats report the free space of the library and download locations so the main
+			// server only hands out transfers that fit
+			measureStorage := func() []dcp.StorageUsage {
+				return dcp.MeasureStorage(periodicScanner.LibraryPaths(), torrentDownloadDir)
+			}
+			clientSync.SetStorageReporter(measureStorage)
+
 			// Wire up error reporting so download errors are reported to the main server
 			torrentClient.SetErrorReporter(func(transferID, status, errorMessage string) error {
 				return transferProcessor.ReportTransferError(transferID, status, errorMessage)
@@ -430,6 +494,9 @@ func main() {
 			defer transferProcessor.Stop()
 			log.Println("Transfer processor started")
 
+			// Throttle torrent traffic by the bandwidth calendar set on the main server
+			go torrentClient.RunBandwidthSchedule(ctx, settingsClient.GetBandwidthSchedule)
+
 			// Resume any in-progress downloads from before restart
 			go torrentClient.ResumeDownloads()
 
@@ -521,6 +588,8 @@ func main() {
 			if err != nil {
 				log.Printf("Warning: failed to create WebSocket client: %v", err)
 			} else {
+				wsClient.SetStorageReporter(measureStorage)
+
 				// Set command handlers
 				wsClient.SetOnRestart(func() error {
 					log.Println("[WS Client] Restart command received")
@@ -540,6 +609,12 @@ func main() {
 					return nil
 				})
 
+				wsClient.SetOnLibraryChanged(func() error {
+					log.Println("[WS Client] Library locations changed on main server")
+					go periodicScanner.RefreshLibraries()
+					return nil
+				})
+
 				wsClient.SetOnStatusRequest(func() map[string]interface{} {
 					packageCount, _ := database.CountDCPPackages()
 					return map[string]interface{}{
@@ -550,13 +625,76 @@ func main() {
 
 				wsClient.SetOnDeleteContent(func(packageID, packageName, infoHash, targetPath string) (string, string, error) {
 					log.Printf("[WS Client] Delete content command: package=%s name=%s hash=%s path=%s", packageID, packageName, infoHash, targetPath)
-					result, message := transferProcessor.DeleteContent(packageID, packageName, infoHash, targetPath)
+					result, message := transferProcessor.DeleteContent(packageID, packageName, infoHash, targetPath, false)
 					if result == "error" {
 						return result, message, fmt.Errorf("%s", message)
 					}
 					return result, message, nil
 				})
 
+				wsClient.SetOnRestoreContent(func(packageID string) (string, error) {
+					log.Printf("[WS Client] Restore content command: package=%s", packageID)
+					localPath, err := transferProcessor.RestoreContent(packageID)
+					if err != nil {
+						return "", err
+					}
+					// Re-index once the restored package is stable, like any other package the watcher sees
+					go func() { scanRequests <- localPath }()
+					return fmt.Sprintf("Restored %s", localPath), nil
+				})
+
+				wsClient.SetOnVerifyPackage(func(verificationID, packageID, packageName, localPath string) error {
+					log.Printf("[WS Client] Verify package command: package=%s name=%s path=%s", packageID, packageName, localPath)
+					if packageVerifier.IsVerifying(packageID) {
+						return fmt.Errorf("verification of %s is already running", packageName)
+					}
+					go func() {
+						run, assets, err := packageVerifier.Verify(packageID, packageName, localPath)
+						if err != nil {
+							now := time.Now()
+							run = &db.DCPVerification{Status: db.VerificationError, ErrorMessage: err.Error(), CompletedAt: &now}
+						}
+						report := api.NewVerificationReport(verificationID, packageID, run, assets)
+						if err := settingsClient.ReportVerification(report); err != nil {
+							log.Printf("[verify] Failed to report verification %s: %v", verificationID, err)
+						}
+					}()
+					return nil
+				})
+
+				// The main server pushes transfers and transfer/content commands over the
+				// websocket; the transfer processor polls for them only while it is down
+				wsClient.SetOnStartTransfers(func(data json.RawMessage) (string, error) {
+					var transfers []torrentpkg.PendingTransfer
+					if err := json.Unmarshal(data, &transfers); err != nil {
+						return "", fmt.Errorf("invalid transfers: %w", err)
+					}
+					started := transferProcessor.StartTransfers(transfers)
+					return fmt.Sprintf("Started %d of %d transfer(s)", started, len(transfers)), nil
+				})
+
+				wsClient.SetOnTransferCommand(func(data json.RawMessage) (string, string, error) {
+					var cmd torrentpkg.TransferCommand
+					if err := json.Unmarshal(data, &cmd); err != nil {
+						return "error", "Invalid transfer command", err
+					}
+					log.Printf("[WS Client] Transfer command: %s for transfer=%s package=%q", cmd.Command, cmd.ID, cmd.PackageName)
+					result, message := transferProcessor.ExecuteCommand(cmd)
+					return result, message, nil
+				})
+
+				wsClient.SetOnContentCommand(func(data json.RawMessage) (string, string, error) {
+					var cmd torrentpkg.ContentCommand
+					if err := json.Unmarshal(data, &cmd); err != nil {
+						return "error", "Invalid content command", err
+					}
+					log.Printf("[WS Client] Content command: %s for package=%q", cmd.Command, cmd.PackageName)
+					result, message := transferProcessor.ExecuteContentCommand(cmd)
+					return result, message, nil
+				})
+
+				transferProcessor.SetPushChannel(wsClient.IsConnected)
+
 				// Start WebSocket client
 				go wsClient.Start(ctx)
 				log.Println("WebSocket client connector started")
@@ -630,6 +768,28 @@ func main() {
 					return []ws.ActivityItem{item}
 				})
 
+				// Register PKL hash verification collector
+				activityReporter.RegisterCollector("verification", func() []ws.ActivityItem {
+					var items []ws.ActivityItem
+					for _, p := range packageVerifier.Active() {
+						startedAt := p.StartedAt
+						var progress float64
+						if p.BytesTotal > 0 {
+							progress = float64(p.BytesDone) / float64(p.BytesTotal) * 100
+						}
+						items = append(items, ws.ActivityItem{
+							Category:  "verification",
+							Action:    "progress",
+							Title:     fmt.Sprintf("Verifying: %s", p.PackageName),
+							Detail:    fmt.Sprintf("%s (%d/%d files, %s / %s)", p.CurrentFile, p.FilesDone, p.FilesTotal, ws.FormatBytes(p.BytesDone), ws.FormatBytes(p.BytesTotal)),
+							Progress:  progress,
+							StartedAt: &startedAt,
+							Extra:     map[string]interface{}{"package_id": p.PackageID},
+						})
+					}
+					return items
+				})
+
 				// Register pending transfers collector
 				activityReporter.RegisterCollector("transfers", ws.NewTransferPendingCollector(database.DB, remoteID.String()))
 
@@ -659,6 +659,560 @@ CREATE INDEX IF NOT EXISTS idx_activity_logs_created_at ON activity_logs(created
 CREATE INDEX IF NOT EXISTS idx_activity_logs_user_id ON activity_logs(user_id);
 CREATE INDEX IF NOT EXISTS idx_activity_logs_category ON activity_logs(category);
 CREATE INDEX IF NOT EXISTS idx_activity_logs_action ON activity_logs(action);
+`,
+
+	"032_cpl_extended_model": `
+-- Composition-level flags derived from the reel asset lists
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS is_stereoscopic BOOLEAN DEFAULT false;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS has_atmos BOOLEAN DEFAULT false;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS has_closed_captions BOOLEAN DEFAULT false;
+
+-- Extension assets per reel (stereoscopic picture, closed captions, markers, AuxData/Atmos)
+ALTER TABLE dcp_reels ADD COLUMN IF NOT EXISTS is_stereoscopic BOOLEAN DEFAULT false;
+ALTER TABLE dcp_reels ADD COLUMN IF NOT EXISTS closed_caption_asset_uuid UUID;
+ALTER TABLE dcp_reels ADD COLUMN IF NOT EXISTS closed_caption_language VARCHAR(10);
+ALTER TABLE dcp_reels ADD COLUMN IF NOT EXISTS markers_asset_uuid UUID;
+ALTER TABLE dcp_reels ADD COLUMN IF NOT EXISTS aux_data_asset_uuid UUID;
+ALTER TABLE dcp_reels ADD COLUMN IF NOT EXISTS aux_data_type VARCHAR(255);
+
+-- MainMarkers entries (FFOC, LFOC, FFEC, LFEC, ...) with composition-absolute positions
+CREATE TABLE IF NOT EXISTS dcp_markers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    reel_number INTEGER NOT NULL,
+    label VARCHAR(20) NOT NULL,
+    offset_frames INTEGER NOT NULL DEFAULT 0,
+    absolute_frame INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_markers_composition_id ON dcp_markers(composition_id);
+CREATE INDEX IF NOT EXISTS idx_dcp_markers_label ON dcp_markers(label);
+
+-- RatingList entries
+CREATE TABLE IF NOT EXISTS dcp_ratings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    agency VARCHAR(512) NOT NULL DEFAULT '',
+    label VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_ratings_composition_id ON dcp_ratings(composition_id);
+
+-- ContentVersion / ContentVersionList entries
+CREATE TABLE IF NOT EXISTS dcp_content_versions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    content_version_id VARCHAR(512) NOT NULL,
+    label_text VARCHAR(512) DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (composition_id, content_version_id)
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_content_versions_composition_id ON dcp_content_versions(composition_id);
+`,
+
+	"033_dcp_standard": `
+-- Interop vs SMPTE, detected from the XML namespace of the ASSETMAP (package) and CPL (composition)
+ALTER TABLE dcp_packages ADD COLUMN IF NOT EXISTS standard VARCHAR(20) DEFAULT 'unknown';
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS standard VARCHAR(20) DEFAULT 'unknown';
+CREATE INDEX IF NOT EXISTS idx_dcp_packages_standard ON dcp_packages(standard);
+CREATE INDEX IF NOT EXISTS idx_dcp_compositions_standard ON dcp_compositions(standard);
+`,
+	"034_dcp_verification": `
+-- PKL hash verification runs (one row per request) and their per-asset results
+CREATE TABLE IF NOT EXISTS dcp_verifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    assets_total INTEGER DEFAULT 0,
+    assets_passed INTEGER DEFAULT 0,
+    assets_failed INTEGER DEFAULT 0,
+    bytes_total BIGINT DEFAULT 0,
+    error_message TEXT,
+    requested_by VARCHAR(255),
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_verifications_package_id ON dcp_verifications(package_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_dcp_verifications_status ON dcp_verifications(status);
+CREATE TABLE IF NOT EXISTS dcp_verification_assets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    verification_id UUID NOT NULL REFERENCES dcp_verifications(id) ON DELETE CASCADE,
+    asset_uuid UUID,
+    file_path VARCHAR(1024),
+    expected_size BIGINT,
+    actual_size BIGINT,
+    expected_hash VARCHAR(64),
+    actual_hash VARCHAR(64),
+    status VARCHAR(20) NOT NULL,
+    message TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_verification_assets_verification_id ON dcp_verification_assets(verification_id);
+`,
+	"035_inventory_volumes": `
+-- Multi-volume deliveries: how many of the package's volumes (dcp_packages.volume_count) a server holds.
+-- Inventory status is 'partial' until all volumes are present.
+ALTER TABLE server_dcp_inventory ADD COLUMN IF NOT EXISTS volumes_present INTEGER DEFAULT 1;
+`,
+	"036_vf_dependencies": `
+-- Track files a CPL references that are not in its own package (Version Files referencing an OV).
+-- provider_package_id is the indexed package that holds the asset, NULL while no package provides it.
+CREATE TABLE IF NOT EXISTS dcp_composition_external_assets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    asset_uuid UUID NOT NULL,
+    asset_kind VARCHAR(30),
+    provider_package_id UUID REFERENCES dcp_packages(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (composition_id, asset_uuid)
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_composition_external_assets_asset_uuid ON dcp_composition_external_assets(asset_uuid);
+CREATE INDEX IF NOT EXISTS idx_dcp_composition_external_assets_provider ON dcp_composition_external_assets(provider_package_id);
+-- VF -> OV relationships derived from the resolved external assets (one row per CPL and providing package)
+CREATE TABLE IF NOT EXISTS dcp_package_dependencies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    ov_package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    asset_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (composition_id, ov_package_id)
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_package_dependencies_package_id ON dcp_package_dependencies(package_id);
+CREATE INDEX IF NOT EXISTS idx_dcp_package_dependencies_ov_package_id ON dcp_package_dependencies(ov_package_id);
+`,
+	"037_kdms": `
+-- KeyIds of encrypted track files, so KDM coverage can be checked per composition
+CREATE TABLE IF NOT EXISTS dcp_composition_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    key_id UUID NOT NULL,
+    key_kind VARCHAR(30),
+    reel_number INTEGER,
+    UNIQUE (composition_id, key_id)
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_composition_keys_key_id ON dcp_composition_keys(key_id);
+-- KDM metadata (public part only; content keys are never decrypted or stored).
+-- KDMs link to compositions by cpl_uuid, so a KDM can be ingested before its DCP.
+CREATE TABLE IF NOT EXISTS kdms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    message_id UUID NOT NULL UNIQUE,
+    cpl_uuid UUID NOT NULL,
+    content_title_text VARCHAR(512),
+    annotation_text TEXT,
+    standard VARCHAR(20) DEFAULT 'unknown',
+    issue_date TIMESTAMP WITH TIME ZONE,
+    signer_issuer VARCHAR(1024),
+    recipient_subject VARCHAR(1024),
+    recipient_thumbprint VARCHAR(64),
+    recipient_serial VARCHAR(128),
+    device_thumbprints TEXT,
+    not_valid_before TIMESTAMP WITH TIME ZONE NOT NULL,
+    not_valid_after TIMESTAMP WITH TIME ZONE NOT NULL,
+    server_id UUID REFERENCES servers(id) ON DELETE SET NULL,
+    source_path VARCHAR(1024),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_kdms_cpl_uuid ON kdms(cpl_uuid);
+CREATE INDEX IF NOT EXISTS idx_kdms_server_id ON kdms(server_id);
+CREATE INDEX IF NOT EXISTS idx_kdms_not_valid_after ON kdms(not_valid_after);
+CREATE TABLE IF NOT EXISTS kdm_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kdm_id UUID NOT NULL REFERENCES kdms(id) ON DELETE CASCADE,
+    key_id UUID NOT NULL,
+    key_type VARCHAR(10),
+    UNIQUE (kdm_id, key_id)
+);
+CREATE INDEX IF NOT EXISTS idx_kdm_keys_key_id ON kdm_keys(key_id);
+`,
+	"038_xml_signatures": `
+-- XML-DSig verdict and signer of each CPL and PKL
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS signature_status VARCHAR(20) DEFAULT 'unknown';
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS signer_subject VARCHAR(1024);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS signer_issuer VARCHAR(1024);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS signer_not_before TIMESTAMP WITH TIME ZONE;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS signer_not_after TIMESTAMP WITH TIME ZONE;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS signature_message TEXT;
+CREATE INDEX IF NOT EXISTS idx_dcp_compositions_signature_status ON dcp_compositions(signature_status);
+ALTER TABLE dcp_packing_lists ADD COLUMN IF NOT EXISTS signature_status VARCHAR(20) DEFAULT 'unknown';
+ALTER TABLE dcp_packing_lists ADD COLUMN IF NOT EXISTS signer_subject VARCHAR(1024);
+ALTER TABLE dcp_packing_lists ADD COLUMN IF NOT EXISTS signer_issuer VARCHAR(1024);
+ALTER TABLE dcp_packing_lists ADD COLUMN IF NOT EXISTS signer_not_before TIMESTAMP WITH TIME ZONE;
+ALTER TABLE dcp_packing_lists ADD COLUMN IF NOT EXISTS signer_not_after TIMESTAMP WITH TIME ZONE;
+ALTER TABLE dcp_packing_lists ADD COLUMN IF NOT EXISTS signature_message TEXT;
+-- Re-scans used to insert a new PKL row each time; keep one per package so the verdict can be upserted
+DELETE FROM dcp_packing_lists a USING dcp_packing_lists b
+    WHERE a.package_id = b.package_id AND a.pkl_uuid = b.pkl_uuid AND a.ctid < b.ctid;
+ALTER TABLE dcp_packing_lists DROP CONSTRAINT IF EXISTS dcp_packing_lists_package_id_pkl_uuid_key;
+ALTER TABLE dcp_packing_lists ADD CONSTRAINT dcp_packing_lists_package_id_pkl_uuid_key UNIQUE (package_id, pkl_uuid);
+-- Signature counts of each scan
+ALTER TABLE scan_logs ADD COLUMN IF NOT EXISTS signatures_checked INTEGER DEFAULT 0;
+ALTER TABLE scan_logs ADD COLUMN IF NOT EXISTS signatures_invalid INTEGER DEFAULT 0;
+`,
+	"039_dcp_validation_findings": `
+-- Structural problems found by the package validator, per package and server (replaced on every scan)
+CREATE TABLE IF NOT EXISTS dcp_validation_findings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    check_id VARCHAR(64) NOT NULL,
+    severity VARCHAR(10) NOT NULL,
+    subject VARCHAR(1024),
+    message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_validation_findings_package_id ON dcp_validation_findings(package_id);
+CREATE INDEX IF NOT EXISTS idx_dcp_validation_findings_server_id ON dcp_validation_findings(server_id);
+CREATE INDEX IF NOT EXISTS idx_dcp_validation_findings_severity ON dcp_validation_findings(severity);
+`,
+	"040_dcp_asset_essence": `
+-- Essence facts read from the MXF header partition of each track file
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS essence_kind VARCHAR(20);
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS essence_container_ul VARCHAR(64);
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS mxf_package_uuid UUID;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS is_encrypted BOOLEAN DEFAULT FALSE;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS mxf_edit_rate VARCHAR(20);
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS mxf_duration BIGINT;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS stored_width INTEGER;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS stored_height INTEGER;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS frame_layout VARCHAR(30);
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS jpeg2000_profile VARCHAR(20);
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS is_stereoscopic BOOLEAN DEFAULT FALSE;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS channel_count INTEGER;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS audio_sample_rate INTEGER;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS bit_depth INTEGER;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS mxf_error TEXT;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS mxf_inspected_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_dcp_assets_essence_kind ON dcp_assets(essence_kind);
+`,
+	"041_dcp_asset_roles": `
+-- Asset roles are derived from CPL references and PKL types; record the source and the referencing CPL/reel
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS role_source VARCHAR(20);
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS cpl_uuid UUID;
+ALTER TABLE dcp_assets ADD COLUMN IF NOT EXISTS reel_number INTEGER;
+CREATE INDEX IF NOT EXISTS idx_dcp_assets_cpl_uuid ON dcp_assets(cpl_uuid);
+`,
+	"042_dcp_timed_text": `
+-- What each reel's subtitle and closed caption track file actually holds (replaced on every scan)
+CREATE TABLE IF NOT EXISTS dcp_timed_text (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    composition_id UUID NOT NULL REFERENCES dcp_compositions(id) ON DELETE CASCADE,
+    reel_number INTEGER NOT NULL,
+    track_kind VARCHAR(20) NOT NULL,
+    asset_uuid UUID NOT NULL,
+    standard VARCHAR(20),
+    language VARCHAR(100),
+    subtitle_kind VARCHAR(10),
+    event_count INTEGER DEFAULT 0,
+    text_event_count INTEGER DEFAULT 0,
+    image_event_count INTEGER DEFAULT 0,
+    first_time_in VARCHAR(20),
+    last_time_out VARCHAR(20),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (composition_id, reel_number, track_kind)
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_timed_text_composition_id ON dcp_timed_text(composition_id);
+CREATE INDEX IF NOT EXISTS idx_dcp_timed_text_language ON dcp_timed_text(language);
+CREATE TABLE IF NOT EXISTS dcp_timed_text_fonts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    timed_text_id UUID NOT NULL REFERENCES dcp_timed_text(id) ON DELETE CASCADE,
+    font_id VARCHAR(255),
+    uri VARCHAR(1024),
+    present BOOLEAN DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_timed_text_fonts_timed_text_id ON dcp_timed_text_fonts(timed_text_id);
+`,
+	"043_dcnc_content_title": `
+-- ContentTitleText decoded along the Digital Cinema Naming Convention (NULL dcnc_parsed_at = not decoded yet)
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_film_title VARCHAR(255);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_content_type VARCHAR(20);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_content_version INTEGER DEFAULT 0;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_aspect_ratio VARCHAR(5);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_image_aspect VARCHAR(5);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_audio_language VARCHAR(10);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_subtitle_language VARCHAR(10);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_captions VARCHAR(5);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_territory VARCHAR(10);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_rating VARCHAR(20);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_audio_format VARCHAR(50);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_resolution VARCHAR(5);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_studio VARCHAR(20);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_date DATE;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_facility VARCHAR(20);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_standard VARCHAR(10);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_package_type VARCHAR(5);
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_conforming BOOLEAN DEFAULT FALSE;
+ALTER TABLE dcp_compositions ADD COLUMN IF NOT EXISTS dcnc_parsed_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_dcp_compositions_dcnc_content_type ON dcp_compositions(dcnc_content_type);
+CREATE INDEX IF NOT EXISTS idx_dcp_compositions_dcnc_audio_language ON dcp_compositions(dcnc_audio_language);
+CREATE INDEX IF NOT EXISTS idx_dcp_compositions_dcnc_territory ON dcp_compositions(dcnc_territory);
+`,
+	"044_scan_file_cache": `
+-- State of every package file as of the last scan, so incremental scans skip unchanged packages
+CREATE TABLE IF NOT EXISTS scan_file_cache (
+    server_id UUID NOT NULL,
+    package_path VARCHAR(1024) NOT NULL,
+    file_path VARCHAR(2048) NOT NULL,
+    inode BIGINT,
+    size_bytes BIGINT,
+    mod_time TIMESTAMP WITH TIME ZONE,
+    xml_hash VARCHAR(64),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (server_id, file_path)
+);
+CREATE INDEX IF NOT EXISTS idx_scan_file_cache_package ON scan_file_cache(server_id, package_path);
+ALTER TABLE scan_logs ADD COLUMN IF NOT EXISTS packages_skipped INTEGER DEFAULT 0;
+ALTER TABLE scan_logs ADD COLUMN IF NOT EXISTS packages_changed INTEGER DEFAULT 0;
+`,
+	"045_content_quarantine": `
+-- Deleted packages are moved to the quarantine area of their library location and kept for
+-- trash_retention_days before they are removed for good; status is 'quarantined' meanwhile
+ALTER TABLE server_dcp_inventory ADD COLUMN IF NOT EXISTS quarantine_path VARCHAR(1024);
+ALTER TABLE server_dcp_inventory ADD COLUMN IF NOT EXISTS quarantined_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS trash_retention_days INTEGER NOT NULL DEFAULT 7;
+`,
+	"046_storage_usage": `
+-- Filesystem usage of the library and download locations of each server, as reported in heartbeats
+CREATE TABLE IF NOT EXISTS server_storage_samples (
+    id BIGSERIAL PRIMARY KEY,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    path VARCHAR(1024) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    total_bytes BIGINT NOT NULL,
+    free_bytes BIGINT NOT NULL,
+    sampled_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_server_storage_samples_location ON server_storage_samples(server_id, path, kind, sampled_at);
+-- Space kept free on the download location; transfers that would eat into it wait for space
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS storage_reserve_gb INTEGER NOT NULL DEFAULT 50;
+`,
+
+	"047_space_reclamation": `
+-- Retention policies: when a server's library locations drop below free_space_threshold_percent,
+-- propose deleting packages older than min_age_days that keep min_fleet_copies copies elsewhere,
+-- until target_free_percent is free again. server_ids empty = every server except the main one.
+CREATE TABLE IF NOT EXISTS reclamation_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    server_ids UUID[] NOT NULL DEFAULT '{}',
+    min_fleet_copies INTEGER NOT NULL DEFAULT 2,
+    min_age_days INTEGER NOT NULL DEFAULT 60,
+    free_space_threshold_percent DECIMAL(5,2) NOT NULL DEFAULT 15,
+    target_free_percent DECIMAL(5,2) NOT NULL DEFAULT 20,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+DO $$ BEGIN
+    CREATE TRIGGER update_reclamation_policies_updated_at BEFORE UPDATE ON reclamation_policies
+        FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+-- Deletion plans proposed by a policy for one server:
+-- proposed -> approved -> executing -> completed | failed, or proposed -> rejected
+CREATE TABLE IF NOT EXISTS reclamation_plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    policy_id UUID REFERENCES reclamation_policies(id) ON DELETE SET NULL,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'proposed',
+    min_fleet_copies INTEGER NOT NULL DEFAULT 2,
+    total_bytes BIGINT NOT NULL DEFAULT 0,
+    free_bytes BIGINT NOT NULL DEFAULT 0,
+    bytes_to_free BIGINT NOT NULL DEFAULT 0,
+    reviewed_by VARCHAR(255),
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_reclamation_plans_server ON reclamation_plans(server_id, status);
+-- Packages a plan deletes; each is executed as a content command once the plan is approved
+CREATE TABLE IF NOT EXISTS reclamation_plan_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    plan_id UUID NOT NULL REFERENCES reclamation_plans(id) ON DELETE CASCADE,
+    package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    package_name TEXT NOT NULL DEFAULT '',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    fleet_copies INTEGER NOT NULL DEFAULT 0,
+    last_arrived_at TIMESTAMP WITH TIME ZONE,
+    uploaded_bytes BIGINT NOT NULL DEFAULT 0,
+    content_command_id UUID,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    result_message TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_reclamation_plan_items_plan ON reclamation_plan_items(plan_id);
+CREATE INDEX IF NOT EXISTS idx_reclamation_plan_items_command ON reclamation_plan_items(content_command_id);
+`,
+	"048_archive_members": `
+-- Files of packages stored in uncompressed tar archives, with the offset of their data in the
+-- archive, so archived packages are hashed and seeded without being extracted
+CREATE TABLE IF NOT EXISTS dcp_archive_members (
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    package_path VARCHAR(1024) NOT NULL,
+    archive_path VARCHAR(1024) NOT NULL,
+    member_path VARCHAR(2048) NOT NULL,
+    data_offset BIGINT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    mod_time TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (server_id, archive_path, member_path)
+);
+CREATE INDEX IF NOT EXISTS idx_dcp_archive_members_package ON dcp_archive_members(server_id, package_path);
+`,
+	"049_asset_content_index": `
+-- Fleet-wide content index: the same MXF (same PKL hash and size) appears in many OV, VF and
+-- re-versioned packages; destinations that hold it already link it instead of downloading it
+CREATE INDEX IF NOT EXISTS idx_dcp_assets_content ON dcp_assets(hash_value, size_bytes);
+`,
+	"050_transfer_scheduling": `
+-- Delivery deadlines: transfers are handed out by slack (deliver_by minus predicted completion)
+-- and flagged as at risk when they are predicted to arrive after deliver_by at current speed
+ALTER TABLE transfers ADD COLUMN IF NOT EXISTS deliver_by TIMESTAMP WITH TIME ZONE;
+ALTER TABLE transfers ADD COLUMN IF NOT EXISTS predicted_completion_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE transfers ADD COLUMN IF NOT EXISTS deadline_at_risk BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_transfers_deliver_by ON transfers(deliver_by) WHERE deliver_by IS NOT NULL;
+-- Bandwidth calendar of each server: default rate limits in bytes/s (0 = unlimited) and windows
+-- of the day with limits of their own. Times are minutes after midnight in bandwidth_timezone
+-- ('' = local time of the server); the first window in position order that matches applies.
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS download_limit_bps BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS upload_limit_bps BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS bandwidth_timezone VARCHAR(64) NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS server_bandwidth_windows (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    days_of_week INTEGER[] NOT NULL DEFAULT '{}',
+    start_minute INTEGER NOT NULL,
+    end_minute INTEGER NOT NULL,
+    download_limit_bps BIGINT NOT NULL DEFAULT 0,
+    upload_limit_bps BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_server_bandwidth_windows_server ON server_bandwidth_windows(server_id, position);
+`,
+	"051_distribution_campaigns": `
+-- Distribution campaigns send packages to many servers at once. The target servers are released
+-- in waves, the sites expected to finish first first, so they seed to the later waves.
+CREATE TABLE IF NOT EXISTS distribution_campaigns (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    wave_size INTEGER NOT NULL DEFAULT 5,
+    advance_percent INTEGER NOT NULL DEFAULT 50,
+    priority INTEGER NOT NULL DEFAULT 5,
+    deliver_by TIMESTAMP WITH TIME ZONE,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_distribution_campaigns_status ON distribution_campaigns(status);
+CREATE TABLE IF NOT EXISTS campaign_packages (
+    campaign_id UUID NOT NULL REFERENCES distribution_campaigns(id) ON DELETE CASCADE,
+    package_id UUID NOT NULL REFERENCES dcp_packages(id) ON DELETE CASCADE,
+    torrent_id UUID NOT NULL REFERENCES dcp_torrents(id) ON DELETE CASCADE,
+    PRIMARY KEY (campaign_id, package_id)
+);
+-- Wave 0 holds the targets that had every package already; they are never sent anything
+CREATE TABLE IF NOT EXISTS campaign_targets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    campaign_id UUID NOT NULL REFERENCES distribution_campaigns(id) ON DELETE CASCADE,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    wave INTEGER NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    released_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (campaign_id, server_id)
+);
+ALTER TABLE transfers ADD COLUMN IF NOT EXISTS campaign_id UUID REFERENCES distribution_campaigns(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_transfers_campaign ON transfers(campaign_id) WHERE campaign_id IS NOT NULL;
+`,
+	"052_server_groups": `
+-- Server groups organise sites by circuit (cinema chain), region or site type; transfers,
+-- content commands, upgrades and rescans can target a whole group. A server can be in any
+-- number of groups.
+CREATE TABLE IF NOT EXISTS server_groups (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    kind VARCHAR(50) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS server_group_members (
+    group_id UUID NOT NULL REFERENCES server_groups(id) ON DELETE CASCADE,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, server_id)
+);
+CREATE INDEX IF NOT EXISTS idx_server_group_members_server ON server_group_members(server_id);
+-- Free-form tags, stored lower case
+CREATE TABLE IF NOT EXISTS server_tags (
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    tag VARCHAR(100) NOT NULL,
+    PRIMARY KEY (server_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_server_tags_tag ON server_tags(tag);
+`,
+	"053_tracker_swarm_persistence": `
+-- Swarm membership of the tracker, so swarms survive a restart. uploaded/downloaded are the
+-- counters of the peer's current session as announced; the totals add up every session.
+CREATE TABLE IF NOT EXISTS tracker_peers (
+    info_hash VARCHAR(40) NOT NULL,
+    peer_id TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    uploaded BIGINT NOT NULL DEFAULT 0,
+    downloaded BIGINT NOT NULL DEFAULT 0,
+    left_bytes BIGINT NOT NULL DEFAULT 0,
+    total_uploaded BIGINT NOT NULL DEFAULT 0,
+    total_downloaded BIGINT NOT NULL DEFAULT 0,
+    first_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    stopped_at TIMESTAMPTZ,
+    PRIMARY KEY (info_hash, peer_id)
+);
+CREATE INDEX IF NOT EXISTS idx_tracker_peers_last_seen ON tracker_peers (last_seen DESC);
+-- Times a peer announced it completed the torrent (the "downloaded" count of a scrape)
+CREATE TABLE IF NOT EXISTS tracker_torrent_stats (
+    info_hash VARCHAR(40) PRIMARY KEY,
+    completed_count BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Swarm health over time, sampled every few minutes
+CREATE TABLE IF NOT EXISTS tracker_swarm_samples (
+    id BIGSERIAL PRIMARY KEY,
+    info_hash VARCHAR(40) NOT NULL,
+    seeders INTEGER NOT NULL,
+    leechers INTEGER NOT NULL,
+    sampled_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_tracker_swarm_samples_hash_sampled
+    ON tracker_swarm_samples (info_hash, sampled_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tracker_swarm_samples_sampled ON tracker_swarm_samples (sampled_at);
+`,
+
+	"054_content_command_purge": `
+-- Deletes that remove the package right away instead of moving it to quarantine (space reclamation)
+ALTER TABLE content_commands ADD COLUMN IF NOT EXISTS purge BOOLEAN DEFAULT false;
+`,
+
+	"055_kdm_servers": `
+-- Servers a KDM was found on or uploaded for; the same KDM may be delivered to several servers.
+-- kdms.server_id / source_path only keep the first one.
+CREATE TABLE IF NOT EXISTS kdm_servers (
+    kdm_id UUID NOT NULL REFERENCES kdms(id) ON DELETE CASCADE,
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    source_path VARCHAR(1024),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kdm_id, server_id)
+);
+CREATE INDEX IF NOT EXISTS idx_kdm_servers_server_id ON kdm_servers(server_id);
+INSERT INTO kdm_servers (kdm_id, server_id, source_path)
+SELECT id, server_id, source_path FROM kdms WHERE server_id IS NOT NULL
+ON CONFLICT (kdm_id, server_id) DO NOTHING;
 `,
 }
 
@@ -696,4 +1250,28 @@ var migrationOrder = []string{
 	"029_create_users",
 	"030_role_permissions",
 	"031_activity_logs",
+	"032_cpl_extended_model",
+	"033_dcp_standard",
+	"034_dcp_verification",
+	"035_inventory_volumes",
+	"036_vf_dependencies",
+	"037_kdms",
+	"038_xml_signatures",
+	"039_dcp_validation_findings",
+	"040_dcp_asset_essence",
+	"041_dcp_asset_roles",
+	"042_dcp_timed_text",
+	"043_dcnc_content_title",
+	"044_scan_file_cache",
+	"045_content_quarantine",
+	"046_storage_usage",
+	"047_space_reclamation",
+	"048_archive_members",
+	"049_asset_content_index",
+	"050_transfer_scheduling",
+	"051_distribution_campaigns",
+	"052_server_groups",
+	"053_tracker_swarm_persistence",
+	"054_content_command_purge",
+	"055_kdm_servers",
 }
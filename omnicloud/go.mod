@@ -9,4 +9,5 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.0
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
 )
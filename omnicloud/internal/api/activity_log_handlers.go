@@ -16,20 +16,7 @@ import (
 // logActivity records a user action to the activity_logs table asynchronously.
 // It extracts the user from the Bearer token (best-effort) and the client IP.
 func (s *Server) logActivity(r *http.Request, action, category, resourceType, resourceID, resourceName, details, status string) {
-	var userID *uuid.UUID
-	username := "system"
-
-	token := extractBearerToken(r)
-	if token != "" {
-		session, err := s.database.GetSession(token)
-		if err == nil && session != nil {
-			user, err := s.database.GetUserByID(session.UserID)
-			if err == nil && user != nil {
-				userID = &user.ID
-				username = user.Username
-			}
-		}
-	}
+	userID, username := s.requestUser(r)
 
 	// Extract client IP
 	ip := r.RemoteAddr
@@ -60,6 +47,22 @@ func (s *Server) logActivity(r *http.Request, action, category, resourceType, re
 	}()
 }
 
+// requestUser returns the user whose Bearer token authenticates the request (best-effort), or
+// "system" when there is none
+func (s *Server) requestUser(r *http.Request) (*uuid.UUID, string) {
+	token := extractBearerToken(r)
+	if token != "" {
+		session, err := s.database.GetSession(token)
+		if err == nil && session != nil {
+			user, err := s.database.GetUserByID(session.UserID)
+			if err == nil && user != nil {
+				return &user.ID, user.Username
+			}
+		}
+	}
+	return nil, "system"
+}
+
 // logActivityWithUser is like logActivity but uses a known user directly (for login handler)
 func (s *Server) logActivityWithUser(r *http.Request, userID *uuid.UUID, username, action, category, resourceType, resourceID, resourceName, details, status string) {
 	ip := r.RemoteAddr
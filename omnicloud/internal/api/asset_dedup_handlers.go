@@ -0,0 +1,129 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// localAssetCopies returns the files of a package that a destination server already holds in
+// other packages, as handed to its transfer processor to link before downloading
+func (s *Server) localAssetCopies(packageID string, serverID uuid.UUID) []map[string]interface{} {
+	id, err := uuid.Parse(packageID)
+	if err != nil {
+		return nil
+	}
+	copies, err := s.database.FindAssetCopies(id, &serverID)
+	if err != nil {
+		log.Printf("[pending-transfers] Failed to look up local asset copies of %s: %v", packageID, err)
+		return nil
+	}
+
+	var assets []map[string]interface{}
+	for _, c := range copies {
+		assets = append(assets, map[string]interface{}{
+			"asset_uuid":  c.AssetUUID,
+			"file_path":   c.FilePath,
+			"source_path": c.SourcePath,
+			"size_bytes":  c.SizeBytes,
+			"hash":        c.HashValue,
+		})
+	}
+	return assets
+}
+
+// handleGetDCPSharedAssets lists the MXF files of a DCP that servers already hold with the
+// same content in other packages (?server_id= for one server), and per server how many bytes
+// a transfer there would link instead of download
+func (s *Server) handleGetDCPSharedAssets(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	dcpUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid DCP UUID", err.Error())
+		return
+	}
+
+	var serverID *uuid.UUID
+	if v := r.URL.Query().Get("server_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+			return
+		}
+		serverID = &id
+	}
+
+	pkg, err := s.database.GetDCPPackageByAssetMapUUID(dcpUUID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query DCP", err.Error())
+		return
+	}
+	if pkg == nil {
+		respondError(w, http.StatusNotFound, "DCP not found", "")
+		return
+	}
+
+	copies, err := s.database.FindAssetCopies(pkg.ID, serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query asset copies", err.Error())
+		return
+	}
+
+	type serverSummary struct {
+		name        string
+		files       int
+		sharedBytes int64
+	}
+	summaries := make(map[uuid.UUID]*serverSummary)
+	var order []uuid.UUID
+	copyList := make([]map[string]interface{}, 0, len(copies))
+	for _, c := range copies {
+		sum, ok := summaries[c.ServerID]
+		if !ok {
+			sum = &serverSummary{}
+			if sv, err := s.database.GetServer(c.ServerID); err == nil && sv != nil {
+				sum.name = sv.DisplayName
+				if sum.name == "" {
+					sum.name = sv.Name
+				}
+			}
+			summaries[c.ServerID] = sum
+			order = append(order, c.ServerID)
+		}
+		sum.files++
+		sum.sharedBytes += c.SizeBytes
+
+		copyList = append(copyList, map[string]interface{}{
+			"asset_uuid":          c.AssetUUID,
+			"file_path":           c.FilePath,
+			"size_bytes":          c.SizeBytes,
+			"hash":                c.HashValue,
+			"server_id":           c.ServerID,
+			"server_name":         sum.name,
+			"source_package_id":   c.SourcePackageID,
+			"source_package_name": c.SourcePackageName,
+			"source_path":         c.SourcePath,
+		})
+	}
+
+	servers := make([]map[string]interface{}, 0, len(order))
+	for _, id := range order {
+		sum := summaries[id]
+		servers = append(servers, map[string]interface{}{
+			"server_id":    id,
+			"server_name":  sum.name,
+			"files":        sum.files,
+			"shared_bytes": sum.sharedBytes,
+			"total_bytes":  pkg.TotalSizeBytes,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"package_id":   pkg.ID,
+		"package_name": pkg.PackageName,
+		"servers":      servers,
+		"copies":       copyList,
+	})
+}
@@ -0,0 +1,711 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+)
+
+// campaignInterval is how often active campaigns release their next wave and are finished
+const campaignInterval = time.Minute
+
+// campaignRequest is the body of POST /campaigns. The packages are given by ID, by the UUIDs of
+// CPLs they contain, or both.
+type campaignRequest struct {
+	Name                string      `json:"name"`
+	PackageIDs          []uuid.UUID `json:"package_ids"`
+	CPLUUIDs            []uuid.UUID `json:"cpl_uuids"`
+	ServerIDs           []uuid.UUID `json:"server_ids"`
+	WaveSize            *int        `json:"wave_size"`
+	AdvancePercent      *int        `json:"advance_percent"`
+	Priority            *int        `json:"priority"`
+	DeliverBy           *time.Time  `json:"deliver_by"`
+	IncludeDependencies *bool       `json:"include_dependencies"` // send the OVs of VFs along; default true
+}
+
+// campaign builds the campaign the request describes and checks it
+func (req *campaignRequest) campaign() (*db.Campaign, error) {
+	c := &db.Campaign{
+		Name:           req.Name,
+		Status:         db.CampaignActive,
+		WaveSize:       5,
+		AdvancePercent: 50,
+		Priority:       5,
+		DeliverBy:      req.DeliverBy,
+	}
+	if req.WaveSize != nil {
+		c.WaveSize = *req.WaveSize
+	}
+	if req.AdvancePercent != nil {
+		c.AdvancePercent = *req.AdvancePercent
+	}
+	if req.Priority != nil {
+		c.Priority = *req.Priority
+	}
+
+	switch {
+	case c.Name == "":
+		return nil, fmt.Errorf("name is required")
+	case len(req.PackageIDs) == 0 && len(req.CPLUUIDs) == 0:
+		return nil, fmt.Errorf("package_ids or cpl_uuids is required")
+	case len(req.ServerIDs) == 0:
+		return nil, fmt.Errorf("server_ids is required")
+	case c.WaveSize < 1:
+		return nil, fmt.Errorf("wave_size must be at least 1")
+	case c.AdvancePercent < 1 || c.AdvancePercent > 100:
+		return nil, fmt.Errorf("advance_percent must be between 1 and 100")
+	}
+	return c, nil
+}
+
+// handleListCampaigns lists distribution campaigns with their progress, optionally filtered by
+// ?status=
+func (s *Server) handleListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := s.database.ListCampaigns(r.URL.Query().Get("status"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query campaigns", err.Error())
+		return
+	}
+	list := []map[string]interface{}{}
+	for _, c := range campaigns {
+		details, err := s.campaignDetails(c, false)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to query campaign progress", err.Error())
+			return
+		}
+		list = append(list, details)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"campaigns": list,
+		"total":     len(list),
+	})
+}
+
+// handleCreateCampaign creates a campaign and releases its first wave
+func (s *Server) handleCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req campaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	campaign, err := req.campaign()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid campaign", err.Error())
+		return
+	}
+
+	packages, problem, err := s.resolveCampaignPackages(req.PackageIDs, req.CPLUUIDs,
+		req.IncludeDependencies == nil || *req.IncludeDependencies)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to resolve campaign packages", err.Error())
+		return
+	}
+	if problem != "" {
+		respondError(w, http.StatusBadRequest, "Invalid campaign", problem)
+		return
+	}
+	targets, problem, err := s.planCampaignTargets(req.ServerIDs, packages, campaign.WaveSize)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to plan campaign targets", err.Error())
+		return
+	}
+	if problem != "" {
+		respondError(w, http.StatusBadRequest, "Invalid campaign", problem)
+		return
+	}
+
+	_, campaign.CreatedBy = s.requestUser(r)
+	if err := s.database.CreateCampaign(campaign, packages, targets); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create campaign", err.Error())
+		return
+	}
+	log.Printf("[campaigns] Created campaign %q: %d package(s) to %d server(s) in waves of %d",
+		campaign.Name, len(packages), len(targets), campaign.WaveSize)
+	if err := s.advanceCampaign(campaign); err != nil {
+		log.Printf("[campaigns] Error releasing the first wave of campaign %s: %v", campaign.ID, err)
+	}
+
+	s.logActivity(r, "campaign.create", "transfers", "campaign", campaign.ID.String(), campaign.Name,
+		fmt.Sprintf(`{"packages":%d,"servers":%d}`, len(packages), len(targets)), "success")
+
+	if c, err := s.database.GetCampaign(campaign.ID); err == nil && c != nil {
+		campaign = c
+	}
+	details, err := s.campaignDetails(campaign, true)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query campaign progress", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusCreated, details)
+}
+
+// handleGetCampaign returns a campaign with the progress of every target and its transfers
+func (s *Server) handleGetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := s.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+	details, err := s.campaignDetails(campaign, true)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query campaign progress", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, details)
+}
+
+// handleCancelCampaign cancels an active campaign: its unfinished transfers are cancelled (data
+// kept) and the waves not released yet never are
+func (s *Server) handleCancelCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := s.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+	cancelled, err := s.database.FinishCampaign(campaign.ID, db.CampaignCancelled)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to cancel campaign", err.Error())
+		return
+	}
+	if !cancelled {
+		respondError(w, http.StatusConflict, "Campaign is not active", "status is "+campaign.Status)
+		return
+	}
+
+	rows, err := s.db.Query(`
+		UPDATE transfers SET status = 'cancelled', delete_data = false, pending_command = 'cancel',
+		       command_acknowledged = false, updated_at = $2
+		WHERE campaign_id = $1
+		  AND status IN ('queued', 'waiting_for_space', 'downloading', 'checking', 'active', 'paused')
+		RETURNING destination_server_id`, campaign.ID, time.Now())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to cancel campaign transfers", err.Error())
+		return
+	}
+	servers := make(map[uuid.UUID]bool)
+	count := 0
+	for rows.Next() {
+		var serverID uuid.UUID
+		if err := rows.Scan(&serverID); err == nil {
+			servers[serverID] = true
+			count++
+		}
+	}
+	rows.Close()
+	for serverID := range servers {
+		s.dispatch(serverID)
+	}
+
+	log.Printf("[campaigns] Cancelled campaign %q and %d transfer(s)", campaign.Name, count)
+	s.logActivity(r, "campaign.cancel", "transfers", "campaign", campaign.ID.String(), campaign.Name, "", "success")
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":             "Campaign cancelled",
+		"cancelled_transfers": count,
+	})
+}
+
+func (s *Server) lookupCampaign(w http.ResponseWriter, r *http.Request) (*db.Campaign, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid campaign ID", err.Error())
+		return nil, false
+	}
+	campaign, err := s.database.GetCampaign(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query campaign", err.Error())
+		return nil, false
+	}
+	if campaign == nil {
+		respondError(w, http.StatusNotFound, "Campaign not found", "")
+		return nil, false
+	}
+	return campaign, true
+}
+
+// resolveCampaignPackages turns package IDs and CPL UUIDs into the packages a campaign sends, with
+// the OVs they depend on when withDependencies is set. A CPL resolves to the newest package
+// holding it that has a torrent. problem describes the first package that cannot be sent.
+func (s *Server) resolveCampaignPackages(packageIDs, cplUUIDs []uuid.UUID, withDependencies bool) ([]*db.CampaignPackage, string, error) {
+	ids := append([]uuid.UUID{}, packageIDs...)
+	for _, cpl := range cplUUIDs {
+		var id uuid.UUID
+		err := s.db.QueryRow(`
+			SELECT c.package_id
+			FROM dcp_compositions c
+			JOIN dcp_packages p ON p.id = c.package_id
+			WHERE c.cpl_uuid = $1
+			ORDER BY EXISTS (SELECT 1 FROM dcp_torrents dt WHERE dt.package_id = c.package_id) DESC,
+			         p.discovered_at DESC
+			LIMIT 1`, cpl).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Sprintf("CPL %s not found", cpl), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, id)
+	}
+
+	var packages []*db.CampaignPackage
+	added := make(map[uuid.UUID]bool)
+	dependency := make(map[uuid.UUID]bool)
+	for i := 0; i < len(ids); i++ {
+		id := ids[i]
+		if added[id] {
+			continue
+		}
+		added[id] = true
+
+		p := &db.CampaignPackage{PackageID: id}
+		var torrentID uuid.NullUUID
+		err := s.db.QueryRow(`
+			SELECT p.package_name, COALESCE(dt.total_size_bytes, p.total_size_bytes, 0), dt.id
+			FROM dcp_packages p
+			LEFT JOIN dcp_torrents dt ON dt.package_id = p.id
+			WHERE p.id = $1
+			LIMIT 1`, id).Scan(&p.PackageName, &p.SizeBytes, &torrentID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, "", err
+		}
+		if err == sql.ErrNoRows || !torrentID.Valid {
+			// Like single transfers, a VF goes without an OV that cannot be sent
+			if dependency[id] {
+				log.Printf("[campaigns] OV package %s has no torrent yet, cannot send it with the VF", id)
+				continue
+			}
+			if err == sql.ErrNoRows {
+				return nil, fmt.Sprintf("package %s not found", id), nil
+			}
+			return nil, fmt.Sprintf("package %s has no torrent yet", p.PackageName), nil
+		}
+		p.TorrentID = torrentID.UUID
+		packages = append(packages, p)
+
+		if withDependencies {
+			deps, err := s.database.GetDCPPackageDependencies(id)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, d := range deps {
+				if !added[d.OVPackageID] {
+					dependency[d.OVPackageID] = true
+					ids = append(ids, d.OVPackageID)
+				}
+			}
+		}
+	}
+	return packages, "", nil
+}
+
+// planCampaignTargets splits the target servers into waves of waveSize. Servers holding every
+// package already are put in wave 0 and sent nothing. The others are ordered by the rate they
+// downloaded at recently, fastest first, so the first waves finish early and seed to the later
+// ones; servers without recent transfers go last. problem describes an unknown server.
+func (s *Server) planCampaignTargets(serverIDs []uuid.UUID, packages []*db.CampaignPackage, waveSize int) ([]*db.CampaignTarget, string, error) {
+	type candidate struct {
+		serverID uuid.UUID
+		rate     int64
+	}
+	var targets []*db.CampaignTarget
+	var candidates []candidate
+	now := time.Now()
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range serverIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		server, err := s.database.GetServer(id)
+		if err != nil {
+			return nil, "", err
+		}
+		if server == nil {
+			return nil, fmt.Sprintf("server %s not found", id), nil
+		}
+
+		missing := 0
+		for _, p := range packages {
+			held, err := s.holdsPackage(id, p.PackageID)
+			if err != nil {
+				return nil, "", err
+			}
+			if !held {
+				missing++
+			}
+		}
+		if missing == 0 {
+			targets = append(targets, &db.CampaignTarget{ServerID: id, Wave: 0, Position: len(targets), ReleasedAt: &now})
+			continue
+		}
+
+		rate, err := s.recentThroughput(id)
+		if err != nil {
+			return nil, "", err
+		}
+		candidates = append(candidates, candidate{serverID: id, rate: rate})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].rate > candidates[j].rate })
+	for i, c := range candidates {
+		targets = append(targets, &db.CampaignTarget{ServerID: c.serverID, Wave: i/waveSize + 1, Position: i})
+	}
+	return targets, "", nil
+}
+
+// holdsPackage reports whether a server holds a complete, online copy of a package
+func (s *Server) holdsPackage(serverID, packageID uuid.UUID) (bool, error) {
+	var held bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM server_dcp_inventory
+		               WHERE package_id = $1 AND server_id = $2 AND status = 'online')`,
+		packageID, serverID).Scan(&held)
+	return held, err
+}
+
+// RunCampaigns advances the active campaigns every campaignInterval until ctx is done (main
+// server only)
+func (s *Server) RunCampaigns(ctx context.Context) {
+	ticker := time.NewTicker(campaignInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			campaigns, err := s.database.ListCampaigns(db.CampaignActive)
+			if err != nil {
+				log.Printf("[campaigns] Error listing active campaigns: %v", err)
+				continue
+			}
+			for _, c := range campaigns {
+				if err := s.advanceCampaign(c); err != nil {
+					log.Printf("[campaigns] Error advancing campaign %s: %v", c.ID, err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// advanceCampaign releases the next wave of an active campaign once advance_percent of the
+// current wave has completed, or all of it has finished, so failed sites do not hold the rest
+// up. The campaign is finished once every target has; it failed if any target did.
+func (s *Server) advanceCampaign(c *db.Campaign) error {
+	packages, err := s.database.GetCampaignPackages(c.ID)
+	if err != nil {
+		return err
+	}
+	targets, err := s.database.GetCampaignTargets(c.ID)
+	if err != nil {
+		return err
+	}
+	transfers, err := s.database.GetCampaignTransfers(c.ID)
+	if err != nil {
+		return err
+	}
+	byServer := campaignTransfersByServer(transfers)
+
+	// The highest wave released and the lowest one waiting (wave 0 is released at creation)
+	current, next := 0, 0
+	for _, t := range targets {
+		if t.ReleasedAt != nil {
+			if t.Wave > current {
+				current = t.Wave
+			}
+		} else if next == 0 || t.Wave < next {
+			next = t.Wave
+		}
+	}
+
+	if next == 0 {
+		failed := false
+		for _, t := range targets {
+			switch campaignTargetState(t, byServer[t.ServerID]) {
+			case "completed", "present":
+			case "failed", "cancelled":
+				failed = true
+			default:
+				return nil
+			}
+		}
+		status := db.CampaignCompleted
+		if failed {
+			status = db.CampaignFailed
+		}
+		if _, err := s.database.FinishCampaign(c.ID, status); err != nil {
+			return err
+		}
+		log.Printf("[campaigns] Campaign %q finished: %s", c.Name, status)
+		return nil
+	}
+
+	if current > 0 {
+		size, succeeded, finished := 0, 0, 0
+		for _, t := range targets {
+			if t.Wave != current {
+				continue
+			}
+			size++
+			switch campaignTargetState(t, byServer[t.ServerID]) {
+			case "completed", "present":
+				succeeded++
+				finished++
+			case "failed", "cancelled":
+				finished++
+			}
+		}
+		if finished < size && succeeded*100 < c.AdvancePercent*size {
+			return nil
+		}
+	}
+
+	released := 0
+	for _, t := range targets {
+		if t.Wave != next {
+			continue
+		}
+		if err := s.releaseCampaignTarget(c, packages, t); err != nil {
+			return err
+		}
+		released++
+	}
+	log.Printf("[campaigns] Campaign %q: released wave %d (%d server(s))", c.Name, next, released)
+	return nil
+}
+
+// releaseCampaignTarget queues a transfer of every campaign package the target server does not
+// hold yet. A transfer of the package to the server that is already under way joins the
+// campaign instead.
+func (s *Server) releaseCampaignTarget(c *db.Campaign, packages []*db.CampaignPackage, target *db.CampaignTarget) error {
+	for _, p := range packages {
+		held, err := s.holdsPackage(target.ServerID, p.PackageID)
+		if err != nil {
+			return err
+		}
+		if held {
+			continue
+		}
+
+		var activeID uuid.UUID
+		var activeCampaign uuid.NullUUID
+		err = s.db.QueryRow(`
+			SELECT id, campaign_id FROM transfers
+			WHERE torrent_id = $1 AND destination_server_id = $2
+			  AND status IN ('queued', 'waiting_for_space', 'downloading', 'paused', 'checking', 'active')
+			LIMIT 1`, p.TorrentID, target.ServerID).Scan(&activeID, &activeCampaign)
+		if err == nil {
+			if !activeCampaign.Valid {
+				if _, err := s.db.Exec(`UPDATE transfers SET campaign_id = $1 WHERE id = $2`, c.ID, activeID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		now := time.Now()
+		_, err = s.db.Exec(`
+			INSERT INTO transfers (id, torrent_id, destination_server_id, requested_by, status, priority, deliver_by, campaign_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, 'queued', $5, $6, $7, $8, $9)`,
+			uuid.New(), p.TorrentID, target.ServerID, c.CreatedBy, c.Priority, c.DeliverBy, c.ID, now, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.database.ReleaseCampaignTarget(target.ID); err != nil {
+		return err
+	}
+	s.dispatch(target.ServerID)
+	return nil
+}
+
+func campaignTransfersByServer(transfers []*db.CampaignTransfer) map[uuid.UUID][]*db.CampaignTransfer {
+	byServer := make(map[uuid.UUID][]*db.CampaignTransfer)
+	for _, t := range transfers {
+		byServer[t.ServerID] = append(byServer[t.ServerID], t)
+	}
+	return byServer
+}
+
+// campaignTargetState sums up the transfers of a campaign target: "waiting" (wave not released),
+// "present" (had everything), "queued", "downloading", "paused", "completed", "failed" or
+// "cancelled"
+func campaignTargetState(target *db.CampaignTarget, transfers []*db.CampaignTransfer) string {
+	if target.ReleasedAt == nil {
+		return "waiting"
+	}
+	if len(transfers) == 0 {
+		return "present"
+	}
+	counts := make(map[string]int)
+	for _, t := range transfers {
+		counts[t.Status]++
+	}
+	switch {
+	case counts["error"] > 0 || counts["failed"] > 0:
+		return "failed"
+	case counts["completed"] == len(transfers):
+		return "completed"
+	case counts["cancelled"] > 0:
+		return "cancelled"
+	case counts["downloading"] > 0 || counts["checking"] > 0 || counts["active"] > 0:
+		return "downloading"
+	case counts["paused"] > 0:
+		return "paused"
+	}
+	return "queued"
+}
+
+// campaignDetails builds the API view of a campaign with its aggregate progress: bytes to send
+// and received over all targets (the targets still waiting count in full), failures, the state
+// of each wave and an ETA at the current combined download rate. withTargets adds every target
+// with its transfers.
+func (s *Server) campaignDetails(c *db.Campaign, withTargets bool) (map[string]interface{}, error) {
+	packages, err := s.database.GetCampaignPackages(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := s.database.GetCampaignTargets(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := s.database.GetCampaignTransfers(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	byServer := campaignTransfersByServer(transfers)
+
+	var packageBytes int64
+	packageList := []map[string]interface{}{}
+	for _, p := range packages {
+		packageBytes += p.SizeBytes
+		packageList = append(packageList, map[string]interface{}{
+			"package_id":   p.PackageID,
+			"package_name": p.PackageName,
+			"torrent_id":   p.TorrentID,
+			"size_bytes":   p.SizeBytes,
+		})
+	}
+
+	var totalBytes, receivedBytes, speed int64
+	states := map[string]int{}
+	failures := []map[string]interface{}{}
+	waves := []map[string]interface{}{}
+	targetList := []map[string]interface{}{}
+	currentWave := 0
+	for _, t := range targets {
+		state := campaignTargetState(t, byServer[t.ServerID])
+		states[state]++
+		if t.ReleasedAt == nil {
+			totalBytes += packageBytes
+		} else if t.Wave > currentWave {
+			currentWave = t.Wave
+		}
+
+		if len(waves) == 0 || waves[len(waves)-1]["wave"] != t.Wave {
+			waves = append(waves, map[string]interface{}{
+				"wave":        t.Wave,
+				"servers":     0,
+				"completed":   0,
+				"failed":      0,
+				"released_at": t.ReleasedAt,
+			})
+		}
+		wave := waves[len(waves)-1]
+		wave["servers"] = wave["servers"].(int) + 1
+		switch state {
+		case "completed", "present":
+			wave["completed"] = wave["completed"].(int) + 1
+		case "failed", "cancelled":
+			wave["failed"] = wave["failed"].(int) + 1
+		}
+
+		transferList := []map[string]interface{}{}
+		for _, tr := range byServer[t.ServerID] {
+			totalBytes += tr.SizeBytes
+			if tr.Status == "completed" {
+				receivedBytes += tr.SizeBytes
+			} else {
+				receivedBytes += tr.DownloadedBytes
+				speed += tr.DownloadSpeedBps
+			}
+			if tr.Status == "error" || tr.Status == "failed" {
+				failures = append(failures, map[string]interface{}{
+					"transfer_id":   tr.ID,
+					"server_id":     t.ServerID,
+					"server_name":   t.ServerName,
+					"package_id":    tr.PackageID,
+					"error_message": tr.ErrorMessage,
+				})
+			}
+			transferList = append(transferList, map[string]interface{}{
+				"id":                 tr.ID,
+				"package_id":         tr.PackageID,
+				"status":             tr.Status,
+				"progress_percent":   tr.ProgressPercent,
+				"downloaded_bytes":   tr.DownloadedBytes,
+				"size_bytes":         tr.SizeBytes,
+				"download_speed_bps": tr.DownloadSpeedBps,
+				"error_message":      tr.ErrorMessage,
+				"completed_at":       tr.CompletedAt,
+			})
+		}
+		targetList = append(targetList, map[string]interface{}{
+			"server_id":   t.ServerID,
+			"server_name": t.ServerName,
+			"wave":        t.Wave,
+			"released_at": t.ReleasedAt,
+			"state":       state,
+			"transfers":   transferList,
+		})
+	}
+
+	progress := 100.0
+	if totalBytes > 0 {
+		progress = float64(receivedBytes) / float64(totalBytes) * 100
+	}
+	var eta *time.Time
+	if remaining := totalBytes - receivedBytes; c.Status == db.CampaignActive && remaining > 0 && speed > 0 {
+		at := time.Now().Add(time.Duration(remaining/speed) * time.Second)
+		eta = &at
+	}
+
+	details := map[string]interface{}{
+		"id":                 c.ID,
+		"name":               c.Name,
+		"status":             c.Status,
+		"wave_size":          c.WaveSize,
+		"advance_percent":    c.AdvancePercent,
+		"priority":           c.Priority,
+		"deliver_by":         c.DeliverBy,
+		"created_by":         c.CreatedBy,
+		"created_at":         c.CreatedAt,
+		"completed_at":       c.CompletedAt,
+		"packages":           packageList,
+		"servers":            len(targets),
+		"servers_by_state":   states,
+		"current_wave":       currentWave,
+		"waves":              waves,
+		"total_bytes":        totalBytes,
+		"received_bytes":     receivedBytes,
+		"progress_percent":   progress,
+		"download_speed_bps": speed,
+		"eta":                eta,
+		"failures":           failures,
+	}
+	if withTargets {
+		details["targets"] = targetList
+	}
+	return details, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,29 +28,158 @@ type DCPPackageMetadata struct {
 	VolumeCount    int                       `json:"volume_count"`
 	TotalSizeBytes int64                     `json:"total_size_bytes"`
 	FileCount      int                       `json:"file_count"`
+	Standard       string                    `json:"standard,omitempty"`
 	DiscoveredAt   time.Time                 `json:"discovered_at"`
 	LastVerified   *time.Time                `json:"last_verified,omitempty"`
 	Compositions   []DCPCompositionMetadata  `json:"compositions,omitempty"`
+	PackingLists   []DCPPackingListMetadata  `json:"packing_lists,omitempty"`
 	Assets         []DCPAssetMetadata        `json:"assets,omitempty"`
+	// Sent as [] when the package is clean so the main server clears earlier findings;
+	// null (older clients) leaves them untouched
+	ValidationFindings []DCPValidationFindingMetadata `json:"validation_findings"`
 }
 
 // DCPCompositionMetadata represents CPL metadata
 type DCPCompositionMetadata struct {
-	ID                     string     `json:"id"`
-	CPLUUID                string     `json:"cpl_uuid"`
-	ContentTitleText       string     `json:"content_title_text"`
-	ContentKind            string     `json:"content_kind"`
-	IssueDate              *time.Time `json:"issue_date,omitempty"`
-	Issuer                 string     `json:"issuer"`
-	Creator                string     `json:"creator"`
-	EditRate               string     `json:"edit_rate"`
-	FrameRate              string     `json:"frame_rate"`
-	ScreenAspectRatio      string     `json:"screen_aspect_ratio"`
-	ResolutionWidth        int        `json:"resolution_width"`
-	ResolutionHeight       int        `json:"resolution_height"`
-	MainSoundConfiguration string     `json:"main_sound_configuration"`
-	ReelCount              int        `json:"reel_count"`
-	TotalDurationFrames    int        `json:"total_duration_frames"`
+	ID                     string                     `json:"id"`
+	CPLUUID                string                     `json:"cpl_uuid"`
+	ContentTitleText       string                     `json:"content_title_text"`
+	ContentKind            string                     `json:"content_kind"`
+	IssueDate              *time.Time                 `json:"issue_date,omitempty"`
+	Issuer                 string                     `json:"issuer"`
+	Creator                string                     `json:"creator"`
+	EditRate               string                     `json:"edit_rate"`
+	FrameRate              string                     `json:"frame_rate"`
+	ScreenAspectRatio      string                     `json:"screen_aspect_ratio"`
+	ResolutionWidth        int                        `json:"resolution_width"`
+	ResolutionHeight       int                        `json:"resolution_height"`
+	MainSoundConfiguration string                     `json:"main_sound_configuration"`
+	ReelCount              int                        `json:"reel_count"`
+	TotalDurationFrames    int                        `json:"total_duration_frames"`
+	IsStereoscopic         bool                       `json:"is_stereoscopic"`
+	HasAtmos               bool                       `json:"has_atmos"`
+	HasClosedCaptions      bool                       `json:"has_closed_captions"`
+	Standard               string                     `json:"standard,omitempty"`
+	ExternalAssets         []DCPExternalAssetMetadata `json:"external_assets,omitempty"`
+	ContentKeys            []DCPContentKeyMetadata    `json:"content_keys,omitempty"`
+	Signature              *DCPSignatureMetadata      `json:"signature,omitempty"`
+	TimedText              []DCPTimedTextMetadata     `json:"timed_text,omitempty"`
+	// The lists below are sent as [] when the CPL has none so the main server clears stale entries;
+	// null (older clients, or a failed lookup) leaves them untouched
+	Reels           []DCPReelMetadata           `json:"reels"`
+	Markers         []DCPMarkerMetadata         `json:"markers"`
+	Ratings         []DCPRatingMetadata         `json:"ratings"`
+	ContentVersions []DCPContentVersionMetadata `json:"content_versions"`
+}
+
+// DCPReelMetadata represents a reel of a CPL and the track files it plays
+type DCPReelMetadata struct {
+	ReelUUID                 string  `json:"reel_uuid"`
+	ReelNumber               int     `json:"reel_number"`
+	DurationFrames           int     `json:"duration_frames"`
+	PictureAssetUUID         *string `json:"picture_asset_uuid,omitempty"`
+	PictureEditRate          string  `json:"picture_edit_rate"`
+	PictureEntryPoint        int     `json:"picture_entry_point"`
+	PictureIntrinsicDuration int     `json:"picture_intrinsic_duration"`
+	PictureKeyID             *string `json:"picture_key_id,omitempty"`
+	PictureHash              string  `json:"picture_hash"`
+	IsStereoscopic           bool    `json:"is_stereoscopic"`
+	SoundAssetUUID           *string `json:"sound_asset_uuid,omitempty"`
+	SoundConfiguration       string  `json:"sound_configuration"`
+	SubtitleAssetUUID        *string `json:"subtitle_asset_uuid,omitempty"`
+	SubtitleLanguage         string  `json:"subtitle_language"`
+	ClosedCaptionAssetUUID   *string `json:"closed_caption_asset_uuid,omitempty"`
+	ClosedCaptionLanguage    string  `json:"closed_caption_language"`
+	MarkersAssetUUID         *string `json:"markers_asset_uuid,omitempty"`
+	AuxDataAssetUUID         *string `json:"aux_data_asset_uuid,omitempty"`
+	AuxDataType              string  `json:"aux_data_type"`
+}
+
+// DCPMarkerMetadata represents a MainMarkers entry of a CPL (FFEC gives the end-credits frame)
+type DCPMarkerMetadata struct {
+	ReelNumber    int    `json:"reel_number"`
+	Label         string `json:"label"`
+	OffsetFrames  int    `json:"offset_frames"`
+	AbsoluteFrame int    `json:"absolute_frame"`
+}
+
+// DCPRatingMetadata represents a RatingList entry of a CPL
+type DCPRatingMetadata struct {
+	Agency string `json:"agency"`
+	Label  string `json:"label"`
+}
+
+// DCPContentVersionMetadata represents a ContentVersion of a CPL
+type DCPContentVersionMetadata struct {
+	ContentVersionID string `json:"content_version_id"`
+	LabelText        string `json:"label_text"`
+}
+
+// DCPTimedTextMetadata represents what a reel's subtitle or closed caption track file holds
+type DCPTimedTextMetadata struct {
+	ReelNumber      int                        `json:"reel_number"`
+	TrackKind       string                     `json:"track_kind"`
+	AssetUUID       string                     `json:"asset_uuid"`
+	Standard        string                     `json:"standard"`
+	Language        string                     `json:"language"`
+	SubtitleKind    string                     `json:"subtitle_kind"`
+	EventCount      int                        `json:"event_count"`
+	TextEventCount  int                        `json:"text_event_count"`
+	ImageEventCount int                        `json:"image_event_count"`
+	FirstTimeIn     string                     `json:"first_time_in"`
+	LastTimeOut     string                     `json:"last_time_out"`
+	Error           string                     `json:"error,omitempty"`
+	Fonts           []DCPTimedTextFontMetadata `json:"fonts,omitempty"`
+}
+
+// DCPTimedTextFontMetadata represents a font a timed text track loads
+type DCPTimedTextFontMetadata struct {
+	FontID  string `json:"font_id"`
+	URI     string `json:"uri"`
+	Present bool   `json:"present"`
+}
+
+// DCPPackingListMetadata represents PKL metadata
+type DCPPackingListMetadata struct {
+	PKLUUID        string                `json:"pkl_uuid"`
+	AnnotationText string                `json:"annotation_text"`
+	IssueDate      *time.Time            `json:"issue_date,omitempty"`
+	Issuer         string                `json:"issuer"`
+	Creator        string                `json:"creator"`
+	AssetCount     int                   `json:"asset_count"`
+	Signature      *DCPSignatureMetadata `json:"signature,omitempty"`
+}
+
+// DCPValidationFindingMetadata represents a structural problem found by this server's validator
+type DCPValidationFindingMetadata struct {
+	CheckID   string    `json:"check_id"`
+	Severity  string    `json:"severity"`
+	Subject   string    `json:"subject,omitempty"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DCPSignatureMetadata represents the XML signature verdict of a CPL or PKL
+type DCPSignatureMetadata struct {
+	Status        string     `json:"status"`
+	SignerSubject string     `json:"signer_subject,omitempty"`
+	SignerIssuer  string     `json:"signer_issuer,omitempty"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	Message       string     `json:"message,omitempty"`
+}
+
+// DCPContentKeyMetadata represents the KeyId of an encrypted track file of a CPL
+type DCPContentKeyMetadata struct {
+	KeyID      string `json:"key_id"`
+	KeyKind    string `json:"key_kind"`
+	ReelNumber int    `json:"reel_number"`
+}
+
+// DCPExternalAssetMetadata represents an asset a CPL references outside its own package (VF -> OV)
+type DCPExternalAssetMetadata struct {
+	AssetUUID string `json:"asset_uuid"`
+	AssetKind string `json:"asset_kind"`
 }
 
 // DCPAssetMetadata represents asset file metadata
@@ -60,9 +190,34 @@ type DCPAssetMetadata struct {
 	FileName      string `json:"file_name"`
 	AssetType     string `json:"asset_type"`
 	AssetRole     string `json:"asset_role"`
+	RoleSource    string `json:"role_source,omitempty"`
+	CPLUUID       string `json:"cpl_uuid,omitempty"`
+	ReelNumber    int    `json:"reel_number,omitempty"`
 	SizeBytes     int64  `json:"size_bytes"`
 	HashAlgorithm string `json:"hash_algorithm"`
 	HashValue     string `json:"hash_value"`
+	// Facts read from the MXF header; nil until the client has read it
+	Essence *DCPAssetEssenceMetadata `json:"essence,omitempty"`
+}
+
+// DCPAssetEssenceMetadata represents the MXF header facts of a track file
+type DCPAssetEssenceMetadata struct {
+	EssenceKind        string    `json:"essence_kind"`
+	EssenceContainerUL string    `json:"essence_container_ul"`
+	MXFPackageUUID     string    `json:"mxf_package_uuid,omitempty"`
+	IsEncrypted        bool      `json:"is_encrypted"`
+	EditRate           string    `json:"edit_rate"`
+	Duration           int64     `json:"duration"`
+	StoredWidth        int       `json:"stored_width"`
+	StoredHeight       int       `json:"stored_height"`
+	FrameLayout        string    `json:"frame_layout"`
+	JPEG2000Profile    string    `json:"jpeg2000_profile"`
+	IsStereoscopic     bool      `json:"is_stereoscopic"`
+	ChannelCount       int       `json:"channel_count"`
+	AudioSampleRate    int       `json:"audio_sample_rate"`
+	BitDepth           int       `json:"bit_depth"`
+	Error              string    `json:"error,omitempty"`
+	InspectedAt        time.Time `json:"inspected_at"`
 }
 
 // DCPMetadataUpdate represents a metadata sync payload
@@ -84,6 +239,11 @@ type ClientSync struct {
 	softwareVersion string
 	scanPath        string
 	stopChan        chan struct{}
+
+	// Measures the library and download locations for heartbeats; set once the download
+	// location is known, which may be after Start
+	storageMu       sync.Mutex
+	storageReporter func() []dcp.StorageUsage
 }
 
 // NewClientSync creates a new client sync service
@@ -108,6 +268,14 @@ func NewClientSync(database *db.DB, serverID uuid.UUID, mainServerURL, serverNam
 	}, nil
 }
 
+// SetStorageReporter sets the function measuring the filesystem usage of the library and
+// download locations, sent with every heartbeat
+func (cs *ClientSync) SetStorageReporter(reporter func() []dcp.StorageUsage) {
+	cs.storageMu.Lock()
+	cs.storageReporter = reporter
+	cs.storageMu.Unlock()
+}
+
 // Start begins periodic synchronization with main server.
 // Note: RegisterWithMainServer() should be called before Start() to get the correct remote server ID.
 func (cs *ClientSync) Start() {
@@ -254,7 +422,7 @@ func (cs *ClientSync) syncInventory() {
 
 	// Get all packages from local database
 	query := `
-		SELECT p.assetmap_uuid, i.local_path, i.status
+		SELECT p.assetmap_uuid, i.local_path, i.status, COALESCE(i.volumes_present, 1), i.quarantined_at
 		FROM dcp_packages p
 		JOIN server_dcp_inventory i ON p.id = i.package_id
 		WHERE i.server_id = $1
@@ -271,16 +439,20 @@ func (cs *ClientSync) syncInventory() {
 	for rows.Next() {
 		var assetMapUUID uuid.UUID
 		var localPath, status string
+		var volumesPresent int
+		var quarantinedAt *time.Time
 
-		if err := rows.Scan(&assetMapUUID, &localPath, &status); err != nil {
+		if err := rows.Scan(&assetMapUUID, &localPath, &status, &volumesPresent, &quarantinedAt); err != nil {
 			log.Printf("Error scanning row: %v", err)
 			continue
 		}
 
 		packages = append(packages, InventoryPackage{
-			AssetMapUUID: assetMapUUID.String(),
-			LocalPath:    localPath,
-			Status:       status,
+			AssetMapUUID:   assetMapUUID.String(),
+			LocalPath:      localPath,
+			Status:         status,
+			VolumesPresent: volumesPresent,
+			QuarantinedAt:  quarantinedAt,
 		})
 	}
 
@@ -344,7 +516,8 @@ func (cs *ClientSync) syncDCPMetadata() {
 	query := `
 		SELECT p.id, p.assetmap_uuid, p.package_name, p.content_title, p.content_kind,
 		       p.issue_date, p.issuer, p.creator, p.annotation_text, p.volume_count,
-		       p.total_size_bytes, p.file_count, p.discovered_at, p.last_verified
+		       p.total_size_bytes, p.file_count, p.discovered_at, p.last_verified,
+		       COALESCE(p.standard, 'unknown')
 		FROM dcp_packages p
 		JOIN server_dcp_inventory i ON p.id = i.package_id
 		WHERE i.server_id = $1
@@ -367,6 +540,7 @@ func (cs *ClientSync) syncDCPMetadata() {
 			&pkg.ID, &pkg.AssetMapUUID, &pkg.PackageName, &pkg.ContentTitle, &pkg.ContentKind,
 			&issueDate, &pkg.Issuer, &pkg.Creator, &pkg.AnnotationText, &pkg.VolumeCount,
 			&pkg.TotalSizeBytes, &pkg.FileCount, &pkg.DiscoveredAt, &lastVerified,
+			&pkg.Standard,
 		)
 		if err != nil {
 			log.Printf("Error scanning DCP metadata: %v", err)
@@ -383,9 +557,15 @@ func (cs *ClientSync) syncDCPMetadata() {
 		// Get compositions for this package
 		pkg.Compositions = cs.getCompositionsForPackage(pkg.ID)
 
+		// Get packing lists for this package
+		pkg.PackingLists = cs.getPackingListsForPackage(pkg.ID)
+
 		// Get assets for this package
 		pkg.Assets = cs.getAssetsForPackage(pkg.ID)
 
+		// Get this server's validation findings for this package
+		pkg.ValidationFindings = cs.getValidationFindingsForPackage(pkg.ID)
+
 		packages = append(packages, pkg)
 	}
 
@@ -426,7 +606,10 @@ func (cs *ClientSync) getCompositionsForPackage(packageID string) []DCPCompositi
 	query := `
 		SELECT id, cpl_uuid, content_title_text, content_kind, issue_date, issuer,
 		       creator, edit_rate, frame_rate, screen_aspect_ratio, resolution_width,
-		       resolution_height, main_sound_configuration, reel_count, total_duration_frames
+		       resolution_height, main_sound_configuration, reel_count, total_duration_frames,
+		       COALESCE(is_stereoscopic, false), COALESCE(has_atmos, false), COALESCE(has_closed_captions, false),
+		       COALESCE(standard, 'unknown'), COALESCE(signature_status, 'unknown'), COALESCE(signer_subject, ''),
+		       COALESCE(signer_issuer, ''), signer_not_before, signer_not_after, COALESCE(signature_message, '')
 		FROM dcp_compositions
 		WHERE package_id = $1
 	`
@@ -441,16 +624,21 @@ func (cs *ClientSync) getCompositionsForPackage(packageID string) []DCPCompositi
 	for rows.Next() {
 		var comp DCPCompositionMetadata
 		var issueDate *time.Time
+		sig := &DCPSignatureMetadata{}
 
 		err := rows.Scan(
 			&comp.ID, &comp.CPLUUID, &comp.ContentTitleText, &comp.ContentKind, &issueDate,
 			&comp.Issuer, &comp.Creator, &comp.EditRate, &comp.FrameRate, &comp.ScreenAspectRatio,
 			&comp.ResolutionWidth, &comp.ResolutionHeight, &comp.MainSoundConfiguration,
 			&comp.ReelCount, &comp.TotalDurationFrames,
+			&comp.IsStereoscopic, &comp.HasAtmos, &comp.HasClosedCaptions,
+			&comp.Standard, &sig.Status, &sig.SignerSubject,
+			&sig.SignerIssuer, &sig.NotBefore, &sig.NotAfter, &sig.Message,
 		)
 		if err != nil {
 			continue
 		}
+		comp.Signature = sig
 
 		if issueDate != nil {
 			comp.IssueDate = issueDate
@@ -458,15 +646,262 @@ func (cs *ClientSync) getCompositionsForPackage(packageID string) []DCPCompositi
 
 		comps = append(comps, comp)
 	}
+	rows.Close()
+
+	for i := range comps {
+		comps[i].ExternalAssets = cs.getExternalAssetsForComposition(comps[i].ID)
+		comps[i].ContentKeys = cs.getContentKeysForComposition(comps[i].ID)
+		comps[i].TimedText = cs.getTimedTextForComposition(comps[i].ID)
+		cs.addCompositionStructure(&comps[i])
+	}
 
 	return comps
 }
 
+// getExternalAssetsForComposition retrieves the assets a CPL references outside its own package
+func (cs *ClientSync) getExternalAssetsForComposition(compositionID string) []DCPExternalAssetMetadata {
+	query := `
+		SELECT asset_uuid, COALESCE(asset_kind, '')
+		FROM dcp_composition_external_assets
+		WHERE composition_id = $1
+	`
+
+	rows, err := cs.database.Query(query, compositionID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var assets []DCPExternalAssetMetadata
+	for rows.Next() {
+		var asset DCPExternalAssetMetadata
+		if err := rows.Scan(&asset.AssetUUID, &asset.AssetKind); err != nil {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets
+}
+
+// getContentKeysForComposition retrieves the KeyIds of a CPL's encrypted track files
+func (cs *ClientSync) getContentKeysForComposition(compositionID string) []DCPContentKeyMetadata {
+	query := `
+		SELECT key_id, COALESCE(key_kind, ''), COALESCE(reel_number, 0)
+		FROM dcp_composition_keys
+		WHERE composition_id = $1
+	`
+
+	rows, err := cs.database.Query(query, compositionID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var keys []DCPContentKeyMetadata
+	for rows.Next() {
+		var key DCPContentKeyMetadata
+		if err := rows.Scan(&key.KeyID, &key.KeyKind, &key.ReelNumber); err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// getTimedTextForComposition retrieves the subtitle and closed caption inspection results of a CPL
+func (cs *ClientSync) getTimedTextForComposition(compositionID string) []DCPTimedTextMetadata {
+	id, err := uuid.Parse(compositionID)
+	if err != nil {
+		return nil
+	}
+	tracks, err := cs.database.GetDCPTimedTextByCompositionID(id)
+	if err != nil {
+		return nil
+	}
+
+	var list []DCPTimedTextMetadata
+	for _, t := range tracks {
+		md := DCPTimedTextMetadata{
+			ReelNumber:      t.ReelNumber,
+			TrackKind:       t.TrackKind,
+			AssetUUID:       t.AssetUUID.String(),
+			Standard:        t.Standard,
+			Language:        t.Language,
+			SubtitleKind:    t.SubtitleKind,
+			EventCount:      t.EventCount,
+			TextEventCount:  t.TextEventCount,
+			ImageEventCount: t.ImageEventCount,
+			FirstTimeIn:     t.FirstTimeIn,
+			LastTimeOut:     t.LastTimeOut,
+			Error:           t.Error,
+		}
+		for _, f := range t.Fonts {
+			md.Fonts = append(md.Fonts, DCPTimedTextFontMetadata{FontID: f.FontID, URI: f.URI, Present: f.Present})
+		}
+		list = append(list, md)
+	}
+	return list
+}
+
+// addCompositionStructure fills in the reels, markers, ratings and content versions of a CPL.
+// A list that cannot be read stays nil so the main server keeps what it has.
+func (cs *ClientSync) addCompositionStructure(comp *DCPCompositionMetadata) {
+	id, err := uuid.Parse(comp.ID)
+	if err != nil {
+		return
+	}
+
+	if reels, err := cs.database.GetDCPReelsByCompositionID(id); err == nil {
+		comp.Reels = []DCPReelMetadata{}
+		for _, r := range reels {
+			comp.Reels = append(comp.Reels, DCPReelMetadata{
+				ReelUUID:                 r.ReelUUID.String(),
+				ReelNumber:               r.ReelNumber,
+				DurationFrames:           r.DurationFrames,
+				PictureAssetUUID:         uuidString(r.PictureAssetUUID),
+				PictureEditRate:          r.PictureEditRate,
+				PictureEntryPoint:        r.PictureEntryPoint,
+				PictureIntrinsicDuration: r.PictureIntrinsicDuration,
+				PictureKeyID:             uuidString(r.PictureKeyID),
+				PictureHash:              r.PictureHash,
+				IsStereoscopic:           r.IsStereoscopic,
+				SoundAssetUUID:           uuidString(r.SoundAssetUUID),
+				SoundConfiguration:       r.SoundConfiguration,
+				SubtitleAssetUUID:        uuidString(r.SubtitleAssetUUID),
+				SubtitleLanguage:         r.SubtitleLanguage,
+				ClosedCaptionAssetUUID:   uuidString(r.ClosedCaptionAssetUUID),
+				ClosedCaptionLanguage:    r.ClosedCaptionLanguage,
+				MarkersAssetUUID:         uuidString(r.MarkersAssetUUID),
+				AuxDataAssetUUID:         uuidString(r.AuxDataAssetUUID),
+				AuxDataType:              r.AuxDataType,
+			})
+		}
+	}
+
+	if markers, err := cs.database.GetDCPMarkersByCompositionID(id); err == nil {
+		comp.Markers = []DCPMarkerMetadata{}
+		for _, m := range markers {
+			comp.Markers = append(comp.Markers, DCPMarkerMetadata{
+				ReelNumber:    m.ReelNumber,
+				Label:         m.Label,
+				OffsetFrames:  m.OffsetFrames,
+				AbsoluteFrame: m.AbsoluteFrame,
+			})
+		}
+	}
+
+	if ratings, err := cs.database.GetDCPRatingsByCompositionID(id); err == nil {
+		comp.Ratings = []DCPRatingMetadata{}
+		for _, r := range ratings {
+			comp.Ratings = append(comp.Ratings, DCPRatingMetadata{Agency: r.Agency, Label: r.Label})
+		}
+	}
+
+	if versions, err := cs.database.GetDCPContentVersionsByCompositionID(id); err == nil {
+		comp.ContentVersions = []DCPContentVersionMetadata{}
+		for _, v := range versions {
+			comp.ContentVersions = append(comp.ContentVersions, DCPContentVersionMetadata{
+				ContentVersionID: v.ContentVersionID,
+				LabelText:        v.LabelText,
+			})
+		}
+	}
+}
+
+// uuidString formats an optional UUID for the sync payload
+func uuidString(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
+
+// parseUUIDString reads an optional UUID of the sync payload; a malformed one is dropped
+func parseUUIDString(s *string) *uuid.UUID {
+	if s == nil {
+		return nil
+	}
+	id, err := uuid.Parse(*s)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// getPackingListsForPackage retrieves the PKLs of a package with their signature verdicts
+func (cs *ClientSync) getPackingListsForPackage(packageID string) []DCPPackingListMetadata {
+	id, err := uuid.Parse(packageID)
+	if err != nil {
+		return nil
+	}
+	pkls, err := cs.database.GetDCPPackingListsByPackageID(id)
+	if err != nil {
+		return nil
+	}
+
+	var lists []DCPPackingListMetadata
+	for _, pkl := range pkls {
+		lists = append(lists, DCPPackingListMetadata{
+			PKLUUID:        pkl.PKLUUID.String(),
+			AnnotationText: pkl.AnnotationText,
+			IssueDate:      pkl.IssueDate,
+			Issuer:         pkl.Issuer,
+			Creator:        pkl.Creator,
+			AssetCount:     pkl.AssetCount,
+			Signature: &DCPSignatureMetadata{
+				Status:        pkl.SignatureStatus,
+				SignerSubject: pkl.SignerSubject,
+				SignerIssuer:  pkl.SignerIssuer,
+				NotBefore:     pkl.SignerNotBefore,
+				NotAfter:      pkl.SignerNotAfter,
+				Message:       pkl.SignatureMessage,
+			},
+		})
+	}
+
+	return lists
+}
+
+// getValidationFindingsForPackage retrieves the findings of the last validation of a package on
+// this server. Returns nil (findings not sent) when they cannot be read.
+func (cs *ClientSync) getValidationFindingsForPackage(packageID string) []DCPValidationFindingMetadata {
+	id, err := uuid.Parse(packageID)
+	if err != nil {
+		return nil
+	}
+	findings, err := cs.database.GetDCPValidationFindings(id, &cs.localServerID)
+	if err != nil {
+		return nil
+	}
+
+	list := []DCPValidationFindingMetadata{}
+	for _, f := range findings {
+		list = append(list, DCPValidationFindingMetadata{
+			CheckID:   f.CheckID,
+			Severity:  f.Severity,
+			Subject:   f.Subject,
+			Message:   f.Message,
+			CreatedAt: f.CreatedAt,
+		})
+	}
+
+	return list
+}
+
 // getAssetsForPackage retrieves assets for a package
 func (cs *ClientSync) getAssetsForPackage(packageID string) []DCPAssetMetadata {
 	query := `
 		SELECT id, asset_uuid, file_path, file_name, asset_type, asset_role,
-		       size_bytes, hash_algorithm, hash_value
+		       COALESCE(role_source, ''), COALESCE(cpl_uuid::text, ''), COALESCE(reel_number, 0),
+		       size_bytes, hash_algorithm, hash_value,
+		       COALESCE(essence_kind, ''), COALESCE(essence_container_ul, ''), COALESCE(mxf_package_uuid::text, ''),
+		       COALESCE(is_encrypted, FALSE), COALESCE(mxf_edit_rate, ''), COALESCE(mxf_duration, 0),
+		       COALESCE(stored_width, 0), COALESCE(stored_height, 0), COALESCE(frame_layout, ''),
+		       COALESCE(jpeg2000_profile, ''), COALESCE(is_stereoscopic, FALSE), COALESCE(channel_count, 0),
+		       COALESCE(audio_sample_rate, 0), COALESCE(bit_depth, 0), COALESCE(mxf_error, ''), mxf_inspected_at
 		FROM dcp_assets
 		WHERE package_id = $1
 		LIMIT 50
@@ -481,14 +916,26 @@ func (cs *ClientSync) getAssetsForPackage(packageID string) []DCPAssetMetadata {
 	var assets []DCPAssetMetadata
 	for rows.Next() {
 		var asset DCPAssetMetadata
+		var essence DCPAssetEssenceMetadata
+		var inspectedAt *time.Time
 
 		err := rows.Scan(
 			&asset.ID, &asset.AssetUUID, &asset.FilePath, &asset.FileName, &asset.AssetType,
-			&asset.AssetRole, &asset.SizeBytes, &asset.HashAlgorithm, &asset.HashValue,
+			&asset.AssetRole, &asset.RoleSource, &asset.CPLUUID, &asset.ReelNumber,
+			&asset.SizeBytes, &asset.HashAlgorithm, &asset.HashValue,
+			&essence.EssenceKind, &essence.EssenceContainerUL, &essence.MXFPackageUUID,
+			&essence.IsEncrypted, &essence.EditRate, &essence.Duration,
+			&essence.StoredWidth, &essence.StoredHeight, &essence.FrameLayout,
+			&essence.JPEG2000Profile, &essence.IsStereoscopic, &essence.ChannelCount,
+			&essence.AudioSampleRate, &essence.BitDepth, &essence.Error, &inspectedAt,
 		)
 		if err != nil {
 			continue
 		}
+		if inspectedAt != nil {
+			essence.InspectedAt = *inspectedAt
+			asset.Essence = &essence
+		}
 
 		assets = append(assets, asset)
 	}
@@ -572,6 +1019,12 @@ func (cs *ClientSync) sendHeartbeat() {
 		"software_version":    cs.softwareVersion,
 		"package_count":       packageCount,
 	}
+	cs.storageMu.Lock()
+	storageReporter := cs.storageReporter
+	cs.storageMu.Unlock()
+	if storageReporter != nil {
+		heartbeat["storage"] = storageReporter()
+	}
 
 	data, err := json.Marshal(heartbeat)
 	if err != nil {
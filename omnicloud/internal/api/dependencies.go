@@ -0,0 +1,219 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// packageRef is the subset of a package shown when it is referenced from another one
+type packageRef struct {
+	ID           uuid.UUID
+	AssetMapUUID uuid.UUID
+	PackageName  string
+}
+
+func (s *Server) getPackageRef(packageID uuid.UUID) (*packageRef, error) {
+	ref := &packageRef{ID: packageID}
+	err := s.db.QueryRow(`SELECT assetmap_uuid, package_name FROM dcp_packages WHERE id = $1`, packageID).
+		Scan(&ref.AssetMapUUID, &ref.PackageName)
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// onlineHolders returns the names of the servers holding a complete, online copy of a package
+func (s *Server) onlineHolders(packageID uuid.UUID) ([]map[string]interface{}, []string) {
+	rows, err := s.db.Query(`
+		SELECT sv.id, COALESCE(NULLIF(sv.display_name, ''), sv.name)
+		FROM server_dcp_inventory i
+		JOIN servers sv ON sv.id = i.server_id
+		WHERE i.package_id = $1 AND i.status = 'online'
+		ORDER BY 2`, packageID)
+	if err != nil {
+		log.Printf("Error loading holders of package %s: %v", packageID, err)
+		return []map[string]interface{}{}, nil
+	}
+	defer rows.Close()
+
+	servers := []map[string]interface{}{}
+	var names []string
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			continue
+		}
+		servers = append(servers, map[string]interface{}{"id": id, "name": name})
+		names = append(names, name)
+	}
+	return servers, names
+}
+
+// dependencyDetails describes the VF/OV relationships of a package: the OVs its compositions need
+// (with the servers holding them), the VFs that need it, and assets no indexed package provides.
+// Lookup failures are logged and yield partial output.
+func (s *Server) dependencyDetails(packageID uuid.UUID) map[string]interface{} {
+	dependencies := []map[string]interface{}{}
+	supplements := []map[string]interface{}{}
+	summary := []string{}
+
+	deps, err := s.database.GetDCPPackageDependencies(packageID)
+	if err != nil {
+		log.Printf("Error loading dependencies of package %s: %v", packageID, err)
+	}
+
+	// Several CPLs of a VF usually share one OV; report each OV once
+	byOV := make(map[uuid.UUID]map[string]interface{})
+	for _, d := range deps {
+		if entry, ok := byOV[d.OVPackageID]; ok {
+			entry["asset_count"] = entry["asset_count"].(int) + d.AssetCount
+			entry["composition_ids"] = append(entry["composition_ids"].([]uuid.UUID), d.CompositionID)
+			continue
+		}
+
+		ov, err := s.getPackageRef(d.OVPackageID)
+		if err != nil {
+			log.Printf("Error loading OV package %s: %v", d.OVPackageID, err)
+			continue
+		}
+		servers, names := s.onlineHolders(ov.ID)
+
+		line := fmt.Sprintf("VF requires OV %s", ov.PackageName)
+		if len(names) > 0 {
+			line += fmt.Sprintf(" (present on servers %s)", strings.Join(names, ", "))
+		} else {
+			line += " (not present on any server)"
+		}
+		summary = append(summary, line)
+
+		entry := map[string]interface{}{
+			"ov_package_id":    ov.ID,
+			"ov_assetmap_uuid": ov.AssetMapUUID,
+			"ov_package_name":  ov.PackageName,
+			"asset_count":      d.AssetCount,
+			"composition_ids":  []uuid.UUID{d.CompositionID},
+			"servers":          servers,
+		}
+		byOV[d.OVPackageID] = entry
+		dependencies = append(dependencies, entry)
+	}
+
+	dependents, err := s.database.GetDCPPackageDependents(packageID)
+	if err != nil {
+		log.Printf("Error loading dependents of package %s: %v", packageID, err)
+	}
+	seen := make(map[uuid.UUID]bool)
+	for _, d := range dependents {
+		if seen[d.PackageID] {
+			continue
+		}
+		seen[d.PackageID] = true
+		vf, err := s.getPackageRef(d.PackageID)
+		if err != nil {
+			log.Printf("Error loading VF package %s: %v", d.PackageID, err)
+			continue
+		}
+		supplements = append(supplements, map[string]interface{}{
+			"package_id":    vf.ID,
+			"assetmap_uuid": vf.AssetMapUUID,
+			"package_name":  vf.PackageName,
+		})
+	}
+
+	unresolved, err := s.database.CountUnresolvedDCPExternalAssets(packageID)
+	if err != nil {
+		log.Printf("Error counting unresolved assets of package %s: %v", packageID, err)
+	}
+	if unresolved > 0 {
+		summary = append(summary, fmt.Sprintf("VF references %d asset(s) not found in any indexed package", unresolved))
+	}
+
+	packageType := "OV"
+	if len(deps) > 0 || unresolved > 0 {
+		packageType = "VF"
+	}
+
+	return map[string]interface{}{
+		"package_type":       packageType,
+		"dependencies":       dependencies,
+		"supplements":        supplements,
+		"unresolved_assets":  unresolved,
+		"dependency_summary": summary,
+	}
+}
+
+// queueDependencyTransfers queues a transfer of every OV the package behind torrentID depends on,
+// unless the destination already holds the OV, it has no torrent yet, or a transfer of it to the
+// destination is already active. Returns the IDs of the transfers created.
+func (s *Server) queueDependencyTransfers(torrentID, destinationServerID, requestedBy string, priority int, deliverBy *time.Time) ([]string, error) {
+	var packageID uuid.UUID
+	if err := s.db.QueryRow(`SELECT package_id FROM dcp_torrents WHERE id = $1`, torrentID).Scan(&packageID); err != nil {
+		return nil, fmt.Errorf("failed to resolve package of torrent %s: %w", torrentID, err)
+	}
+
+	deps, err := s.database.GetDCPPackageDependencies(packageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	queued := make(map[uuid.UUID]bool)
+	for _, d := range deps {
+		if queued[d.OVPackageID] {
+			continue
+		}
+		queued[d.OVPackageID] = true
+
+		var present bool
+		err := s.db.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM server_dcp_inventory
+			               WHERE package_id = $1 AND server_id = $2 AND status = 'online')`,
+			d.OVPackageID, destinationServerID).Scan(&present)
+		if err != nil {
+			return created, err
+		}
+		if present {
+			continue
+		}
+
+		torrent, err := s.database.GetTorrentByPackageID(d.OVPackageID)
+		if err != nil {
+			return created, err
+		}
+		if torrent == nil {
+			log.Printf("[transfers] OV package %s has no torrent yet, cannot send it with the VF", d.OVPackageID)
+			continue
+		}
+
+		var active bool
+		err = s.db.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM transfers
+			               WHERE torrent_id = $1 AND destination_server_id = $2
+			               AND status IN ('queued', 'waiting_for_space', 'downloading', 'paused', 'checking'))`,
+			torrent.ID, destinationServerID).Scan(&active)
+		if err != nil {
+			return created, err
+		}
+		if active {
+			continue
+		}
+
+		id := uuid.New().String()
+		now := time.Now()
+		_, err = s.db.Exec(`
+			INSERT INTO transfers (id, torrent_id, destination_server_id, requested_by, status, priority, deliver_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, 'queued', $5, $6, $7, $8)`,
+			id, torrent.ID, destinationServerID, requestedBy, priority, deliverBy, now, now)
+		if err != nil {
+			return created, err
+		}
+		log.Printf("[transfers] Queued OV package %s with VF torrent %s (transfer %s)", d.OVPackageID, torrentID, id)
+		created = append(created, id)
+	}
+	return created, nil
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
@@ -19,10 +20,13 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"github.com/omnicloud/omnicloud/internal/relay"
 	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/parser"
 	"github.com/omnicloud/omnicloud/internal/updater"
 	ws "github.com/omnicloud/omnicloud/internal/websocket"
+	"github.com/omnicloud/omnicloud/pkg/dcp"
 )
 
 // Response structures
@@ -52,9 +56,19 @@ type InventoryUpdate struct {
 }
 
 type InventoryPackage struct {
-	AssetMapUUID string `json:"assetmap_uuid"`
-	LocalPath    string `json:"local_path"`
-	Status       string `json:"status"`
+	AssetMapUUID   string     `json:"assetmap_uuid"`
+	LocalPath      string     `json:"local_path"`
+	Status         string     `json:"status"`
+	VolumesPresent int        `json:"volumes_present,omitempty"`
+	QuarantinedAt  *time.Time `json:"quarantined_at,omitempty"`
+}
+
+// inventoryStatusLabel describes an inventory entry for display, e.g. "partial (2 of 3 volumes)"
+func inventoryStatusLabel(status string, volumesPresent, volumeCount int) string {
+	if status == "partial" && volumeCount > 1 {
+		return fmt.Sprintf("partial (%d of %d volumes)", volumesPresent, volumeCount)
+	}
+	return status
 }
 
 // TorrentStatusReport represents the status report sent from clients
@@ -124,8 +138,37 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, response)
 }
 
-// handleListServers returns all registered servers
+// handleListServers returns all registered servers with their groups and tags. ?group= (ID or
+// name) and ?tag= narrow the list down.
 func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.database.ListServerGroups()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server groups", err.Error())
+		return
+	}
+	tags, err := s.database.GetServerTags()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server tags", err.Error())
+		return
+	}
+	memberOf := make(map[uuid.UUID][]map[string]interface{})
+	inGroup := make(map[uuid.UUID]bool)
+	groupFilter := r.URL.Query().Get("group")
+	for _, g := range groups {
+		selected := g.ID.String() == groupFilter || strings.EqualFold(g.Name, groupFilter)
+		for _, serverID := range g.ServerIDs {
+			memberOf[serverID] = append(memberOf[serverID], map[string]interface{}{
+				"id":   g.ID,
+				"name": g.Name,
+				"kind": g.Kind,
+			})
+			if selected {
+				inGroup[serverID] = true
+			}
+		}
+	}
+	tagFilter := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+
 	rows, err := s.database.Query("SELECT id, name, COALESCE(display_name, ''), location, api_url, COALESCE(mac_address, ''), COALESCE(is_authorized, false), last_seen, storage_capacity_tb, COALESCE(software_version, ''), COALESCE(upgrade_status, 'idle'), target_version FROM servers ORDER BY name")
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to query servers", err.Error())
@@ -147,6 +190,21 @@ func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Error scanning server row: %v", err)
 			continue
 		}
+		if groupFilter != "" && !inGroup[id] {
+			continue
+		}
+		if tagFilter != "" && !containsString(tags[id], tagFilter) {
+			continue
+		}
+
+		serverGroups := memberOf[id]
+		if serverGroups == nil {
+			serverGroups = []map[string]interface{}{}
+		}
+		serverTags := tags[id]
+		if serverTags == nil {
+			serverTags = []string{}
+		}
 
 		server := map[string]interface{}{
 			"id":                   id,
@@ -159,6 +217,8 @@ func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
 			"storage_capacity_tb":  capacity,
 			"software_version":     softwareVersion,
 			"upgrade_status":       upgradeStatus,
+			"groups":               serverGroups,
+			"tags":                 serverTags,
 		}
 
 		if lastSeen != nil {
@@ -289,6 +349,8 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 		StorageCapacityTB float64 `json:"storage_capacity_tb"`
 		SoftwareVersion   string  `json:"software_version"`
 		PackageCount      int     `json:"package_count"`
+
+		Storage []dcp.StorageUsage `json:"storage"`
 	}
 	
 	// Body is optional, just update last_seen if not provided
@@ -317,6 +379,9 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, "Failed to update heartbeat", err.Error())
 		return
 	}
+	if len(heartbeat.Storage) > 0 {
+		s.recordStorageUsage(serverID, heartbeat.Storage)
+	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Heartbeat recorded",
@@ -459,6 +524,7 @@ func (s *Server) handleUpdateInventory(w http.ResponseWriter, r *http.Request) {
 
 	// Process each package in the inventory
 	updated := 0
+	var reported []string
 	for _, pkg := range update.Packages {
 		assetMapUUID, err := uuid.Parse(pkg.AssetMapUUID)
 		if err != nil {
@@ -476,23 +542,39 @@ func (s *Server) handleUpdateInventory(w http.ResponseWriter, r *http.Request) {
 		// Upsert inventory record
 		now := time.Now()
 		inv := &db.ServerDCPInventory{
-			ID:           uuid.New(),
-			ServerID:     serverID,
-			PackageID:    dcpPkg.ID,
-			LocalPath:    pkg.LocalPath,
-			Status:       pkg.Status,
-			LastVerified: now,
-			CreatedAt:    now,
-			UpdatedAt:    now,
+			ID:             uuid.New(),
+			ServerID:       serverID,
+			PackageID:      dcpPkg.ID,
+			LocalPath:      pkg.LocalPath,
+			Status:         pkg.Status,
+			VolumesPresent: pkg.VolumesPresent,
+			QuarantinedAt:  pkg.QuarantinedAt,
+			LastVerified:   now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
 		}
 
 		if err := s.database.UpsertServerDCPInventory(inv); err != nil {
 			log.Printf("Error updating inventory: %v", err)
 			continue
 		}
+		reported = append(reported, dcpPkg.ID.String())
 		updated++
 	}
 
+	// Quarantined packages the server no longer reports have been purged from its trash
+	if len(reported) > 0 {
+		res, err := s.db.Exec(`
+			DELETE FROM server_dcp_inventory
+			WHERE server_id = $1 AND status = 'quarantined' AND NOT (package_id::text = ANY($2))
+		`, serverID, pq.Array(reported))
+		if err != nil {
+			log.Printf("Error removing purged packages from inventory: %v", err)
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("[inventory-sync] Server %s: removed %d purged quarantined package(s)", serverID, n)
+		}
+	}
+
 	notFound := len(update.Packages) - updated
 	if notFound > 0 {
 		log.Printf("[inventory-sync] Server %s: updated %d/%d inventory entries (%d packages not found on main server - metadata may need to sync first)",
@@ -815,6 +897,7 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 	packagesProcessed := 0
 	compositionsProcessed := 0
 	assetsProcessed := 0
+	var syncedPackageIDs []uuid.UUID
 
 	// Process each package
 	for _, pkg := range update.Packages {
@@ -830,14 +913,15 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Upsert package
+		// Upsert package. The client's last_verified is its scan time, not a hash check, so
+		// it is ignored; only CompleteDCPVerification sets last_verified.
 		pkgQuery := `
 			INSERT INTO dcp_packages (
 				id, assetmap_uuid, package_name, content_title, content_kind,
 				issue_date, issuer, creator, annotation_text, volume_count,
-				total_size_bytes, file_count, discovered_at, last_verified,
-				created_at, updated_at
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+				total_size_bytes, file_count, discovered_at,
+				created_at, updated_at, standard
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, COALESCE(NULLIF($16, ''), 'unknown'))
 			ON CONFLICT (assetmap_uuid) DO UPDATE SET
 				package_name = EXCLUDED.package_name,
 				content_title = EXCLUDED.content_title,
@@ -849,7 +933,7 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 				volume_count = EXCLUDED.volume_count,
 				total_size_bytes = EXCLUDED.total_size_bytes,
 				file_count = EXCLUDED.file_count,
-				last_verified = EXCLUDED.last_verified,
+				standard = EXCLUDED.standard,
 				updated_at = CURRENT_TIMESTAMP
 		`
 
@@ -857,8 +941,8 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 		_, err = s.db.Exec(pkgQuery,
 			pkgID, assetMapUUID, pkg.PackageName, pkg.ContentTitle, pkg.ContentKind,
 			pkg.IssueDate, pkg.Issuer, pkg.Creator, pkg.AnnotationText, pkg.VolumeCount,
-			pkg.TotalSizeBytes, pkg.FileCount, pkg.DiscoveredAt, pkg.LastVerified,
-			now, now,
+			pkg.TotalSizeBytes, pkg.FileCount, pkg.DiscoveredAt,
+			now, now, pkg.Standard,
 		)
 		if err != nil {
 			log.Printf("Error upserting package %s: %v", pkg.PackageName, err)
@@ -874,6 +958,7 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		actualPkgUUID, _ := uuid.Parse(actualPkgID)
+		syncedPackageIDs = append(syncedPackageIDs, actualPkgUUID)
 
 		// Process compositions
 		for _, comp := range pkg.Compositions {
@@ -886,26 +971,259 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 					issue_date, issuer, creator, edit_rate, frame_rate,
 					screen_aspect_ratio, resolution_width, resolution_height,
 					main_sound_configuration, reel_count, total_duration_frames,
-					created_at, updated_at
-				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+					created_at, updated_at, is_stereoscopic, has_atmos, has_closed_captions, standard,
+					signature_status, signer_subject, signer_issuer, signer_not_before, signer_not_after, signature_message
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, COALESCE(NULLIF($22, ''), 'unknown'),
+				          COALESCE(NULLIF($23, ''), 'unknown'), $24, $25, $26, $27, $28)
 				ON CONFLICT (package_id, cpl_uuid) DO UPDATE SET
 					content_title_text = EXCLUDED.content_title_text,
 					content_kind = EXCLUDED.content_kind,
+					is_stereoscopic = EXCLUDED.is_stereoscopic,
+					has_atmos = EXCLUDED.has_atmos,
+					has_closed_captions = EXCLUDED.has_closed_captions,
+					standard = EXCLUDED.standard,
+					signature_status = EXCLUDED.signature_status,
+					signer_subject = EXCLUDED.signer_subject,
+					signer_issuer = EXCLUDED.signer_issuer,
+					signer_not_before = EXCLUDED.signer_not_before,
+					signer_not_after = EXCLUDED.signer_not_after,
+					signature_message = EXCLUDED.signature_message,
 					updated_at = CURRENT_TIMESTAMP
+				RETURNING id
 			`
 
-			_, err = s.db.Exec(compQuery,
+			// Clients that predate signature checks send no verdict
+			sig := comp.Signature
+			if sig == nil {
+				sig = &DCPSignatureMetadata{}
+			}
+
+			var actualCompID uuid.UUID
+			err = s.db.QueryRow(compQuery,
 				compID, actualPkgUUID, cplUUID, comp.ContentTitleText, comp.ContentKind,
 				comp.IssueDate, comp.Issuer, comp.Creator, comp.EditRate, comp.FrameRate,
 				comp.ScreenAspectRatio, comp.ResolutionWidth, comp.ResolutionHeight,
 				comp.MainSoundConfiguration, comp.ReelCount, comp.TotalDurationFrames,
-				now, now,
-			)
+				now, now, comp.IsStereoscopic, comp.HasAtmos, comp.HasClosedCaptions, comp.Standard,
+				sig.Status, sig.SignerSubject, sig.SignerIssuer, sig.NotBefore, sig.NotAfter, sig.Message,
+			).Scan(&actualCompID)
 			if err != nil {
 				log.Printf("Error upserting composition: %v", err)
 				continue
 			}
 			compositionsProcessed++
+			if err := s.database.SetDCPCompositionTitle(actualCompID, comp.ContentTitleText); err != nil {
+				log.Printf("Error storing decoded title of composition %s: %v", cplUUID, err)
+			}
+
+			// Assets the CPL references outside this package (VF -> OV)
+			var external []*db.DCPExternalAsset
+			for _, ea := range comp.ExternalAssets {
+				assetUUID, err := uuid.Parse(ea.AssetUUID)
+				if err != nil {
+					continue
+				}
+				external = append(external, &db.DCPExternalAsset{
+					ID:            uuid.New(),
+					CompositionID: actualCompID,
+					AssetUUID:     assetUUID,
+					AssetKind:     ea.AssetKind,
+					CreatedAt:     now,
+				})
+			}
+			if err := s.database.ReplaceDCPExternalAssets(actualCompID, external); err != nil {
+				log.Printf("Error storing external assets of composition %s: %v", cplUUID, err)
+			}
+
+			// KeyIds of encrypted track files, for KDM coverage checks
+			var keys []*db.DCPCompositionKey
+			for _, ck := range comp.ContentKeys {
+				keyID, err := uuid.Parse(ck.KeyID)
+				if err != nil {
+					continue
+				}
+				keys = append(keys, &db.DCPCompositionKey{
+					ID:            uuid.New(),
+					CompositionID: actualCompID,
+					KeyID:         keyID,
+					KeyKind:       ck.KeyKind,
+					ReelNumber:    ck.ReelNumber,
+				})
+			}
+			if err := s.database.ReplaceDCPCompositionKeys(actualCompID, keys); err != nil {
+				log.Printf("Error storing content keys of composition %s: %v", cplUUID, err)
+			}
+
+			// Subtitle and closed caption inspection results
+			var timedText []*db.DCPTimedText
+			for _, tt := range comp.TimedText {
+				assetUUID, err := uuid.Parse(tt.AssetUUID)
+				if err != nil {
+					continue
+				}
+				track := &db.DCPTimedText{
+					ID:              uuid.New(),
+					CompositionID:   actualCompID,
+					ReelNumber:      tt.ReelNumber,
+					TrackKind:       tt.TrackKind,
+					AssetUUID:       assetUUID,
+					Standard:        tt.Standard,
+					Language:        tt.Language,
+					SubtitleKind:    tt.SubtitleKind,
+					EventCount:      tt.EventCount,
+					TextEventCount:  tt.TextEventCount,
+					ImageEventCount: tt.ImageEventCount,
+					FirstTimeIn:     tt.FirstTimeIn,
+					LastTimeOut:     tt.LastTimeOut,
+					Error:           tt.Error,
+					CreatedAt:       now,
+				}
+				for _, f := range tt.Fonts {
+					track.Fonts = append(track.Fonts, &db.DCPTimedTextFont{FontID: f.FontID, URI: f.URI, Present: f.Present})
+				}
+				timedText = append(timedText, track)
+			}
+			if err := s.database.ReplaceDCPTimedText(actualCompID, timedText); err != nil {
+				log.Printf("Error storing timed text of composition %s: %v", cplUUID, err)
+			}
+
+			// Reels, markers (end-credits frame), ratings and content versions; null means the
+			// client did not send them
+			if comp.Reels != nil {
+				var reels []*db.DCPReel
+				for _, rl := range comp.Reels {
+					reelUUID, err := uuid.Parse(rl.ReelUUID)
+					if err != nil {
+						continue
+					}
+					reels = append(reels, &db.DCPReel{
+						ID:                       uuid.New(),
+						CompositionID:            actualCompID,
+						ReelUUID:                 reelUUID,
+						ReelNumber:               rl.ReelNumber,
+						DurationFrames:           rl.DurationFrames,
+						PictureAssetUUID:         parseUUIDString(rl.PictureAssetUUID),
+						PictureEditRate:          rl.PictureEditRate,
+						PictureEntryPoint:        rl.PictureEntryPoint,
+						PictureIntrinsicDuration: rl.PictureIntrinsicDuration,
+						PictureKeyID:             parseUUIDString(rl.PictureKeyID),
+						PictureHash:              rl.PictureHash,
+						SoundAssetUUID:           parseUUIDString(rl.SoundAssetUUID),
+						SoundConfiguration:       rl.SoundConfiguration,
+						SubtitleAssetUUID:        parseUUIDString(rl.SubtitleAssetUUID),
+						SubtitleLanguage:         rl.SubtitleLanguage,
+						IsStereoscopic:           rl.IsStereoscopic,
+						ClosedCaptionAssetUUID:   parseUUIDString(rl.ClosedCaptionAssetUUID),
+						ClosedCaptionLanguage:    rl.ClosedCaptionLanguage,
+						MarkersAssetUUID:         parseUUIDString(rl.MarkersAssetUUID),
+						AuxDataAssetUUID:         parseUUIDString(rl.AuxDataAssetUUID),
+						AuxDataType:              rl.AuxDataType,
+						CreatedAt:                now,
+					})
+				}
+				if err := s.database.ReplaceDCPReels(actualCompID, reels); err != nil {
+					log.Printf("Error storing reels of composition %s: %v", cplUUID, err)
+				}
+			}
+
+			if comp.Markers != nil {
+				var markers []*db.DCPMarker
+				for _, m := range comp.Markers {
+					markers = append(markers, &db.DCPMarker{
+						ID:            uuid.New(),
+						CompositionID: actualCompID,
+						ReelNumber:    m.ReelNumber,
+						Label:         m.Label,
+						OffsetFrames:  m.OffsetFrames,
+						AbsoluteFrame: m.AbsoluteFrame,
+						CreatedAt:     now,
+					})
+				}
+				if err := s.database.ReplaceDCPMarkers(actualCompID, markers); err != nil {
+					log.Printf("Error storing markers of composition %s: %v", cplUUID, err)
+				}
+			}
+
+			if comp.Ratings != nil {
+				var ratings []*db.DCPRating
+				for _, rt := range comp.Ratings {
+					ratings = append(ratings, &db.DCPRating{
+						ID:            uuid.New(),
+						CompositionID: actualCompID,
+						Agency:        rt.Agency,
+						Label:         rt.Label,
+						CreatedAt:     now,
+					})
+				}
+				if err := s.database.ReplaceDCPRatings(actualCompID, ratings); err != nil {
+					log.Printf("Error storing ratings of composition %s: %v", cplUUID, err)
+				}
+			}
+
+			if comp.ContentVersions != nil {
+				var versions []*db.DCPContentVersion
+				for _, cv := range comp.ContentVersions {
+					versions = append(versions, &db.DCPContentVersion{
+						ID:               uuid.New(),
+						CompositionID:    actualCompID,
+						ContentVersionID: cv.ContentVersionID,
+						LabelText:        cv.LabelText,
+						CreatedAt:        now,
+					})
+				}
+				if err := s.database.ReplaceDCPContentVersions(actualCompID, versions); err != nil {
+					log.Printf("Error storing content versions of composition %s: %v", cplUUID, err)
+				}
+			}
+		}
+
+		// Process packing lists (signature verdicts)
+		for _, pl := range pkg.PackingLists {
+			pklUUID, err := uuid.Parse(pl.PKLUUID)
+			if err != nil {
+				continue
+			}
+			record := &db.DCPPackingList{
+				ID:              uuid.New(),
+				PackageID:       actualPkgUUID,
+				PKLUUID:         pklUUID,
+				AnnotationText:  pl.AnnotationText,
+				IssueDate:       pl.IssueDate,
+				Issuer:          pl.Issuer,
+				Creator:         pl.Creator,
+				AssetCount:      pl.AssetCount,
+				SignatureStatus: "unknown",
+				CreatedAt:       now,
+			}
+			if sig := pl.Signature; sig != nil && sig.Status != "" {
+				record.SignatureStatus = sig.Status
+				record.SignerSubject = sig.SignerSubject
+				record.SignerIssuer = sig.SignerIssuer
+				record.SignerNotBefore = sig.NotBefore
+				record.SignerNotAfter = sig.NotAfter
+				record.SignatureMessage = sig.Message
+			}
+			if err := s.database.InsertDCPPackingList(record); err != nil {
+				log.Printf("Error upserting packing list %s: %v", pklUUID, err)
+			}
+		}
+
+		// Validation findings of the package on the reporting server
+		if pkg.ValidationFindings != nil {
+			var findings []*db.DCPValidationFinding
+			for _, vf := range pkg.ValidationFindings {
+				findings = append(findings, &db.DCPValidationFinding{
+					ID:        uuid.New(),
+					CheckID:   vf.CheckID,
+					Severity:  vf.Severity,
+					Subject:   vf.Subject,
+					Message:   vf.Message,
+					CreatedAt: vf.CreatedAt,
+				})
+			}
+			if err := s.database.ReplaceDCPValidationFindings(actualPkgUUID, serverID, findings); err != nil {
+				log.Printf("Error storing validation findings of package %s: %v", pkg.PackageName, err)
+			}
 		}
 
 		// Process assets
@@ -913,31 +1231,75 @@ func (s *Server) handleDCPMetadata(w http.ResponseWriter, r *http.Request) {
 			assetID, _ := uuid.Parse(asset.ID)
 			assetUUID, _ := uuid.Parse(asset.AssetUUID)
 
+			var cplUUID *uuid.UUID
+			if id, err := uuid.Parse(asset.CPLUUID); err == nil {
+				cplUUID = &id
+			}
+
 			assetQuery := `
 				INSERT INTO dcp_assets (
 					id, package_id, asset_uuid, file_path, file_name,
 					asset_type, asset_role, size_bytes, hash_algorithm, hash_value,
-					created_at
-				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+					created_at, role_source, cpl_uuid, reel_number
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 				ON CONFLICT (package_id, asset_uuid) DO UPDATE SET
 					file_path = EXCLUDED.file_path,
 					file_name = EXCLUDED.file_name,
-					size_bytes = EXCLUDED.size_bytes
+					size_bytes = EXCLUDED.size_bytes,
+					asset_role = EXCLUDED.asset_role,
+					role_source = EXCLUDED.role_source,
+					cpl_uuid = EXCLUDED.cpl_uuid,
+					reel_number = EXCLUDED.reel_number
 			`
 
 			_, err = s.db.Exec(assetQuery,
 				assetID, actualPkgUUID, assetUUID, asset.FilePath, asset.FileName,
 				asset.AssetType, asset.AssetRole, asset.SizeBytes, asset.HashAlgorithm, asset.HashValue,
-				now,
+				now, asset.RoleSource, cplUUID, asset.ReelNumber,
 			)
 			if err != nil {
 				log.Printf("Error upserting asset: %v", err)
 				continue
 			}
+			if e := asset.Essence; e != nil {
+				dbAsset := &db.DCPAsset{
+					PackageID:          actualPkgUUID,
+					AssetUUID:          assetUUID,
+					AssetRole:          asset.AssetRole,
+					EssenceKind:        e.EssenceKind,
+					EssenceContainerUL: e.EssenceContainerUL,
+					IsEncrypted:        e.IsEncrypted,
+					MXFEditRate:        e.EditRate,
+					MXFDuration:        e.Duration,
+					StoredWidth:        e.StoredWidth,
+					StoredHeight:       e.StoredHeight,
+					FrameLayout:        e.FrameLayout,
+					JPEG2000Profile:    e.JPEG2000Profile,
+					IsStereoscopic:     e.IsStereoscopic,
+					ChannelCount:       e.ChannelCount,
+					AudioSampleRate:    e.AudioSampleRate,
+					BitDepth:           e.BitDepth,
+					MXFError:           e.Error,
+					MXFInspectedAt:     &e.InspectedAt,
+				}
+				if id, err := uuid.Parse(e.MXFPackageUUID); err == nil {
+					dbAsset.MXFPackageUUID = &id
+				}
+				if err := s.database.UpdateDCPAssetEssence(dbAsset); err != nil {
+					log.Printf("Error storing MXF header of asset %s: %v", asset.AssetUUID, err)
+				}
+			}
 			assetsProcessed++
 		}
 	}
 
+	// Packages of this batch may provide (or be) the OV of VFs already known
+	if len(syncedPackageIDs) > 0 {
+		if err := s.database.ResolveDCPDependencies(syncedPackageIDs); err != nil {
+			log.Printf("[metadata-sync] Failed to resolve VF/OV dependencies: %v", err)
+		}
+	}
+
 	// Count total packages in database after sync
 	var totalPackages int
 	if err := s.db.QueryRow("SELECT COUNT(*) FROM dcp_packages").Scan(&totalPackages); err == nil {
@@ -967,7 +1329,8 @@ func (s *Server) handleGetServerDCPs(w http.ResponseWriter, r *http.Request) {
 
 	query := `
 		SELECT p.id, p.assetmap_uuid, p.package_name, p.content_title, p.content_kind,
-		       i.local_path, i.status, i.last_verified
+		       i.local_path, i.status, i.last_verified,
+		       COALESCE(i.volumes_present, 1), COALESCE(p.volume_count, 1)
 		FROM dcp_packages p
 		JOIN server_dcp_inventory i ON p.id = i.package_id
 		WHERE i.server_id = $1
@@ -985,9 +1348,10 @@ func (s *Server) handleGetServerDCPs(w http.ResponseWriter, r *http.Request) {
 		var id, assetMapUUID uuid.UUID
 		var packageName, contentTitle, contentKind, localPath, status string
 		var lastVerified time.Time
+		var volumesPresent, volumeCount int
 
 		if err := rows.Scan(&id, &assetMapUUID, &packageName, &contentTitle, &contentKind,
-			&localPath, &status, &lastVerified); err != nil {
+			&localPath, &status, &lastVerified, &volumesPresent, &volumeCount); err != nil {
 			log.Printf("Error scanning DCP row: %v", err)
 			continue
 		}
@@ -1000,6 +1364,9 @@ func (s *Server) handleGetServerDCPs(w http.ResponseWriter, r *http.Request) {
 			"content_kind":    contentKind,
 			"local_path":      localPath,
 			"status":          status,
+			"status_label":    inventoryStatusLabel(status, volumesPresent, volumeCount),
+			"volumes_present": volumesPresent,
+			"volume_count":    volumeCount,
 			"last_verified":   lastVerified,
 		})
 	}
@@ -1010,15 +1377,46 @@ func (s *Server) handleGetServerDCPs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// dcncListFields are the decoded ContentTitleText fields the DCP list filters and facets on:
+// query param and dcp_compositions column
+var dcncListFields = []struct{ param, column string }{
+	{"film_title", "dcnc_film_title"},
+	{"content_type", "dcnc_content_type"},
+	{"aspect_ratio", "dcnc_aspect_ratio"},
+	{"audio_language", "dcnc_audio_language"},
+	{"subtitle_language", "dcnc_subtitle_language"},
+	{"captions", "dcnc_captions"},
+	{"territory", "dcnc_territory"},
+	{"rating", "dcnc_rating"},
+	{"audio_format", "dcnc_audio_format"},
+	{"resolution", "dcnc_resolution"},
+	{"studio", "dcnc_studio"},
+	{"facility", "dcnc_facility"},
+	{"package_type", "dcnc_package_type"},
+}
+
 // handleListDCPs returns DCP packages available on at least one server.
-// Supports query params: search, content_kind, server_ids (comma-separated UUIDs),
-// limit (0 = no limit, default), offset (default 0).
+// Supports query params: search, content_kind, standard (interop|smpte|unknown),
+// server_ids (comma-separated UUIDs), limit (0 = no limit, default), offset (default 0),
+// and the naming convention fields of dcncListFields (a package matches when one of its
+// compositions' titles has that value). "facets" counts the matching packages per value of
+// each of those fields.
 func (s *Server) handleListDCPs(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	search := strings.TrimSpace(q.Get("search"))
 	contentKind := strings.TrimSpace(q.Get("content_kind"))
 	serverIDsParam := strings.TrimSpace(q.Get("server_ids"))
 
+	var standard parser.Standard
+	if raw := strings.TrimSpace(q.Get("standard")); raw != "" {
+		std, ok := parser.ParseStandard(raw)
+		if !ok {
+			respondError(w, http.StatusBadRequest, "Invalid standard", "standard must be one of: interop, smpte, unknown")
+			return
+		}
+		standard = std
+	}
+
 	// limit=0 (or unset) means no limit; explicit positive value paginates
 	limit := 0
 	offset := 0
@@ -1038,7 +1436,7 @@ func (s *Server) handleListDCPs(w http.ResponseWriter, r *http.Request) {
 		UNION
 		SELECT dt.package_id FROM transfers t
 		JOIN dcp_torrents dt ON dt.id = t.torrent_id
-		WHERE t.status IN ('queued','downloading','checking','paused','error','failed')
+		WHERE t.status IN ('queued','waiting_for_space','downloading','checking','paused','error','failed')
 	)`
 
 	filterClause := baseWhere
@@ -1073,6 +1471,18 @@ func (s *Server) handleListDCPs(w http.ResponseWriter, r *http.Request) {
 		args = append(args, strings.ToLower(contentKind))
 		argIdx++
 	}
+	if standard != "" {
+		filterClause += fmt.Sprintf(` AND COALESCE(dp.standard, 'unknown') = $%d`, argIdx)
+		args = append(args, string(standard))
+		argIdx++
+	}
+	for _, f := range dcncListFields {
+		if v := strings.TrimSpace(q.Get(f.param)); v != "" {
+			filterClause += fmt.Sprintf(` AND dp.id IN (SELECT package_id FROM dcp_compositions WHERE LOWER(%s) = $%d)`, f.column, argIdx)
+			args = append(args, strings.ToLower(v))
+			argIdx++
+		}
+	}
 
 	// Count total matching rows
 	countQuery := `SELECT COUNT(DISTINCT dp.id) FROM dcp_packages dp WHERE ` + filterClause
@@ -1085,7 +1495,8 @@ func (s *Server) handleListDCPs(w http.ResponseWriter, r *http.Request) {
 	// Data query — paginated only when limit > 0
 	dataQuery := fmt.Sprintf(`
 		SELECT DISTINCT dp.id, dp.assetmap_uuid, dp.package_name, dp.content_title, dp.content_kind,
-		       dp.issuer, dp.total_size_bytes, dp.file_count, dp.discovered_at
+		       dp.issuer, dp.total_size_bytes, dp.file_count, dp.discovered_at,
+		       COALESCE(dp.standard, 'unknown')
 		FROM dcp_packages dp
 		WHERE %s
 		ORDER BY dp.discovered_at DESC`, filterClause)
@@ -1107,13 +1518,13 @@ func (s *Server) handleListDCPs(w http.ResponseWriter, r *http.Request) {
 	var dcps []map[string]interface{}
 	for rows.Next() {
 		var id, assetMapUUID uuid.UUID
-		var packageName, contentTitle, contentKind2, issuer string
+		var packageName, contentTitle, contentKind2, issuer, pkgStandard string
 		var totalSize int64
 		var fileCount int
 		var discoveredAt time.Time
 
 		if err := rows.Scan(&id, &assetMapUUID, &packageName, &contentTitle, &contentKind2,
-			&issuer, &totalSize, &fileCount, &discoveredAt); err != nil {
+			&issuer, &totalSize, &fileCount, &discoveredAt, &pkgStandard); err != nil {
 			log.Printf("Error scanning DCP row: %v", err)
 			continue
 		}
@@ -1128,21 +1539,63 @@ func (s *Server) handleListDCPs(w http.ResponseWriter, r *http.Request) {
 			"total_size_bytes": totalSize,
 			"file_count":       fileCount,
 			"discovered_at":    discoveredAt,
+			"standard":         pkgStandard,
 		})
 	}
 	if dcps == nil {
 		dcps = []map[string]interface{}{}
 	}
 
+	facets, err := s.dcncFacets(filterClause, args)
+	if err != nil {
+		log.Printf("Error computing DCP facets: %v", err)
+	}
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"dcps":        dcps,
 		"count":       len(dcps),
 		"total_count": totalCount,
 		"offset":      offset,
 		"limit":       limit,
+		"facets":      facets,
 	})
 }
 
+// dcncFacets counts the packages matching filterClause per value of each naming convention
+// field, most common value first
+func (s *Server) dcncFacets(filterClause string, args []interface{}) (map[string][]map[string]interface{}, error) {
+	facets := make(map[string][]map[string]interface{}, len(dcncListFields))
+	var parts []string
+	for _, f := range dcncListFields {
+		facets[f.param] = []map[string]interface{}{}
+		parts = append(parts, fmt.Sprintf(`
+		SELECT '%s', dc.%s, COUNT(DISTINCT dp.id)
+		FROM dcp_packages dp
+		JOIN dcp_compositions dc ON dc.package_id = dp.id
+		WHERE %s AND COALESCE(dc.%s, '') <> ''
+		GROUP BY dc.%s`, f.param, f.column, filterClause, f.column, f.column))
+	}
+
+	rows, err := s.database.Query(strings.Join(parts, " UNION ALL ")+" ORDER BY 1, 3 DESC, 2", args...)
+	if err != nil {
+		return facets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field, value string
+		var count int
+		if err := rows.Scan(&field, &value, &count); err != nil {
+			return facets, err
+		}
+		facets[field] = append(facets[field], map[string]interface{}{
+			"value": value,
+			"count": count,
+		})
+	}
+	return facets, rows.Err()
+}
+
 // handleGetDCP returns detailed information about a specific DCP
 func (s *Server) handleGetDCP(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -1162,7 +1615,7 @@ func (s *Server) handleGetDCP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"id":               pkg.ID,
 		"assetmap_uuid":    pkg.AssetMapUUID,
 		"package_name":     pkg.PackageName,
@@ -1174,9 +1627,278 @@ func (s *Server) handleGetDCP(w http.ResponseWriter, r *http.Request) {
 		"volume_count":     pkg.VolumeCount,
 		"total_size_bytes": pkg.TotalSizeBytes,
 		"file_count":       pkg.FileCount,
+		"standard":         pkg.Standard,
 		"discovered_at":    pkg.DiscoveredAt,
 		"last_verified":    pkg.LastVerified,
-	})
+		"compositions":     s.compositionDetails(pkg.ID),
+		"packing_lists":    s.packingListDetails(pkg.ID),
+		"assets":           s.assetDetails(pkg.ID),
+	}
+	for k, v := range s.dependencyDetails(pkg.ID) {
+		resp[k] = v
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// compositionDetails builds the per-CPL detail list (reels, markers, ratings, versions) for a package.
+// Lookup failures are logged and yield partial output rather than failing the whole request.
+func (s *Server) compositionDetails(packageID uuid.UUID) []map[string]interface{} {
+	details := []map[string]interface{}{}
+
+	comps, err := s.database.GetDCPCompositionsByPackageID(packageID)
+	if err != nil {
+		log.Printf("Error loading compositions for package %s: %v", packageID, err)
+		return details
+	}
+
+	for _, c := range comps {
+		reels, err := s.database.GetDCPReelsByCompositionID(c.ID)
+		if err != nil {
+			log.Printf("Error loading reels for composition %s: %v", c.CPLUUID, err)
+		}
+		markers, err := s.database.GetDCPMarkersByCompositionID(c.ID)
+		if err != nil {
+			log.Printf("Error loading markers for composition %s: %v", c.CPLUUID, err)
+		}
+		ratings, err := s.database.GetDCPRatingsByCompositionID(c.ID)
+		if err != nil {
+			log.Printf("Error loading ratings for composition %s: %v", c.CPLUUID, err)
+		}
+		versions, err := s.database.GetDCPContentVersionsByCompositionID(c.ID)
+		if err != nil {
+			log.Printf("Error loading content versions for composition %s: %v", c.CPLUUID, err)
+		}
+		timedText, err := s.database.GetDCPTimedTextByCompositionID(c.ID)
+		if err != nil {
+			log.Printf("Error loading timed text for composition %s: %v", c.CPLUUID, err)
+		}
+		title, err := s.database.GetDCPCompositionTitle(c.ID)
+		if err != nil {
+			log.Printf("Error loading decoded title of composition %s: %v", c.CPLUUID, err)
+		}
+
+		// What the subtitle and closed caption track files of each reel hold
+		timedTextByReel := make(map[int][]map[string]interface{})
+		for _, t := range timedText {
+			fonts := []map[string]interface{}{}
+			for _, f := range t.Fonts {
+				fonts = append(fonts, map[string]interface{}{
+					"id":      f.FontID,
+					"uri":     f.URI,
+					"present": f.Present,
+				})
+			}
+			timedTextByReel[t.ReelNumber] = append(timedTextByReel[t.ReelNumber], map[string]interface{}{
+				"track_kind":        t.TrackKind,
+				"asset_uuid":        t.AssetUUID,
+				"standard":          t.Standard,
+				"language":          t.Language,
+				"subtitle_kind":     t.SubtitleKind,
+				"event_count":       t.EventCount,
+				"text_event_count":  t.TextEventCount,
+				"image_event_count": t.ImageEventCount,
+				"first_time_in":     t.FirstTimeIn,
+				"last_time_out":     t.LastTimeOut,
+				"fonts":             fonts,
+				"error":             t.Error,
+			})
+		}
+
+		reelList := []map[string]interface{}{}
+		for _, r := range reels {
+			reelList = append(reelList, map[string]interface{}{
+				"reel_uuid":                 r.ReelUUID,
+				"reel_number":               r.ReelNumber,
+				"duration_frames":           r.DurationFrames,
+				"picture_asset_uuid":        r.PictureAssetUUID,
+				"picture_edit_rate":         r.PictureEditRate,
+				"picture_key_id":            r.PictureKeyID,
+				"is_stereoscopic":           r.IsStereoscopic,
+				"sound_asset_uuid":          r.SoundAssetUUID,
+				"subtitle_asset_uuid":       r.SubtitleAssetUUID,
+				"subtitle_language":         r.SubtitleLanguage,
+				"closed_caption_asset_uuid": r.ClosedCaptionAssetUUID,
+				"closed_caption_language":   r.ClosedCaptionLanguage,
+				"markers_asset_uuid":        r.MarkersAssetUUID,
+				"aux_data_asset_uuid":       r.AuxDataAssetUUID,
+				"aux_data_type":             r.AuxDataType,
+				"timed_text":                timedTextByReel[r.ReelNumber],
+			})
+		}
+
+		markerList := []map[string]interface{}{}
+		var endCreditsFrame interface{}
+		for _, m := range markers {
+			markerList = append(markerList, map[string]interface{}{
+				"label":          m.Label,
+				"reel_number":    m.ReelNumber,
+				"offset_frames":  m.OffsetFrames,
+				"absolute_frame": m.AbsoluteFrame,
+			})
+			if m.Label == "FFEC" && endCreditsFrame == nil {
+				endCreditsFrame = m.AbsoluteFrame
+			}
+		}
+
+		ratingList := []map[string]interface{}{}
+		for _, rt := range ratings {
+			ratingList = append(ratingList, map[string]interface{}{
+				"agency": rt.Agency,
+				"label":  rt.Label,
+			})
+		}
+
+		versionList := []map[string]interface{}{}
+		for _, v := range versions {
+			versionList = append(versionList, map[string]interface{}{
+				"id":         v.ContentVersionID,
+				"label_text": v.LabelText,
+			})
+		}
+
+		details = append(details, map[string]interface{}{
+			"id":                       c.ID,
+			"cpl_uuid":                 c.CPLUUID,
+			"content_title_text":       c.ContentTitleText,
+			"content_kind":             c.ContentKind,
+			"standard":                 c.Standard,
+			"edit_rate":                c.EditRate,
+			"screen_aspect_ratio":      c.ScreenAspectRatio,
+			"resolution_width":         c.ResolutionWidth,
+			"resolution_height":        c.ResolutionHeight,
+			"main_sound_configuration": c.MainSoundConfiguration,
+			"reel_count":               c.ReelCount,
+			"total_duration_frames":    c.TotalDurationFrames,
+			"is_stereoscopic":          c.IsStereoscopic,
+			"has_atmos":                c.HasAtmos,
+			"has_closed_captions":      c.HasClosedCaptions,
+			"end_credits_frame":        endCreditsFrame,
+			"reels":                    reelList,
+			"markers":                  markerList,
+			"ratings":                  ratingList,
+			"content_versions":         versionList,
+			"naming":                   namingDetails(title),
+			"signature": signatureDetails(c.SignatureStatus, c.SignerSubject, c.SignerIssuer,
+				c.SignerNotBefore, c.SignerNotAfter, c.SignatureMessage),
+		})
+	}
+
+	return details
+}
+
+// packingListDetails lists the PKLs of a package with their signature verdicts
+func (s *Server) packingListDetails(packageID uuid.UUID) []map[string]interface{} {
+	details := []map[string]interface{}{}
+
+	pkls, err := s.database.GetDCPPackingListsByPackageID(packageID)
+	if err != nil {
+		log.Printf("Error loading packing lists for package %s: %v", packageID, err)
+		return details
+	}
+
+	for _, p := range pkls {
+		details = append(details, map[string]interface{}{
+			"id":              p.ID,
+			"pkl_uuid":        p.PKLUUID,
+			"annotation_text": p.AnnotationText,
+			"issue_date":      p.IssueDate,
+			"issuer":          p.Issuer,
+			"creator":         p.Creator,
+			"asset_count":     p.AssetCount,
+			"signature": signatureDetails(p.SignatureStatus, p.SignerSubject, p.SignerIssuer,
+				p.SignerNotBefore, p.SignerNotAfter, p.SignatureMessage),
+		})
+	}
+
+	return details
+}
+
+// assetDetails builds the asset list of a package, with the MXF header facts of track files
+func (s *Server) assetDetails(packageID uuid.UUID) []map[string]interface{} {
+	details := []map[string]interface{}{}
+
+	assets, err := s.database.GetDCPAssetsByPackageID(packageID)
+	if err != nil {
+		log.Printf("Error loading assets for package %s: %v", packageID, err)
+		return details
+	}
+
+	for _, a := range assets {
+		detail := map[string]interface{}{
+			"asset_uuid":  a.AssetUUID,
+			"file_name":   a.FileName,
+			"asset_type":  a.AssetType,
+			"asset_role":  a.AssetRole,
+			"role_source": a.RoleSource,
+			"cpl_uuid":    a.CPLUUID,
+			"reel_number": a.ReelNumber,
+			"size_bytes":  a.SizeBytes,
+			"hash_value":  a.HashValue,
+		}
+		if a.MXFInspectedAt != nil {
+			detail["essence"] = map[string]interface{}{
+				"kind":              a.EssenceKind,
+				"container_ul":      a.EssenceContainerUL,
+				"mxf_package_uuid":  a.MXFPackageUUID,
+				"is_encrypted":      a.IsEncrypted,
+				"edit_rate":         a.MXFEditRate,
+				"duration":          a.MXFDuration,
+				"stored_width":      a.StoredWidth,
+				"stored_height":     a.StoredHeight,
+				"frame_layout":      a.FrameLayout,
+				"jpeg2000_profile":  a.JPEG2000Profile,
+				"is_stereoscopic":   a.IsStereoscopic,
+				"channel_count":     a.ChannelCount,
+				"audio_sample_rate": a.AudioSampleRate,
+				"bit_depth":         a.BitDepth,
+				"error":             a.MXFError,
+				"inspected_at":      a.MXFInspectedAt,
+			}
+		}
+		details = append(details, detail)
+	}
+
+	return details
+}
+
+// signatureDetails describes the XML signature verdict of a CPL or PKL
+func signatureDetails(status, subject, issuer string, notBefore, notAfter *time.Time, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"status":         status,
+		"signer_subject": subject,
+		"signer_issuer":  issuer,
+		"not_before":     notBefore,
+		"not_after":      notAfter,
+		"message":        message,
+	}
+}
+
+// namingDetails describes the naming convention fields decoded from a ContentTitleText, nil
+// when the title has not been decoded
+func namingDetails(t *dcp.ContentTitle) map[string]interface{} {
+	if t == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"film_title":        t.FilmTitle,
+		"content_type":      t.ContentType,
+		"content_version":   t.ContentVersion,
+		"aspect_ratio":      t.AspectRatio,
+		"image_aspect":      t.ImageAspect,
+		"audio_language":    t.AudioLanguage,
+		"subtitle_language": t.SubtitleLanguage,
+		"captions":          t.Captions,
+		"territory":         t.Territory,
+		"rating":            t.Rating,
+		"audio_format":      t.AudioFormat,
+		"resolution":        t.Resolution,
+		"studio":            t.Studio,
+		"date":              t.Date,
+		"facility":          t.Facility,
+		"standard":          t.Standard,
+		"package_type":      t.PackageType,
+		"conforming":        t.Conforming,
+	}
 }
 
 // handleRegisterVersion adds a new version to the catalog (used by build-release.sh)
@@ -1354,7 +2076,45 @@ func (s *Server) handleTriggerUpgrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Upgrade triggered for server %s to version %s", serverID, request.TargetVersion)
+	method, err := s.triggerUpgrade(serverID, request.TargetVersion)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to set upgrade target", err.Error())
+		return
+	}
+
+	s.logActivity(r, "server.upgrade", "servers", "server", vars["id"], "", "", "success")
+	switch method {
+	case "local":
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"message":        "Upgrade triggered successfully (local)",
+			"server_id":      serverID,
+			"target_version": request.TargetVersion,
+			"status":         "pending",
+		})
+	case "websocket":
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"message":        "Upgrade command sent successfully (via WebSocket)",
+			"server_id":      serverID,
+			"target_version": request.TargetVersion,
+			"status":         "sent",
+			"method":         "websocket",
+		})
+	default:
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"message":        "Upgrade triggered successfully (polling mode)",
+			"server_id":      serverID,
+			"target_version": request.TargetVersion,
+			"status":         "pending",
+			"method":         "polling",
+		})
+	}
+}
+
+// triggerUpgrade upgrades a server to an existing version and tells how: "local" when it is
+// this server, "websocket" when the command reached the connected client, or "polling" when
+// the target version was set for the client to pick up
+func (s *Server) triggerUpgrade(serverID uuid.UUID, targetVersion string) (string, error) {
+	log.Printf("Upgrade triggered for server %s to version %s", serverID, targetVersion)
 
 	// If this process is the target (main server upgrading itself), run upgrade locally then restart
 	if s.selfServerID != nil && *s.selfServerID == serverID {
@@ -1363,11 +2123,11 @@ func (s *Server) handleTriggerUpgrade(w http.ResponseWriter, r *http.Request) {
 			UPDATE servers
 			SET target_version = $1, upgrade_status = 'pending', updated_at = CURRENT_TIMESTAMP
 			WHERE id = $2`,
-			request.TargetVersion, serverID)
+			targetVersion, serverID)
 
 		go func() {
 			baseURL := "http://127.0.0.1:" + strconv.Itoa(s.port)
-			if err := updater.PerformSelfUpgrade(baseURL, request.TargetVersion); err != nil {
+			if err := updater.PerformSelfUpgrade(baseURL, targetVersion); err != nil {
 				log.Printf("Self-upgrade failed: %v", err)
 				s.database.DB.Exec(`UPDATE servers SET upgrade_status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, "failed", serverID)
 				return
@@ -1377,57 +2137,31 @@ func (s *Server) handleTriggerUpgrade(w http.ResponseWriter, r *http.Request) {
 			time.Sleep(2 * time.Second)
 			syscall.Kill(os.Getpid(), syscall.SIGTERM)
 		}()
-
-		s.logActivity(r, "server.upgrade", "servers", "server", vars["id"], "", "", "success")
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"message":        "Upgrade triggered successfully (local)",
-			"server_id":      serverID,
-			"target_version": request.TargetVersion,
-			"status":         "pending",
-		})
-		return
+		return "local", nil
 	}
 
 	// Try WebSocket first (instant delivery if client is connected)
 	if s.wsHub != nil && s.wsHub.IsClientConnected(serverID) {
 		payload := map[string]interface{}{
-			"version": request.TargetVersion,
+			"version": targetVersion,
 		}
 		if err := s.wsHub.SendCommandToClient(serverID, ws.CommandUpgrade, payload); err == nil {
 			log.Printf("Upgrade command sent via WebSocket to server %s", serverID)
-			s.logActivity(r, "server.upgrade", "servers", "server", vars["id"], "", "", "success")
-			respondJSON(w, http.StatusOK, map[string]interface{}{
-				"message":        "Upgrade command sent successfully (via WebSocket)",
-				"server_id":      serverID,
-				"target_version": request.TargetVersion,
-				"status":         "sent",
-				"method":         "websocket",
-			})
-			return
+			return "websocket", nil
 		}
 		log.Printf("WebSocket send failed for %s, falling back to database flag", serverID)
 	}
 
 	// Fallback to database flag for HTTP polling (legacy method)
-	_, err = s.database.DB.Exec(`
+	_, err := s.database.DB.Exec(`
 		UPDATE servers
 		SET target_version = $1, upgrade_status = 'pending', updated_at = CURRENT_TIMESTAMP
 		WHERE id = $2`,
-		request.TargetVersion, serverID)
-
+		targetVersion, serverID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to set upgrade target", err.Error())
-		return
+		return "", err
 	}
-
-	s.logActivity(r, "server.upgrade", "servers", "server", vars["id"], "", "", "success")
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message":        "Upgrade triggered successfully (polling mode)",
-		"server_id":      serverID,
-		"target_version": request.TargetVersion,
-		"status":         "pending",
-		"method":         "polling",
-	})
+	return "polling", nil
 }
 
 // handleRestartServer triggers a restart for a specific server
@@ -1556,12 +2290,29 @@ func (s *Server) handlePendingTransfers(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("[pending-transfers] Request from server %s", serverID)
 
+	transfers, err := s.pendingTransfers(serverID)
+	if err != nil {
+		log.Printf("[pending-transfers] Database error for server %s: %v", serverID, err)
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	log.Printf("[pending-transfers] Returning %d transfer(s) for server %s", len(transfers), serverID)
+	respondJSON(w, http.StatusOK, transfers)
+}
+
+// pendingTransfers returns the transfers a server is to run, as polled by its transfer processor
+// or pushed to it over the websocket
+func (s *Server) pendingTransfers(serverID uuid.UUID) ([]map[string]interface{}, error) {
 	// Return transfers that are:
 	// 1. 'queued' - waiting to be started
 	// 2. 'downloading' - in progress (may need resuming after client restart)
 	// 3. 'active' - alternative status for in-progress transfers
+	// 4. 'waiting_for_space' - held until the download location can hold them
 	// The client's TransferProcessor will skip transfers it's already handling.
 	// PostgreSQL piece completion ensures already-downloaded pieces aren't re-downloaded.
+	// Transfers with a delivery deadline come first, least slack (time between the predicted
+	// completion and the deadline) first, then the rest by priority.
 	rows, err := s.database.Query(`
 		SELECT
 			t.id,
@@ -1579,18 +2330,21 @@ func (s *Server) handlePendingTransfers(w http.ResponseWriter, r *http.Request)
 		LEFT JOIN dcp_torrents dt ON t.torrent_id = dt.id
 		LEFT JOIN dcp_packages dp ON dt.package_id = dp.id
 		WHERE t.destination_server_id = $1
-		  AND t.status IN ('queued', 'downloading', 'checking', 'active')
-		ORDER BY t.priority DESC, t.created_at ASC
+		  AND t.status IN ('queued', 'waiting_for_space', 'downloading', 'checking', 'active')
+		ORDER BY t.deliver_by - COALESCE(t.predicted_completion_at, NOW()) ASC NULLS LAST,
+		         t.priority DESC, t.created_at ASC
 		LIMIT 10
 	`, serverID)
 	if err != nil {
-		log.Printf("[pending-transfers] Database error for server %s: %v", serverID, err)
-		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
+	// Space left on the download location for transfers that have not started yet
+	available, reserve, knownSpace := s.downloadSpaceAvailable(serverID)
+
 	transfers := []map[string]interface{}{}
+	var held []heldTransfer
 	for rows.Next() {
 		var id, torrentID, destServerID uuid.UUID
 		var sourceServerID sql.NullString
@@ -1611,6 +2365,24 @@ func (s *Server) handlePendingTransfers(w http.ResponseWriter, r *http.Request)
 		log.Printf("[pending-transfers]   Found: id=%s package=%q status=%s progress=%.1f%% info_hash=%s",
 			id, packageName, status, progressPercent, infoHash)
 
+		// MXFs the destination already holds in other packages are linked instead of
+		// downloaded. Linking only works when the source is on the download location's
+		// filesystem, which only the client knows, so admission counts the full size; the
+		// client leaves out what it can link.
+		localAssets := s.localAssetCopies(packageID, serverID)
+		neededBytes := totalSizeBytes
+
+		// Not started yet: admit it only if it fits, in the order above. A transfer already
+		// waiting for space is handed out as is: the samples here can be minutes old, so the
+		// client measures its download location itself and starts it once it fits.
+		if knownSpace && status == "queued" {
+			if neededBytes > available {
+				held = append(held, heldTransfer{id: id, size: neededBytes, available: available})
+				continue
+			}
+			available -= neededBytes
+		}
+
 		transfer := map[string]interface{}{
 			"id":                    id,
 			"torrent_id":            torrentID,
@@ -1618,18 +2390,23 @@ func (s *Server) handlePendingTransfers(w http.ResponseWriter, r *http.Request)
 			"package_name":          packageName,
 			"destination_server_id": destServerID,
 			"priority":              priority,
+			"status":                status,
 			"total_size_bytes":      totalSizeBytes,
+			"storage_reserve_bytes": reserve,
 			"torrent_file_url":      fmt.Sprintf("/api/v1/torrents/%s/file", infoHash),
 		}
 		if sourceServerID.Valid {
 			transfer["source_server_id"] = sourceServerID.String
 		}
+		if len(localAssets) > 0 {
+			transfer["local_assets"] = localAssets
+		}
 
 		transfers = append(transfers, transfer)
 	}
-
-	log.Printf("[pending-transfers] Returning %d transfer(s) for server %s", len(transfers), serverID)
-	respondJSON(w, http.StatusOK, transfers)
+	rows.Close()
+	s.updateHeldTransfers(held)
+	return transfers, nil
 }
 
 // handleTransferCommands returns pending commands (pause, resume, cancel) for a server's transfers.
@@ -1642,6 +2419,16 @@ func (s *Server) handleTransferCommands(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	items, err := s.transferCommands(serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, items)
+}
+
+// transferCommands returns the transfer commands a server has not acknowledged yet
+func (s *Server) transferCommands(serverID uuid.UUID) ([]map[string]interface{}, error) {
 	rows, err := s.database.Query(`
 		SELECT t.id, COALESCE(dt.info_hash, '') as info_hash,
 		       COALESCE(dp.package_name, '') as package_name,
@@ -1656,8 +2443,7 @@ func (s *Server) handleTransferCommands(w http.ResponseWriter, r *http.Request)
 		  AND COALESCE(t.command_acknowledged, true) = false
 	`, serverID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -1680,7 +2466,7 @@ func (s *Server) handleTransferCommands(w http.ResponseWriter, r *http.Request)
 	if items == nil {
 		items = []map[string]interface{}{}
 	}
-	respondJSON(w, http.StatusOK, items)
+	return items, nil
 }
 
 // handleTransferCommandAck marks a command as acknowledged by the client
@@ -1702,18 +2488,26 @@ func (s *Server) handleTransferCommandAck(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, err = s.database.Exec(`
+	if err := s.acknowledgeTransferCommand(serverID, req.TransferID, req.Result, req.Message); err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "acknowledged"})
+}
+
+// acknowledgeTransferCommand records that a server has executed the pending command of a transfer
+func (s *Server) acknowledgeTransferCommand(serverID uuid.UUID, transferID, result, message string) error {
+	_, err := s.database.Exec(`
 		UPDATE transfers SET command_acknowledged = true, pending_command = '', updated_at = $1
 		WHERE id = $2 AND destination_server_id = $3
-	`, time.Now(), req.TransferID, serverID)
+	`, time.Now(), transferID, serverID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
-		return
+		return err
 	}
 
 	log.Printf("[command-ack] Server %s acknowledged command for transfer %s: %s (%s)",
-		serverID, req.TransferID, req.Result, req.Message)
-	respondJSON(w, http.StatusOK, map[string]string{"message": "acknowledged"})
+		serverID, transferID, result, message)
+	return nil
 }
 
 // handleContentCommands returns pending content commands for a server (client polls this)
@@ -1725,22 +2519,32 @@ func (s *Server) handleContentCommands(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	items, err := s.contentCommands(serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, items)
+}
+
+// contentCommands returns the content commands a server has not executed yet, oldest first
+func (s *Server) contentCommands(serverID uuid.UUID) ([]map[string]interface{}, error) {
 	rows, err := s.db.Query(`
-		SELECT id, package_id, package_name, info_hash, command, COALESCE(target_path, '')
+		SELECT id, package_id, package_name, info_hash, command, COALESCE(target_path, ''), COALESCE(purge, false)
 		FROM content_commands
 		WHERE server_id = $1 AND status = 'pending'
 		ORDER BY created_at ASC
 	`, serverID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var items []map[string]interface{}
 	for rows.Next() {
 		var id, packageID, packageName, infoHash, command, targetPath string
-		if err := rows.Scan(&id, &packageID, &packageName, &infoHash, &command, &targetPath); err != nil {
+		var purge bool
+		if err := rows.Scan(&id, &packageID, &packageName, &infoHash, &command, &targetPath, &purge); err != nil {
 			continue
 		}
 		items = append(items, map[string]interface{}{
@@ -1750,12 +2554,13 @@ func (s *Server) handleContentCommands(w http.ResponseWriter, r *http.Request) {
 			"info_hash":    infoHash,
 			"command":      command,
 			"target_path":  targetPath,
+			"purge":        purge,
 		})
 	}
 	if items == nil {
 		items = []map[string]interface{}{}
 	}
-	respondJSON(w, http.StatusOK, items)
+	return items, nil
 }
 
 // handleContentCommandAck acknowledges a content command from the client
@@ -1769,7 +2574,7 @@ func (s *Server) handleContentCommandAck(w http.ResponseWriter, r *http.Request)
 
 	var req struct {
 		CommandID string `json:"command_id"`
-		Result    string `json:"result"`  // "deleted", "error"
+		Result    string `json:"result"`  // "quarantined", "deleted", "error"
 		Message   string `json:"message"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1777,26 +2582,52 @@ func (s *Server) handleContentCommandAck(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := s.acknowledgeContentCommand(serverID, req.CommandID, req.Result, req.Message); err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "acknowledged"})
+}
+
+// acknowledgeContentCommand records the result of a content command a server has executed and
+// updates its inventory and the reclamation plan the command belongs to
+func (s *Server) acknowledgeContentCommand(serverID uuid.UUID, commandID, result, message string) error {
 	now := time.Now()
 	status := "completed"
-	if req.Result == "error" {
+	if result == "error" {
 		status = "error"
 	}
 
-	_, err = s.db.Exec(`
+	_, err := s.db.Exec(`
 		UPDATE content_commands SET status = $1, result_message = $2, acknowledged_at = $3
 		WHERE id = $4 AND server_id = $5
-	`, status, req.Message, now, req.CommandID, serverID)
+	`, status, message, now, commandID, serverID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
-		return
+		return err
+	}
+
+	// Commands executing a reclamation plan report back to it
+	if id, err := uuid.Parse(commandID); err == nil {
+		if err := s.database.CompleteReclamationCommand(id, status, message); err != nil {
+			log.Printf("[content-cmd-ack] Warning: failed to update reclamation plan for command %s: %v", commandID, err)
+		}
 	}
 
-	// If successfully deleted, remove from server_dcp_inventory
-	if req.Result == "deleted" {
+	// If successfully deleted, remove from server_dcp_inventory (or mark it quarantined until purged)
+	if result == "deleted" || result == "quarantined" {
 		var packageID string
-		err := s.db.QueryRow("SELECT package_id FROM content_commands WHERE id = $1", req.CommandID).Scan(&packageID)
-		if err == nil {
+		err := s.db.QueryRow("SELECT package_id FROM content_commands WHERE id = $1", commandID).Scan(&packageID)
+		if err == nil && result == "quarantined" {
+			_, err = s.db.Exec(`
+				UPDATE server_dcp_inventory SET status = 'quarantined', quarantined_at = $3, updated_at = $3
+				WHERE server_id = $1 AND package_id = $2
+			`, serverID, packageID, now)
+			if err != nil {
+				log.Printf("[content-cmd-ack] Warning: failed to update inventory for server=%s package=%s: %v", serverID, packageID, err)
+			} else {
+				log.Printf("[content-cmd-ack] Marked inventory entry quarantined for server=%s package=%s", serverID, packageID)
+			}
+		} else if err == nil {
 			_, err = s.db.Exec("DELETE FROM server_dcp_inventory WHERE server_id = $1 AND package_id = $2", serverID, packageID)
 			if err != nil {
 				log.Printf("[content-cmd-ack] Warning: failed to remove inventory for server=%s package=%s: %v", serverID, packageID, err)
@@ -1806,8 +2637,8 @@ func (s *Server) handleContentCommandAck(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	log.Printf("[content-cmd-ack] Server %s acknowledged content command %s: %s (%s)", serverID, req.CommandID, req.Result, req.Message)
-	respondJSON(w, http.StatusOK, map[string]string{"message": "acknowledged"})
+	log.Printf("[content-cmd-ack] Server %s acknowledged content command %s: %s (%s)", serverID, commandID, result, message)
+	return nil
 }
 
 // handleActionDone clears the pending action after the agent has completed restart or upgrade
@@ -1849,13 +2680,14 @@ func (s *Server) handleActionDone(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleScanTrigger starts a full library scan on this server (called by Rescan UI or by main server proxying to this site)
+// handleScanTrigger starts a library scan on this server (called by Rescan UI or by main server proxying to this site).
+// Unchanged packages are skipped unless ?full=true is given.
 func (s *Server) handleScanTrigger(w http.ResponseWriter, r *http.Request) {
 	if s.triggerScan == nil {
 		respondError(w, http.StatusNotImplemented, "Scan trigger not configured", "")
 		return
 	}
-	go s.triggerScan()
+	go s.triggerScan(r.URL.Query().Get("full") == "true")
 	respondJSON(w, http.StatusAccepted, map[string]string{"message": "Scan started"})
 }
 
@@ -1891,11 +2723,16 @@ func (s *Server) handleScanStatus(w http.ResponseWriter, r *http.Request) {
 		"packages_added":    logEntry.PackagesAdded,
 		"packages_updated":  logEntry.PackagesUpdated,
 		"packages_removed": logEntry.PackagesRemoved,
+		"signatures_checked": logEntry.SignaturesChecked,
+		"signatures_invalid": logEntry.SignaturesInvalid,
+		"packages_skipped":   logEntry.PackagesSkipped,
+		"packages_changed":   logEntry.PackagesChanged,
 		"errors":           logEntry.Errors,
 	})
 }
 
-// handleRescanServer triggers a full library rescan on a server (this server or a remote site)
+// handleRescanServer triggers a library rescan on a server (this server or a remote site).
+// ?full=true re-indexes every package instead of only changed ones.
 func (s *Server) handleRescanServer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	serverID, err := uuid.Parse(vars["id"])
@@ -1903,48 +2740,76 @@ func (s *Server) handleRescanServer(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
 		return
 	}
+	full := r.URL.Query().Get("full") == "true"
+	remote, err := s.rescanServer(r.Context(), serverID, full)
+	if err != nil {
+		if re, ok := err.(*rescanError); ok {
+			respondError(w, re.status, re.title, re.detail)
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to start rescan", err.Error())
+		}
+		return
+	}
+	s.logActivity(r, "server.rescan", "servers", "server", vars["id"], "", "", "success")
+	if remote {
+		respondJSON(w, http.StatusAccepted, map[string]string{"message": "Rescan started on remote server"})
+		return
+	}
+	respondJSON(w, http.StatusAccepted, map[string]string{"message": "Rescan started"})
+}
+
+// rescanError is why a rescan could not be started, with the HTTP status to answer with
+type rescanError struct {
+	status        int
+	title, detail string
+}
+
+func (e *rescanError) Error() string {
+	if e.detail == "" {
+		return e.title
+	}
+	return e.title + ": " + e.detail
+}
+
+// rescanServer starts a library rescan on this server or, through its API, on a remote one.
+// Reports whether the server was remote.
+func (s *Server) rescanServer(ctx context.Context, serverID uuid.UUID, full bool) (bool, error) {
 	// If targeting this server, trigger locally
 	if s.selfServerID != nil && serverID == *s.selfServerID {
 		if s.triggerScan == nil {
-			respondError(w, http.StatusNotImplemented, "Scan trigger not configured", "")
-			return
+			return false, &rescanError{http.StatusNotImplemented, "Scan trigger not configured", ""}
 		}
-		go s.triggerScan()
-		s.logActivity(r, "server.rescan", "servers", "server", vars["id"], "", "", "success")
-		respondJSON(w, http.StatusAccepted, map[string]string{"message": "Rescan started"})
-		return
+		go s.triggerScan(full)
+		return false, nil
 	}
 	// Otherwise call the remote server's API
 	server, err := s.database.GetServer(serverID)
 	if err != nil || server == nil {
-		respondError(w, http.StatusNotFound, "Server not found", "")
-		return
+		return true, &rescanError{http.StatusNotFound, "Server not found", ""}
 	}
 	if server.APIURL == "" {
-		respondError(w, http.StatusBadRequest, "Server has no API URL", "")
-		return
+		return true, &rescanError{http.StatusBadRequest, "Server has no API URL", ""}
 	}
 	url := strings.TrimSuffix(server.APIURL, "/") + "/api/v1/scan/trigger"
-	req, err := http.NewRequestWithContext(r.Context(), "POST", url, nil)
+	if full {
+		url += "?full=true"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create request", err.Error())
-		return
+		return true, &rescanError{http.StatusInternalServerError, "Failed to create request", err.Error()}
 	}
 	req.Header.Set("Content-Type", "application/json")
 	client := &http.Client{Timeout: 15 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		respondError(w, http.StatusBadGateway, "Failed to reach server", err.Error())
-		return
+		return true, &rescanError{http.StatusBadGateway, "Failed to reach server", err.Error()}
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		respondError(w, resp.StatusCode, "Server returned error", string(body))
-		return
+		return true, &rescanError{resp.StatusCode, "Server returned error", string(body)}
 	}
-	s.logActivity(r, "server.rescan", "servers", "server", vars["id"], "", "", "success")
-	respondJSON(w, http.StatusAccepted, map[string]string{"message": "Rescan started on remote server"})
+	return true, nil
 }
 
 // handleServerScanStatus returns the current scan status for a server (this server or remote)
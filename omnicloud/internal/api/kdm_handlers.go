@@ -0,0 +1,399 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// maxKDMSize bounds uploaded KDM documents; real KDMs are a few tens of KB
+const maxKDMSize = 1 << 20
+
+// defaultKDMExpiryWindow is how far ahead GET /servers/{id}/kdm-report looks for expiring KDMs
+const defaultKDMExpiryWindow = 7 * 24 * time.Hour
+
+// KDM coverage states: whether the KeyIdList carries every KeyId of the CPL
+const (
+	KDMCoverageComplete   = "complete"
+	KDMCoverageIncomplete = "incomplete"
+	KDMCoverageUnknownCPL = "unknown_cpl" // the CPL is not indexed (or not encrypted), coverage cannot be checked
+)
+
+// KDMReport is a KDM found in a client's library, sent to the main server for parsing and storage
+type KDMReport struct {
+	SourcePath string `json:"source_path"`
+	XML        string `json:"xml"`
+}
+
+// NewKDMRecord parses KDM XML into the database records for the KDM and its KeyIdList.
+// The KDM is not linked to a server; callers set ServerID.
+func NewKDMRecord(data []byte, sourcePath string) (*db.KDM, []*db.KDMKey, error) {
+	kdm, err := parser.ParseKDMData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messageID, err := uuid.Parse(kdm.MessageID())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid KDM MessageId: %w", err)
+	}
+	cplUUID, err := uuid.Parse(kdm.CPLID())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid KDM CompositionPlaylistId: %w", err)
+	}
+	notBefore, notAfter, err := kdm.ValidityWindow()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var issueDate *time.Time
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(kdm.AuthenticatedPublic.IssueDate)); err == nil {
+		issueDate = &t
+	}
+
+	ext := kdm.Extensions()
+	now := time.Now()
+	record := &db.KDM{
+		ID:                  uuid.New(),
+		MessageID:           messageID,
+		CPLUUID:             cplUUID,
+		ContentTitleText:    strings.TrimSpace(ext.ContentTitleText),
+		AnnotationText:      strings.TrimSpace(kdm.AuthenticatedPublic.AnnotationText),
+		Standard:            string(kdm.Standard),
+		IssueDate:           issueDate,
+		SignerIssuer:        strings.TrimSpace(kdm.AuthenticatedPublic.Signer.IssuerName),
+		RecipientSubject:    strings.TrimSpace(ext.Recipient.X509SubjectName),
+		RecipientThumbprint: kdm.RecipientThumbprint(),
+		RecipientSerial:     strings.TrimSpace(ext.Recipient.X509IssuerSerial.SerialNumber),
+		DeviceThumbprints:   strings.Join(ext.AuthorizedDeviceInfo.DeviceList.CertificateThumbprints, ","),
+		NotValidBefore:      notBefore,
+		NotValidAfter:       notAfter,
+		SourcePath:          sourcePath,
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+
+	var keys []*db.KDMKey
+	for _, k := range kdm.KeyIDs() {
+		keyID, err := uuid.Parse(k.KeyID)
+		if err != nil {
+			log.Printf("[kdm] Skipping invalid KeyId %q in KDM %s", k.KeyID, messageID)
+			continue
+		}
+		keys = append(keys, &db.KDMKey{
+			ID:      uuid.New(),
+			KDMID:   record.ID,
+			KeyID:   keyID,
+			KeyType: k.KeyType,
+		})
+	}
+
+	return record, keys, nil
+}
+
+// handleUploadKDM ingests a KDM posted as raw XML. ?server_id= links it to the server it is for.
+func (s *Server) handleUploadKDM(w http.ResponseWriter, r *http.Request) {
+	var serverID *uuid.UUID
+	if raw := r.URL.Query().Get("server_id"); raw != "" {
+		sid, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+			return
+		}
+		serverID = &sid
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxKDMSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to read request body", err.Error())
+		return
+	}
+
+	kdm, keys, err := NewKDMRecord(data, "")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid KDM", err.Error())
+		return
+	}
+	kdm.ServerID = serverID
+
+	if err := s.database.UpsertKDM(kdm, keys); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to store KDM", err.Error())
+		return
+	}
+
+	s.logActivity(r, "kdm.upload", "kdms", "kdm", kdm.ID.String(), kdm.ContentTitleText, "", "success")
+	respondJSON(w, http.StatusCreated, s.kdmDetails(kdm, time.Now()))
+}
+
+// handleReportKDM stores a KDM a client found in its library; the KDM is linked to that server
+func (s *Server) handleReportKDM(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	var report KDMReport
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*maxKDMSize)).Decode(&report); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	kdm, keys, err := NewKDMRecord([]byte(report.XML), report.SourcePath)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid KDM", err.Error())
+		return
+	}
+	kdm.ServerID = &serverID
+
+	if err := s.database.UpsertKDM(kdm, keys); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to store KDM", err.Error())
+		return
+	}
+
+	log.Printf("[kdm] Stored KDM %s for %s from server %s (valid %s to %s)",
+		kdm.MessageID, kdm.ContentTitleText, serverID,
+		kdm.NotValidBefore.Format(time.RFC3339), kdm.NotValidAfter.Format(time.RFC3339))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      kdm.ID,
+		"message": "KDM stored",
+	})
+}
+
+// handleListKDMs lists KDMs, optionally filtered by ?server_id= and ?cpl_uuid=
+func (s *Server) handleListKDMs(w http.ResponseWriter, r *http.Request) {
+	var serverID, cplUUID *uuid.UUID
+	if raw := r.URL.Query().Get("server_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+			return
+		}
+		serverID = &id
+	}
+	if raw := r.URL.Query().Get("cpl_uuid"); raw != "" {
+		id, err := uuid.Parse(parser.ExtractUUID(raw))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid CPL UUID", err.Error())
+			return
+		}
+		cplUUID = &id
+	}
+
+	kdms, err := s.database.ListKDMs(serverID, cplUUID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query KDMs", err.Error())
+		return
+	}
+
+	now := time.Now()
+	list := []map[string]interface{}{}
+	for _, k := range kdms {
+		list = append(list, s.kdmDetails(k, now))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"kdms":  list,
+		"total": len(list),
+	})
+}
+
+// handleGetKDM returns a KDM with its KeyIdList, key window state and CPL coverage
+func (s *Server) handleGetKDM(w http.ResponseWriter, r *http.Request) {
+	kdm, ok := s.lookupKDM(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := s.database.GetKDMKeys(kdm.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query KDM keys", err.Error())
+		return
+	}
+	keyList := []map[string]interface{}{}
+	for _, k := range keys {
+		keyList = append(keyList, map[string]interface{}{
+			"key_id":   k.KeyID,
+			"key_type": k.KeyType,
+		})
+	}
+
+	resp := s.kdmDetails(kdm, time.Now())
+	resp["keys"] = keyList
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteKDM removes a KDM
+func (s *Server) handleDeleteKDM(w http.ResponseWriter, r *http.Request) {
+	kdm, ok := s.lookupKDM(w, r)
+	if !ok {
+		return
+	}
+	if err := s.database.DeleteKDM(kdm.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete KDM", err.Error())
+		return
+	}
+	s.logActivity(r, "kdm.delete", "kdms", "kdm", kdm.ID.String(), kdm.ContentTitleText, "", "success")
+	respondJSON(w, http.StatusOK, map[string]string{"message": "KDM deleted"})
+}
+
+func (s *Server) lookupKDM(w http.ResponseWriter, r *http.Request) (*db.KDM, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid KDM ID", err.Error())
+		return nil, false
+	}
+	kdm, err := s.database.GetKDM(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query KDM", err.Error())
+		return nil, false
+	}
+	if kdm == nil {
+		respondError(w, http.StatusNotFound, "KDM not found", "")
+		return nil, false
+	}
+	return kdm, true
+}
+
+// handleGetServerKDMReport reports a server's KDMs that expire within ?days= (default 7) and the
+// encrypted compositions it holds without a usable KDM
+func (s *Server) handleGetServerKDMReport(w http.ResponseWriter, r *http.Request) {
+	serverID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	window := defaultKDMExpiryWindow
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days < 0 {
+			respondError(w, http.StatusBadRequest, "Invalid days", "days must be a non-negative integer")
+			return
+		}
+		window = time.Duration(days) * 24 * time.Hour
+	}
+
+	now := time.Now()
+	expiring, err := s.database.GetExpiringKDMs(serverID, now.Add(window))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query expiring KDMs", err.Error())
+		return
+	}
+	missing, err := s.database.GetMissingKDMs(serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query missing KDMs", err.Error())
+		return
+	}
+
+	expiringList := []map[string]interface{}{}
+	for _, k := range expiring {
+		entry := s.kdmDetails(k, now)
+		entry["expires_in_hours"] = int(k.NotValidAfter.Sub(now).Hours())
+		expiringList = append(expiringList, entry)
+	}
+
+	missingList := []map[string]interface{}{}
+	for _, m := range missing {
+		missingList = append(missingList, map[string]interface{}{
+			"composition_id":     m.CompositionID,
+			"cpl_uuid":           m.CPLUUID,
+			"content_title_text": m.ContentTitleText,
+			"package_id":         m.PackageID,
+			"package_name":       m.PackageName,
+			"key_count":          m.KeyCount,
+			"last_expired":       m.LastExpired,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id":    serverID,
+		"window_hours": int(window.Hours()),
+		"expiring":     expiringList,
+		"missing":      missingList,
+	})
+}
+
+// kdmDetails builds the API view of a KDM: metadata, key window state at now and whether its
+// KeyIdList covers every KeyId of the CPL. Lookup failures are logged and leave coverage unknown.
+func (s *Server) kdmDetails(k *db.KDM, now time.Time) map[string]interface{} {
+	var devices []string
+	if k.DeviceThumbprints != "" {
+		devices = strings.Split(k.DeviceThumbprints, ",")
+	}
+
+	details := map[string]interface{}{
+		"id":                   k.ID,
+		"message_id":           k.MessageID,
+		"cpl_uuid":             k.CPLUUID,
+		"content_title_text":   k.ContentTitleText,
+		"annotation_text":      k.AnnotationText,
+		"standard":             k.Standard,
+		"issue_date":           k.IssueDate,
+		"signer_issuer":        k.SignerIssuer,
+		"recipient_subject":    k.RecipientSubject,
+		"recipient_thumbprint": k.RecipientThumbprint,
+		"device_thumbprints":   devices,
+		"not_valid_before":     k.NotValidBefore,
+		"not_valid_after":      k.NotValidAfter,
+		"status":               k.WindowStatus(now),
+		"server_id":            k.ServerID,
+		"source_path":          k.SourcePath,
+	}
+
+	coverage := KDMCoverageUnknownCPL
+	missingKeys := []map[string]interface{}{}
+	cplKeys, err := s.database.GetDCPCompositionKeysByCPLUUID(k.CPLUUID)
+	if err != nil {
+		log.Printf("Error loading CPL keys for KDM %s: %v", k.ID, err)
+	}
+	if len(cplKeys) > 0 {
+		kdmKeys, err := s.database.GetKDMKeys(k.ID)
+		if err != nil {
+			log.Printf("Error loading keys of KDM %s: %v", k.ID, err)
+		}
+		have := make(map[uuid.UUID]bool, len(kdmKeys))
+		for _, kk := range kdmKeys {
+			have[kk.KeyID] = true
+		}
+		coverage = KDMCoverageComplete
+		for _, ck := range cplKeys {
+			if !have[ck.KeyID] {
+				coverage = KDMCoverageIncomplete
+				missingKeys = append(missingKeys, map[string]interface{}{
+					"key_id":      ck.KeyID,
+					"kind":        ck.KeyKind,
+					"reel_number": ck.ReelNumber,
+				})
+			}
+		}
+	}
+	details["coverage"] = coverage
+	details["missing_keys"] = missingKeys
+
+	serverList := []map[string]interface{}{}
+	servers, err := s.database.GetKDMServers(k.ID)
+	if err != nil {
+		log.Printf("Error loading servers of KDM %s: %v", k.ID, err)
+	}
+	for _, ks := range servers {
+		serverList = append(serverList, map[string]interface{}{
+			"server_id":   ks.ServerID,
+			"source_path": ks.SourcePath,
+		})
+	}
+	details["servers"] = serverList
+
+	return details
+}
@@ -0,0 +1,571 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+	ws "github.com/omnicloud/omnicloud/internal/websocket"
+)
+
+// reclamationInterval is how often the active reclamation policies are evaluated
+const reclamationInterval = time.Hour
+
+// reclamationPolicyRequest is the body of POST and PUT /reclamation/policies. Fields left out keep
+// their current value, or the default for a new policy.
+type reclamationPolicyRequest struct {
+	Name                      *string      `json:"name"`
+	IsActive                  *bool        `json:"is_active"`
+	ServerIDs                 *[]uuid.UUID `json:"server_ids"`
+	MinFleetCopies            *int         `json:"min_fleet_copies"`
+	MinAgeDays                *int         `json:"min_age_days"`
+	FreeSpaceThresholdPercent *float64     `json:"free_space_threshold_percent"`
+	TargetFreePercent         *float64     `json:"target_free_percent"`
+}
+
+// apply copies the fields that were sent onto a policy and checks the result
+func (req *reclamationPolicyRequest) apply(p *db.ReclamationPolicy) error {
+	if req.Name != nil {
+		p.Name = *req.Name
+	}
+	if req.IsActive != nil {
+		p.IsActive = *req.IsActive
+	}
+	if req.ServerIDs != nil {
+		p.ServerIDs = *req.ServerIDs
+	}
+	if req.MinFleetCopies != nil {
+		p.MinFleetCopies = *req.MinFleetCopies
+	}
+	if req.MinAgeDays != nil {
+		p.MinAgeDays = *req.MinAgeDays
+	}
+	if req.FreeSpaceThresholdPercent != nil {
+		p.FreeSpaceThresholdPercent = *req.FreeSpaceThresholdPercent
+	}
+	if req.TargetFreePercent != nil {
+		p.TargetFreePercent = *req.TargetFreePercent
+	}
+
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("name is required")
+	case p.MinFleetCopies < 1:
+		return fmt.Errorf("min_fleet_copies must be at least 1")
+	case p.MinAgeDays < 0:
+		return fmt.Errorf("min_age_days must not be negative")
+	case p.FreeSpaceThresholdPercent <= 0 || p.FreeSpaceThresholdPercent > 100:
+		return fmt.Errorf("free_space_threshold_percent must be between 0 and 100")
+	case p.TargetFreePercent < p.FreeSpaceThresholdPercent || p.TargetFreePercent > 100:
+		return fmt.Errorf("target_free_percent must be between free_space_threshold_percent and 100")
+	}
+	return nil
+}
+
+// handleListReclamationPolicies lists the reclamation policies
+func (s *Server) handleListReclamationPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.database.ListReclamationPolicies()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation policies", err.Error())
+		return
+	}
+	list := []map[string]interface{}{}
+	for _, p := range policies {
+		list = append(list, reclamationPolicyDetails(p))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"policies": list,
+		"total":    len(list),
+	})
+}
+
+// handleCreateReclamationPolicy creates a reclamation policy
+func (s *Server) handleCreateReclamationPolicy(w http.ResponseWriter, r *http.Request) {
+	var req reclamationPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	policy := &db.ReclamationPolicy{
+		IsActive:                  true,
+		MinFleetCopies:            2,
+		MinAgeDays:                60,
+		FreeSpaceThresholdPercent: 15,
+		TargetFreePercent:         20,
+	}
+	if err := req.apply(policy); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid policy", err.Error())
+		return
+	}
+	if err := s.database.CreateReclamationPolicy(policy); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create reclamation policy", err.Error())
+		return
+	}
+
+	s.logActivity(r, "reclamation.policy_create", "content", "reclamation_policy", policy.ID.String(), policy.Name, "", "success")
+	respondJSON(w, http.StatusCreated, reclamationPolicyDetails(policy))
+}
+
+// handleUpdateReclamationPolicy changes the settings of a reclamation policy
+func (s *Server) handleUpdateReclamationPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, ok := s.lookupReclamationPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	var req reclamationPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.apply(policy); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid policy", err.Error())
+		return
+	}
+	if err := s.database.UpdateReclamationPolicy(policy); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update reclamation policy", err.Error())
+		return
+	}
+
+	s.logActivity(r, "reclamation.policy_update", "content", "reclamation_policy", policy.ID.String(), policy.Name, "", "success")
+	respondJSON(w, http.StatusOK, reclamationPolicyDetails(policy))
+}
+
+// handleDeleteReclamationPolicy removes a reclamation policy. Its plans are kept.
+func (s *Server) handleDeleteReclamationPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, ok := s.lookupReclamationPolicy(w, r)
+	if !ok {
+		return
+	}
+	if err := s.database.DeleteReclamationPolicy(policy.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete reclamation policy", err.Error())
+		return
+	}
+	s.logActivity(r, "reclamation.policy_delete", "content", "reclamation_policy", policy.ID.String(), policy.Name, "", "success")
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Reclamation policy deleted"})
+}
+
+func (s *Server) lookupReclamationPolicy(w http.ResponseWriter, r *http.Request) (*db.ReclamationPolicy, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid policy ID", err.Error())
+		return nil, false
+	}
+	policy, err := s.database.GetReclamationPolicy(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation policy", err.Error())
+		return nil, false
+	}
+	if policy == nil {
+		respondError(w, http.StatusNotFound, "Reclamation policy not found", "")
+		return nil, false
+	}
+	return policy, true
+}
+
+// handleEvaluateReclamation evaluates the active policies right away and returns the plans proposed
+func (s *Server) handleEvaluateReclamation(w http.ResponseWriter, r *http.Request) {
+	plans, err := s.evaluateReclamationPolicies()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to evaluate reclamation policies", err.Error())
+		return
+	}
+	list := []map[string]interface{}{}
+	for _, p := range plans {
+		list = append(list, reclamationPlanDetails(p))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"plans": list,
+		"total": len(list),
+	})
+}
+
+// handleListReclamationPlans lists reclamation plans, optionally filtered by ?status= and ?server_id=
+func (s *Server) handleListReclamationPlans(w http.ResponseWriter, r *http.Request) {
+	var serverID *uuid.UUID
+	if raw := r.URL.Query().Get("server_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+			return
+		}
+		serverID = &id
+	}
+
+	plans, err := s.database.ListReclamationPlans(r.URL.Query().Get("status"), serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation plans", err.Error())
+		return
+	}
+	list := []map[string]interface{}{}
+	for _, p := range plans {
+		list = append(list, reclamationPlanDetails(p))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"plans": list,
+		"total": len(list),
+	})
+}
+
+// handleGetReclamationPlan returns a reclamation plan with the packages it deletes
+func (s *Server) handleGetReclamationPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.lookupReclamationPlan(w, r)
+	if !ok {
+		return
+	}
+	resp, err := s.reclamationPlanWithItems(plan)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation plan items", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleApproveReclamationPlan approves a proposed plan and executes it: every package that still
+// leaves enough copies in the fleet is sent a delete content command
+func (s *Server) handleApproveReclamationPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.lookupReclamationPlan(w, r)
+	if !ok {
+		return
+	}
+	_, username := s.requestUser(r)
+	approved, err := s.database.ReviewReclamationPlan(plan.ID, db.ReclamationPlanExecuting, username)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to approve reclamation plan", err.Error())
+		return
+	}
+	if !approved {
+		respondError(w, http.StatusConflict, "Reclamation plan is not proposed", "status is "+plan.Status)
+		return
+	}
+
+	if err := s.executeReclamationPlan(plan); err != nil {
+		log.Printf("[reclamation] Error executing plan %s: %v", plan.ID, err)
+		s.logActivity(r, "reclamation.plan_approve", "content", "reclamation_plan", plan.ID.String(), "", err.Error(), "failure")
+		respondError(w, http.StatusInternalServerError, "Failed to execute reclamation plan", err.Error())
+		return
+	}
+	s.logActivity(r, "reclamation.plan_approve", "content", "reclamation_plan", plan.ID.String(), "", "", "success")
+
+	if plan, err = s.database.GetReclamationPlan(plan.ID); err != nil || plan == nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation plan", fmt.Sprint(err))
+		return
+	}
+	resp, err := s.reclamationPlanWithItems(plan)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation plan items", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleRejectReclamationPlan rejects a proposed plan; the policy may propose a new one later
+func (s *Server) handleRejectReclamationPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.lookupReclamationPlan(w, r)
+	if !ok {
+		return
+	}
+	_, username := s.requestUser(r)
+	rejected, err := s.database.ReviewReclamationPlan(plan.ID, db.ReclamationPlanRejected, username)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to reject reclamation plan", err.Error())
+		return
+	}
+	if !rejected {
+		respondError(w, http.StatusConflict, "Reclamation plan is not proposed", "status is "+plan.Status)
+		return
+	}
+	s.logActivity(r, "reclamation.plan_reject", "content", "reclamation_plan", plan.ID.String(), "", "", "success")
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Reclamation plan rejected"})
+}
+
+func (s *Server) lookupReclamationPlan(w http.ResponseWriter, r *http.Request) (*db.ReclamationPlan, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid plan ID", err.Error())
+		return nil, false
+	}
+	plan, err := s.database.GetReclamationPlan(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query reclamation plan", err.Error())
+		return nil, false
+	}
+	if plan == nil {
+		respondError(w, http.StatusNotFound, "Reclamation plan not found", "")
+		return nil, false
+	}
+	return plan, true
+}
+
+// RunReclamation evaluates the active reclamation policies every reclamationInterval until ctx
+// is done (main server only)
+func (s *Server) RunReclamation(ctx context.Context) {
+	ticker := time.NewTicker(reclamationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.evaluateReclamationPolicies(); err != nil {
+				log.Printf("[reclamation] Error evaluating policies: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evaluateReclamationPolicies proposes a plan for every server an active policy applies to whose
+// library locations have dropped below the policy's free space threshold. Servers with a plan
+// waiting for review or executing are left alone; the first policy that applies to a server wins.
+func (s *Server) evaluateReclamationPolicies() ([]*db.ReclamationPlan, error) {
+	policies, err := s.database.ListReclamationPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []*db.ReclamationPlan
+	evaluated := make(map[uuid.UUID]bool)
+	for _, policy := range policies {
+		if !policy.IsActive {
+			continue
+		}
+		serverIDs := policy.ServerIDs
+		if len(serverIDs) == 0 {
+			if serverIDs, err = s.reclamationServers(); err != nil {
+				return plans, err
+			}
+		}
+		for _, serverID := range serverIDs {
+			if evaluated[serverID] {
+				continue
+			}
+			evaluated[serverID] = true
+
+			plan, err := s.proposeReclamationPlan(policy, serverID)
+			if err != nil {
+				log.Printf("[reclamation] Error evaluating policy %q for server %s: %v", policy.Name, serverID, err)
+				continue
+			}
+			if plan != nil {
+				plans = append(plans, plan)
+			}
+		}
+	}
+	return plans, nil
+}
+
+// reclamationServers returns the authorized servers other than the main one
+func (s *Server) reclamationServers() ([]uuid.UUID, error) {
+	rows, err := s.db.Query(`SELECT id FROM servers WHERE is_authorized = true`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if s.selfServerID == nil || id != *s.selfServerID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// proposeReclamationPlan stores a plan deleting the oldest eligible packages of a server until the
+// policy's target free space is reached, or returns nil when the server does not need one
+func (s *Server) proposeReclamationPlan(policy *db.ReclamationPolicy, serverID uuid.UUID) (*db.ReclamationPlan, error) {
+	open, err := s.database.HasOpenReclamationPlan(serverID)
+	if err != nil || open {
+		return nil, err
+	}
+	total, free, ok, err := s.database.GetLibraryStorage(serverID)
+	if err != nil || !ok || total <= 0 {
+		return nil, err
+	}
+	freePercent := float64(free) / float64(total) * 100
+	if freePercent >= policy.FreeSpaceThresholdPercent {
+		return nil, nil
+	}
+	bytesToFree := int64(policy.TargetFreePercent/100*float64(total)) - free
+
+	arrivedBefore := time.Now().Add(-time.Duration(policy.MinAgeDays) * 24 * time.Hour)
+	candidates, err := s.database.GetReclamationCandidates(serverID, arrivedBefore, policy.MinFleetCopies)
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.ReclamationPlanItem
+	var planned int64
+	for _, c := range candidates {
+		if planned >= bytesToFree {
+			break
+		}
+		items = append(items, c)
+		planned += c.SizeBytes
+	}
+	if len(items) == 0 {
+		log.Printf("[reclamation] Server %s is %.1f%% free (policy %q wants %.1f%%) but no package can be deleted",
+			serverID, freePercent, policy.Name, policy.FreeSpaceThresholdPercent)
+		return nil, nil
+	}
+
+	policyID := policy.ID
+	plan := &db.ReclamationPlan{
+		PolicyID:       &policyID,
+		ServerID:       serverID,
+		Status:         db.ReclamationPlanProposed,
+		MinFleetCopies: policy.MinFleetCopies,
+		TotalBytes:     total,
+		FreeBytes:      free,
+		BytesToFree:    bytesToFree,
+	}
+	if err := s.database.CreateReclamationPlan(plan, items); err != nil {
+		return nil, err
+	}
+	log.Printf("[reclamation] Proposed plan %s for server %s: %d package(s), %s of %s to free (policy %q)",
+		plan.ID, serverID, len(items), ws.FormatBytes(planned), ws.FormatBytes(bytesToFree), policy.Name)
+	return plan, nil
+}
+
+// executeReclamationPlan queues a delete content command for every pending package of an approved
+// plan. Packages that would leave fewer than the plan's minimum copies in the fleet, or that the
+// server no longer holds, are skipped.
+func (s *Server) executeReclamationPlan(plan *db.ReclamationPlan) error {
+	items, err := s.database.GetReclamationPlanItems(plan.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.Status != "pending" {
+			continue
+		}
+
+		status, message := "queued", ""
+		var commandID *uuid.UUID
+		copies, err := s.database.CountRemainingCopies(item.PackageID)
+		switch {
+		case err != nil:
+			status, message = "error", err.Error()
+		case copies <= plan.MinFleetCopies:
+			status, message = "skipped", fmt.Sprintf("only %d copies left in the fleet", copies)
+		default:
+			var id uuid.UUID
+			id, err = s.queueReclamationDelete(plan.ServerID, item)
+			if err == sql.ErrNoRows {
+				status, message = "skipped", "no longer online on the server"
+			} else if err != nil {
+				status, message = "error", err.Error()
+			} else {
+				commandID = &id
+			}
+		}
+
+		if err := s.database.UpdateReclamationPlanItem(item.ID, status, commandID, message); err != nil {
+			return err
+		}
+		if status == "queued" {
+			log.Printf("[reclamation] Queued delete of %s on server %s (plan %s)", item.PackageName, plan.ServerID, plan.ID)
+		}
+	}
+
+	// Nothing queued (everything skipped) completes the plan right away
+	if err := s.database.FinishReclamationPlan(plan.ID); err != nil {
+		return err
+	}
+	s.dispatch(plan.ServerID)
+	return nil
+}
+
+// queueReclamationDelete creates the delete content command for a package of a plan, like
+// POST /content-commands does but purging the package instead of quarantining it, since the plan
+// is there to free space now. Returns sql.ErrNoRows when the server no longer holds the package
+// online.
+func (s *Server) queueReclamationDelete(serverID uuid.UUID, item *db.ReclamationPlanItem) (uuid.UUID, error) {
+	var commandID uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO content_commands (package_id, server_id, package_name, info_hash, command, target_path, purge)
+		SELECT i.package_id, i.server_id, $3, COALESCE((SELECT info_hash FROM dcp_torrents WHERE package_id = i.package_id LIMIT 1), ''), 'delete', '', true
+		FROM server_dcp_inventory i
+		WHERE i.server_id = $1 AND i.package_id = $2 AND i.status = 'online'
+		RETURNING id
+	`, serverID, item.PackageID, item.PackageName).Scan(&commandID)
+	return commandID, err
+}
+
+// reclamationPlanWithItems builds the API view of a plan with the packages it deletes
+func (s *Server) reclamationPlanWithItems(plan *db.ReclamationPlan) (map[string]interface{}, error) {
+	items, err := s.database.GetReclamationPlanItems(plan.ID)
+	if err != nil {
+		return nil, err
+	}
+	itemList := []map[string]interface{}{}
+	var planned int64
+	for _, item := range items {
+		planned += item.SizeBytes
+		itemList = append(itemList, map[string]interface{}{
+			"id":                 item.ID,
+			"package_id":         item.PackageID,
+			"package_name":       item.PackageName,
+			"size_bytes":         item.SizeBytes,
+			"fleet_copies":       item.FleetCopies,
+			"last_arrived_at":    item.LastArrivedAt,
+			"uploaded_bytes":     item.UploadedBytes,
+			"content_command_id": item.ContentCommandID,
+			"status":             item.Status,
+			"result_message":     item.ResultMessage,
+		})
+	}
+	resp := reclamationPlanDetails(plan)
+	resp["items"] = itemList
+	resp["planned_bytes"] = planned
+	return resp, nil
+}
+
+func reclamationPlanDetails(p *db.ReclamationPlan) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               p.ID,
+		"policy_id":        p.PolicyID,
+		"server_id":        p.ServerID,
+		"status":           p.Status,
+		"min_fleet_copies": p.MinFleetCopies,
+		"total_bytes":      p.TotalBytes,
+		"free_bytes":       p.FreeBytes,
+		"bytes_to_free":    p.BytesToFree,
+		"reviewed_by":      p.ReviewedBy,
+		"reviewed_at":      p.ReviewedAt,
+		"completed_at":     p.CompletedAt,
+		"created_at":       p.CreatedAt,
+	}
+}
+
+func reclamationPolicyDetails(p *db.ReclamationPolicy) map[string]interface{} {
+	serverIDs := p.ServerIDs
+	if serverIDs == nil {
+		serverIDs = []uuid.UUID{}
+	}
+	return map[string]interface{}{
+		"id":                           p.ID,
+		"name":                         p.Name,
+		"is_active":                    p.IsActive,
+		"server_ids":                   serverIDs,
+		"min_fleet_copies":             p.MinFleetCopies,
+		"min_age_days":                 p.MinAgeDays,
+		"free_space_threshold_percent": p.FreeSpaceThresholdPercent,
+		"target_free_percent":          p.TargetFreePercent,
+		"created_at":                   p.CreatedAt,
+		"updated_at":                   p.UpdatedAt,
+	}
+}
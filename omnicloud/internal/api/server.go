@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,8 +17,9 @@ import (
 	ws "github.com/omnicloud/omnicloud/internal/websocket"
 )
 
-// TriggerScanFunc is called to start a full library scan on this server (e.g. from Rescan in UI)
-type TriggerScanFunc func()
+// TriggerScanFunc is called to start a library scan on this server (e.g. from Rescan in UI).
+// Unless full is set, packages unchanged since the previous scan are skipped.
+type TriggerScanFunc func(full bool)
 
 // Server represents the HTTP API server
 type Server struct {
@@ -29,13 +31,18 @@ type Server struct {
 	trackerHandler  http.Handler // optional; when set, /announce is served on the same port (avoids second listener)
 	server          *http.Server
 	registrationKey string
-	selfServerID    *uuid.UUID      // when set, restart for this ID triggers local process restart
-	triggerScan     TriggerScanFunc // when set, POST /scan/trigger runs a full scan
-	wsHub           *ws.Hub         // WebSocket hub for client connections (main server only)
+	selfServerID    *uuid.UUID        // when set, restart for this ID triggers local process restart
+	triggerScan     TriggerScanFunc   // when set, POST /scan/trigger runs a scan
+	wsHub           *ws.Hub           // WebSocket hub for client connections (main server only)
+	localVerify     VerifyPackageFunc // when set, packages held by this server can be verified in-process
+	reloadLibraries func()            // when set, called after this server's library locations change
+
+	dispatchMu  sync.Mutex
+	dispatching map[uuid.UUID]bool // servers being pushed work; true = push again when done
 }
 
 // NewServer creates a new API server. selfServerID is this process's server row ID; when restart is requested for it, the process will restart itself.
-// triggerScan is optional; when set, allows HTTP-triggered full library scan (used by Rescan in UI).
+// triggerScan is optional; when set, allows HTTP-triggered library scans (used by Rescan in UI).
 // trackerPort is the BitTorrent tracker port on the main server; when non-zero, GET /torrents/:id/file rewrites the announce URL to use the request host so clients reach the tracker.
 func NewServer(database *db.DB, port int, registrationKey string, selfServerID *uuid.UUID, triggerScan TriggerScanFunc, trackerPort int) *Server {
 	s := &Server{
@@ -47,13 +54,14 @@ func NewServer(database *db.DB, port int, registrationKey string, selfServerID *
 		registrationKey: registrationKey,
 		selfServerID:    selfServerID,
 		triggerScan:     triggerScan,
+		dispatching:     make(map[uuid.UUID]bool),
 	}
 
 	s.setupRoutes()
 	return s
 }
 
-// RegisterTracker sets the BitTorrent tracker handler for /announce (route is registered in setupRoutes so it wins over the catch-all).
+// RegisterTracker sets the BitTorrent tracker handler for /announce and /scrape (route is registered in setupRoutes so it wins over the catch-all).
 // Use this on the main server to avoid binding a second port and prevent "address already in use" conflicts.
 func (s *Server) RegisterTracker(handler http.Handler) {
 	s.trackerHandler = handler
@@ -62,6 +70,14 @@ func (s *Server) RegisterTracker(handler http.Handler) {
 // RegisterWebSocketHub sets the WebSocket hub for client connections (main server only)
 func (s *Server) RegisterWebSocketHub(hub *ws.Hub) {
 	s.wsHub = hub
+	hub.SetStorageRecorder(s.recordStorageUsage)
+	hub.SetOnConnect(s.dispatch)
+}
+
+// RegisterLibraryReloader sets the function that makes this server's watcher and scanner follow
+// its library locations after they were changed through the API
+func (s *Server) RegisterLibraryReloader(reload func()) {
+	s.reloadLibraries = reload
 }
 
 // GetWebSocketHub returns the WebSocket hub
@@ -74,7 +90,7 @@ func (s *Server) setupRoutes() {
 	// CORS first so every response (including OPTIONS preflight and 404) has CORS headers
 	s.router.Use(s.corsMiddleware)
 
-	// BitTorrent tracker at /announce (must be before PathPrefix("/") so it matches first)
+	// BitTorrent tracker at /announce and /scrape (must be before PathPrefix("/") so it matches first)
 	s.router.HandleFunc("/announce", func(w http.ResponseWriter, r *http.Request) {
 		if s.trackerHandler != nil {
 			s.trackerHandler.ServeHTTP(w, r)
@@ -82,6 +98,13 @@ func (s *Server) setupRoutes() {
 			http.NotFound(w, r)
 		}
 	}).Methods("GET")
+	s.router.HandleFunc("/scrape", func(w http.ResponseWriter, r *http.Request) {
+		if s.trackerHandler != nil {
+			s.trackerHandler.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	}).Methods("GET")
 
 	// Handle CORS preflight for all paths first (so OPTIONS always gets CORS headers)
 	s.router.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -150,10 +173,24 @@ func (s *Server) setupRoutes() {
 	apiAuth.HandleFunc("/dcp-metadata", s.handleDCPMetadata).Methods("POST")
 	apiAuth.HandleFunc("/missing-torrents", s.handleMissingTorrents).Methods("GET")
 	apiAuth.HandleFunc("/canonical-xml", s.handleGetCanonicalXML).Methods("POST")
+	apiAuth.HandleFunc("/verification-result", s.handleReportVerification).Methods("POST")
+	apiAuth.HandleFunc("/kdms", s.handleReportKDM).Methods("POST")
 
 	// DCP routes
 	api.HandleFunc("/dcps", s.handleListDCPs).Methods("GET")
 	api.HandleFunc("/dcps/{uuid}", s.handleGetDCP).Methods("GET")
+	api.HandleFunc("/dcps/{uuid}/verify", s.handleVerifyDCP).Methods("POST")
+	api.HandleFunc("/dcps/{uuid}/verification", s.handleGetDCPVerification).Methods("GET")
+	api.HandleFunc("/dcps/{uuid}/validation", s.handleGetDCPValidation).Methods("GET")
+	api.HandleFunc("/dcps/{uuid}/shared-assets", s.handleGetDCPSharedAssets).Methods("GET") // MXFs servers already hold in other packages
+	api.HandleFunc("/validation/packages", s.handleListPackagesWithFindings).Methods("GET") // fleet-wide "packages with errors"
+
+	// KDMs (Key Delivery Messages): metadata, key windows and CPL coverage
+	api.HandleFunc("/kdms", s.handleListKDMs).Methods("GET")
+	api.HandleFunc("/kdms", s.handleUploadKDM).Methods("POST")
+	api.HandleFunc("/kdms/{id}", s.handleGetKDM).Methods("GET")
+	api.HandleFunc("/kdms/{id}", s.handleDeleteKDM).Methods("DELETE")
+	api.HandleFunc("/servers/{id}/kdm-report", s.handleGetServerKDMReport).Methods("GET")
 
 	// Torrent routes
 	api.HandleFunc("/torrents", s.handleListTorrents).Methods("GET")
@@ -165,6 +202,7 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/torrents/{info_hash}/peer-status", s.handleTorrentPeerStatus).Methods("GET")
 	api.HandleFunc("/torrents/{info_hash}/seeders", s.handleRegisterSeeder).Methods("POST")
 	api.HandleFunc("/tracker/live", s.handleTrackerLive).Methods("GET")
+	api.HandleFunc("/tracker/swarms/{info_hash}/history", s.handleGetSwarmHistory).Methods("GET")
 
 	// Torrent stats routes - detailed per-server stats
 	api.HandleFunc("/servers/{id}/torrent-stats", s.handleGetServerTorrentStats).Methods("GET")
@@ -181,6 +219,17 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/packages/{id}/server-status", s.handleGetPackageServerStatus).Methods("GET")
 	api.HandleFunc("/content-commands", s.handleCreateContentCommand).Methods("POST")
 
+	// Space reclamation routes (policies propose deletion plans, an admin approves them)
+	api.HandleFunc("/reclamation/policies", s.handleListReclamationPolicies).Methods("GET")
+	api.HandleFunc("/reclamation/policies", s.handleCreateReclamationPolicy).Methods("POST")
+	api.HandleFunc("/reclamation/policies/{id}", s.handleUpdateReclamationPolicy).Methods("PUT")
+	api.HandleFunc("/reclamation/policies/{id}", s.handleDeleteReclamationPolicy).Methods("DELETE")
+	api.HandleFunc("/reclamation/evaluate", s.handleEvaluateReclamation).Methods("POST")
+	api.HandleFunc("/reclamation/plans", s.handleListReclamationPlans).Methods("GET")
+	api.HandleFunc("/reclamation/plans/{id}", s.handleGetReclamationPlan).Methods("GET")
+	api.HandleFunc("/reclamation/plans/{id}/approve", s.handleApproveReclamationPlan).Methods("POST")
+	api.HandleFunc("/reclamation/plans/{id}/reject", s.handleRejectReclamationPlan).Methods("POST")
+
 	// Transfer routes
 	api.HandleFunc("/transfers", s.handleListTransfers).Methods("GET")
 	api.HandleFunc("/transfers", s.handleCreateTransfer).Methods("POST")
@@ -191,6 +240,26 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/transfers/{id}/pause", s.handlePauseTransfer).Methods("POST")
 	api.HandleFunc("/transfers/{id}/resume", s.handleResumeTransfer).Methods("POST")
 
+	// Server group and tag routes (circuits, regions, site types); groups can be targeted by
+	// transfers, content commands, upgrades and rescans
+	api.HandleFunc("/server-groups", s.handleListServerGroups).Methods("GET")
+	api.HandleFunc("/server-groups", s.handleCreateServerGroup).Methods("POST")
+	api.HandleFunc("/server-groups/{id}", s.handleGetServerGroup).Methods("GET")
+	api.HandleFunc("/server-groups/{id}", s.handleUpdateServerGroup).Methods("PUT")
+	api.HandleFunc("/server-groups/{id}", s.handleDeleteServerGroup).Methods("DELETE")
+	api.HandleFunc("/server-groups/{id}/servers", s.handleAddServerGroupMembers).Methods("POST")
+	api.HandleFunc("/server-groups/{id}/servers/{server_id}", s.handleRemoveServerGroupMember).Methods("DELETE")
+	api.HandleFunc("/server-groups/{id}/upgrade", s.handleTriggerGroupUpgrade).Methods("POST")
+	api.HandleFunc("/server-groups/{id}/rescan", s.handleRescanGroup).Methods("POST")
+	api.HandleFunc("/server-tags", s.handleListServerTags).Methods("GET")
+	api.HandleFunc("/servers/{id}/tags", s.handleSetServerTags).Methods("PUT")
+
+	// Distribution campaign routes (packages sent to many servers in waves)
+	api.HandleFunc("/campaigns", s.handleListCampaigns).Methods("GET")
+	api.HandleFunc("/campaigns", s.handleCreateCampaign).Methods("POST")
+	api.HandleFunc("/campaigns/{id}", s.handleGetCampaign).Methods("GET")
+	api.HandleFunc("/campaigns/{id}/cancel", s.handleCancelCampaign).Methods("POST")
+
 	// Software version routes
 	api.HandleFunc("/versions", s.handleListVersions).Methods("GET")
 	api.HandleFunc("/versions", s.handleRegisterVersion).Methods("POST")
@@ -203,16 +272,20 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/logs/ingest", s.handleLogIngest).Methods("POST")
 	api.HandleFunc("/servers/{id}/rescan", s.handleRescanServer).Methods("POST")
 	api.HandleFunc("/servers/{id}/scan-status", s.handleServerScanStatus).Methods("GET")
+	api.HandleFunc("/servers/{id}/storage", s.handleGetServerStorage).Methods("GET")
 
 	// WebSocket client management routes
 	api.HandleFunc("/websocket/clients", s.handleListWebSocketClients).Methods("GET")
 	api.HandleFunc("/servers/{id}/ws-status", s.handleGetWebSocketClientStatus).Methods("GET")
 	api.HandleFunc("/servers/{id}/send-command", s.handleSendServerCommand).Methods("POST")
 	api.HandleFunc("/servers/{id}/delete-content", s.handleDeleteContent).Methods("POST")
+	api.HandleFunc("/servers/{id}/restore-content", s.handleRestoreContent).Methods("POST")
 
 	// Server settings routes
 	api.HandleFunc("/servers/{id}/settings", s.handleGetServerSettings).Methods("GET")
 	api.HandleFunc("/servers/{id}/settings", s.handleUpdateServerSettings).Methods("PUT")
+	api.HandleFunc("/servers/{id}/bandwidth-schedule", s.handleGetBandwidthSchedule).Methods("GET")
+	api.HandleFunc("/servers/{id}/bandwidth-schedule", s.handleUpdateBandwidthSchedule).Methods("PUT")
 	api.HandleFunc("/servers/{id}/library-locations", s.handleAddLibraryLocation).Methods("POST")
 	api.HandleFunc("/servers/{id}/library-locations/{location_id}", s.handleUpdateLibraryLocation).Methods("PUT")
 	api.HandleFunc("/servers/{id}/library-locations/{location_id}", s.handleDeleteLibraryLocation).Methods("DELETE")
@@ -0,0 +1,513 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+)
+
+// maxTagLength is the longest server tag accepted
+const maxTagLength = 100
+
+// serverGroupRequest is the body of POST and PUT /server-groups. Fields left out keep their
+// current value.
+type serverGroupRequest struct {
+	Name        *string      `json:"name"`
+	Kind        *string      `json:"kind"` // e.g. "circuit", "region", "site_type"
+	Description *string      `json:"description"`
+	ServerIDs   *[]uuid.UUID `json:"server_ids"`
+}
+
+// apply copies the fields that were sent onto a group and checks the result
+func (req *serverGroupRequest) apply(g *db.ServerGroup) error {
+	if req.Name != nil {
+		g.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Kind != nil {
+		g.Kind = strings.ToLower(strings.TrimSpace(*req.Kind))
+	}
+	if req.Description != nil {
+		g.Description = *req.Description
+	}
+	if req.ServerIDs != nil {
+		g.ServerIDs = uniqueServerIDs(*req.ServerIDs)
+	}
+
+	switch {
+	case g.Name == "":
+		return fmt.Errorf("name is required")
+	case len(g.Name) > 255:
+		return fmt.Errorf("name must not be longer than 255 characters")
+	case len(g.Kind) > 50:
+		return fmt.Errorf("kind must not be longer than 50 characters")
+	}
+	return nil
+}
+
+func uniqueServerIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	unique := []uuid.UUID{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// normalizeTags trims, lower-cases and de-duplicates server tags
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// handleListServerGroups lists the server groups, optionally filtered by ?kind=
+func (s *Server) handleListServerGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.database.ListServerGroups()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server groups", err.Error())
+		return
+	}
+	kind := strings.ToLower(r.URL.Query().Get("kind"))
+	list := []map[string]interface{}{}
+	for _, g := range groups {
+		if kind != "" && g.Kind != kind {
+			continue
+		}
+		list = append(list, serverGroupDetails(g))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"groups": list,
+		"total":  len(list),
+	})
+}
+
+// handleCreateServerGroup creates a server group
+func (s *Server) handleCreateServerGroup(w http.ResponseWriter, r *http.Request) {
+	var req serverGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	group := &db.ServerGroup{}
+	if err := req.apply(group); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server group", err.Error())
+		return
+	}
+	if !s.checkServerGroup(w, group) {
+		return
+	}
+	if err := s.database.CreateServerGroup(group); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create server group", err.Error())
+		return
+	}
+
+	s.logActivity(r, "server_group.create", "servers", "server_group", group.ID.String(), group.Name,
+		fmt.Sprintf(`{"servers":%d}`, len(group.ServerIDs)), "success")
+	respondJSON(w, http.StatusCreated, serverGroupDetails(group))
+}
+
+// handleGetServerGroup returns a server group and its members
+func (s *Server) handleGetServerGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, serverGroupDetails(group))
+}
+
+// handleUpdateServerGroup renames or re-describes a server group; server_ids, when sent,
+// replaces its members
+func (s *Server) handleUpdateServerGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var req serverGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.apply(group); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server group", err.Error())
+		return
+	}
+	if !s.checkServerGroup(w, group) {
+		return
+	}
+	if err := s.database.UpdateServerGroup(group); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update server group", err.Error())
+		return
+	}
+	if req.ServerIDs != nil {
+		if err := s.database.SetServerGroupMembers(group.ID, group.ServerIDs); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to update server group members", err.Error())
+			return
+		}
+	}
+
+	s.logActivity(r, "server_group.update", "servers", "server_group", group.ID.String(), group.Name, "", "success")
+	s.respondServerGroup(w, group.ID)
+}
+
+// handleDeleteServerGroup removes a server group. Its servers are not affected.
+func (s *Server) handleDeleteServerGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+	if err := s.database.DeleteServerGroup(group.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete server group", err.Error())
+		return
+	}
+	s.logActivity(r, "server_group.delete", "servers", "server_group", group.ID.String(), group.Name, "", "success")
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Server group deleted"})
+}
+
+// handleAddServerGroupMembers adds the servers in {"server_ids": [...]} to a group
+func (s *Server) handleAddServerGroupMembers(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ServerIDs []uuid.UUID `json:"server_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if len(req.ServerIDs) == 0 {
+		respondError(w, http.StatusBadRequest, "Missing server_ids", "")
+		return
+	}
+	if !s.checkServersExist(w, req.ServerIDs) {
+		return
+	}
+	if err := s.database.AddServerGroupMembers(group.ID, uniqueServerIDs(req.ServerIDs)); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to add servers to group", err.Error())
+		return
+	}
+
+	s.logActivity(r, "server_group.add_servers", "servers", "server_group", group.ID.String(), group.Name,
+		fmt.Sprintf(`{"servers":%d}`, len(req.ServerIDs)), "success")
+	s.respondServerGroup(w, group.ID)
+}
+
+// handleRemoveServerGroupMember takes a server out of a group
+func (s *Server) handleRemoveServerGroupMember(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+	serverID, err := uuid.Parse(mux.Vars(r)["server_id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	removed, err := s.database.RemoveServerGroupMember(group.ID, serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to remove server from group", err.Error())
+		return
+	}
+	if !removed {
+		respondError(w, http.StatusNotFound, "Server is not a member of the group", "")
+		return
+	}
+
+	s.logActivity(r, "server_group.remove_server", "servers", "server_group", group.ID.String(), group.Name,
+		fmt.Sprintf(`{"server_id":%q}`, serverID), "success")
+	s.respondServerGroup(w, group.ID)
+}
+
+// handleListServerTags lists the tags in use and how many servers carry each
+func (s *Server) handleListServerTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.database.ListServerTags()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server tags", err.Error())
+		return
+	}
+	list := []map[string]interface{}{}
+	for _, t := range tags {
+		list = append(list, map[string]interface{}{
+			"tag":     t.Tag,
+			"servers": t.Servers,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tags":  list,
+		"total": len(list),
+	})
+}
+
+// handleSetServerTags replaces the tags of a server with {"tags": [...]}. Tags are free-form and
+// stored lower case.
+func (s *Server) handleSetServerTags(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid tags", err.Error())
+		return
+	}
+	if !s.checkServersExist(w, []uuid.UUID{serverID}) {
+		return
+	}
+	if err := s.database.SetServerTags(serverID, tags); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save server tags", err.Error())
+		return
+	}
+
+	s.logActivity(r, "server.tags", "servers", "server", vars["id"], "", "", "success")
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id": serverID,
+		"tags":      tags,
+	})
+}
+
+// handleTriggerGroupUpgrade upgrades every server of a group to {"target_version": ...}. When
+// this server is a member it upgrades last, as it restarts once done.
+func (s *Server) handleTriggerGroupUpgrade(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		TargetVersion string `json:"target_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if request.TargetVersion == "" {
+		respondError(w, http.StatusBadRequest, "Missing target_version", "")
+		return
+	}
+	var exists bool
+	if err := s.database.QueryRow("SELECT EXISTS(SELECT 1 FROM software_versions WHERE version = $1)", request.TargetVersion).Scan(&exists); err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+	if !exists {
+		respondError(w, http.StatusNotFound, "Version not found", "")
+		return
+	}
+
+	var serverIDs []uuid.UUID
+	self := false
+	for _, serverID := range group.ServerIDs {
+		if s.selfServerID != nil && serverID == *s.selfServerID {
+			self = true
+			continue
+		}
+		serverIDs = append(serverIDs, serverID)
+	}
+	if self {
+		serverIDs = append(serverIDs, *s.selfServerID)
+	}
+	results := []map[string]interface{}{}
+	failed := 0
+	for _, serverID := range serverIDs {
+		result := map[string]interface{}{"server_id": serverID}
+		if method, err := s.triggerUpgrade(serverID, request.TargetVersion); err != nil {
+			result["error"] = err.Error()
+			failed++
+		} else {
+			result["method"] = method
+		}
+		results = append(results, result)
+	}
+
+	status := "success"
+	if failed > 0 {
+		status = "partial"
+	}
+	s.logActivity(r, "server.upgrade", "servers", "server_group", group.ID.String(), group.Name,
+		fmt.Sprintf(`{"target_version":%q,"servers":%d,"failed":%d}`, request.TargetVersion, len(results), failed), status)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        fmt.Sprintf("Upgrade triggered on %d of %d server(s)", len(results)-failed, len(results)),
+		"group_id":       group.ID,
+		"target_version": request.TargetVersion,
+		"servers":        results,
+	})
+}
+
+// handleRescanGroup starts a library rescan on every server of a group. ?full=true re-indexes
+// every package instead of only changed ones.
+func (s *Server) handleRescanGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.lookupServerGroup(w, r)
+	if !ok {
+		return
+	}
+	full := r.URL.Query().Get("full") == "true"
+
+	results := []map[string]interface{}{}
+	failed := 0
+	for _, serverID := range group.ServerIDs {
+		result := map[string]interface{}{"server_id": serverID, "started": true}
+		if _, err := s.rescanServer(r.Context(), serverID, full); err != nil {
+			result["started"] = false
+			result["error"] = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	status := "success"
+	if failed > 0 {
+		status = "partial"
+	}
+	s.logActivity(r, "server.rescan", "servers", "server_group", group.ID.String(), group.Name,
+		fmt.Sprintf(`{"servers":%d,"failed":%d}`, len(results), failed), status)
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":  fmt.Sprintf("Rescan started on %d of %d server(s)", len(results)-failed, len(results)),
+		"group_id": group.ID,
+		"servers":  results,
+	})
+}
+
+func (s *Server) lookupServerGroup(w http.ResponseWriter, r *http.Request) (*db.ServerGroup, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server group ID", err.Error())
+		return nil, false
+	}
+	group, err := s.database.GetServerGroup(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server group", err.Error())
+		return nil, false
+	}
+	if group == nil {
+		respondError(w, http.StatusNotFound, "Server group not found", "")
+		return nil, false
+	}
+	return group, true
+}
+
+// checkServerGroup rejects a group whose name another group has or with unknown members
+func (s *Server) checkServerGroup(w http.ResponseWriter, group *db.ServerGroup) bool {
+	groups, err := s.database.ListServerGroups()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server groups", err.Error())
+		return false
+	}
+	for _, g := range groups {
+		if g.ID != group.ID && strings.EqualFold(g.Name, group.Name) {
+			respondError(w, http.StatusConflict, "Server group already exists", "a group named "+g.Name+" exists")
+			return false
+		}
+	}
+	return s.checkServersExist(w, group.ServerIDs)
+}
+
+// checkServersExist responds 400 and returns false when one of the servers is unknown
+func (s *Server) checkServersExist(w http.ResponseWriter, serverIDs []uuid.UUID) bool {
+	for _, id := range serverIDs {
+		server, err := s.database.GetServer(id)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to query server", err.Error())
+			return false
+		}
+		if server == nil {
+			respondError(w, http.StatusBadRequest, "Server not found", id.String())
+			return false
+		}
+	}
+	return true
+}
+
+// respondServerGroup responds with the current state of a group after it was changed
+func (s *Server) respondServerGroup(w http.ResponseWriter, id uuid.UUID) {
+	group, err := s.database.GetServerGroup(id)
+	if err != nil || group == nil {
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Server group updated"})
+		return
+	}
+	respondJSON(w, http.StatusOK, serverGroupDetails(group))
+}
+
+// groupServerIDs returns the members of the group a request targets instead of a single server.
+// It responds itself and returns false when the group ID is invalid, unknown or the group empty.
+func (s *Server) groupServerIDs(w http.ResponseWriter, groupID string) ([]uuid.UUID, bool) {
+	id, err := uuid.Parse(groupID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server group ID", err.Error())
+		return nil, false
+	}
+	group, err := s.database.GetServerGroup(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query server group", err.Error())
+		return nil, false
+	}
+	if group == nil {
+		respondError(w, http.StatusNotFound, "Server group not found", "")
+		return nil, false
+	}
+	if len(group.ServerIDs) == 0 {
+		respondError(w, http.StatusBadRequest, "Server group has no servers", group.Name)
+		return nil, false
+	}
+	return group.ServerIDs, true
+}
+
+func serverGroupDetails(g *db.ServerGroup) map[string]interface{} {
+	serverIDs := g.ServerIDs
+	if serverIDs == nil {
+		serverIDs = []uuid.UUID{}
+	}
+	return map[string]interface{}{
+		"id":           g.ID,
+		"name":         g.Name,
+		"kind":         g.Kind,
+		"description":  g.Description,
+		"server_ids":   serverIDs,
+		"server_count": len(serverIDs),
+		"created_at":   g.CreatedAt,
+		"updated_at":   g.UpdatedAt,
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
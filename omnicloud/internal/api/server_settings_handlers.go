@@ -9,17 +9,22 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/torrent"
+	ws "github.com/omnicloud/omnicloud/internal/websocket"
 )
 
 // ServerSettings represents the configuration settings for a server
 type ServerSettings struct {
-	ServerID                    string                   `json:"server_id"`
-	DisplayName                 string                   `json:"display_name"`
-	DownloadLocation            string                   `json:"download_location"`
-	TorrentDownloadLocation     string                   `json:"torrent_download_location"`
-	WatchFolder                 string                   `json:"watch_folder"`
-	AutoCleanupAfterIngestion   bool                     `json:"auto_cleanup_after_ingestion"`
-	LibraryLocations            []ServerLibraryLocation  `json:"library_locations"`
+	ServerID                    string                     `json:"server_id"`
+	DisplayName                 string                     `json:"display_name"`
+	DownloadLocation            string                     `json:"download_location"`
+	TorrentDownloadLocation     string                     `json:"torrent_download_location"`
+	WatchFolder                 string                     `json:"watch_folder"`
+	AutoCleanupAfterIngestion   bool                       `json:"auto_cleanup_after_ingestion"`
+	TrashRetentionDays          int                        `json:"trash_retention_days"`
+	StorageReserveGB            int                        `json:"storage_reserve_gb"`
+	BandwidthSchedule           *torrent.BandwidthSchedule `json:"bandwidth_schedule"`
+	LibraryLocations            []ServerLibraryLocation    `json:"library_locations"`
 }
 
 // ServerLibraryLocation represents a library path for a server
@@ -46,16 +51,19 @@ func (s *Server) handleGetServerSettings(w http.ResponseWriter, r *http.Request)
 	// Get server basic settings
 	var displayName, downloadLocation, torrentDownloadLocation, watchFolder sql.NullString
 	var autoCleanup bool
+	var trashRetentionDays, storageReserveGB int
 	err = s.database.QueryRow(`
 		SELECT
 			COALESCE(display_name, ''),
 			COALESCE(download_location, ''),
 			COALESCE(torrent_download_location, ''),
 			COALESCE(watch_folder, ''),
-			COALESCE(auto_cleanup_after_ingestion, false)
+			COALESCE(auto_cleanup_after_ingestion, false),
+			trash_retention_days,
+			storage_reserve_gb
 		FROM servers
 		WHERE id = $1
-	`, serverID).Scan(&displayName, &downloadLocation, &torrentDownloadLocation, &watchFolder, &autoCleanup)
+	`, serverID).Scan(&displayName, &downloadLocation, &torrentDownloadLocation, &watchFolder, &autoCleanup, &trashRetentionDays, &storageReserveGB)
 
 	if err == sql.ErrNoRows {
 		respondError(w, http.StatusNotFound, "Server not found", "")
@@ -93,6 +101,13 @@ func (s *Server) handleGetServerSettings(w http.ResponseWriter, r *http.Request)
 		libraryLocations = append(libraryLocations, loc)
 	}
 
+	// Rate limits the server's torrent engine applies through the day
+	bandwidthSchedule, err := s.BandwidthSchedule(serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
 	settings := ServerSettings{
 		ServerID:                    serverID.String(),
 		DisplayName:                 displayName.String,
@@ -100,6 +115,9 @@ func (s *Server) handleGetServerSettings(w http.ResponseWriter, r *http.Request)
 		TorrentDownloadLocation:     torrentDownloadLocation.String,
 		WatchFolder:                 watchFolder.String,
 		AutoCleanupAfterIngestion:   autoCleanup,
+		TrashRetentionDays:          trashRetentionDays,
+		StorageReserveGB:            storageReserveGB,
+		BandwidthSchedule:           bandwidthSchedule,
 		LibraryLocations:            libraryLocations,
 	}
 
@@ -121,6 +139,8 @@ func (s *Server) handleUpdateServerSettings(w http.ResponseWriter, r *http.Reque
 		TorrentDownloadLocation   string `json:"torrent_download_location"`
 		WatchFolder               string `json:"watch_folder"`
 		AutoCleanupAfterIngestion *bool  `json:"auto_cleanup_after_ingestion,omitempty"`
+		TrashRetentionDays        *int   `json:"trash_retention_days,omitempty"` // days deleted content stays in quarantine
+		StorageReserveGB          *int   `json:"storage_reserve_gb,omitempty"`   // space transfers must leave free on the download location
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
@@ -128,6 +148,15 @@ func (s *Server) handleUpdateServerSettings(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if settings.TrashRetentionDays != nil && *settings.TrashRetentionDays < 0 {
+		respondError(w, http.StatusBadRequest, "trash_retention_days must not be negative", "")
+		return
+	}
+	if settings.StorageReserveGB != nil && *settings.StorageReserveGB < 0 {
+		respondError(w, http.StatusBadRequest, "storage_reserve_gb must not be negative", "")
+		return
+	}
+
 	// Update server settings (display_name is user-defined and not overwritten by client sync)
 	autoCleanup := false
 	if settings.AutoCleanupAfterIngestion != nil {
@@ -140,9 +169,11 @@ func (s *Server) handleUpdateServerSettings(w http.ResponseWriter, r *http.Reque
 		    torrent_download_location = $3,
 		    watch_folder = $4,
 		    auto_cleanup_after_ingestion = $5,
+		    trash_retention_days = COALESCE($7, trash_retention_days),
+		    storage_reserve_gb = COALESCE($8, storage_reserve_gb),
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $6
-	`, settings.DisplayName, settings.DownloadLocation, settings.TorrentDownloadLocation, settings.WatchFolder, autoCleanup, serverID)
+	`, settings.DisplayName, settings.DownloadLocation, settings.TorrentDownloadLocation, settings.WatchFolder, autoCleanup, serverID, settings.TrashRetentionDays, settings.StorageReserveGB)
 
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to update settings", err.Error())
@@ -208,6 +239,7 @@ func (s *Server) handleAddLibraryLocation(w http.ResponseWriter, r *http.Request
 	}
 
 	log.Printf("Added library location '%s' for server %s", location.Name, serverID)
+	s.notifyLibraryChanged(serverID)
 
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"message": "Library location added successfully",
@@ -254,7 +286,8 @@ func (s *Server) handleUpdateLibraryLocation(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Update library location
-	result, err := s.database.Exec(`
+	var serverID uuid.UUID
+	err = s.database.QueryRow(`
 		UPDATE server_library_locations
 		SET name = $1,
 		    path = $2,
@@ -262,20 +295,20 @@ func (s *Server) handleUpdateLibraryLocation(w http.ResponseWriter, r *http.Requ
 		    location_type = $4,
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $5
-	`, location.Name, location.Path, location.IsActive, location.LocationType, locationID)
+		RETURNING server_id
+	`, location.Name, location.Path, location.IsActive, location.LocationType, locationID).Scan(&serverID)
 
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update library location", err.Error())
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Library location not found", "")
 		return
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		respondError(w, http.StatusNotFound, "Library location not found", "")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update library location", err.Error())
 		return
 	}
 
 	log.Printf("Updated library location %s", locationID)
+	s.notifyLibraryChanged(serverID)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Library location updated successfully",
@@ -292,29 +325,47 @@ func (s *Server) handleDeleteLibraryLocation(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Delete library location
-	result, err := s.database.Exec(`
+	var serverID uuid.UUID
+	err = s.database.QueryRow(`
 		DELETE FROM server_library_locations
 		WHERE id = $1
-	`, locationID)
+		RETURNING server_id
+	`, locationID).Scan(&serverID)
 
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to delete library location", err.Error())
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Library location not found", "")
 		return
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		respondError(w, http.StatusNotFound, "Library location not found", "")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete library location", err.Error())
 		return
 	}
 
 	log.Printf("Deleted library location %s", locationID)
+	s.notifyLibraryChanged(serverID)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Library location deleted successfully",
 	})
 }
 
+// notifyLibraryChanged makes the server owning changed library locations follow them: this
+// process directly, a connected client through a library_changed command. Clients that are
+// not connected pick the change up on their next periodic refresh.
+func (s *Server) notifyLibraryChanged(serverID uuid.UUID) {
+	if s.selfServerID != nil && *s.selfServerID == serverID {
+		if s.reloadLibraries != nil {
+			go s.reloadLibraries()
+		}
+		return
+	}
+	if s.wsHub != nil && s.wsHub.IsClientConnected(serverID) {
+		if err := s.wsHub.SendCommandToClient(serverID, ws.CommandLibraryChanged, nil); err != nil {
+			log.Printf("Failed to notify server %s of library location change: %v", serverID, err)
+		}
+	}
+}
+
 // IngestionStatusRecord represents a DCP ingestion tracking record
 type IngestionStatusRecord struct {
 	ID               string     `json:"id"`
@@ -11,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/omnicloud/omnicloud/internal/torrent"
 )
 
 // LibraryLocation represents a library path returned from the main server
@@ -24,12 +26,14 @@ type LibraryLocation struct {
 
 // ServerSettingsResponse is the response from /servers/{id}/settings
 type ServerSettingsResponse struct {
-	ServerID                    string            `json:"server_id"`
-	DownloadLocation            string            `json:"download_location"`
-	TorrentDownloadLocation     string            `json:"torrent_download_location"`
-	WatchFolder                 string            `json:"watch_folder"`
-	AutoCleanupAfterIngestion   bool              `json:"auto_cleanup_after_ingestion"`
-	LibraryLocations            []LibraryLocation `json:"library_locations"`
+	ServerID                    string                     `json:"server_id"`
+	DownloadLocation            string                     `json:"download_location"`
+	TorrentDownloadLocation     string                     `json:"torrent_download_location"`
+	WatchFolder                 string                     `json:"watch_folder"`
+	AutoCleanupAfterIngestion   bool                       `json:"auto_cleanup_after_ingestion"`
+	TrashRetentionDays          int                        `json:"trash_retention_days"`
+	BandwidthSchedule           *torrent.BandwidthSchedule `json:"bandwidth_schedule"`
+	LibraryLocations            []LibraryLocation          `json:"library_locations"`
 }
 
 // SettingsClient fetches server settings from the main server
@@ -256,6 +260,26 @@ func (sc *SettingsClient) GetAutoCleanupAfterIngestion() (bool, error) {
 	return settings.AutoCleanupAfterIngestion, nil
 }
 
+// GetTrashRetentionDays returns how many days this server keeps quarantined packages
+func (sc *SettingsClient) GetTrashRetentionDays() (int, error) {
+	settings, err := sc.fetchSettings()
+	if err != nil {
+		return 0, err
+	}
+
+	return settings.TrashRetentionDays, nil
+}
+
+// GetBandwidthSchedule returns the bandwidth calendar this server's torrent engine follows
+func (sc *SettingsClient) GetBandwidthSchedule() (*torrent.BandwidthSchedule, error) {
+	settings, err := sc.fetchSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	return settings.BandwidthSchedule, nil
+}
+
 // GetLibraryLocationsDetailed returns full library location details including type
 func (sc *SettingsClient) GetLibraryLocationsDetailed() ([]LibraryLocation, error) {
 	settings, err := sc.fetchSettings()
@@ -308,6 +332,70 @@ func (sc *SettingsClient) ReportIngestion(packageID, infoHash, downloadPath, rbP
 	return nil
 }
 
+// ReportVerification sends the results of a PKL hash verification run to the main server
+func (sc *SettingsClient) ReportVerification(report *VerificationReport) error {
+	url := fmt.Sprintf("%s/api/v1/servers/%s/verification-result", sc.mainServerURL, sc.serverID)
+
+	jsonBody, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Server-ID", sc.serverID)
+	req.Header.Set("X-MAC-Address", sc.macAddress)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to report verification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	log.Printf("[verify] Reported verification %s (%s) for package %s to main server", report.VerificationID, report.Status, report.PackageID)
+	return nil
+}
+
+// ReportKDM sends a KDM found in this server's library to the main server, which parses and stores it
+func (sc *SettingsClient) ReportKDM(sourcePath string, data []byte) error {
+	url := fmt.Sprintf("%s/api/v1/servers/%s/kdms", sc.mainServerURL, sc.serverID)
+
+	jsonBody, err := json.Marshal(KDMReport{SourcePath: sourcePath, XML: string(data)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Server-ID", sc.serverID)
+	req.Header.Set("X-MAC-Address", sc.macAddress)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to report KDM: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // CanonicalXMLResult contains the canonical torrent and XML files returned by the main server
 // for a DCP identified by CPL UUID.
 type CanonicalXMLResult struct {
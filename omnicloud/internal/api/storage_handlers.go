@@ -0,0 +1,227 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+	ws "github.com/omnicloud/omnicloud/internal/websocket"
+	"github.com/omnicloud/omnicloud/pkg/dcp"
+)
+
+// storageProjectionWindow is how far back samples are used to project when a location fills up
+const storageProjectionWindow = 7 * 24 * time.Hour
+
+// StorageLocationResponse is the latest usage of one storage location with its history and
+// the projection of when it fills up
+type StorageLocationResponse struct {
+	Path            string                `json:"path"`
+	Kind            string                `json:"kind"`
+	TotalBytes      int64                 `json:"total_bytes"`
+	FreeBytes       int64                 `json:"free_bytes"`
+	UsedBytes       int64                 `json:"used_bytes"`
+	SampledAt       time.Time             `json:"sampled_at"`
+	FreeBytesPerDay *float64              `json:"free_bytes_per_day,omitempty"` // negative while the location fills up
+	DaysUntilFull   *float64              `json:"days_until_full,omitempty"`
+	ProjectedFullAt *time.Time            `json:"projected_full_at,omitempty"`
+	History         []StorageHistoryPoint `json:"history"`
+}
+
+// StorageHistoryPoint is one storage sample of a location
+type StorageHistoryPoint struct {
+	SampledAt  time.Time `json:"sampled_at"`
+	TotalBytes int64     `json:"total_bytes"`
+	FreeBytes  int64     `json:"free_bytes"`
+}
+
+// recordStorageUsage stores the filesystem usage a server reported with its heartbeat
+func (s *Server) recordStorageUsage(serverID uuid.UUID, usage []dcp.StorageUsage) {
+	if err := s.database.RecordStorageUsage(serverID, usage); err != nil {
+		log.Printf("Failed to record storage usage for server %s: %v", serverID, err)
+	}
+}
+
+// handleGetServerStorage returns the usage of a server's library and download locations, their
+// history over the last ?days (default 7) and when they are projected to fill up. The download
+// location counts as full once its free space drops to the configured reserve.
+func (s *Server) handleGetServerStorage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid days", "days must be a positive integer")
+			return
+		}
+	}
+
+	reserve, err := s.database.GetStorageReserveBytes(serverID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Server not found", err.Error())
+		return
+	}
+
+	now := time.Now()
+	since := now.Add(-time.Duration(days) * 24 * time.Hour)
+	if projectionSince := now.Add(-storageProjectionWindow); projectionSince.Before(since) {
+		since = projectionSince
+	}
+	samples, err := s.database.GetStorageSamples(serverID, since)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get storage samples", err.Error())
+		return
+	}
+
+	// Group samples per location, keeping the order locations first appear in
+	type locationKey struct{ path, kind string }
+	var order []locationKey
+	byLocation := make(map[locationKey][]*db.StorageSample)
+	for _, sample := range samples {
+		key := locationKey{sample.Path, sample.Kind}
+		if _, ok := byLocation[key]; !ok {
+			order = append(order, key)
+		}
+		byLocation[key] = append(byLocation[key], sample)
+	}
+
+	historySince := now.Add(-time.Duration(days) * 24 * time.Hour)
+	locations := make([]StorageLocationResponse, 0, len(order))
+	for _, key := range order {
+		locSamples := byLocation[key]
+		latest := locSamples[len(locSamples)-1]
+		loc := StorageLocationResponse{
+			Path:       key.path,
+			Kind:       key.kind,
+			TotalBytes: latest.TotalBytes,
+			FreeBytes:  latest.FreeBytes,
+			UsedBytes:  latest.TotalBytes - latest.FreeBytes,
+			SampledAt:  latest.SampledAt,
+			History:    []StorageHistoryPoint{},
+		}
+		for _, sample := range locSamples {
+			if !sample.SampledAt.Before(historySince) {
+				loc.History = append(loc.History, StorageHistoryPoint{
+					SampledAt:  sample.SampledAt,
+					TotalBytes: sample.TotalBytes,
+					FreeBytes:  sample.FreeBytes,
+				})
+			}
+		}
+
+		var floor int64
+		if key.kind == "download" {
+			floor = reserve
+		}
+		if perDay, ok := freeBytesTrend(locSamples, now.Add(-storageProjectionWindow)); ok {
+			loc.FreeBytesPerDay = &perDay
+			if perDay < 0 {
+				daysUntilFull := float64(latest.FreeBytes-floor) / -perDay
+				if daysUntilFull < 0 {
+					daysUntilFull = 0
+				}
+				fullAt := latest.SampledAt.Add(time.Duration(daysUntilFull * float64(24*time.Hour)))
+				loc.DaysUntilFull = &daysUntilFull
+				loc.ProjectedFullAt = &fullAt
+			}
+		}
+		locations = append(locations, loc)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id":             serverID,
+		"storage_reserve_bytes": reserve,
+		"locations":             locations,
+	})
+}
+
+// freeBytesTrend fits a least-squares line through the free space samples taken since a given
+// time and returns its slope in bytes per day. Needs two samples at least a day apart.
+func freeBytesTrend(samples []*db.StorageSample, since time.Time) (float64, bool) {
+	var points []*db.StorageSample
+	for _, sample := range samples {
+		if !sample.SampledAt.Before(since) {
+			points = append(points, sample)
+		}
+	}
+	if len(points) < 2 || points[len(points)-1].SampledAt.Sub(points[0].SampledAt) < 24*time.Hour {
+		return 0, false
+	}
+
+	origin := points[0].SampledAt
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range points {
+		x := p.SampledAt.Sub(origin).Hours() / 24
+		y := float64(p.FreeBytes)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(points))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denom, true
+}
+
+// heldTransfer is a queued transfer that does not fit the download location of its destination
+type heldTransfer struct {
+	id        uuid.UUID
+	size      int64
+	available int64
+}
+
+// downloadSpaceAvailable returns the space left for new transfers on a server's download
+// location: its last reported free space minus the configured reserve and what the transfers
+// in progress still have to write. Reports false when the server never reported its storage.
+func (s *Server) downloadSpaceAvailable(serverID uuid.UUID) (available, reserve int64, ok bool) {
+	sample, err := s.database.GetDownloadStorage(serverID)
+	if err != nil || sample == nil {
+		return 0, 0, false
+	}
+	if reserve, err = s.database.GetStorageReserveBytes(serverID); err != nil {
+		return 0, 0, false
+	}
+
+	var remaining int64
+	err = s.database.QueryRow(`
+		SELECT COALESCE(SUM(GREATEST(COALESCE(dp.total_size_bytes, 0) - COALESCE(t.downloaded_bytes, 0), 0)), 0)::BIGINT
+		FROM transfers t
+		JOIN dcp_torrents dt ON t.torrent_id = dt.id
+		JOIN dcp_packages dp ON dt.package_id = dp.id
+		WHERE t.destination_server_id = $1
+		  AND t.status IN ('downloading', 'checking', 'active')
+	`, serverID).Scan(&remaining)
+	if err != nil {
+		return 0, 0, false
+	}
+	return sample.FreeBytes - reserve - remaining, reserve, true
+}
+
+// updateHeldTransfers marks queued transfers that do not fit as waiting_for_space. From then
+// on the client decides when they start, from its own measurement of the download location.
+func (s *Server) updateHeldTransfers(held []heldTransfer) {
+	for _, h := range held {
+		log.Printf("[pending-transfers] Holding transfer %s: needs %s, %s available", h.id,
+			ws.FormatBytes(h.size), ws.FormatBytes(h.available))
+		_, err := s.database.Exec(`
+			UPDATE transfers SET status = 'waiting_for_space', error_message = $1, updated_at = $2
+			WHERE id = $3 AND status = 'queued'`,
+			fmt.Sprintf("Needs %s, %s available on the download location after the reserve",
+				ws.FormatBytes(h.size), ws.FormatBytes(h.available)), time.Now(), h.id)
+		if err != nil {
+			log.Printf("[pending-transfers] Failed to update transfer %s: %v", h.id, err)
+		}
+	}
+}
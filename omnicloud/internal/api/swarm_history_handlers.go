@@ -0,0 +1,129 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// swarmHistoryPoints is about how many points a swarm health history is condensed into
+const swarmHistoryPoints = 288
+
+// handleGetSwarmHistory returns the health of a torrent's swarm over the last ?hours= (default 24,
+// at most 720): seeders and leechers per time bucket from the tracker's samples, and every peer
+// the tracker knows with its cumulative upload and download counters
+func (s *Server) handleGetSwarmHistory(w http.ResponseWriter, r *http.Request) {
+	infoHash := strings.ToLower(mux.Vars(r)["info_hash"])
+
+	hours := 24
+	if raw := r.URL.Query().Get("hours"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 720 {
+			respondError(w, http.StatusBadRequest, "Invalid hours", "must be between 1 and 720")
+			return
+		}
+		hours = n
+	}
+	// Samples are taken every 5 minutes; wider buckets keep long ranges to a few hundred points
+	bucket := hours * 3600 / swarmHistoryPoints
+	if bucket < 300 {
+		bucket = 300
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	rows, err := s.db.Query(`
+		SELECT to_timestamp(floor(extract(epoch FROM sampled_at) / $3) * $3) AS bucket,
+		       AVG(seeders)::float8, MIN(seeders), MAX(seeders), AVG(leechers)::float8, MAX(leechers)
+		FROM tracker_swarm_samples
+		WHERE info_hash = $1 AND sampled_at > $2
+		GROUP BY bucket
+		ORDER BY bucket`, infoHash, since, bucket)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query swarm history", err.Error())
+		return
+	}
+	defer rows.Close()
+
+	samples := []map[string]interface{}{}
+	for rows.Next() {
+		var at time.Time
+		var avgSeeders, avgLeechers float64
+		var minSeeders, maxSeeders, maxLeechers int
+		if err := rows.Scan(&at, &avgSeeders, &minSeeders, &maxSeeders, &avgLeechers, &maxLeechers); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to scan swarm history", err.Error())
+			return
+		}
+		samples = append(samples, map[string]interface{}{
+			"at":           at,
+			"seeders":      avgSeeders,
+			"min_seeders":  minSeeders,
+			"max_seeders":  maxSeeders,
+			"leechers":     avgLeechers,
+			"max_leechers": maxLeechers,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query swarm history", err.Error())
+		return
+	}
+
+	peerRows, err := s.db.Query(`
+		SELECT peer_id, ip, port, left_bytes, total_uploaded, total_downloaded, first_seen, last_seen, stopped_at
+		FROM tracker_peers
+		WHERE info_hash = $1
+		ORDER BY last_seen DESC`, infoHash)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query swarm peers", err.Error())
+		return
+	}
+	defer peerRows.Close()
+
+	peers := []map[string]interface{}{}
+	for peerRows.Next() {
+		var peerID, ip string
+		var port int
+		var left, uploaded, downloaded int64
+		var firstSeen, lastSeen time.Time
+		var stoppedAt *time.Time
+		if err := peerRows.Scan(&peerID, &ip, &port, &left, &uploaded, &downloaded, &firstSeen, &lastSeen, &stoppedAt); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to scan swarm peer", err.Error())
+			return
+		}
+		peers = append(peers, map[string]interface{}{
+			"peer_id":          peerID,
+			"ip":               ip,
+			"port":             port,
+			"is_seeder":        left == 0,
+			"total_uploaded":   uploaded,
+			"total_downloaded": downloaded,
+			"first_seen":       firstSeen,
+			"last_seen":        lastSeen,
+			"stopped_at":       stoppedAt,
+		})
+	}
+	if err := peerRows.Err(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query swarm peers", err.Error())
+		return
+	}
+
+	// A torrent nobody completed yet has no stats row
+	var completed int64
+	err = s.db.QueryRow(`SELECT completed_count FROM tracker_torrent_stats WHERE info_hash = $1`, infoHash).Scan(&completed)
+	if err != nil && err != sql.ErrNoRows {
+		respondError(w, http.StatusInternalServerError, "Failed to query swarm completions", err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"info_hash":      infoHash,
+		"hours":          hours,
+		"bucket_seconds": bucket,
+		"completed":      completed,
+		"samples":        samples,
+		"peers":          peers,
+	})
+}
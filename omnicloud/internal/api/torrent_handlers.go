@@ -124,14 +124,26 @@ type TransferInfo struct {
 	CompletedAt           *time.Time `json:"completed_at"`
 	CreatedAt             time.Time  `json:"created_at"`
 	UpdatedAt             time.Time  `json:"updated_at"`
+	// DeliverBy is when the content must have arrived; PredictedCompletionAt and DeadlineAtRisk
+	// are kept up to date by the deadline monitor
+	DeliverBy             *time.Time `json:"deliver_by"`
+	PredictedCompletionAt *time.Time `json:"predicted_completion_at"`
+	DeadlineAtRisk        bool       `json:"deadline_at_risk"`
 }
 
 // CreateTransferRequest represents a request to create a transfer
 type CreateTransferRequest struct {
 	TorrentID           string `json:"torrent_id"`
 	DestinationServerID string `json:"destination_server_id"`
+	// DestinationGroupID sends the torrent to every server of a group that does not hold it yet,
+	// instead of to DestinationServerID
+	DestinationGroupID string `json:"destination_group_id"`
 	RequestedBy         string `json:"requested_by"`
 	Priority            *int   `json:"priority"`
+	// IncludeDependencies also queues the OV packages a VF depends on (default true)
+	IncludeDependencies *bool `json:"include_dependencies"`
+	// DeliverBy is when the content must have arrived (RFC 3339); OVs queued along share it
+	DeliverBy *time.Time `json:"deliver_by"`
 }
 
 // UpdateTransferRequest represents a request to update transfer progress
@@ -144,6 +156,9 @@ type UpdateTransferRequest struct {
 	PeersConnected   *int     `json:"peers_connected"`
 	ETASeconds       *int     `json:"eta_seconds"`
 	ErrorMessage     *string  `json:"error_message"`
+	// DeliverBy sets a delivery deadline, ClearDeliverBy removes it
+	DeliverBy      *time.Time `json:"deliver_by"`
+	ClearDeliverBy bool       `json:"clear_deliver_by"`
 }
 
 // handleListTorrents returns all registered torrents
@@ -842,6 +857,7 @@ func (s *Server) handleListTransfers(w http.ResponseWriter, r *http.Request) {
 	serverID := r.URL.Query().Get("server_id")
 	status := r.URL.Query().Get("status")
 	torrentID := r.URL.Query().Get("torrent_id")
+	atRisk := r.URL.Query().Get("at_risk") == "true"
 
 	query := `
 		SELECT t.id, t.torrent_id, t.source_server_id, t.destination_server_id, t.requested_by,
@@ -851,7 +867,8 @@ func (s *Server) handleListTransfers(w http.ResponseWriter, r *http.Request) {
 		       dt.package_id, dp.package_name,
 		       COALESCE(NULLIF(TRIM(dst_srv.display_name), ''), dst_srv.name, '') AS destination_server_name,
 		       COALESCE(NULLIF(TRIM(src_srv.display_name), ''), src_srv.name, '') AS source_server_name,
-		       COALESCE(dt.total_size_bytes, dp.total_size_bytes, 0) AS total_size_bytes
+		       COALESCE(dt.total_size_bytes, dp.total_size_bytes, 0) AS total_size_bytes,
+		       t.deliver_by, t.predicted_completion_at, t.deadline_at_risk
 		FROM transfers t
 		LEFT JOIN dcp_torrents dt ON t.torrent_id = dt.id
 		LEFT JOIN dcp_packages dp ON dt.package_id = dp.id
@@ -880,6 +897,10 @@ func (s *Server) handleListTransfers(w http.ResponseWriter, r *http.Request) {
 		argNum++
 	}
 
+	if atRisk {
+		query += " AND t.deadline_at_risk"
+	}
+
 	query += " ORDER BY t.created_at DESC"
 
 	rows, err := s.db.Query(query, args...)
@@ -902,7 +923,8 @@ func (s *Server) handleListTransfers(w http.ResponseWriter, r *http.Request) {
 			&ti.Status, &ti.Priority, &ti.ProgressPercent, &ti.DownloadedBytes,
 			&ti.DownloadSpeedBps, &ti.UploadSpeedBps, &ti.PeersConnected, &etaSeconds,
 			&errorMsg, &startedAt, &completedAt, &ti.CreatedAt, &ti.UpdatedAt,
-			&packageID, &packageName, &destServerName, &srcServerName, &totalSizeBytes)
+			&packageID, &packageName, &destServerName, &srcServerName, &totalSizeBytes,
+			&ti.DeliverBy, &ti.PredictedCompletionAt, &ti.DeadlineAtRisk)
 		if err != nil {
 			respondError(w, http.StatusInternalServerError, "Failed to scan transfer", "")
 			return
@@ -940,7 +962,7 @@ func (s *Server) handleListTransfers(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, transfers)
 }
 
-// handleCreateTransfer creates a new transfer request
+// handleCreateTransfer creates a new transfer request, or one per server of a group
 func (s *Server) handleCreateTransfer(w http.ResponseWriter, r *http.Request) {
 	var req CreateTransferRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -949,7 +971,7 @@ func (s *Server) handleCreateTransfer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate required fields
-	if req.TorrentID == "" || req.DestinationServerID == "" {
+	if req.TorrentID == "" || (req.DestinationServerID == "" && req.DestinationGroupID == "") {
 		respondError(w, http.StatusBadRequest, "Missing required fields", "")
 		return
 	}
@@ -959,25 +981,125 @@ func (s *Server) handleCreateTransfer(w http.ResponseWriter, r *http.Request) {
 		priority = *req.Priority
 	}
 
-	// Create transfer
+	if req.DestinationGroupID != "" {
+		s.createGroupTransfers(w, r, req, priority)
+		return
+	}
+
+	id, dependencyTransfers, err := s.createTransfer(req, req.DestinationServerID, priority)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create transfer", "")
+		return
+	}
+
+	details := ""
+	if len(dependencyTransfers) > 0 {
+		details = fmt.Sprintf(`{"dependency_transfers":%d}`, len(dependencyTransfers))
+	}
+	s.logActivity(r, "transfer.create", "transfers", "transfer", id, "", details, "success")
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":                   id,
+		"message":              "Transfer created successfully",
+		"dependency_transfers": dependencyTransfers,
+	})
+}
+
+// createGroupTransfers creates a transfer of the requested torrent to every server of the
+// request's group. Servers that hold the package already or are receiving it are skipped.
+func (s *Server) createGroupTransfers(w http.ResponseWriter, r *http.Request, req CreateTransferRequest, priority int) {
+	serverIDs, ok := s.groupServerIDs(w, req.DestinationGroupID)
+	if !ok {
+		return
+	}
+	var packageID uuid.UUID
+	if err := s.db.QueryRow(`SELECT package_id FROM dcp_torrents WHERE id = $1`, req.TorrentID).Scan(&packageID); err != nil {
+		respondError(w, http.StatusNotFound, "Torrent not found", "")
+		return
+	}
+
+	created := []map[string]interface{}{}
+	skipped := []map[string]interface{}{}
+	for _, serverID := range serverIDs {
+		reason, err := s.transferNotNeeded(req.TorrentID, packageID, serverID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to check group servers", err.Error())
+			return
+		}
+		if reason != "" {
+			skipped = append(skipped, map[string]interface{}{"server_id": serverID, "reason": reason})
+			continue
+		}
+
+		id, dependencyTransfers, err := s.createTransfer(req, serverID.String(), priority)
+		if err != nil {
+			log.Printf("[transfers] Failed to create transfer of torrent %s to server %s: %v", req.TorrentID, serverID, err)
+			skipped = append(skipped, map[string]interface{}{"server_id": serverID, "reason": "failed: " + err.Error()})
+			continue
+		}
+		created = append(created, map[string]interface{}{
+			"id":                    id,
+			"destination_server_id": serverID,
+			"dependency_transfers":  dependencyTransfers,
+		})
+	}
+
+	s.logActivity(r, "transfer.create", "transfers", "server_group", req.DestinationGroupID, "",
+		fmt.Sprintf(`{"transfers":%d,"skipped":%d}`, len(created), len(skipped)), "success")
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":   fmt.Sprintf("%d transfer(s) created", len(created)),
+		"group_id":  req.DestinationGroupID,
+		"transfers": created,
+		"skipped":   skipped,
+	})
+}
+
+// transferNotNeeded tells why a server of a group is not sent a package: "present" when it holds
+// it, "in_progress" when a transfer of the torrent to it is open. Empty when it needs it.
+func (s *Server) transferNotNeeded(torrentID string, packageID, serverID uuid.UUID) (string, error) {
+	held, err := s.holdsPackage(serverID, packageID)
+	if err != nil || held {
+		return "present", err
+	}
+	var open bool
+	err = s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM transfers
+		               WHERE torrent_id = $1 AND destination_server_id = $2
+		                 AND status IN ('queued', 'waiting_for_space', 'downloading', 'paused', 'checking', 'active'))`,
+		torrentID, serverID).Scan(&open)
+	if err != nil || !open {
+		return "", err
+	}
+	return "in_progress", nil
+}
+
+// createTransfer queues a transfer of the requested torrent to a server, and of the OVs it
+// depends on unless the request opted out, and pushes them to the server
+func (s *Server) createTransfer(req CreateTransferRequest, destinationServerID string, priority int) (string, []string, error) {
 	id := uuid.New().String()
 	query := `
-		INSERT INTO transfers (id, torrent_id, destination_server_id, requested_by, status, priority, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, 'queued', $5, $6, $7)
+		INSERT INTO transfers (id, torrent_id, destination_server_id, requested_by, status, priority, deliver_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 'queued', $5, $6, $7, $8)
 	`
 
 	now := time.Now()
-	_, err := s.db.Exec(query, id, req.TorrentID, req.DestinationServerID, req.RequestedBy, priority, now, now)
+	_, err := s.db.Exec(query, id, req.TorrentID, destinationServerID, req.RequestedBy, priority, req.DeliverBy, now, now)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create transfer", "")
-		return
+		return "", nil, err
 	}
 
-	s.logActivity(r, "transfer.create", "transfers", "transfer", id, "", "", "success")
-	respondJSON(w, http.StatusCreated, map[string]string{
-		"id":      id,
-		"message": "Transfer created successfully",
-	})
+	// A VF is unplayable without its OV: send the OV along unless the caller opted out
+	var dependencyTransfers []string
+	if req.IncludeDependencies == nil || *req.IncludeDependencies {
+		dependencyTransfers, err = s.queueDependencyTransfers(req.TorrentID, destinationServerID, req.RequestedBy, priority, req.DeliverBy)
+		if err != nil {
+			log.Printf("[transfers] Failed to queue OV dependencies for transfer %s: %v", id, err)
+		}
+	}
+
+	if destID, err := uuid.Parse(destinationServerID); err == nil {
+		s.dispatch(destID)
+	}
+	return id, dependencyTransfers, nil
 }
 
 // handleGetTransfer returns a specific transfer
@@ -994,7 +1116,8 @@ func (s *Server) handleGetTransfer(w http.ResponseWriter, r *http.Request) {
 		SELECT id, torrent_id, source_server_id, destination_server_id, requested_by,
 		       status, priority, progress_percent, downloaded_bytes,
 		       download_speed_bps, upload_speed_bps, peers_connected, eta_seconds,
-		       error_message, started_at, completed_at, created_at, updated_at
+		       error_message, started_at, completed_at, created_at, updated_at,
+		       deliver_by, predicted_completion_at, deadline_at_risk
 		FROM transfers
 		WHERE id = $1
 	`
@@ -1004,6 +1127,7 @@ func (s *Server) handleGetTransfer(w http.ResponseWriter, r *http.Request) {
 		&ti.Status, &ti.Priority, &ti.ProgressPercent, &ti.DownloadedBytes,
 		&ti.DownloadSpeedBps, &ti.UploadSpeedBps, &ti.PeersConnected, &etaSeconds,
 		&errorMsg, &startedAt, &completedAt, &ti.CreatedAt, &ti.UpdatedAt,
+		&ti.DeliverBy, &ti.PredictedCompletionAt, &ti.DeadlineAtRisk,
 	)
 
 	if err == sql.ErrNoRows {
@@ -1112,6 +1236,15 @@ func (s *Server) handleUpdateTransfer(w http.ResponseWriter, r *http.Request) {
 		argNum++
 	}
 
+	// A new deadline is judged again by the next deadline check
+	if req.DeliverBy != nil {
+		query += fmt.Sprintf(", deliver_by = $%d, deadline_at_risk = false", argNum)
+		args = append(args, *req.DeliverBy)
+		argNum++
+	} else if req.ClearDeliverBy {
+		query += ", deliver_by = NULL, predicted_completion_at = NULL, deadline_at_risk = false"
+	}
+
 	query += fmt.Sprintf(" WHERE id = $%d", argNum)
 	args = append(args, transferID)
 
@@ -1145,6 +1278,7 @@ func (s *Server) handleDeleteTransfer(w http.ResponseWriter, r *http.Request) {
 		action = "cancelled (data will be deleted)"
 	}
 	log.Printf("[transfers] Transfer %s %s", transferID, action)
+	s.dispatchTransfer(transferID)
 
 	s.logActivity(r, "transfer.delete", "transfers", "transfer", transferID, "", "", "success")
 	respondJSON(w, http.StatusOK, map[string]string{
@@ -1158,7 +1292,7 @@ func (s *Server) handlePauseTransfer(w http.ResponseWriter, r *http.Request) {
 	transferID := vars["id"]
 
 	query := `UPDATE transfers SET status = 'paused', pending_command = 'pause', command_acknowledged = false, updated_at = $1
-	           WHERE id = $2 AND status IN ('downloading', 'checking', 'queued')`
+	           WHERE id = $2 AND status IN ('downloading', 'checking', 'queued', 'waiting_for_space')`
 	result, err := s.db.Exec(query, time.Now(), transferID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to pause transfer", "")
@@ -1170,6 +1304,7 @@ func (s *Server) handlePauseTransfer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Printf("[transfers] Transfer %s paused", transferID)
+	s.dispatchTransfer(transferID)
 	s.logActivity(r, "transfer.pause", "transfers", "transfer", transferID, "", "", "success")
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Transfer paused"})
 }
@@ -1192,6 +1327,7 @@ func (s *Server) handleResumeTransfer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Printf("[transfers] Transfer %s resumed", transferID)
+	s.dispatchTransfer(transferID)
 	s.logActivity(r, "transfer.resume", "transfers", "transfer", transferID, "", "", "success")
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Transfer resumed"})
 }
@@ -1230,6 +1366,7 @@ func (s *Server) handleRetryTransfer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Transfer %s retried (reset to queued)", transferID)
+	s.dispatchTransfer(transferID)
 	s.logActivity(r, "transfer.retry", "transfers", "transfer", transferID, "", "", "success")
 	respondJSON(w, http.StatusOK, map[string]string{
 		"message": "Transfer queued for retry",
@@ -2020,6 +2157,8 @@ func (s *Server) handleGetPackageServerStatus(w http.ResponseWriter, r *http.Req
 				item.Status = "checking"
 			case "queued":
 				item.Status = "queued"
+			case "waiting_for_space":
+				item.Status = "waiting_for_space"
 			case "error", "failed":
 				item.Status = "error"
 			case "completed":
@@ -2066,11 +2205,13 @@ func (s *Server) handleGetPackageServerStatus(w http.ResponseWriter, r *http.Req
 	respondJSON(w, http.StatusOK, items)
 }
 
-// handleCreateContentCommand creates a content management command (delete) for a server
+// handleCreateContentCommand creates a content management command (delete) for a server, or for
+// every server of a group that holds the package or is receiving it
 func (s *Server) handleCreateContentCommand(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		PackageID  string `json:"package_id"`
 		ServerID   string `json:"server_id"`
+		GroupID    string `json:"group_id"`    // instead of server_id
 		Command    string `json:"command"`     // "delete"
 		TargetPath string `json:"target_path"` // optional: specific path to delete from
 	}
@@ -2078,7 +2219,7 @@ func (s *Server) handleCreateContentCommand(w http.ResponseWriter, r *http.Reque
 		respondError(w, http.StatusBadRequest, "Invalid request body", "")
 		return
 	}
-	if req.PackageID == "" || req.ServerID == "" || req.Command == "" {
+	if req.PackageID == "" || (req.ServerID == "" && req.GroupID == "") || req.Command == "" {
 		respondError(w, http.StatusBadRequest, "Missing required fields", "")
 		return
 	}
@@ -2106,15 +2247,78 @@ func (s *Server) handleCreateContentCommand(w http.ResponseWriter, r *http.Reque
 		ih = infoHash.String
 	}
 
+	if req.GroupID != "" {
+		serverIDs, ok := s.groupServerIDs(w, req.GroupID)
+		if !ok {
+			return
+		}
+		queued := []map[string]interface{}{}
+		failed := []map[string]interface{}{}
+		for _, serverID := range serverIDs {
+			var involved bool
+			err := s.db.QueryRow(`
+				SELECT EXISTS (SELECT 1 FROM server_dcp_inventory WHERE package_id = $1 AND server_id = $2)
+				    OR EXISTS (SELECT 1 FROM transfers t JOIN dcp_torrents dt ON dt.id = t.torrent_id
+				               WHERE dt.package_id = $1 AND t.destination_server_id = $2
+				                 AND t.status IN ('downloading', 'paused', 'checking', 'queued', 'waiting_for_space', 'error', 'failed'))`,
+				req.PackageID, serverID).Scan(&involved)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Failed to check group servers", err.Error())
+				return
+			}
+			if !involved {
+				continue
+			}
+			transferID, err := s.queueContentCommand(req.PackageID, packageName, ih, serverID.String(), req.Command, req.TargetPath)
+			if err != nil {
+				failed = append(failed, map[string]interface{}{"server_id": serverID, "error": err.Error()})
+				continue
+			}
+			entry := map[string]interface{}{"server_id": serverID}
+			if transferID != "" {
+				entry["transfer_id"] = transferID
+			}
+			queued = append(queued, entry)
+		}
+		s.logActivity(r, "content.command", "content", "package", req.PackageID, packageName,
+			fmt.Sprintf(`{"group_id":%q,"servers":%d}`, req.GroupID, len(queued)), "success")
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"message": fmt.Sprintf("Delete queued on %d server(s)", len(queued)),
+			"servers": queued,
+			"failed":  failed,
+		})
+		return
+	}
+
+	transferID, err := s.queueContentCommand(req.PackageID, packageName, ih, req.ServerID, req.Command, req.TargetPath)
+	if err != nil {
+		if transferID != "" {
+			respondError(w, http.StatusInternalServerError, "Failed to cancel transfer", "")
+		} else {
+			respondError(w, http.StatusInternalServerError, "Failed to create command", "")
+		}
+		return
+	}
+	if transferID != "" {
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Transfer cancelled with delete", "transfer_id": transferID})
+		return
+	}
+	s.logActivity(r, "content.command", "content", "package", req.PackageID, "", "", "success")
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Delete command queued"})
+}
+
+// queueContentCommand deletes a package from a server. An open transfer of the package to the
+// server is cancelled with its data instead, and its ID returned.
+func (s *Server) queueContentCommand(packageID, packageName, infoHash, serverID, command, targetPath string) (string, error) {
 	// Check for existing active transfer — if one exists, cancel it with delete_data
 	var existingTransferID string
-	err = s.db.QueryRow(`
+	err := s.db.QueryRow(`
 		SELECT t.id FROM transfers t
 		JOIN dcp_torrents dt ON dt.id = t.torrent_id
 		WHERE dt.package_id = $1 AND t.destination_server_id = $2
-		AND t.status IN ('downloading', 'paused', 'checking', 'queued', 'error', 'failed')
+		AND t.status IN ('downloading', 'paused', 'checking', 'queued', 'waiting_for_space', 'error', 'failed')
 		ORDER BY t.created_at DESC LIMIT 1
-	`, req.PackageID, req.ServerID).Scan(&existingTransferID)
+	`, packageID, serverID).Scan(&existingTransferID)
 
 	if err == nil && existingTransferID != "" {
 		// Cancel the existing transfer with delete_data
@@ -2124,27 +2328,27 @@ func (s *Server) handleCreateContentCommand(w http.ResponseWriter, r *http.Reque
 			WHERE id = $2
 		`, time.Now(), existingTransferID)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, "Failed to cancel transfer", "")
-			return
+			return existingTransferID, err
 		}
-		log.Printf("[content-cmd] Cancelled transfer %s with delete for package %s on server %s", existingTransferID, packageName, req.ServerID)
-		respondJSON(w, http.StatusOK, map[string]string{"message": "Transfer cancelled with delete", "transfer_id": existingTransferID})
-		return
+		log.Printf("[content-cmd] Cancelled transfer %s with delete for package %s on server %s", existingTransferID, packageName, serverID)
+		s.dispatchTransfer(existingTransferID)
+		return existingTransferID, nil
 	}
 
 	// No active transfer — create a content command
 	_, err = s.db.Exec(`
 		INSERT INTO content_commands (package_id, server_id, package_name, info_hash, command, target_path)
 		VALUES ($1, $2, $3, $4, $5, $6)
-	`, req.PackageID, req.ServerID, packageName, ih, req.Command, req.TargetPath)
+	`, packageID, serverID, packageName, infoHash, command, targetPath)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create command", "")
-		return
+		return "", err
 	}
 
-	log.Printf("[content-cmd] Created delete command for package %s on server %s", packageName, req.ServerID)
-	s.logActivity(r, "content.command", "content", "package", req.PackageID, "", "", "success")
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Delete command queued"})
+	log.Printf("[content-cmd] Created delete command for package %s on server %s", packageName, serverID)
+	if id, err := uuid.Parse(serverID); err == nil {
+		s.dispatch(id)
+	}
+	return "", nil
 }
 
 // CanonicalXMLRequest asks the main server for the canonical XML metadata files for a DCP
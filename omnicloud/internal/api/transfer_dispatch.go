@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	ws "github.com/omnicloud/omnicloud/internal/websocket"
+)
+
+const (
+	// dispatchInterval is how often the work of connected clients is pushed again, so clients
+	// measure the space for held transfers again and pushes that got no answer are retried
+	dispatchInterval = 30 * time.Second
+
+	// startTransfersTimeout bounds the wait for a client to start pushed transfers, which
+	// includes fetching their torrent files
+	startTransfersTimeout = 2 * time.Minute
+
+	// commandTimeout bounds the wait for a client to execute a pushed command
+	commandTimeout = 30 * time.Second
+)
+
+// dispatch pushes the pending transfers, transfer commands and content commands of a server
+// over its websocket in the background. Clients without a websocket poll for them instead.
+// While a push to the server is under way a further one is run once it is done, so work queued
+// meanwhile is not missed and the server is never pushed the same work twice at once.
+func (s *Server) dispatch(serverID uuid.UUID) {
+	if s.wsHub == nil || !s.wsHub.IsClientConnected(serverID) {
+		return
+	}
+
+	s.dispatchMu.Lock()
+	if _, running := s.dispatching[serverID]; running {
+		s.dispatching[serverID] = true
+		s.dispatchMu.Unlock()
+		return
+	}
+	s.dispatching[serverID] = false
+	s.dispatchMu.Unlock()
+
+	go func() {
+		for {
+			s.pushWork(serverID)
+
+			s.dispatchMu.Lock()
+			if !s.dispatching[serverID] {
+				delete(s.dispatching, serverID)
+				s.dispatchMu.Unlock()
+				return
+			}
+			s.dispatching[serverID] = false
+			s.dispatchMu.Unlock()
+		}
+	}()
+}
+
+// RunTransferDispatch pushes the work of every connected client every dispatchInterval until ctx
+// is done (main server only)
+func (s *Server) RunTransferDispatch(ctx context.Context) {
+	if s.wsHub == nil {
+		return
+	}
+
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, serverID := range s.wsHub.GetConnectedClients() {
+				s.dispatch(serverID)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pushWork pushes a server's commands first, so a transfer cancelled or paused before it
+// started is not started, then its pending transfers
+func (s *Server) pushWork(serverID uuid.UUID) {
+	commands, err := s.transferCommands(serverID)
+	if err != nil {
+		log.Printf("[dispatch] Failed to load transfer commands of server %s: %v", serverID, err)
+	}
+	for _, cmd := range commands {
+		transferID, _ := cmd["id"].(string)
+		result, message, ok := s.pushCommand(serverID, ws.CommandTransferCommand, cmd)
+		if !ok {
+			continue
+		}
+		if err := s.acknowledgeTransferCommand(serverID, transferID, result, message); err != nil {
+			log.Printf("[dispatch] Failed to record acknowledgement of transfer %s: %v", transferID, err)
+		}
+	}
+
+	contentCommands, err := s.contentCommands(serverID)
+	if err != nil {
+		log.Printf("[dispatch] Failed to load content commands of server %s: %v", serverID, err)
+	}
+	for _, cmd := range contentCommands {
+		commandID, _ := cmd["id"].(string)
+		result, message, ok := s.pushCommand(serverID, ws.CommandContentCommand, cmd)
+		if !ok {
+			continue
+		}
+		if err := s.acknowledgeContentCommand(serverID, commandID, result, message); err != nil {
+			log.Printf("[dispatch] Failed to record acknowledgement of content command %s: %v", commandID, err)
+		}
+	}
+
+	transfers, err := s.pendingTransfers(serverID)
+	if err != nil {
+		log.Printf("[dispatch] Failed to load pending transfers of server %s: %v", serverID, err)
+		return
+	}
+	if len(transfers) == 0 {
+		return
+	}
+	resp, err := s.wsHub.SendCommandAndWait(serverID, ws.CommandStartTransfers,
+		map[string]interface{}{"transfers": transfers}, startTransfersTimeout)
+	if err != nil {
+		log.Printf("[dispatch] Pushing %d transfer(s) to server %s failed: %v", len(transfers), serverID, err)
+		return
+	}
+	if !resp.Success {
+		log.Printf("[dispatch] Server %s did not take %d pushed transfer(s): %s %s", serverID, len(transfers), resp.Message, resp.Error)
+	}
+}
+
+// pushCommand pushes a transfer or content command and returns the result the client
+// acknowledged it with. ok is false when the client did not answer or does not know the
+// command; it stays pending and is pushed (or polled) again.
+func (s *Server) pushCommand(serverID uuid.UUID, command ws.CommandType, payload map[string]interface{}) (result, message string, ok bool) {
+	resp, err := s.wsHub.SendCommandAndWait(serverID, command, payload, commandTimeout)
+	if err != nil {
+		log.Printf("[dispatch] Pushing %s %v to server %s failed: %v", command, payload["id"], serverID, err)
+		return "", "", false
+	}
+
+	if p, isMap := resp.Payload.(map[string]interface{}); isMap {
+		result, _ = p["result"].(string)
+	}
+	if result == "" {
+		log.Printf("[dispatch] Server %s gave no result for %s %v: %s %s", serverID, command, payload["id"], resp.Message, resp.Error)
+		return "", "", false
+	}
+
+	message = resp.Message
+	if resp.Error != "" {
+		message = resp.Error
+	}
+	return result, message, true
+}
+
+// dispatchTransfer pushes the work of the destination server of a transfer, e.g. after a
+// command was queued for it
+func (s *Server) dispatchTransfer(transferID string) {
+	var serverID uuid.UUID
+	if err := s.db.QueryRow(`SELECT destination_server_id FROM transfers WHERE id = $1`, transferID).Scan(&serverID); err != nil {
+		return
+	}
+	s.dispatch(serverID)
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/torrent"
+)
+
+// deadlineCheckInterval is how often the completion of transfers with a deadline is predicted
+const deadlineCheckInterval = time.Minute
+
+// bandwidthScheduleView converts a stored bandwidth calendar into the form the API and the
+// clients' torrent engines use
+func bandwidthScheduleView(sched *db.BandwidthSchedule) *torrent.BandwidthSchedule {
+	view := &torrent.BandwidthSchedule{
+		Timezone:    sched.Timezone,
+		DownloadBps: sched.DownloadLimitBps,
+		UploadBps:   sched.UploadLimitBps,
+		Windows:     []torrent.BandwidthWindow{},
+	}
+	for _, w := range sched.Windows {
+		days := make([]int, 0, len(w.DaysOfWeek))
+		for _, d := range w.DaysOfWeek {
+			days = append(days, int(d))
+		}
+		view.Windows = append(view.Windows, torrent.BandwidthWindow{
+			ID:          w.ID.String(),
+			Days:        days,
+			Start:       torrent.FormatClock(w.StartMinute),
+			End:         torrent.FormatClock(w.EndMinute),
+			DownloadBps: w.DownloadLimitBps,
+			UploadBps:   w.UploadLimitBps,
+		})
+	}
+	return view
+}
+
+// BandwidthSchedule returns the bandwidth calendar of a server, nil if there is no such server
+func (s *Server) BandwidthSchedule(serverID uuid.UUID) (*torrent.BandwidthSchedule, error) {
+	sched, err := s.database.GetBandwidthSchedule(serverID)
+	if err != nil || sched == nil {
+		return nil, err
+	}
+	return bandwidthScheduleView(sched), nil
+}
+
+// handleGetBandwidthSchedule returns a server's bandwidth calendar and the limits in force now
+func (s *Server) handleGetBandwidthSchedule(w http.ResponseWriter, r *http.Request) {
+	serverID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	sched, err := s.BandwidthSchedule(serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load bandwidth schedule", err.Error())
+		return
+	}
+	if sched == nil {
+		respondError(w, http.StatusNotFound, "Server not found", "")
+		return
+	}
+
+	down, up := sched.Limits(time.Now())
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"server_id":                  serverID,
+		"schedule":                   sched,
+		"current_download_limit_bps": down,
+		"current_upload_limit_bps":   up,
+	})
+}
+
+// handleUpdateBandwidthSchedule replaces a server's bandwidth calendar. The client picks the new
+// schedule up within a few minutes.
+func (s *Server) handleUpdateBandwidthSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	var req torrent.BandwidthSchedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid bandwidth schedule", err.Error())
+		return
+	}
+
+	existing, err := s.database.GetBandwidthSchedule(serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load bandwidth schedule", err.Error())
+		return
+	}
+	if existing == nil {
+		respondError(w, http.StatusNotFound, "Server not found", "")
+		return
+	}
+
+	sched := &db.BandwidthSchedule{
+		ServerID:         serverID,
+		Timezone:         req.Timezone,
+		DownloadLimitBps: req.DownloadBps,
+		UploadLimitBps:   req.UploadBps,
+	}
+	for _, win := range req.Windows {
+		start, _ := torrent.ParseClock(win.Start)
+		end, _ := torrent.ParseClock(win.End)
+		days := make([]int64, 0, len(win.Days))
+		for _, d := range win.Days {
+			days = append(days, int64(d))
+		}
+		sched.Windows = append(sched.Windows, &db.BandwidthWindow{
+			DaysOfWeek:       days,
+			StartMinute:      start % (24 * 60),
+			EndMinute:        end % (24 * 60),
+			DownloadLimitBps: win.DownloadBps,
+			UploadLimitBps:   win.UploadBps,
+		})
+	}
+	if err := s.database.ReplaceBandwidthSchedule(sched); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save bandwidth schedule", err.Error())
+		return
+	}
+
+	log.Printf("[bandwidth] Updated bandwidth schedule of server %s (%d window(s))", serverID, len(sched.Windows))
+	s.logActivity(r, "bandwidth.update", "system", "server", vars["id"], "", "", "success")
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":  "Bandwidth schedule updated",
+		"schedule": bandwidthScheduleView(sched),
+	})
+}
+
+// RunDeadlineMonitor predicts the completion of every open transfer with a delivery deadline
+// every deadlineCheckInterval until ctx is cancelled
+func (s *Server) RunDeadlineMonitor(ctx context.Context) {
+	ticker := time.NewTicker(deadlineCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.predictTransferCompletion(); err != nil {
+				log.Printf("[deadlines] Error predicting transfer completion: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// predictTransferCompletion works out when each open transfer with a deadline will finish, from
+// its current speed (or, before it runs, the destination's recent throughput) and the
+// destination's bandwidth calendar, and flags the transfers predicted to miss their deadline.
+// The prediction also drives the order pending transfers are handed out in.
+func (s *Server) predictTransferCompletion() error {
+	rows, err := s.db.Query(`
+		SELECT t.id, t.destination_server_id, t.deliver_by, t.deadline_at_risk,
+		       t.downloaded_bytes, t.download_speed_bps,
+		       COALESCE(dt.total_size_bytes, dp.total_size_bytes, 0),
+		       COALESCE(dp.package_name, '')
+		FROM transfers t
+		LEFT JOIN dcp_torrents dt ON t.torrent_id = dt.id
+		LEFT JOIN dcp_packages dp ON dt.package_id = dp.id
+		WHERE t.deliver_by IS NOT NULL
+		  AND t.status IN ('queued', 'waiting_for_space', 'downloading', 'checking', 'active', 'paused')
+	`)
+	if err != nil {
+		return err
+	}
+
+	type scheduledTransfer struct {
+		id, serverID             uuid.UUID
+		packageName              string
+		deliverBy                time.Time
+		atRisk                   bool
+		downloaded, speed, total int64
+	}
+	var transfers []scheduledTransfer
+	for rows.Next() {
+		var t scheduledTransfer
+		if err := rows.Scan(&t.id, &t.serverID, &t.deliverBy, &t.atRisk,
+			&t.downloaded, &t.speed, &t.total, &t.packageName); err != nil {
+			rows.Close()
+			return err
+		}
+		transfers = append(transfers, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	schedules := make(map[uuid.UUID]*torrent.BandwidthSchedule)
+	throughput := make(map[uuid.UUID]int64)
+	for _, t := range transfers {
+		sched, ok := schedules[t.serverID]
+		if !ok {
+			if sched, err = s.BandwidthSchedule(t.serverID); err != nil {
+				log.Printf("[deadlines] Failed to load bandwidth schedule of server %s: %v", t.serverID, err)
+			}
+			schedules[t.serverID] = sched
+		}
+
+		speed := t.speed
+		if speed <= 0 {
+			rate, ok := throughput[t.serverID]
+			if !ok {
+				if rate, err = s.recentThroughput(t.serverID); err != nil {
+					log.Printf("[deadlines] Failed to measure throughput of server %s: %v", t.serverID, err)
+				}
+				throughput[t.serverID] = rate
+			}
+			speed = rate
+		}
+
+		// Without any speed to go by only a deadline that has passed is known to be missed
+		var predicted *time.Time
+		atRisk := !now.Before(t.deliverBy)
+		if at, ok := sched.EstimateCompletion(now, t.total-t.downloaded, speed); ok {
+			predicted = &at
+			atRisk = at.After(t.deliverBy)
+		}
+
+		if _, err := s.db.Exec(`UPDATE transfers SET predicted_completion_at = $2, deadline_at_risk = $3 WHERE id = $1`,
+			t.id, predicted, atRisk); err != nil {
+			return err
+		}
+		if atRisk && !t.atRisk {
+			eta := "unknown"
+			if predicted != nil {
+				eta = predicted.Format(time.RFC3339)
+			}
+			log.Printf("[deadlines] Transfer %s of %q is predicted to miss its deadline %s (predicted completion %s)",
+				t.id, t.packageName, t.deliverBy.Format(time.RFC3339), eta)
+		}
+	}
+	return nil
+}
+
+// recentThroughput returns the average download rate (bytes/s) of a server's transfers that
+// completed in the last 30 days, 0 when it has none
+func (s *Server) recentThroughput(serverID uuid.UUID) (int64, error) {
+	var rate float64
+	err := s.db.QueryRow(`
+		SELECT COALESCE(AVG(downloaded_bytes / EXTRACT(EPOCH FROM (completed_at - started_at))), 0)
+		FROM transfers
+		WHERE destination_server_id = $1 AND status = 'completed' AND downloaded_bytes > 0
+		  AND completed_at > started_at + INTERVAL '1 minute'
+		  AND completed_at > NOW() - INTERVAL '30 days'
+	`, serverID).Scan(&rate)
+	return int64(rate), err
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+)
+
+// handleGetDCPValidation returns the structural validation findings of a package on every
+// server holding it. ?server_id= restricts them to one server.
+func (s *Server) handleGetDCPValidation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	dcpUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid DCP UUID", err.Error())
+		return
+	}
+
+	var serverID *uuid.UUID
+	if v := r.URL.Query().Get("server_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+			return
+		}
+		serverID = &id
+	}
+
+	pkg, err := s.database.GetDCPPackageByAssetMapUUID(dcpUUID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query DCP", err.Error())
+		return
+	}
+	if pkg == nil {
+		respondError(w, http.StatusNotFound, "DCP not found", "")
+		return
+	}
+
+	findings, err := s.database.GetDCPValidationFindings(pkg.ID, serverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query validation findings", err.Error())
+		return
+	}
+
+	serverNames := make(map[uuid.UUID]string)
+	counts := map[string]int{db.FindingError: 0, db.FindingWarning: 0, db.FindingInfo: 0}
+	findingList := make([]map[string]interface{}, 0, len(findings))
+	for _, f := range findings {
+		name, ok := serverNames[f.ServerID]
+		if !ok {
+			if sv, err := s.database.GetServer(f.ServerID); err == nil && sv != nil {
+				name = sv.DisplayName
+				if name == "" {
+					name = sv.Name
+				}
+			}
+			serverNames[f.ServerID] = name
+		}
+		counts[f.Severity]++
+		findingList = append(findingList, map[string]interface{}{
+			"check":       f.CheckID,
+			"severity":    f.Severity,
+			"subject":     f.Subject,
+			"message":     f.Message,
+			"server_id":   f.ServerID,
+			"server_name": name,
+			"checked_at":  f.CreatedAt,
+		})
+	}
+
+	status := "clean"
+	switch {
+	case counts[db.FindingError] > 0:
+		status = db.FindingError
+	case counts[db.FindingWarning] > 0:
+		status = db.FindingWarning
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"package_id":    pkg.ID,
+		"assetmap_uuid": pkg.AssetMapUUID,
+		"package_name":  pkg.PackageName,
+		"status":        status,
+		"error_count":   counts[db.FindingError],
+		"warning_count": counts[db.FindingWarning],
+		"info_count":    counts[db.FindingInfo],
+		"findings":      findingList,
+	})
+}
+
+// handleListPackagesWithFindings lists the packages the validator found errors in on any server.
+// ?severity=warning also includes packages that only have warnings.
+func (s *Server) handleListPackagesWithFindings(w http.ResponseWriter, r *http.Request) {
+	severity := r.URL.Query().Get("severity")
+	switch severity {
+	case "":
+		severity = db.FindingError
+	case db.FindingError, db.FindingWarning:
+	default:
+		respondError(w, http.StatusBadRequest, "Invalid severity", "severity must be error or warning")
+		return
+	}
+
+	summaries, err := s.database.ListPackagesWithFindings(severity)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query validation findings", err.Error())
+		return
+	}
+
+	packages := make([]map[string]interface{}, 0, len(summaries))
+	for _, v := range summaries {
+		packages = append(packages, map[string]interface{}{
+			"package_id":    v.PackageID,
+			"assetmap_uuid": v.AssetMapUUID,
+			"package_name":  v.PackageName,
+			"error_count":   v.ErrorCount,
+			"warning_count": v.WarningCount,
+			"server_count":  v.ServerCount,
+			"last_checked":  v.LastChecked,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"severity": severity,
+		"packages": packages,
+		"total":    len(packages),
+	})
+}
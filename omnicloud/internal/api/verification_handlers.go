@@ -0,0 +1,409 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/omnicloud/omnicloud/internal/db"
+	ws "github.com/omnicloud/omnicloud/internal/websocket"
+)
+
+// verificationTimeout is how long a verification run may stay pending or running before it is
+// marked as errored; hashing even a large feature takes a fraction of this
+const verificationTimeout = 12 * time.Hour
+
+// verificationTimeoutInterval is how often stale verification runs are looked for
+const verificationTimeoutInterval = 10 * time.Minute
+
+// VerifyPackageFunc runs a PKL hash verification of a package on this server's local disk
+// and returns the verdict with per-asset results (see scanner.PackageVerifier.Verify).
+type VerifyPackageFunc func(packageID, packageName, packagePath string) (*db.DCPVerification, []*db.DCPVerificationAsset, error)
+
+// RegisterLocalVerifier lets POST /dcps/{uuid}/verify run verifications for packages held by this server itself
+func (s *Server) RegisterLocalVerifier(verify VerifyPackageFunc) {
+	s.localVerify = verify
+}
+
+// VerificationReport is the result of a verification run, sent from a client to the main server
+type VerificationReport struct {
+	VerificationID string                    `json:"verification_id"`
+	PackageID      string                    `json:"package_id"`
+	Status         string                    `json:"status"`
+	ErrorMessage   string                    `json:"error_message,omitempty"`
+	StartedAt      *time.Time                `json:"started_at,omitempty"`
+	CompletedAt    *time.Time                `json:"completed_at,omitempty"`
+	AssetsTotal    int                       `json:"assets_total"`
+	AssetsPassed   int                       `json:"assets_passed"`
+	AssetsFailed   int                       `json:"assets_failed"`
+	BytesTotal     int64                     `json:"bytes_total"`
+	Assets         []VerificationAssetReport `json:"assets"`
+}
+
+// VerificationAssetReport is the result for a single PKL asset
+type VerificationAssetReport struct {
+	AssetUUID    string `json:"asset_uuid,omitempty"`
+	FilePath     string `json:"file_path"`
+	ExpectedSize int64  `json:"expected_size"`
+	ActualSize   int64  `json:"actual_size"`
+	ExpectedHash string `json:"expected_hash"`
+	ActualHash   string `json:"actual_hash,omitempty"`
+	Status       string `json:"status"`
+	Message      string `json:"message,omitempty"`
+}
+
+// NewVerificationReport builds the wire report for a finished verification run
+func NewVerificationReport(verificationID, packageID string, run *db.DCPVerification, assets []*db.DCPVerificationAsset) *VerificationReport {
+	report := &VerificationReport{
+		VerificationID: verificationID,
+		PackageID:      packageID,
+		Status:         run.Status,
+		ErrorMessage:   run.ErrorMessage,
+		StartedAt:      run.StartedAt,
+		CompletedAt:    run.CompletedAt,
+		AssetsTotal:    run.AssetsTotal,
+		AssetsPassed:   run.AssetsPassed,
+		AssetsFailed:   run.AssetsFailed,
+		BytesTotal:     run.BytesTotal,
+	}
+	for _, a := range assets {
+		ar := VerificationAssetReport{
+			FilePath:     a.FilePath,
+			ExpectedSize: a.ExpectedSize,
+			ActualSize:   a.ActualSize,
+			ExpectedHash: a.ExpectedHash,
+			ActualHash:   a.ActualHash,
+			Status:       a.Status,
+			Message:      a.Message,
+		}
+		if a.AssetUUID != nil {
+			ar.AssetUUID = a.AssetUUID.String()
+		}
+		report.Assets = append(report.Assets, ar)
+	}
+	return report
+}
+
+// handleVerifyDCP starts a PKL hash verification of a package on a server that holds it.
+// The command is dispatched over the WebSocket channel (or run in-process when this server holds
+// the package); the client reports results to /servers/{id}/verification-result when done.
+func (s *Server) handleVerifyDCP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	dcpUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid DCP UUID", err.Error())
+		return
+	}
+
+	var req struct {
+		ServerID string `json:"server_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	pkg, err := s.database.GetDCPPackageByAssetMapUUID(dcpUUID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query DCP", err.Error())
+		return
+	}
+	if pkg == nil {
+		respondError(w, http.StatusNotFound, "DCP not found", "")
+		return
+	}
+
+	// Pick a server holding the package: the requested one, otherwise the first reachable one
+	rows, err := s.db.Query(`
+		SELECT server_id, local_path FROM server_dcp_inventory
+		WHERE package_id = $1 AND status = 'online'
+		ORDER BY last_verified DESC
+	`, pkg.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query inventory", err.Error())
+		return
+	}
+	var serverID uuid.UUID
+	var localPath string
+	holders := 0
+	for rows.Next() {
+		var sid uuid.UUID
+		var path string
+		if err := rows.Scan(&sid, &path); err != nil {
+			continue
+		}
+		holders++
+		if req.ServerID != "" && sid.String() != req.ServerID {
+			continue
+		}
+		if s.isLocalServer(sid) || (s.wsHub != nil && s.wsHub.IsClientConnected(sid)) {
+			serverID, localPath = sid, path
+			break
+		}
+	}
+	rows.Close()
+
+	if localPath == "" {
+		msg := "No server holding this package is connected"
+		if holders == 0 {
+			msg = "No server holds this package"
+		} else if req.ServerID != "" {
+			msg = "Requested server does not hold this package or is not connected"
+		}
+		respondError(w, http.StatusConflict, msg, "")
+		return
+	}
+
+	now := time.Now()
+	run := &db.DCPVerification{
+		ID:        uuid.New(),
+		PackageID: pkg.ID,
+		ServerID:  serverID,
+		Status:    db.VerificationRunning,
+		StartedAt: &now,
+		CreatedAt: now,
+	}
+	if err := s.database.CreateDCPVerification(run); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create verification", err.Error())
+		return
+	}
+
+	if s.isLocalServer(serverID) {
+		go s.runLocalVerification(run, pkg.PackageName, localPath)
+	} else {
+		payload := map[string]interface{}{
+			"verification_id": run.ID.String(),
+			"package_id":      pkg.ID.String(),
+			"package_name":    pkg.PackageName,
+			"local_path":      localPath,
+		}
+		resp, err := s.wsHub.SendCommandAndWait(serverID, ws.CommandVerifyPackage, payload, 30*time.Second)
+		if err == nil && !resp.Success {
+			err = fmt.Errorf("%s: %s", resp.Message, resp.Error)
+		}
+		if err != nil {
+			log.Printf("[verify] Failed to dispatch verification of %s to server %s: %v", pkg.PackageName, serverID, err)
+			s.database.UpdateDCPVerificationStatus(run.ID, db.VerificationError, err.Error())
+			respondError(w, http.StatusBadGateway, "Client did not start verification", err.Error())
+			return
+		}
+	}
+
+	log.Printf("[verify] Verification %s of %s started on server %s", run.ID, pkg.PackageName, serverID)
+	s.logActivity(r, "dcp.verify", "content", "dcp", pkg.ID.String(), pkg.PackageName, "", "success")
+
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"verification_id": run.ID,
+		"server_id":       serverID,
+		"status":          run.Status,
+		"message":         "Verification started",
+	})
+}
+
+// isLocalServer reports whether serverID is this process and it can verify packages in-process
+func (s *Server) isLocalServer(serverID uuid.UUID) bool {
+	return s.localVerify != nil && s.selfServerID != nil && *s.selfServerID == serverID
+}
+
+// runLocalVerification verifies a package held by this server and stores the results
+func (s *Server) runLocalVerification(run *db.DCPVerification, packageName, localPath string) {
+	result, assets, err := s.localVerify(run.PackageID.String(), packageName, localPath)
+	if err != nil {
+		s.database.UpdateDCPVerificationStatus(run.ID, db.VerificationError, err.Error())
+		return
+	}
+	result.ID = run.ID
+	result.PackageID = run.PackageID
+	result.ServerID = run.ServerID
+	for _, a := range assets {
+		a.VerificationID = run.ID
+	}
+	if err := s.database.CompleteDCPVerification(result, assets); err != nil {
+		log.Printf("[verify] Failed to store verification %s: %v", run.ID, err)
+	}
+}
+
+// handleReportVerification receives the results of a verification run from a client server
+func (s *Server) handleReportVerification(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	var report VerificationReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	verificationID, err := uuid.Parse(report.VerificationID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid verification ID", err.Error())
+		return
+	}
+
+	run, err := s.database.GetDCPVerification(verificationID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query verification", err.Error())
+		return
+	}
+	if run == nil || run.ServerID != serverID {
+		respondError(w, http.StatusNotFound, "Verification not found", "")
+		return
+	}
+	if run.Status != db.VerificationPending && run.Status != db.VerificationRunning {
+		respondError(w, http.StatusConflict, "Verification already finished", run.Status)
+		return
+	}
+
+	switch report.Status {
+	case db.VerificationPassed, db.VerificationFailed, db.VerificationError:
+	default:
+		respondError(w, http.StatusBadRequest, "Invalid verification status", report.Status)
+		return
+	}
+
+	run.Status = report.Status
+	run.ErrorMessage = report.ErrorMessage
+	run.StartedAt = report.StartedAt
+	run.CompletedAt = report.CompletedAt
+	if run.CompletedAt == nil {
+		now := time.Now()
+		run.CompletedAt = &now
+	}
+	run.AssetsTotal = report.AssetsTotal
+	run.AssetsPassed = report.AssetsPassed
+	run.AssetsFailed = report.AssetsFailed
+	run.BytesTotal = report.BytesTotal
+
+	var assets []*db.DCPVerificationAsset
+	for _, ar := range report.Assets {
+		a := &db.DCPVerificationAsset{
+			ID:             uuid.New(),
+			VerificationID: run.ID,
+			FilePath:       ar.FilePath,
+			ExpectedSize:   ar.ExpectedSize,
+			ActualSize:     ar.ActualSize,
+			ExpectedHash:   ar.ExpectedHash,
+			ActualHash:     ar.ActualHash,
+			Status:         ar.Status,
+			Message:        ar.Message,
+		}
+		if u, err := uuid.Parse(ar.AssetUUID); err == nil {
+			a.AssetUUID = &u
+		}
+		assets = append(assets, a)
+	}
+
+	if err := s.database.CompleteDCPVerification(run, assets); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to store verification", err.Error())
+		return
+	}
+
+	log.Printf("[verify] Server %s reported verification %s: %s (%d passed, %d failed)",
+		serverID, run.ID, run.Status, run.AssetsPassed, run.AssetsFailed)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Verification results stored",
+	})
+}
+
+// RunVerificationTimeouts marks verification runs whose results never arrived as errored every
+// verificationTimeoutInterval until ctx is cancelled
+func (s *Server) RunVerificationTimeouts(ctx context.Context) {
+	ticker := time.NewTicker(verificationTimeoutInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := s.database.ExpireDCPVerifications(time.Now().Add(-verificationTimeout))
+			if err != nil {
+				log.Printf("[verify] Error expiring stale verifications: %v", err)
+			} else if n > 0 {
+				log.Printf("[verify] Marked %d verification(s) with no result after %s as errored", n, verificationTimeout)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleGetDCPVerification returns the latest verification run of a package with per-asset results
+func (s *Server) handleGetDCPVerification(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	dcpUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid DCP UUID", err.Error())
+		return
+	}
+
+	pkg, err := s.database.GetDCPPackageByAssetMapUUID(dcpUUID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query DCP", err.Error())
+		return
+	}
+	if pkg == nil {
+		respondError(w, http.StatusNotFound, "DCP not found", "")
+		return
+	}
+
+	run, err := s.database.GetLatestDCPVerification(pkg.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query verification", err.Error())
+		return
+	}
+	if run == nil {
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"package_id":    pkg.ID,
+			"last_verified": pkg.LastVerified,
+			"verification":  nil,
+		})
+		return
+	}
+
+	assets, err := s.database.GetDCPVerificationAssets(run.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query verification results", err.Error())
+		return
+	}
+	assetList := make([]map[string]interface{}, 0, len(assets))
+	for _, a := range assets {
+		assetList = append(assetList, map[string]interface{}{
+			"asset_uuid":    a.AssetUUID,
+			"file_path":     a.FilePath,
+			"expected_size": a.ExpectedSize,
+			"actual_size":   a.ActualSize,
+			"expected_hash": a.ExpectedHash,
+			"actual_hash":   a.ActualHash,
+			"status":        a.Status,
+			"message":       a.Message,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"package_id":    pkg.ID,
+		"last_verified": pkg.LastVerified,
+		"verification": map[string]interface{}{
+			"id":            run.ID,
+			"server_id":     run.ServerID,
+			"status":        run.Status,
+			"assets_total":  run.AssetsTotal,
+			"assets_passed": run.AssetsPassed,
+			"assets_failed": run.AssetsFailed,
+			"bytes_total":   run.BytesTotal,
+			"error_message": run.ErrorMessage,
+			"started_at":    run.StartedAt,
+			"completed_at":  run.CompletedAt,
+			"assets":        assetList,
+		},
+	})
+}
@@ -133,7 +133,8 @@ func (s *Server) handleGetWebSocketClientStatus(w http.ResponseWriter, r *http.R
 }
 
 // handleDeleteContent sends a delete_content command to a client via WebSocket and waits for the result.
-// Also handles cancelling any active transfers and cleaning up main-server inventory on success.
+// The client moves the package to quarantine; on success the main-server inventory entry is marked
+// quarantined until the client purges it. Also handles cancelling any active transfers.
 func (s *Server) handleDeleteContent(w http.ResponseWriter, r *http.Request) {
 	if s.wsHub == nil {
 		respondError(w, http.StatusServiceUnavailable, "WebSocket not available", "")
@@ -191,7 +192,7 @@ func (s *Server) handleDeleteContent(w http.ResponseWriter, r *http.Request) {
 		SELECT t.id FROM transfers t
 		JOIN dcp_torrents dt ON dt.id = t.torrent_id
 		WHERE dt.package_id = $1 AND t.destination_server_id = $2
-		AND t.status IN ('downloading', 'paused', 'checking', 'queued', 'error', 'failed')
+		AND t.status IN ('downloading', 'paused', 'checking', 'queued', 'waiting_for_space', 'error', 'failed')
 		ORDER BY t.created_at DESC LIMIT 1
 	`, req.PackageID, serverID).Scan(&cancelledTransferID)
 
@@ -202,6 +203,7 @@ func (s *Server) handleDeleteContent(w http.ResponseWriter, r *http.Request) {
 			WHERE id = $2
 		`, time.Now(), cancelledTransferID)
 		log.Printf("[delete-content] Cancelled transfer %s for package %s on server %s", cancelledTransferID, packageName, serverID)
+		s.dispatch(serverID)
 	}
 
 	// Send delete_content command via WebSocket and wait for response
@@ -221,13 +223,16 @@ func (s *Server) handleDeleteContent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// On successful deletion, clean up main server inventory
+	// On successful deletion, mark the main server inventory entry quarantined
 	if resp.Success && req.TargetPath == "" {
-		_, err = s.db.Exec("DELETE FROM server_dcp_inventory WHERE server_id = $1 AND package_id = $2", serverID, req.PackageID)
+		_, err = s.db.Exec(`
+			UPDATE server_dcp_inventory SET status = 'quarantined', quarantined_at = $3, updated_at = $3
+			WHERE server_id = $1 AND package_id = $2
+		`, serverID, req.PackageID, time.Now())
 		if err != nil {
-			log.Printf("[delete-content] Warning: failed to remove inventory for server=%s package=%s: %v", serverID, req.PackageID, err)
+			log.Printf("[delete-content] Warning: failed to update inventory for server=%s package=%s: %v", serverID, req.PackageID, err)
 		} else {
-			log.Printf("[delete-content] Removed inventory entry for server=%s package=%s", serverID, req.PackageID)
+			log.Printf("[delete-content] Marked inventory entry quarantined for server=%s package=%s", serverID, req.PackageID)
 		}
 
 		// Also clean up ingestion status
@@ -249,3 +254,89 @@ func (s *Server) handleDeleteContent(w http.ResponseWriter, r *http.Request) {
 		"error":   resp.Error,
 	})
 }
+
+// handleRestoreContent sends a restore_content command to a client via WebSocket: the client moves a
+// quarantined package back into its library location and re-indexes it.
+func (s *Server) handleRestoreContent(w http.ResponseWriter, r *http.Request) {
+	if s.wsHub == nil {
+		respondError(w, http.StatusServiceUnavailable, "WebSocket not available", "")
+		return
+	}
+
+	vars := mux.Vars(r)
+	serverID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid server ID", err.Error())
+		return
+	}
+
+	var req struct {
+		PackageID string `json:"package_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if req.PackageID == "" {
+		respondError(w, http.StatusBadRequest, "package_id is required", "")
+		return
+	}
+
+	var status string
+	err = s.db.QueryRow(`
+		SELECT status FROM server_dcp_inventory WHERE server_id = $1 AND package_id = $2
+	`, serverID, req.PackageID).Scan(&status)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Package not found on this server", "")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+	if status != "quarantined" {
+		respondError(w, http.StatusConflict, "Package is not quarantined", "status is "+status)
+		return
+	}
+
+	if !s.wsHub.IsClientConnected(serverID) {
+		respondError(w, http.StatusServiceUnavailable, "Client not connected via WebSocket", "")
+		return
+	}
+
+	log.Printf("[restore-content] Sending restore command to server %s for package %s", serverID, req.PackageID)
+
+	resp, err := s.wsHub.SendCommandAndWait(serverID, ws.CommandRestoreContent, map[string]interface{}{
+		"package_id": req.PackageID,
+	}, 30*time.Second)
+	if err != nil {
+		log.Printf("[restore-content] Error: %v", err)
+		respondError(w, http.StatusGatewayTimeout, "Timeout or error waiting for client response", err.Error())
+		return
+	}
+
+	// The client re-indexes the package and reports its inventory; until then show it online
+	if resp.Success {
+		_, err = s.db.Exec(`
+			UPDATE server_dcp_inventory SET status = 'online', quarantine_path = NULL, quarantined_at = NULL, updated_at = $3
+			WHERE server_id = $1 AND package_id = $2
+		`, serverID, req.PackageID, time.Now())
+		if err != nil {
+			log.Printf("[restore-content] Warning: failed to update inventory for server=%s package=%s: %v", serverID, req.PackageID, err)
+		}
+	}
+
+	log.Printf("[restore-content] Result from server %s: success=%v message=%s", serverID, resp.Success, resp.Message)
+
+	result := "success"
+	if !resp.Success {
+		result = "failure"
+	}
+	s.logActivity(r, "content.restore", "content", "package", req.PackageID, "", "", result)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": resp.Success,
+		"message": resp.Message,
+		"error":   resp.Error,
+	})
+}
@@ -0,0 +1,420 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ext is the extension of the archives a library location may hold packages in. Only
+// uncompressed tar files can be read in place, so compressed ones are not indexed.
+const Ext = ".tar"
+
+// Paths inside an archive are written as the archive path followed by the member path, e.g.
+// /library/cold/FEATURE.tar/FEATURE_FTR/ASSETMAP.xml. The functions of this package accept
+// such paths as well as ordinary ones, which they pass to the os equivalent.
+
+// Member is a regular file stored in an archive
+type Member struct {
+	Name    string // slash-separated path inside the archive
+	Offset  int64  // offset of the file data in the archive
+	Size    int64
+	ModTime time.Time
+}
+
+// Index lists the members of an archive, read from the tar headers without touching the data
+type Index struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Members []Member // in archive order
+
+	files    map[string]int      // member name -> index in Members
+	children map[string][]string // directory -> sorted base names of its entries
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*Index)
+)
+
+// IsArchive reports whether a file name has the extension of a supported archive
+func IsArchive(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), Ext)
+}
+
+// Split separates a path inside an archive into the archive path and the slash-separated
+// member path ("" for the archive root). Reports false for paths not inside an archive.
+func Split(p string) (archivePath, member string, ok bool) {
+	p = filepath.Clean(p)
+	for i := 1; i <= len(p); i++ {
+		if i < len(p) && p[i] != filepath.Separator {
+			continue
+		}
+		prefix := p[:i]
+		if !IsArchive(prefix) {
+			continue
+		}
+		if fi, err := os.Stat(prefix); err == nil && fi.Mode().IsRegular() {
+			if i < len(p) {
+				member = filepath.ToSlash(p[i+1:])
+			}
+			return prefix, member, true
+		}
+	}
+	return "", "", false
+}
+
+// Contains reports whether a path lies inside an archive (or is an archive root)
+func Contains(p string) bool {
+	_, _, ok := Split(p)
+	return ok
+}
+
+// Join returns the path of a member of an archive
+func Join(archivePath, member string) string {
+	if member == "" || member == "." {
+		return archivePath
+	}
+	return filepath.Join(archivePath, filepath.FromSlash(member))
+}
+
+// Load returns the index of an archive. Indexes are kept in memory and rebuilt when the
+// archive's size or modification time changes.
+func Load(archivePath string) (*Index, error) {
+	archivePath = filepath.Clean(archivePath)
+	fi, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheMu.Lock()
+	idx := cache[archivePath]
+	cacheMu.Unlock()
+	if idx != nil && idx.Size == fi.Size() && idx.ModTime.Equal(fi.ModTime()) {
+		return idx, nil
+	}
+
+	idx, err = build(archivePath, fi)
+	if err != nil {
+		return nil, err
+	}
+	cacheMu.Lock()
+	cache[archivePath] = idx
+	cacheMu.Unlock()
+	return idx, nil
+}
+
+// build reads the headers of a tar file, seeking past the member data
+func build(archivePath string, fi os.FileInfo) (*Index, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := &Index{
+		Path:     archivePath,
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		files:    make(map[string]int),
+		children: map[string][]string{".": nil},
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", archivePath, err)
+		}
+		name := cleanName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		switch {
+		case hdr.Typeflag == tar.TypeDir:
+			idx.addDir(name)
+		case hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA:
+			// Sparse members are not stored contiguously and cannot be read at an offset
+			if isSparse(hdr) {
+				continue
+			}
+			// The tar reader has consumed the header blocks, so the data starts here
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			if i, ok := idx.files[name]; ok {
+				// A later copy of a member replaces the earlier one, as tar extraction does
+				idx.Members[i] = Member{Name: name, Offset: offset, Size: hdr.Size, ModTime: hdr.ModTime}
+				continue
+			}
+			idx.addDir(path.Dir(name))
+			idx.files[name] = len(idx.Members)
+			idx.Members = append(idx.Members, Member{Name: name, Offset: offset, Size: hdr.Size, ModTime: hdr.ModTime})
+			idx.children[path.Dir(name)] = append(idx.children[path.Dir(name)], path.Base(name))
+		}
+	}
+
+	for dir := range idx.children {
+		sort.Strings(idx.children[dir])
+	}
+	return idx, nil
+}
+
+// addDir records a directory and its parents
+func (idx *Index) addDir(dir string) {
+	for dir != "." {
+		if _, ok := idx.children[dir]; ok {
+			return
+		}
+		idx.children[dir] = nil
+		parent := path.Dir(dir)
+		idx.children[parent] = append(idx.children[parent], path.Base(dir))
+		dir = parent
+	}
+}
+
+// Lookup returns the member stored under a name
+func (idx *Index) Lookup(name string) (Member, bool) {
+	i, ok := idx.files[cleanName(name)]
+	if !ok {
+		return Member{}, false
+	}
+	return idx.Members[i], true
+}
+
+// Under returns the members inside a directory of the archive ("" for all of them)
+func (idx *Index) Under(dir string) []Member {
+	dir = cleanName(dir)
+	var members []Member
+	for _, m := range idx.Members {
+		if dir == "" || strings.HasPrefix(m.Name, dir+"/") {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// stat describes a member or directory of the archive
+func (idx *Index) stat(name string) (os.FileInfo, bool) {
+	name = cleanName(name)
+	if name == "" {
+		return &memberInfo{name: strings.TrimSuffix(filepath.Base(idx.Path), filepath.Ext(idx.Path)), modTime: idx.ModTime, dir: true}, true
+	}
+	if i, ok := idx.files[name]; ok {
+		m := idx.Members[i]
+		return &memberInfo{name: path.Base(name), size: m.Size, modTime: m.ModTime}, true
+	}
+	if _, ok := idx.children[name]; ok {
+		return &memberInfo{name: path.Base(name), modTime: idx.ModTime, dir: true}, true
+	}
+	return nil, false
+}
+
+// cleanName normalises a member name to a relative slash-separated path ("" for the root)
+func cleanName(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	return strings.TrimPrefix(name, "/")
+}
+
+// isSparse reports whether a tar header describes a sparse file
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// memberInfo is the os.FileInfo of a member or directory of an archive
+type memberInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *memberInfo) Name() string       { return fi.name }
+func (fi *memberInfo) Size() int64        { return fi.size }
+func (fi *memberInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memberInfo) IsDir() bool        { return fi.dir }
+func (fi *memberInfo) Sys() interface{}   { return nil }
+
+func (fi *memberInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+// File is an open file, either an ordinary one or a member read in place from its archive
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// memberFile reads a member from its offset in the archive
+type memberFile struct {
+	*io.SectionReader
+	f    *os.File
+	info os.FileInfo
+}
+
+func (m *memberFile) Close() error               { return m.f.Close() }
+func (m *memberFile) Stat() (os.FileInfo, error) { return m.info, nil }
+
+// Open opens a file for reading
+func Open(p string) (File, error) {
+	archivePath, member, ok := Split(p)
+	if !ok {
+		return os.Open(p)
+	}
+	idx, err := Load(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := idx.Lookup(member)
+	if !ok {
+		if info, ok := idx.stat(member); ok && info.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: p, Err: errors.New("is a directory")}
+		}
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	info, _ := idx.stat(member)
+	return &memberFile{SectionReader: io.NewSectionReader(f, m.Offset, m.Size), f: f, info: info}, nil
+}
+
+// ReadFile reads a whole file
+func ReadFile(p string) ([]byte, error) {
+	if !Contains(p) {
+		return ioutil.ReadFile(p)
+	}
+	f, err := Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// Stat describes a file or directory. An archive root is reported as a directory named after
+// the archive without its extension.
+func Stat(p string) (os.FileInfo, error) {
+	archivePath, member, ok := Split(p)
+	if !ok {
+		return os.Stat(p)
+	}
+	idx, err := Load(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := idx.stat(member)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return info, nil
+}
+
+// ReadDir lists a directory sorted by name
+func ReadDir(p string) ([]os.FileInfo, error) {
+	archivePath, member, ok := Split(p)
+	if !ok {
+		return ioutil.ReadDir(p)
+	}
+	idx, err := Load(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	dir := cleanName(member)
+	if dir == "" {
+		dir = "."
+	}
+	names, ok := idx.children[dir]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	entries := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		if info, ok := idx.stat(path.Join(dir, name)); ok {
+			entries = append(entries, info)
+		}
+	}
+	return entries, nil
+}
+
+// Walk walks a directory tree like filepath.Walk. A tree inside an archive is walked from
+// the archive index; archives found while walking an ordinary tree are not entered.
+func Walk(root string, fn filepath.WalkFunc) error {
+	archivePath, member, ok := Split(root)
+	if !ok {
+		return filepath.Walk(root, fn)
+	}
+	idx, err := Load(archivePath)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	info, ok := idx.stat(member)
+	if !ok {
+		return fn(root, nil, &os.PathError{Op: "lstat", Path: root, Err: os.ErrNotExist})
+	}
+	err = idx.walk(filepath.Clean(root), cleanName(member), info, fn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (idx *Index) walk(p, name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(p, info, nil)
+	}
+	if err := fn(p, info, nil); err != nil {
+		return err
+	}
+	dir := name
+	if dir == "" {
+		dir = "."
+	}
+	for _, child := range idx.children[dir] {
+		childName := path.Join(dir, child)
+		childInfo, _ := idx.stat(childName)
+		err := idx.walk(filepath.Join(p, child), childName, childInfo, fn)
+		if err != nil {
+			if !childInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Name returns the base name of a path, without the extension when it is an archive root
+func Name(p string) string {
+	if _, member, ok := Split(p); ok && member == "" {
+		return strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	}
+	return filepath.Base(p)
+}
@@ -36,6 +36,7 @@ type DCPPackage struct {
 	VolumeCount     int
 	TotalSizeBytes  int64
 	FileCount       int
+	Standard        string // "Interop", "SMPTE" or "unknown" (from the ASSETMAP namespace)
 	DiscoveredAt    time.Time
 	LastVerified    *time.Time
 	CreatedAt       time.Time
@@ -68,6 +69,16 @@ type DCPComposition struct {
 	Facility               string
 	ReelCount              int
 	TotalDurationFrames    int
+	Standard               string // "Interop", "SMPTE" or "unknown" (from the CPL namespace)
+	IsStereoscopic         bool
+	HasAtmos               bool
+	HasClosedCaptions      bool
+	SignatureStatus        string // XML signature verdict (parser.Signature*), "unknown" until checked
+	SignerSubject          string
+	SignerIssuer           string
+	SignerNotBefore        *time.Time
+	SignerNotAfter         *time.Time
+	SignatureMessage       string
 	CreatedAt              time.Time
 	UpdatedAt              time.Time
 }
@@ -89,9 +100,246 @@ type DCPReel struct {
 	SoundConfiguration       string
 	SubtitleAssetUUID        *uuid.UUID
 	SubtitleLanguage         string
+	IsStereoscopic           bool
+	ClosedCaptionAssetUUID   *uuid.UUID
+	ClosedCaptionLanguage    string
+	MarkersAssetUUID         *uuid.UUID
+	AuxDataAssetUUID         *uuid.UUID
+	AuxDataType              string
 	CreatedAt                time.Time
 }
 
+// DCPMarker represents a MainMarkers entry (FFOC, LFOC, FFEC, ...) of a composition
+type DCPMarker struct {
+	ID            uuid.UUID
+	CompositionID uuid.UUID
+	ReelNumber    int
+	Label         string
+	OffsetFrames  int // relative to the start of the reel
+	AbsoluteFrame int // relative to the start of the composition
+	CreatedAt     time.Time
+}
+
+// DCPRating represents a RatingList entry of a composition
+type DCPRating struct {
+	ID            uuid.UUID
+	CompositionID uuid.UUID
+	Agency        string
+	Label         string
+	CreatedAt     time.Time
+}
+
+// DCPContentVersion represents a ContentVersion of a composition.
+// ContentVersionID is kept as text because not every CPL uses a urn:uuid identifier.
+type DCPContentVersion struct {
+	ID               uuid.UUID
+	CompositionID    uuid.UUID
+	ContentVersionID string
+	LabelText        string
+	CreatedAt        time.Time
+}
+
+// DCPExternalAsset is a track file referenced by a CPL but not contained in the CPL's own
+// package, as in a Version File that plays picture or sound from an Original Version
+type DCPExternalAsset struct {
+	ID                uuid.UUID
+	CompositionID     uuid.UUID
+	AssetUUID         uuid.UUID
+	AssetKind         string     // picture, sound, subtitle, closed_caption or aux_data
+	ProviderPackageID *uuid.UUID // indexed package holding the asset; nil while unresolved
+	CreatedAt         time.Time
+}
+
+// DCPTimedText is what the subtitle or closed caption track file of a reel holds
+type DCPTimedText struct {
+	ID              uuid.UUID
+	CompositionID   uuid.UUID
+	ReelNumber      int
+	TrackKind       string // subtitle or closed_caption
+	AssetUUID       uuid.UUID
+	Standard        string // Interop (DCSubtitle XML) or SMPTE (ST 428-7 MXF)
+	Language        string
+	SubtitleKind    string // text, image, mixed or empty
+	EventCount      int
+	TextEventCount  int
+	ImageEventCount int
+	FirstTimeIn     string
+	LastTimeOut     string
+	Error           string // why the track file could not be read
+	Fonts           []*DCPTimedTextFont
+	CreatedAt       time.Time
+}
+
+// DCPTimedTextFont is a font a timed text track loads
+type DCPTimedTextFont struct {
+	FontID  string
+	URI     string
+	Present bool // the font file or embedded resource exists in the package
+}
+
+// DCPPackageDependency records that a composition of PackageID (the VF) needs AssetCount
+// assets held by OVPackageID
+type DCPPackageDependency struct {
+	ID            uuid.UUID
+	PackageID     uuid.UUID
+	OVPackageID   uuid.UUID
+	CompositionID uuid.UUID
+	AssetCount    int
+	CreatedAt     time.Time
+}
+
+// DCPCompositionKey is the KeyId of an encrypted track file of a composition
+type DCPCompositionKey struct {
+	ID            uuid.UUID
+	CompositionID uuid.UUID
+	KeyID         uuid.UUID
+	KeyKind       string // picture, sound, subtitle, closed_caption or aux_data
+	ReelNumber    int
+}
+
+// KDM represents the public metadata of a Key Delivery Message
+type KDM struct {
+	ID                  uuid.UUID
+	MessageID           uuid.UUID
+	CPLUUID             uuid.UUID
+	ContentTitleText    string
+	AnnotationText      string
+	Standard            string
+	IssueDate           *time.Time
+	SignerIssuer        string
+	RecipientSubject    string
+	RecipientThumbprint string // dnQualifier of the recipient certificate
+	RecipientSerial     string
+	DeviceThumbprints   string // comma-separated AuthorizedDeviceInfo thumbprints
+	NotValidBefore      time.Time
+	NotValidAfter       time.Time
+	ServerID            *uuid.UUID // server the KDM was first ingested on or uploaded for; see KDMServer
+	SourcePath          string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// KDMServer links a KDM to a server it was found on or uploaded for
+type KDMServer struct {
+	KDMID      uuid.UUID
+	ServerID   uuid.UUID
+	SourcePath string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// KDM key window states (relative to the time of the query)
+const (
+	KDMStatusNotYetValid = "not_yet_valid"
+	KDMStatusValid       = "valid"
+	KDMStatusExpired     = "expired"
+)
+
+// WindowStatus reports whether the KDM's key window has opened, is open or has closed at t
+func (k *KDM) WindowStatus(t time.Time) string {
+	switch {
+	case t.Before(k.NotValidBefore):
+		return KDMStatusNotYetValid
+	case t.After(k.NotValidAfter):
+		return KDMStatusExpired
+	}
+	return KDMStatusValid
+}
+
+// KDMKey is a KeyIdList entry of a KDM
+type KDMKey struct {
+	ID      uuid.UUID
+	KDMID   uuid.UUID
+	KeyID   uuid.UUID
+	KeyType string // MDIK, MDAK, MDSK, MDEK, FMIK, FMAK
+}
+
+// MissingKDM is an encrypted composition held online by a server without a usable KDM for it
+type MissingKDM struct {
+	CompositionID    uuid.UUID
+	CPLUUID          uuid.UUID
+	ContentTitleText string
+	PackageID        uuid.UUID
+	PackageName      string
+	KeyCount         int
+	LastExpired      *time.Time // end of the latest expired KDM, nil if the server never had one
+}
+
+// Verification verdicts (package level) and per-asset result states
+const (
+	VerificationPending = "pending"
+	VerificationRunning = "running"
+	VerificationPassed  = "passed"
+	VerificationFailed  = "failed"
+	VerificationError   = "error" // the run itself could not complete (package unreadable, client offline, ...)
+
+	AssetVerifyPass         = "pass"
+	AssetVerifyMissing      = "missing"
+	AssetVerifySizeMismatch = "size_mismatch"
+	AssetVerifyHashMismatch = "hash_mismatch"
+	AssetVerifyError        = "error"
+)
+
+// DCPVerification represents one PKL hash verification run of a package on a server
+type DCPVerification struct {
+	ID           uuid.UUID
+	PackageID    uuid.UUID
+	ServerID     uuid.UUID
+	Status       string
+	AssetsTotal  int
+	AssetsPassed int
+	AssetsFailed int
+	BytesTotal   int64
+	ErrorMessage string
+	StartedAt    *time.Time
+	CompletedAt  *time.Time
+	CreatedAt    time.Time
+}
+
+// DCPVerificationAsset is the result of checking one PKL asset against its Size and Hash
+type DCPVerificationAsset struct {
+	ID             uuid.UUID
+	VerificationID uuid.UUID
+	AssetUUID      *uuid.UUID
+	FilePath       string
+	ExpectedSize   int64
+	ActualSize     int64
+	ExpectedHash   string // base64 SHA-1 from the PKL
+	ActualHash     string // base64 SHA-1 of the file on disk
+	Status         string
+	Message        string
+}
+
+// Validation finding severities
+const (
+	FindingError   = "error"   // the package will not ingest or play correctly
+	FindingWarning = "warning" // suspicious, but usually playable
+	FindingInfo    = "info"
+)
+
+// DCPValidationFinding is a structural problem found in a package as stored on a server
+type DCPValidationFinding struct {
+	ID        uuid.UUID
+	PackageID uuid.UUID
+	ServerID  uuid.UUID
+	CheckID   string // e.g. "pkl_size_mismatch" (scanner.Check*)
+	Severity  string
+	Subject   string // file, asset or reel the finding is about
+	Message   string
+	CreatedAt time.Time
+}
+
+// PackageValidationSummary counts the findings of a package across the servers holding it
+type PackageValidationSummary struct {
+	PackageID    uuid.UUID
+	AssetMapUUID uuid.UUID
+	PackageName  string
+	ErrorCount   int
+	WarningCount int
+	ServerCount  int // servers reporting at least one finding
+	LastChecked  time.Time
+}
+
 // DCPAsset represents an MXF or other asset file
 type DCPAsset struct {
 	ID            uuid.UUID
@@ -101,37 +349,67 @@ type DCPAsset struct {
 	FileName      string
 	AssetType     string
 	AssetRole     string
+	RoleSource    string     // what the role was derived from: cpl, pkl, mxf or filename
+	CPLUUID       *uuid.UUID // first CPL referencing the asset
+	ReelNumber    int        // reel of that CPL, 0 when not referenced from a reel
 	SizeBytes     int64
 	HashAlgorithm string
 	HashValue     string
 	ChunkOffset   int64
 	ChunkLength   int64
 	CreatedAt     time.Time
+
+	// Read from the MXF header partition; MXFInspectedAt stays nil until the header was read
+	EssenceKind        string // parser.MXFEssence*
+	EssenceContainerUL string
+	MXFPackageUUID     *uuid.UUID
+	IsEncrypted        bool
+	MXFEditRate        string
+	MXFDuration        int64
+	StoredWidth        int
+	StoredHeight       int
+	FrameLayout        string
+	JPEG2000Profile    string
+	IsStereoscopic     bool
+	ChannelCount       int
+	AudioSampleRate    int
+	BitDepth           int
+	MXFError           string // why the header could not be read
+	MXFInspectedAt     *time.Time
 }
 
 // DCPPackingList represents a PKL
 type DCPPackingList struct {
-	ID             uuid.UUID
-	PackageID      uuid.UUID
-	PKLUUID        uuid.UUID
-	AnnotationText string
-	IssueDate      *time.Time
-	Issuer         string
-	Creator        string
-	AssetCount     int
-	CreatedAt      time.Time
+	ID               uuid.UUID
+	PackageID        uuid.UUID
+	PKLUUID          uuid.UUID
+	AnnotationText   string
+	IssueDate        *time.Time
+	Issuer           string
+	Creator          string
+	AssetCount       int
+	SignatureStatus  string // XML signature verdict (parser.Signature*), "unknown" until checked
+	SignerSubject    string
+	SignerIssuer     string
+	SignerNotBefore  *time.Time
+	SignerNotAfter   *time.Time
+	SignatureMessage string
+	CreatedAt        time.Time
 }
 
 // ServerDCPInventory represents the junction table
 type ServerDCPInventory struct {
-	ID           uuid.UUID
-	ServerID     uuid.UUID
-	PackageID    uuid.UUID
-	LocalPath    string
-	Status       string
-	LastVerified time.Time
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID             uuid.UUID
+	ServerID       uuid.UUID
+	PackageID      uuid.UUID
+	LocalPath      string
+	Status         string // "online", "partial" while volumes of a multi-volume package are missing, or "quarantined"
+	VolumesPresent int    // volumes found on this server (0 is stored as 1)
+	QuarantinePath string // where a quarantined package was moved to
+	QuarantinedAt  *time.Time
+	LastVerified   time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
 
 // User represents a web UI user
@@ -192,15 +470,211 @@ type ActivityLogFilter struct {
 
 // ScanLog represents an audit log entry
 type ScanLog struct {
-	ID              uuid.UUID
-	ServerID        uuid.UUID
-	ScanType        string
-	StartedAt       time.Time
-	CompletedAt     *time.Time
-	PackagesFound   int
-	PackagesAdded   int
-	PackagesUpdated int
-	PackagesRemoved int
-	Errors          string
-	Status          string
+	ID                uuid.UUID
+	ServerID          uuid.UUID
+	ScanType          string
+	StartedAt         time.Time
+	CompletedAt       *time.Time
+	PackagesFound     int
+	PackagesAdded     int
+	PackagesUpdated   int
+	PackagesRemoved   int
+	SignaturesChecked int // CPL and PKL signatures verified during the scan
+	SignaturesInvalid int // of which not valid (modified, expired chain, ...)
+	PackagesSkipped   int // unchanged since the previous scan, not re-indexed
+	PackagesChanged   int // known packages whose files changed since the previous scan
+	Errors            string
+	Status            string
+}
+
+// StorageSample is the filesystem usage of one location of a server at one point in time
+type StorageSample struct {
+	ServerID   uuid.UUID
+	Path       string
+	Kind       string // "library" or "download"
+	TotalBytes int64
+	FreeBytes  int64
+	SampledAt  time.Time
+}
+
+// ReclamationPolicy decides when a server has to free space and which of its packages may go
+type ReclamationPolicy struct {
+	ID                        uuid.UUID
+	Name                      string
+	IsActive                  bool
+	ServerIDs                 []uuid.UUID // servers the policy applies to, empty for every server but the main one
+	MinFleetCopies            int         // online copies that must remain in the fleet after a deletion
+	MinAgeDays                int         // packages that arrived on the server more recently are kept
+	FreeSpaceThresholdPercent float64     // a plan is proposed once the free space drops below this
+	TargetFreePercent         float64     // a plan deletes packages until this much space is free
+	CreatedAt                 time.Time
+	UpdatedAt                 time.Time
+}
+
+// Reclamation plan states. Approving a plan executes it right away.
+const (
+	ReclamationPlanProposed  = "proposed"
+	ReclamationPlanRejected  = "rejected"
+	ReclamationPlanExecuting = "executing"
+	ReclamationPlanCompleted = "completed"
+	ReclamationPlanFailed    = "failed" // at least one deletion failed
+)
+
+// ReclamationPlan is a set of deletions a policy proposes for one server
+type ReclamationPlan struct {
+	ID             uuid.UUID
+	PolicyID       *uuid.UUID
+	ServerID       uuid.UUID
+	Status         string
+	MinFleetCopies int   // copied from the policy, checked again when the plan is executed
+	TotalBytes     int64 // capacity of the server's library locations when the plan was made
+	FreeBytes      int64
+	BytesToFree    int64
+	ReviewedBy     string
+	ReviewedAt     *time.Time
+	CompletedAt    *time.Time
+	CreatedAt      time.Time
+}
+
+// ReclamationPlanItem is one package a reclamation plan deletes, with the facts it was chosen on
+type ReclamationPlanItem struct {
+	ID               uuid.UUID
+	PlanID           uuid.UUID
+	PackageID        uuid.UUID
+	PackageName      string
+	SizeBytes        int64
+	FleetCopies      int        // online copies in the fleet, this one included
+	LastArrivedAt    *time.Time // latest of discovery, inventory and transfer completion on the server
+	UploadedBytes    int64      // uploaded by the server's torrent for this package
+	ContentCommandID *uuid.UUID
+	Status           string // "pending", "queued", "completed", "error" or "skipped"
+	ResultMessage    string
+}
+
+// ScanCacheEntry is the state of one package file as of the last scan that indexed the package
+type ScanCacheEntry struct {
+	ServerID    uuid.UUID
+	PackagePath string
+	FilePath    string
+	Inode       uint64
+	Size        int64
+	ModTime     time.Time
+	XMLHash     string // SHA-256 of the content, XML files only
+}
+
+// AssetCopy is a file of a package whose content (same PKL hash and size) a server already
+// holds in another package
+type AssetCopy struct {
+	AssetUUID         uuid.UUID
+	FilePath          string // ASSETMAP path of the file in the package
+	SizeBytes         int64
+	HashValue         string
+	ServerID          uuid.UUID
+	SourcePackageID   uuid.UUID
+	SourcePackageName string
+	SourcePath        string // absolute path of the identical file on the server
+}
+
+// ArchiveMember is a file of a package stored in a tar archive, read in place at DataOffset
+type ArchiveMember struct {
+	ServerID    uuid.UUID
+	PackageID   uuid.UUID
+	PackagePath string
+	ArchivePath string
+	MemberPath  string // slash-separated path inside the archive
+	DataOffset  int64
+	Size        int64
+	ModTime     time.Time
+}
+
+// BandwidthSchedule is a server's bandwidth calendar. Limits are bytes/s, 0 = unlimited.
+type BandwidthSchedule struct {
+	ServerID         uuid.UUID
+	Timezone         string // IANA name; "" = local time of the server
+	DownloadLimitBps int64  // outside every window
+	UploadLimitBps   int64
+	Windows          []*BandwidthWindow // in position order
+}
+
+// BandwidthWindow is a part of the day with rate limits of its own
+type BandwidthWindow struct {
+	ID               uuid.UUID
+	DaysOfWeek       []int64 // 0 = Sunday .. 6 = Saturday; empty = every day
+	StartMinute      int     // minutes after midnight
+	EndMinute        int     // exclusive; at or before StartMinute runs past midnight
+	DownloadLimitBps int64
+	UploadLimitBps   int64
+}
+
+// Distribution campaign states
+const (
+	CampaignActive    = "active"
+	CampaignCompleted = "completed"
+	CampaignFailed    = "failed" // finished, but a target did not receive every package
+	CampaignCancelled = "cancelled"
+)
+
+// Campaign sends a set of packages to many servers. The targets are released in waves so the
+// servers that finish first seed to the later ones.
+type Campaign struct {
+	ID             uuid.UUID
+	Name           string
+	Status         string
+	WaveSize       int // targets per wave
+	AdvancePercent int // share of a wave that must have completed before the next one is released
+	Priority       int // of the transfers the campaign creates
+	DeliverBy      *time.Time
+	CreatedBy      string
+	CreatedAt      time.Time
+	CompletedAt    *time.Time
+}
+
+// CampaignPackage is a package a campaign sends and the torrent it is sent with
+type CampaignPackage struct {
+	PackageID   uuid.UUID
+	TorrentID   uuid.UUID
+	PackageName string
+	SizeBytes   int64
+}
+
+// CampaignTarget is a server a campaign sends its packages to
+type CampaignTarget struct {
+	ID         uuid.UUID
+	ServerID   uuid.UUID
+	ServerName string
+	Wave       int // 0 = held every package already
+	Position   int
+	ReleasedAt *time.Time // when its transfers were created; nil while its wave waits
+}
+
+// CampaignTransfer is a transfer created by (or joined to) a campaign
+type CampaignTransfer struct {
+	ID               uuid.UUID
+	ServerID         uuid.UUID
+	PackageID        uuid.UUID
+	Status           string
+	ProgressPercent  float64
+	DownloadedBytes  int64
+	SizeBytes        int64
+	DownloadSpeedBps int64
+	ErrorMessage     string
+	CompletedAt      *time.Time
+}
+
+// ServerGroup is a named set of servers, e.g. a circuit (cinema chain), a region or a site type.
+// Transfers, content commands, upgrades and rescans can target every server of a group at once.
+type ServerGroup struct {
+	ID          uuid.UUID
+	Name        string
+	Kind        string // "circuit", "region", "site_type" or any other grouping; may be empty
+	Description string
+	ServerIDs   []uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ServerTagCount is a server tag and the number of servers carrying it
+type ServerTagCount struct {
+	Tag     string
+	Servers int
 }
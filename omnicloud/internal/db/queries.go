@@ -6,9 +6,13 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/omnicloud/omnicloud/pkg/dcp"
 )
 
 // HashPassword creates a salted SHA-256 hash: "salt:hash"
@@ -124,14 +128,15 @@ func (db *DB) GetServerByMACAddress(macAddress string) (*Server, error) {
 	return server, err
 }
 
-// UpsertDCPPackage inserts or updates a DCP package
+// UpsertDCPPackage inserts or updates a DCP package. last_verified is left alone: only a
+// completed hash verification sets it (see CompleteDCPVerification).
 func (db *DB) UpsertDCPPackage(pkg *DCPPackage) error {
 	query := `
 		INSERT INTO dcp_packages (
 			id, assetmap_uuid, package_name, content_title, content_kind,
 			issue_date, issuer, creator, annotation_text, volume_count,
-			total_size_bytes, file_count, discovered_at, last_verified,
-			created_at, updated_at
+			total_size_bytes, file_count, discovered_at,
+			created_at, updated_at, standard
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 		ON CONFLICT (assetmap_uuid) DO UPDATE SET
 			package_name = EXCLUDED.package_name,
@@ -144,15 +149,15 @@ func (db *DB) UpsertDCPPackage(pkg *DCPPackage) error {
 			volume_count = EXCLUDED.volume_count,
 			total_size_bytes = EXCLUDED.total_size_bytes,
 			file_count = EXCLUDED.file_count,
-			last_verified = EXCLUDED.last_verified,
+			standard = EXCLUDED.standard,
 			updated_at = CURRENT_TIMESTAMP
 		RETURNING id`
 	
 	return db.QueryRow(query,
 		pkg.ID, pkg.AssetMapUUID, pkg.PackageName, pkg.ContentTitle, pkg.ContentKind,
 		pkg.IssueDate, pkg.Issuer, pkg.Creator, pkg.AnnotationText, pkg.VolumeCount,
-		pkg.TotalSizeBytes, pkg.FileCount, pkg.DiscoveredAt, pkg.LastVerified,
-		pkg.CreatedAt, pkg.UpdatedAt,
+		pkg.TotalSizeBytes, pkg.FileCount, pkg.DiscoveredAt,
+		pkg.CreatedAt, pkg.UpdatedAt, pkg.Standard,
 	).Scan(&pkg.ID)
 }
 
@@ -161,7 +166,7 @@ func (db *DB) GetDCPPackageByAssetMapUUID(assetMapUUID uuid.UUID) (*DCPPackage,
 	query := `SELECT id, assetmap_uuid, package_name, content_title, content_kind,
 			  issue_date, issuer, creator, annotation_text, volume_count,
 			  total_size_bytes, file_count, discovered_at, last_verified,
-			  created_at, updated_at
+			  created_at, updated_at, COALESCE(standard, 'unknown')
 			  FROM dcp_packages WHERE assetmap_uuid = $1`
 	
 	pkg := &DCPPackage{}
@@ -169,7 +174,7 @@ func (db *DB) GetDCPPackageByAssetMapUUID(assetMapUUID uuid.UUID) (*DCPPackage,
 		&pkg.ID, &pkg.AssetMapUUID, &pkg.PackageName, &pkg.ContentTitle, &pkg.ContentKind,
 		&pkg.IssueDate, &pkg.Issuer, &pkg.Creator, &pkg.AnnotationText, &pkg.VolumeCount,
 		&pkg.TotalSizeBytes, &pkg.FileCount, &pkg.DiscoveredAt, &pkg.LastVerified,
-		&pkg.CreatedAt, &pkg.UpdatedAt,
+		&pkg.CreatedAt, &pkg.UpdatedAt, &pkg.Standard,
 	)
 	
 	if err == sql.ErrNoRows {
@@ -186,7 +191,7 @@ func (db *DB) GetDCPPackageByCPLUUID(cplUUID uuid.UUID) (*DCPPackage, error) {
 		SELECT p.id, p.assetmap_uuid, p.package_name, p.content_title, p.content_kind,
 		       p.issue_date, p.issuer, p.creator, p.annotation_text, p.volume_count,
 		       p.total_size_bytes, p.file_count, p.discovered_at, p.last_verified,
-		       p.created_at, p.updated_at
+		       p.created_at, p.updated_at, COALESCE(p.standard, 'unknown')
 		FROM dcp_packages p
 		JOIN dcp_compositions c ON c.package_id = p.id
 		WHERE c.cpl_uuid = $1
@@ -197,7 +202,7 @@ func (db *DB) GetDCPPackageByCPLUUID(cplUUID uuid.UUID) (*DCPPackage, error) {
 		&pkg.ID, &pkg.AssetMapUUID, &pkg.PackageName, &pkg.ContentTitle, &pkg.ContentKind,
 		&pkg.IssueDate, &pkg.Issuer, &pkg.Creator, &pkg.AnnotationText, &pkg.VolumeCount,
 		&pkg.TotalSizeBytes, &pkg.FileCount, &pkg.DiscoveredAt, &pkg.LastVerified,
-		&pkg.CreatedAt, &pkg.UpdatedAt,
+		&pkg.CreatedAt, &pkg.UpdatedAt, &pkg.Standard,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -232,8 +237,11 @@ func (db *DB) InsertDCPComposition(comp *DCPComposition) error {
 			creator, edit_rate, frame_rate, screen_aspect_ratio,
 			resolution_width, resolution_height, main_sound_configuration,
 			main_sound_sample_rate, luminance, release_territory, distributor,
-			facility, reel_count, total_duration_frames, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)
+			facility, reel_count, total_duration_frames, created_at, updated_at,
+			is_stereoscopic, has_atmos, has_closed_captions, standard,
+			signature_status, signer_subject, signer_issuer, signer_not_before, signer_not_after, signature_message
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30,
+		          $31, $32, $33, $34, $35, $36)
 		ON CONFLICT (package_id, cpl_uuid) DO UPDATE SET
 			content_title_text = EXCLUDED.content_title_text,
 			full_content_title = EXCLUDED.full_content_title,
@@ -248,6 +256,16 @@ func (db *DB) InsertDCPComposition(comp *DCPComposition) error {
 			luminance = EXCLUDED.luminance,
 			reel_count = EXCLUDED.reel_count,
 			total_duration_frames = EXCLUDED.total_duration_frames,
+			is_stereoscopic = EXCLUDED.is_stereoscopic,
+			has_atmos = EXCLUDED.has_atmos,
+			has_closed_captions = EXCLUDED.has_closed_captions,
+			standard = EXCLUDED.standard,
+			signature_status = EXCLUDED.signature_status,
+			signer_subject = EXCLUDED.signer_subject,
+			signer_issuer = EXCLUDED.signer_issuer,
+			signer_not_before = EXCLUDED.signer_not_before,
+			signer_not_after = EXCLUDED.signer_not_after,
+			signature_message = EXCLUDED.signature_message,
 			updated_at = CURRENT_TIMESTAMP
 		RETURNING id`
 
@@ -258,9 +276,116 @@ func (db *DB) InsertDCPComposition(comp *DCPComposition) error {
 		comp.ResolutionWidth, comp.ResolutionHeight, comp.MainSoundConfiguration,
 		comp.MainSoundSampleRate, comp.Luminance, comp.ReleaseTerritory, comp.Distributor,
 		comp.Facility, comp.ReelCount, comp.TotalDurationFrames, comp.CreatedAt, comp.UpdatedAt,
+		comp.IsStereoscopic, comp.HasAtmos, comp.HasClosedCaptions, comp.Standard,
+		comp.SignatureStatus, comp.SignerSubject, comp.SignerIssuer, comp.SignerNotBefore, comp.SignerNotAfter, comp.SignatureMessage,
 	).Scan(&comp.ID)
 }
 
+// GetActiveLibraryPaths returns the paths of a server's active library locations
+func (db *DB) GetActiveLibraryPaths(serverID uuid.UUID) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT path FROM server_library_locations
+		WHERE server_id = $1 AND is_active = true
+		ORDER BY created_at ASC`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// SetDCPCompositionTitle decodes a composition's ContentTitleText along the Digital Cinema
+// Naming Convention and stores its fields
+func (db *DB) SetDCPCompositionTitle(compositionID uuid.UUID, contentTitleText string) error {
+	ct := dcp.ParseContentTitle(contentTitleText)
+	_, err := db.Exec(`
+		UPDATE dcp_compositions SET
+			dcnc_film_title = $2, dcnc_content_type = $3, dcnc_content_version = $4,
+			dcnc_aspect_ratio = $5, dcnc_image_aspect = $6, dcnc_audio_language = $7,
+			dcnc_subtitle_language = $8, dcnc_captions = $9, dcnc_territory = $10,
+			dcnc_rating = $11, dcnc_audio_format = $12, dcnc_resolution = $13,
+			dcnc_studio = $14, dcnc_date = $15, dcnc_facility = $16, dcnc_standard = $17,
+			dcnc_package_type = $18, dcnc_conforming = $19, dcnc_parsed_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		compositionID, ct.FilmTitle, ct.ContentType, ct.ContentVersion,
+		ct.AspectRatio, ct.ImageAspect, ct.AudioLanguage,
+		ct.SubtitleLanguage, ct.Captions, ct.Territory,
+		ct.Rating, ct.AudioFormat, ct.Resolution,
+		ct.Studio, ct.Date, ct.Facility, ct.Standard,
+		ct.PackageType, ct.Conforming,
+	)
+	return err
+}
+
+// BackfillDCPCompositionTitles decodes the titles of compositions indexed before titles were
+// decoded. Returns how many were decoded.
+func (db *DB) BackfillDCPCompositionTitles() (int, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(content_title_text, '') FROM dcp_compositions WHERE dcnc_parsed_at IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		id    uuid.UUID
+		title string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.title); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, p := range todo {
+		if err := db.SetDCPCompositionTitle(p.id, p.title); err != nil {
+			return i, err
+		}
+	}
+	return len(todo), nil
+}
+
+// GetDCPCompositionTitle returns the decoded ContentTitleText of a composition, nil when it
+// has not been decoded yet
+func (db *DB) GetDCPCompositionTitle(compositionID uuid.UUID) (*dcp.ContentTitle, error) {
+	ct := &dcp.ContentTitle{}
+	err := db.QueryRow(`
+		SELECT COALESCE(content_title_text, ''), COALESCE(dcnc_film_title, ''), COALESCE(dcnc_content_type, ''),
+		       COALESCE(dcnc_content_version, 0), COALESCE(dcnc_aspect_ratio, ''), COALESCE(dcnc_image_aspect, ''),
+		       COALESCE(dcnc_audio_language, ''), COALESCE(dcnc_subtitle_language, ''), COALESCE(dcnc_captions, ''),
+		       COALESCE(dcnc_territory, ''), COALESCE(dcnc_rating, ''), COALESCE(dcnc_audio_format, ''),
+		       COALESCE(dcnc_resolution, ''), COALESCE(dcnc_studio, ''), dcnc_date, COALESCE(dcnc_facility, ''),
+		       COALESCE(dcnc_standard, ''), COALESCE(dcnc_package_type, ''), COALESCE(dcnc_conforming, FALSE)
+		FROM dcp_compositions WHERE id = $1 AND dcnc_parsed_at IS NOT NULL`, compositionID,
+	).Scan(&ct.Raw, &ct.FilmTitle, &ct.ContentType,
+		&ct.ContentVersion, &ct.AspectRatio, &ct.ImageAspect,
+		&ct.AudioLanguage, &ct.SubtitleLanguage, &ct.Captions,
+		&ct.Territory, &ct.Rating, &ct.AudioFormat,
+		&ct.Resolution, &ct.Studio, &ct.Date, &ct.Facility,
+		&ct.Standard, &ct.PackageType, &ct.Conforming)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
 // InsertDCPReel inserts or updates a reel record
 func (db *DB) InsertDCPReel(reel *DCPReel) error {
 	query := `
@@ -269,185 +394,2308 @@ func (db *DB) InsertDCPReel(reel *DCPReel) error {
 			picture_asset_uuid, picture_edit_rate, picture_entry_point,
 			picture_intrinsic_duration, picture_key_id, picture_hash,
 			sound_asset_uuid, sound_configuration, subtitle_asset_uuid,
-			subtitle_language, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
-		ON CONFLICT (composition_id, reel_uuid) DO NOTHING`
+			subtitle_language, created_at, is_stereoscopic,
+			closed_caption_asset_uuid, closed_caption_language, markers_asset_uuid,
+			aux_data_asset_uuid, aux_data_type
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+		ON CONFLICT (composition_id, reel_uuid) DO UPDATE SET
+			is_stereoscopic = EXCLUDED.is_stereoscopic,
+			closed_caption_asset_uuid = EXCLUDED.closed_caption_asset_uuid,
+			closed_caption_language = EXCLUDED.closed_caption_language,
+			markers_asset_uuid = EXCLUDED.markers_asset_uuid,
+			aux_data_asset_uuid = EXCLUDED.aux_data_asset_uuid,
+			aux_data_type = EXCLUDED.aux_data_type`
 
 	_, err := db.Exec(query,
 		reel.ID, reel.CompositionID, reel.ReelUUID, reel.ReelNumber, reel.DurationFrames,
 		reel.PictureAssetUUID, reel.PictureEditRate, reel.PictureEntryPoint,
 		reel.PictureIntrinsicDuration, reel.PictureKeyID, reel.PictureHash,
 		reel.SoundAssetUUID, reel.SoundConfiguration, reel.SubtitleAssetUUID,
-		reel.SubtitleLanguage, reel.CreatedAt,
+		reel.SubtitleLanguage, reel.CreatedAt, reel.IsStereoscopic,
+		reel.ClosedCaptionAssetUUID, reel.ClosedCaptionLanguage, reel.MarkersAssetUUID,
+		reel.AuxDataAssetUUID, reel.AuxDataType,
 	)
 	return err
 }
 
-// InsertDCPAsset inserts an asset record
-func (db *DB) InsertDCPAsset(asset *DCPAsset) error {
-	query := `
-		INSERT INTO dcp_assets (
-			id, package_id, asset_uuid, file_path, file_name, asset_type,
-			asset_role, size_bytes, hash_algorithm, hash_value,
-			chunk_offset, chunk_length, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		ON CONFLICT DO NOTHING`
-	
-	_, err := db.Exec(query,
-		asset.ID, asset.PackageID, asset.AssetUUID, asset.FilePath, asset.FileName,
-		asset.AssetType, asset.AssetRole, asset.SizeBytes, asset.HashAlgorithm,
-		asset.HashValue, asset.ChunkOffset, asset.ChunkLength, asset.CreatedAt,
-	)
-	return err
+// ReplaceDCPReels replaces all reels of a composition
+func (db *DB) ReplaceDCPReels(compositionID uuid.UUID, reels []*DCPReel) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_reels WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, r := range reels {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_reels (
+				id, composition_id, reel_uuid, reel_number, duration_frames,
+				picture_asset_uuid, picture_edit_rate, picture_entry_point,
+				picture_intrinsic_duration, picture_key_id, picture_hash,
+				sound_asset_uuid, sound_configuration, subtitle_asset_uuid,
+				subtitle_language, created_at, is_stereoscopic,
+				closed_caption_asset_uuid, closed_caption_language, markers_asset_uuid,
+				aux_data_asset_uuid, aux_data_type
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+			ON CONFLICT (composition_id, reel_uuid) DO NOTHING`,
+			r.ID, compositionID, r.ReelUUID, r.ReelNumber, r.DurationFrames,
+			r.PictureAssetUUID, r.PictureEditRate, r.PictureEntryPoint,
+			r.PictureIntrinsicDuration, r.PictureKeyID, r.PictureHash,
+			r.SoundAssetUUID, r.SoundConfiguration, r.SubtitleAssetUUID,
+			r.SubtitleLanguage, r.CreatedAt, r.IsStereoscopic,
+			r.ClosedCaptionAssetUUID, r.ClosedCaptionLanguage, r.MarkersAssetUUID,
+			r.AuxDataAssetUUID, r.AuxDataType,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// InsertDCPPackingList inserts a packing list record
-func (db *DB) InsertDCPPackingList(pkl *DCPPackingList) error {
-	query := `
-		INSERT INTO dcp_packing_lists (
-			id, package_id, pkl_uuid, annotation_text, issue_date,
-			issuer, creator, asset_count, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		ON CONFLICT DO NOTHING`
-	
-	_, err := db.Exec(query,
-		pkl.ID, pkl.PackageID, pkl.PKLUUID, pkl.AnnotationText, pkl.IssueDate,
-		pkl.Issuer, pkl.Creator, pkl.AssetCount, pkl.CreatedAt,
-	)
-	return err
+// ReplaceDCPMarkers replaces all markers of a composition (re-indexing a CPL rewrites the full list)
+func (db *DB) ReplaceDCPMarkers(compositionID uuid.UUID, markers []*DCPMarker) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_markers WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, m := range markers {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_markers (id, composition_id, reel_number, label, offset_frames, absolute_frame, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			m.ID, compositionID, m.ReelNumber, m.Label, m.OffsetFrames, m.AbsoluteFrame, m.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// UpsertServerDCPInventory inserts or updates inventory record
-func (db *DB) UpsertServerDCPInventory(inv *ServerDCPInventory) error {
-	query := `
-		INSERT INTO server_dcp_inventory (
-			id, server_id, package_id, local_path, status, last_verified, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (server_id, package_id) DO UPDATE SET
-			local_path = EXCLUDED.local_path,
-			status = EXCLUDED.status,
-			last_verified = EXCLUDED.last_verified,
-			updated_at = CURRENT_TIMESTAMP`
-	
-	_, err := db.Exec(query,
-		inv.ID, inv.ServerID, inv.PackageID, inv.LocalPath,
-		inv.Status, inv.LastVerified, inv.CreatedAt, inv.UpdatedAt,
-	)
-	return err
+// ReplaceDCPRatings replaces all ratings of a composition
+func (db *DB) ReplaceDCPRatings(compositionID uuid.UUID, ratings []*DCPRating) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_ratings WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, r := range ratings {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_ratings (id, composition_id, agency, label, created_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			r.ID, compositionID, r.Agency, r.Label, r.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// GetServerInventory retrieves all inventory entries for a specific server
-func (db *DB) GetServerInventory(serverID uuid.UUID) ([]*ServerDCPInventory, error) {
+// ReplaceDCPContentVersions replaces all content versions of a composition
+func (db *DB) ReplaceDCPContentVersions(compositionID uuid.UUID, versions []*DCPContentVersion) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_content_versions WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, v := range versions {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_content_versions (id, composition_id, content_version_id, label_text, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (composition_id, content_version_id) DO NOTHING`,
+			v.ID, compositionID, v.ContentVersionID, v.LabelText, v.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDCPCompositionsByPackageID returns all compositions of a package
+func (db *DB) GetDCPCompositionsByPackageID(packageID uuid.UUID) ([]*DCPComposition, error) {
 	query := `
-		SELECT id, server_id, package_id, local_path, status, last_verified, created_at, updated_at
-		FROM server_dcp_inventory
-		WHERE server_id = $1
-		ORDER BY created_at DESC`
-	
-	rows, err := db.Query(query, serverID)
+		SELECT id, package_id, cpl_uuid, COALESCE(content_title_text, ''), COALESCE(full_content_title, ''),
+		       COALESCE(content_kind, ''), content_version_id, COALESCE(label_text, ''), issue_date,
+		       COALESCE(issuer, ''), COALESCE(creator, ''), COALESCE(edit_rate, ''), COALESCE(frame_rate, ''),
+		       COALESCE(screen_aspect_ratio, ''), COALESCE(resolution_width, 0), COALESCE(resolution_height, 0),
+		       COALESCE(main_sound_configuration, ''), COALESCE(main_sound_sample_rate, ''), COALESCE(luminance, 0),
+		       COALESCE(release_territory, ''), COALESCE(distributor, ''), COALESCE(facility, ''),
+		       COALESCE(reel_count, 0), COALESCE(total_duration_frames, 0),
+		       COALESCE(is_stereoscopic, false), COALESCE(has_atmos, false), COALESCE(has_closed_captions, false),
+		       COALESCE(standard, 'unknown'), COALESCE(signature_status, 'unknown'), COALESCE(signer_subject, ''),
+		       COALESCE(signer_issuer, ''), signer_not_before, signer_not_after, COALESCE(signature_message, ''),
+		       created_at, updated_at
+		FROM dcp_compositions
+		WHERE package_id = $1
+		ORDER BY content_title_text`
+
+	rows, err := db.Query(query, packageID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
-	var inventory []*ServerDCPInventory
+
+	var comps []*DCPComposition
 	for rows.Next() {
-		inv := &ServerDCPInventory{}
+		c := &DCPComposition{}
 		err := rows.Scan(
-			&inv.ID, &inv.ServerID, &inv.PackageID, &inv.LocalPath,
-			&inv.Status, &inv.LastVerified, &inv.CreatedAt, &inv.UpdatedAt,
+			&c.ID, &c.PackageID, &c.CPLUUID, &c.ContentTitleText, &c.FullContentTitle,
+			&c.ContentKind, &c.ContentVersionID, &c.LabelText, &c.IssueDate,
+			&c.Issuer, &c.Creator, &c.EditRate, &c.FrameRate,
+			&c.ScreenAspectRatio, &c.ResolutionWidth, &c.ResolutionHeight,
+			&c.MainSoundConfiguration, &c.MainSoundSampleRate, &c.Luminance,
+			&c.ReleaseTerritory, &c.Distributor, &c.Facility,
+			&c.ReelCount, &c.TotalDurationFrames,
+			&c.IsStereoscopic, &c.HasAtmos, &c.HasClosedCaptions,
+			&c.Standard, &c.SignatureStatus, &c.SignerSubject,
+			&c.SignerIssuer, &c.SignerNotBefore, &c.SignerNotAfter, &c.SignatureMessage,
+			&c.CreatedAt, &c.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
-		inventory = append(inventory, inv)
+		comps = append(comps, c)
 	}
-	
-	if err = rows.Err(); err != nil {
+	return comps, rows.Err()
+}
+
+// GetDCPReelsByCompositionID returns all reels of a composition in reel order
+func (db *DB) GetDCPReelsByCompositionID(compositionID uuid.UUID) ([]*DCPReel, error) {
+	query := `
+		SELECT id, composition_id, reel_uuid, reel_number, COALESCE(duration_frames, 0),
+		       picture_asset_uuid, COALESCE(picture_edit_rate, ''), COALESCE(picture_entry_point, 0),
+		       COALESCE(picture_intrinsic_duration, 0), picture_key_id, COALESCE(picture_hash, ''),
+		       sound_asset_uuid, COALESCE(sound_configuration, ''), subtitle_asset_uuid,
+		       COALESCE(subtitle_language, ''), COALESCE(is_stereoscopic, false),
+		       closed_caption_asset_uuid, COALESCE(closed_caption_language, ''), markers_asset_uuid,
+		       aux_data_asset_uuid, COALESCE(aux_data_type, ''), created_at
+		FROM dcp_reels
+		WHERE composition_id = $1
+		ORDER BY reel_number`
+
+	rows, err := db.Query(query, compositionID)
+	if err != nil {
 		return nil, err
 	}
-	
-	return inventory, nil
-}
+	defer rows.Close()
 
-// DeleteServerDCPInventory removes an inventory entry
-func (db *DB) DeleteServerDCPInventory(inventoryID uuid.UUID) error {
-	query := `DELETE FROM server_dcp_inventory WHERE id = $1`
-	_, err := db.Exec(query, inventoryID)
-	return err
+	var reels []*DCPReel
+	for rows.Next() {
+		r := &DCPReel{}
+		err := rows.Scan(
+			&r.ID, &r.CompositionID, &r.ReelUUID, &r.ReelNumber, &r.DurationFrames,
+			&r.PictureAssetUUID, &r.PictureEditRate, &r.PictureEntryPoint,
+			&r.PictureIntrinsicDuration, &r.PictureKeyID, &r.PictureHash,
+			&r.SoundAssetUUID, &r.SoundConfiguration, &r.SubtitleAssetUUID,
+			&r.SubtitleLanguage, &r.IsStereoscopic,
+			&r.ClosedCaptionAssetUUID, &r.ClosedCaptionLanguage, &r.MarkersAssetUUID,
+			&r.AuxDataAssetUUID, &r.AuxDataType, &r.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reels = append(reels, r)
+	}
+	return reels, rows.Err()
 }
 
-// CreateScanLog creates a new scan log entry
-func (db *DB) CreateScanLog(log *ScanLog) error {
+// GetDCPMarkersByCompositionID returns all markers of a composition in playback order
+func (db *DB) GetDCPMarkersByCompositionID(compositionID uuid.UUID) ([]*DCPMarker, error) {
 	query := `
-		INSERT INTO scan_logs (
-			id, server_id, scan_type, started_at, completed_at,
-			packages_found, packages_added, packages_updated, packages_removed,
-			errors, status
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id`
-	
-	return db.QueryRow(query,
-		log.ID, log.ServerID, log.ScanType, log.StartedAt, log.CompletedAt,
-		log.PackagesFound, log.PackagesAdded, log.PackagesUpdated, log.PackagesRemoved,
-		log.Errors, log.Status,
-	).Scan(&log.ID)
+		SELECT id, composition_id, reel_number, label, offset_frames, absolute_frame, created_at
+		FROM dcp_markers
+		WHERE composition_id = $1
+		ORDER BY absolute_frame, label`
+
+	rows, err := db.Query(query, compositionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var markers []*DCPMarker
+	for rows.Next() {
+		m := &DCPMarker{}
+		if err := rows.Scan(&m.ID, &m.CompositionID, &m.ReelNumber, &m.Label, &m.OffsetFrames, &m.AbsoluteFrame, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		markers = append(markers, m)
+	}
+	return markers, rows.Err()
 }
 
-// UpdateScanLog updates an existing scan log
-func (db *DB) UpdateScanLog(log *ScanLog) error {
-	query := `
-		UPDATE scan_logs SET
-			completed_at = $1,
-			packages_found = $2,
-			packages_added = $3,
-			packages_updated = $4,
-			packages_removed = $5,
-			errors = $6,
-			status = $7
-		WHERE id = $8`
-	
-	_, err := db.Exec(query,
-		log.CompletedAt, log.PackagesFound, log.PackagesAdded,
-		log.PackagesUpdated, log.PackagesRemoved, log.Errors, log.Status, log.ID,
-	)
-	return err
+// GetDCPRatingsByCompositionID returns all ratings of a composition
+func (db *DB) GetDCPRatingsByCompositionID(compositionID uuid.UUID) ([]*DCPRating, error) {
+	query := `SELECT id, composition_id, agency, label, created_at FROM dcp_ratings WHERE composition_id = $1 ORDER BY agency`
+	rows, err := db.Query(query, compositionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratings []*DCPRating
+	for rows.Next() {
+		r := &DCPRating{}
+		if err := rows.Scan(&r.ID, &r.CompositionID, &r.Agency, &r.Label, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, r)
+	}
+	return ratings, rows.Err()
 }
 
-// GetLatestScanLog returns the most recent scan log for a server
-func (db *DB) GetLatestScanLog(serverID uuid.UUID) (*ScanLog, error) {
-	query := `
-		SELECT id, server_id, scan_type, started_at, completed_at,
-		       packages_found, packages_added, packages_updated, packages_removed,
-		       errors, status
-		FROM scan_logs
-		WHERE server_id = $1
-		ORDER BY started_at DESC
-		LIMIT 1`
-	log := &ScanLog{}
-	err := db.QueryRow(query, serverID).Scan(
-		&log.ID, &log.ServerID, &log.ScanType, &log.StartedAt, &log.CompletedAt,
-		&log.PackagesFound, &log.PackagesAdded, &log.PackagesUpdated, &log.PackagesRemoved,
-		&log.Errors, &log.Status,
-	)
+// GetDCPContentVersionsByCompositionID returns all content versions of a composition
+func (db *DB) GetDCPContentVersionsByCompositionID(compositionID uuid.UUID) ([]*DCPContentVersion, error) {
+	query := `SELECT id, composition_id, content_version_id, COALESCE(label_text, ''), created_at
+	          FROM dcp_content_versions WHERE composition_id = $1 ORDER BY created_at`
+	rows, err := db.Query(query, compositionID)
 	if err != nil {
 		return nil, err
 	}
-	return log, nil
+	defer rows.Close()
+
+	var versions []*DCPContentVersion
+	for rows.Next() {
+		v := &DCPContentVersion{}
+		if err := rows.Scan(&v.ID, &v.CompositionID, &v.ContentVersionID, &v.LabelText, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
 }
 
-// UpdateScanLogProgress updates progress fields of a scan log during an in-progress scan
-func (db *DB) UpdateScanLogProgress(scanLogID uuid.UUID, packagesAdded, packagesUpdated int) error {
-	query := `UPDATE scan_logs SET packages_added = $1, packages_updated = $2 WHERE id = $3`
-	_, err := db.Exec(query, packagesAdded, packagesUpdated, scanLogID)
-	return err
+// ReplaceDCPExternalAssets replaces the list of assets a composition references outside its own package.
+// Providers are filled in by ResolveDCPDependencies.
+func (db *DB) ReplaceDCPExternalAssets(compositionID uuid.UUID, assets []*DCPExternalAsset) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_composition_external_assets WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, a := range assets {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_composition_external_assets (id, composition_id, asset_uuid, asset_kind, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (composition_id, asset_uuid) DO NOTHING`,
+			a.ID, compositionID, a.AssetUUID, a.AssetKind, a.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// CountDCPPackages returns the total number of packages
-func (db *DB) CountDCPPackages() (int, error) {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM dcp_packages").Scan(&count)
-	return count, err
+// ReplaceDCPTimedText replaces the timed text inspection results of a composition
+func (db *DB) ReplaceDCPTimedText(compositionID uuid.UUID, tracks []*DCPTimedText) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_timed_text WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_timed_text (
+				id, composition_id, reel_number, track_kind, asset_uuid, standard, language,
+				subtitle_kind, event_count, text_event_count, image_event_count,
+				first_time_in, last_time_out, error, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			t.ID, compositionID, t.ReelNumber, t.TrackKind, t.AssetUUID, t.Standard, t.Language,
+			t.SubtitleKind, t.EventCount, t.TextEventCount, t.ImageEventCount,
+			t.FirstTimeIn, t.LastTimeOut, t.Error, t.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		for _, f := range t.Fonts {
+			_, err := tx.Exec(`
+				INSERT INTO dcp_timed_text_fonts (id, timed_text_id, font_id, uri, present)
+				VALUES ($1, $2, $3, $4, $5)`,
+				uuid.New(), t.ID, f.FontID, f.URI, f.Present,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDCPTimedTextByCompositionID returns the timed text tracks of a composition with their fonts,
+// in reel order
+func (db *DB) GetDCPTimedTextByCompositionID(compositionID uuid.UUID) ([]*DCPTimedText, error) {
+	query := `
+		SELECT id, composition_id, reel_number, track_kind, asset_uuid, COALESCE(standard, ''),
+		       COALESCE(language, ''), COALESCE(subtitle_kind, ''), COALESCE(event_count, 0),
+		       COALESCE(text_event_count, 0), COALESCE(image_event_count, 0),
+		       COALESCE(first_time_in, ''), COALESCE(last_time_out, ''), COALESCE(error, ''), created_at
+		FROM dcp_timed_text
+		WHERE composition_id = $1
+		ORDER BY reel_number, track_kind`
+
+	rows, err := db.Query(query, compositionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tracks []*DCPTimedText
+	byID := make(map[uuid.UUID]*DCPTimedText)
+	for rows.Next() {
+		t := &DCPTimedText{}
+		err := rows.Scan(
+			&t.ID, &t.CompositionID, &t.ReelNumber, &t.TrackKind, &t.AssetUUID, &t.Standard,
+			&t.Language, &t.SubtitleKind, &t.EventCount,
+			&t.TextEventCount, &t.ImageEventCount,
+			&t.FirstTimeIn, &t.LastTimeOut, &t.Error, &t.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, t)
+		byID[t.ID] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return tracks, nil
+	}
+
+	fontRows, err := db.Query(`
+		SELECT f.timed_text_id, COALESCE(f.font_id, ''), COALESCE(f.uri, ''), COALESCE(f.present, FALSE)
+		FROM dcp_timed_text_fonts f
+		JOIN dcp_timed_text t ON t.id = f.timed_text_id
+		WHERE t.composition_id = $1
+		ORDER BY f.font_id`, compositionID)
+	if err != nil {
+		return nil, err
+	}
+	defer fontRows.Close()
+
+	for fontRows.Next() {
+		var timedTextID uuid.UUID
+		f := &DCPTimedTextFont{}
+		if err := fontRows.Scan(&timedTextID, &f.FontID, &f.URI, &f.Present); err != nil {
+			return nil, err
+		}
+		if t := byID[timedTextID]; t != nil {
+			t.Fonts = append(t.Fonts, f)
+		}
+	}
+	return tracks, fontRows.Err()
+}
+
+// ResolveDCPDependencies looks up which indexed package provides the external assets touched by
+// the given packages and rebuilds their VF -> OV relationships: the packages' own external assets,
+// those they provided so far, and the unresolved ones they may now provide. A provider that still
+// holds the asset is kept, so repeated runs are stable when several packages (e.g. two deliveries
+// of the same OV) carry the same track file.
+func (db *DB) ResolveDCPDependencies(packageIDs []uuid.UUID) error {
+	if len(packageIDs) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		WITH resolved AS (
+			UPDATE dcp_composition_external_assets ea SET provider_package_id = (
+				SELECT a.package_id
+				FROM dcp_assets a
+				JOIN dcp_compositions c ON c.id = ea.composition_id
+				WHERE a.asset_uuid = ea.asset_uuid AND a.package_id <> c.package_id
+				ORDER BY (a.package_id = ea.provider_package_id) DESC NULLS LAST, a.created_at
+				LIMIT 1)
+			WHERE ea.composition_id IN (SELECT id FROM dcp_compositions WHERE package_id = ANY($1::uuid[]))
+			   OR ea.provider_package_id = ANY($1::uuid[])
+			   OR (ea.provider_package_id IS NULL
+			       AND ea.asset_uuid IN (SELECT asset_uuid FROM dcp_assets WHERE package_id = ANY($1::uuid[])))
+			RETURNING ea.composition_id)
+		SELECT DISTINCT c.package_id
+		FROM resolved r
+		JOIN dcp_compositions c ON c.id = r.composition_id`, uuidArray(packageIDs))
+	if err != nil {
+		return err
+	}
+	affected := append([]uuid.UUID{}, packageIDs...)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		affected = append(affected, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM dcp_package_dependencies WHERE package_id = ANY($1::uuid[])`, uuidArray(affected)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO dcp_package_dependencies (package_id, ov_package_id, composition_id, asset_count, created_at)
+		SELECT c.package_id, ea.provider_package_id, ea.composition_id, COUNT(*), CURRENT_TIMESTAMP
+		FROM dcp_composition_external_assets ea
+		JOIN dcp_compositions c ON c.id = ea.composition_id
+		WHERE ea.provider_package_id IS NOT NULL AND c.package_id = ANY($1::uuid[])
+		GROUP BY c.package_id, ea.provider_package_id, ea.composition_id`, uuidArray(affected))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) queryDCPPackageDependencies(where string, packageID uuid.UUID) ([]*DCPPackageDependency, error) {
+	query := `SELECT id, package_id, ov_package_id, composition_id, COALESCE(asset_count, 0), created_at
+	          FROM dcp_package_dependencies WHERE ` + where + ` = $1 ORDER BY asset_count DESC, created_at`
+	rows, err := db.Query(query, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deps []*DCPPackageDependency
+	for rows.Next() {
+		d := &DCPPackageDependency{}
+		if err := rows.Scan(&d.ID, &d.PackageID, &d.OVPackageID, &d.CompositionID, &d.AssetCount, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deps = append(deps, d)
+	}
+	return deps, rows.Err()
+}
+
+// GetDCPPackageDependencies returns the OV packages the compositions of a package depend on
+func (db *DB) GetDCPPackageDependencies(packageID uuid.UUID) ([]*DCPPackageDependency, error) {
+	return db.queryDCPPackageDependencies("package_id", packageID)
+}
+
+// GetDCPPackageDependents returns the VF compositions that play assets from the given package
+func (db *DB) GetDCPPackageDependents(ovPackageID uuid.UUID) ([]*DCPPackageDependency, error) {
+	return db.queryDCPPackageDependencies("ov_package_id", ovPackageID)
+}
+
+// CountUnresolvedDCPExternalAssets returns how many external assets of a package's compositions
+// are not provided by any indexed package
+func (db *DB) CountUnresolvedDCPExternalAssets(packageID uuid.UUID) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM dcp_composition_external_assets ea
+		JOIN dcp_compositions c ON c.id = ea.composition_id
+		WHERE c.package_id = $1 AND ea.provider_package_id IS NULL`, packageID).Scan(&count)
+	return count, err
+}
+
+// InsertDCPAsset inserts an asset record, refreshing the role of an existing one
+func (db *DB) InsertDCPAsset(asset *DCPAsset) error {
+	query := `
+		INSERT INTO dcp_assets (
+			id, package_id, asset_uuid, file_path, file_name, asset_type,
+			asset_role, size_bytes, hash_algorithm, hash_value,
+			chunk_offset, chunk_length, created_at,
+			role_source, cpl_uuid, reel_number
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (package_id, asset_uuid) DO UPDATE SET
+			asset_role = EXCLUDED.asset_role,
+			role_source = EXCLUDED.role_source,
+			cpl_uuid = EXCLUDED.cpl_uuid,
+			reel_number = EXCLUDED.reel_number`
+	
+	_, err := db.Exec(query,
+		asset.ID, asset.PackageID, asset.AssetUUID, asset.FilePath, asset.FileName,
+		asset.AssetType, asset.AssetRole, asset.SizeBytes, asset.HashAlgorithm,
+		asset.HashValue, asset.ChunkOffset, asset.ChunkLength, asset.CreatedAt,
+		asset.RoleSource, asset.CPLUUID, asset.ReelNumber,
+	)
+	return err
+}
+
+// UpdateDCPAssetEssence stores the role and MXF header facts of an asset
+func (db *DB) UpdateDCPAssetEssence(asset *DCPAsset) error {
+	query := `
+		UPDATE dcp_assets SET
+			asset_role = $3, essence_kind = $4, essence_container_ul = $5, mxf_package_uuid = $6,
+			is_encrypted = $7, mxf_edit_rate = $8, mxf_duration = $9, stored_width = $10, stored_height = $11,
+			frame_layout = $12, jpeg2000_profile = $13, is_stereoscopic = $14, channel_count = $15,
+			audio_sample_rate = $16, bit_depth = $17, mxf_error = $18, mxf_inspected_at = $19
+		WHERE package_id = $1 AND asset_uuid = $2`
+
+	_, err := db.Exec(query,
+		asset.PackageID, asset.AssetUUID,
+		asset.AssetRole, asset.EssenceKind, asset.EssenceContainerUL, asset.MXFPackageUUID,
+		asset.IsEncrypted, asset.MXFEditRate, asset.MXFDuration, asset.StoredWidth, asset.StoredHeight,
+		asset.FrameLayout, asset.JPEG2000Profile, asset.IsStereoscopic, asset.ChannelCount,
+		asset.AudioSampleRate, asset.BitDepth, asset.MXFError, asset.MXFInspectedAt,
+	)
+	return err
+}
+
+// GetDCPAssetsByPackageID returns the assets of a package, ordered by role and file name
+func (db *DB) GetDCPAssetsByPackageID(packageID uuid.UUID) ([]*DCPAsset, error) {
+	query := `
+		SELECT id, package_id, asset_uuid, COALESCE(file_path, ''), COALESCE(file_name, ''),
+		       COALESCE(asset_type, ''), COALESCE(asset_role, ''), COALESCE(role_source, ''), cpl_uuid, COALESCE(reel_number, 0),
+		       COALESCE(size_bytes, 0),
+		       COALESCE(hash_algorithm, ''), COALESCE(hash_value, ''),
+		       COALESCE(chunk_offset, 0), COALESCE(chunk_length, 0), created_at,
+		       COALESCE(essence_kind, ''), COALESCE(essence_container_ul, ''), mxf_package_uuid,
+		       COALESCE(is_encrypted, FALSE), COALESCE(mxf_edit_rate, ''), COALESCE(mxf_duration, 0),
+		       COALESCE(stored_width, 0), COALESCE(stored_height, 0), COALESCE(frame_layout, ''),
+		       COALESCE(jpeg2000_profile, ''), COALESCE(is_stereoscopic, FALSE), COALESCE(channel_count, 0),
+		       COALESCE(audio_sample_rate, 0), COALESCE(bit_depth, 0), COALESCE(mxf_error, ''), mxf_inspected_at
+		FROM dcp_assets
+		WHERE package_id = $1
+		ORDER BY asset_role, reel_number, file_name`
+
+	rows, err := db.Query(query, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []*DCPAsset
+	for rows.Next() {
+		a := &DCPAsset{}
+		err := rows.Scan(
+			&a.ID, &a.PackageID, &a.AssetUUID, &a.FilePath, &a.FileName,
+			&a.AssetType, &a.AssetRole, &a.RoleSource, &a.CPLUUID, &a.ReelNumber,
+			&a.SizeBytes,
+			&a.HashAlgorithm, &a.HashValue,
+			&a.ChunkOffset, &a.ChunkLength, &a.CreatedAt,
+			&a.EssenceKind, &a.EssenceContainerUL, &a.MXFPackageUUID,
+			&a.IsEncrypted, &a.MXFEditRate, &a.MXFDuration,
+			&a.StoredWidth, &a.StoredHeight, &a.FrameLayout,
+			&a.JPEG2000Profile, &a.IsStereoscopic, &a.ChannelCount,
+			&a.AudioSampleRate, &a.BitDepth, &a.MXFError, &a.MXFInspectedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
+
+// InsertDCPPackingList inserts a packing list record, refreshing the signature verdict of an existing one
+func (db *DB) InsertDCPPackingList(pkl *DCPPackingList) error {
+	query := `
+		INSERT INTO dcp_packing_lists (
+			id, package_id, pkl_uuid, annotation_text, issue_date,
+			issuer, creator, asset_count, created_at,
+			signature_status, signer_subject, signer_issuer, signer_not_before, signer_not_after, signature_message
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (package_id, pkl_uuid) DO UPDATE SET
+			asset_count = EXCLUDED.asset_count,
+			signature_status = EXCLUDED.signature_status,
+			signer_subject = EXCLUDED.signer_subject,
+			signer_issuer = EXCLUDED.signer_issuer,
+			signer_not_before = EXCLUDED.signer_not_before,
+			signer_not_after = EXCLUDED.signer_not_after,
+			signature_message = EXCLUDED.signature_message`
+	
+	_, err := db.Exec(query,
+		pkl.ID, pkl.PackageID, pkl.PKLUUID, pkl.AnnotationText, pkl.IssueDate,
+		pkl.Issuer, pkl.Creator, pkl.AssetCount, pkl.CreatedAt,
+		pkl.SignatureStatus, pkl.SignerSubject, pkl.SignerIssuer, pkl.SignerNotBefore, pkl.SignerNotAfter, pkl.SignatureMessage,
+	)
+	return err
+}
+
+// GetDCPPackingListsByPackageID returns the packing lists of a package
+func (db *DB) GetDCPPackingListsByPackageID(packageID uuid.UUID) ([]*DCPPackingList, error) {
+	query := `
+		SELECT id, package_id, pkl_uuid, COALESCE(annotation_text, ''), issue_date,
+		       COALESCE(issuer, ''), COALESCE(creator, ''), COALESCE(asset_count, 0),
+		       COALESCE(signature_status, 'unknown'), COALESCE(signer_subject, ''), COALESCE(signer_issuer, ''),
+		       signer_not_before, signer_not_after, COALESCE(signature_message, ''), created_at
+		FROM dcp_packing_lists
+		WHERE package_id = $1
+		ORDER BY created_at`
+
+	rows, err := db.Query(query, packageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pkls []*DCPPackingList
+	for rows.Next() {
+		p := &DCPPackingList{}
+		err := rows.Scan(
+			&p.ID, &p.PackageID, &p.PKLUUID, &p.AnnotationText, &p.IssueDate,
+			&p.Issuer, &p.Creator, &p.AssetCount,
+			&p.SignatureStatus, &p.SignerSubject, &p.SignerIssuer,
+			&p.SignerNotBefore, &p.SignerNotAfter, &p.SignatureMessage, &p.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pkls = append(pkls, p)
+	}
+	return pkls, rows.Err()
+}
+
+// UpsertServerDCPInventory inserts or updates inventory record. The quarantine columns are
+// kept while the status stays "quarantined" and cleared once it changes.
+func (db *DB) UpsertServerDCPInventory(inv *ServerDCPInventory) error {
+	query := `
+		INSERT INTO server_dcp_inventory (
+			id, server_id, package_id, local_path, status, last_verified, created_at, updated_at, volumes_present,
+			quarantined_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, GREATEST($9, 1), $10)
+		ON CONFLICT (server_id, package_id) DO UPDATE SET
+			local_path = EXCLUDED.local_path,
+			status = EXCLUDED.status,
+			volumes_present = EXCLUDED.volumes_present,
+			quarantine_path = CASE WHEN EXCLUDED.status = 'quarantined' THEN server_dcp_inventory.quarantine_path END,
+			quarantined_at = CASE WHEN EXCLUDED.status = 'quarantined'
+				THEN COALESCE(server_dcp_inventory.quarantined_at, EXCLUDED.quarantined_at, CURRENT_TIMESTAMP) END,
+			last_verified = EXCLUDED.last_verified,
+			updated_at = CURRENT_TIMESTAMP`
+	
+	_, err := db.Exec(query,
+		inv.ID, inv.ServerID, inv.PackageID, inv.LocalPath,
+		inv.Status, inv.LastVerified, inv.CreatedAt, inv.UpdatedAt,
+		inv.VolumesPresent, inv.QuarantinedAt,
+	)
+	return err
+}
+
+// GetServerInventory retrieves all inventory entries for a specific server
+func (db *DB) GetServerInventory(serverID uuid.UUID) ([]*ServerDCPInventory, error) {
+	query := `
+		SELECT id, server_id, package_id, local_path, status, last_verified, created_at, updated_at,
+		       COALESCE(volumes_present, 1), COALESCE(quarantine_path, ''), quarantined_at
+		FROM server_dcp_inventory
+		WHERE server_id = $1
+		ORDER BY created_at DESC`
+	
+	rows, err := db.Query(query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var inventory []*ServerDCPInventory
+	for rows.Next() {
+		inv := &ServerDCPInventory{}
+		err := rows.Scan(
+			&inv.ID, &inv.ServerID, &inv.PackageID, &inv.LocalPath,
+			&inv.Status, &inv.LastVerified, &inv.CreatedAt, &inv.UpdatedAt,
+			&inv.VolumesPresent, &inv.QuarantinePath, &inv.QuarantinedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		inventory = append(inventory, inv)
+	}
+	
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	
+	return inventory, nil
+}
+
+// DeleteServerDCPInventory removes an inventory entry
+func (db *DB) DeleteServerDCPInventory(inventoryID uuid.UUID) error {
+	query := `DELETE FROM server_dcp_inventory WHERE id = $1`
+	_, err := db.Exec(query, inventoryID)
+	return err
+}
+
+// How often a storage sample is kept per location (heartbeats arrive more often), and how long
+const (
+	storageSampleInterval  = 5 * time.Minute
+	storageSampleRetention = 90 * 24 * time.Hour
+)
+
+// RecordStorageUsage stores the filesystem usage a server reported, at most one sample per
+// location every storageSampleInterval, and drops its samples older than the retention
+func (db *DB) RecordStorageUsage(serverID uuid.UUID, usage []dcp.StorageUsage) error {
+	now := time.Now()
+	for _, u := range usage {
+		_, err := db.Exec(`
+			INSERT INTO server_storage_samples (server_id, path, kind, total_bytes, free_bytes, sampled_at)
+			SELECT $1, $2, $3, $4, $5, $6
+			WHERE NOT EXISTS (
+				SELECT 1 FROM server_storage_samples
+				WHERE server_id = $1 AND path = $2 AND kind = $3 AND sampled_at > $7)`,
+			serverID, u.Path, u.Kind, u.TotalBytes, u.FreeBytes, now, now.Add(-storageSampleInterval))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`DELETE FROM server_storage_samples WHERE server_id = $1 AND sampled_at < $2`,
+		serverID, now.Add(-storageSampleRetention))
+	return err
+}
+
+// GetStorageSamples returns the storage samples of a server taken since a given time, oldest first
+func (db *DB) GetStorageSamples(serverID uuid.UUID, since time.Time) ([]*StorageSample, error) {
+	rows, err := db.Query(`
+		SELECT server_id, path, kind, total_bytes, free_bytes, sampled_at
+		FROM server_storage_samples
+		WHERE server_id = $1 AND sampled_at >= $2
+		ORDER BY sampled_at`, serverID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*StorageSample
+	for rows.Next() {
+		s := &StorageSample{}
+		if err := rows.Scan(&s.ServerID, &s.Path, &s.Kind, &s.TotalBytes, &s.FreeBytes, &s.SampledAt); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// GetDownloadStorage returns the latest sample of a server's download location, or nil when
+// the server never reported one
+func (db *DB) GetDownloadStorage(serverID uuid.UUID) (*StorageSample, error) {
+	s := &StorageSample{}
+	err := db.QueryRow(`
+		SELECT server_id, path, kind, total_bytes, free_bytes, sampled_at
+		FROM server_storage_samples
+		WHERE server_id = $1 AND kind = 'download'
+		ORDER BY sampled_at DESC LIMIT 1`, serverID).Scan(
+		&s.ServerID, &s.Path, &s.Kind, &s.TotalBytes, &s.FreeBytes, &s.SampledAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetStorageReserveBytes returns the space a server keeps free on its download location
+func (db *DB) GetStorageReserveBytes(serverID uuid.UUID) (int64, error) {
+	var gb int64
+	err := db.QueryRow(`SELECT storage_reserve_gb FROM servers WHERE id = $1`, serverID).Scan(&gb)
+	return gb << 30, err
+}
+
+// GetTrashRetentionDays returns how many days a server keeps quarantined packages
+func (db *DB) GetTrashRetentionDays(serverID uuid.UUID) (int, error) {
+	var days int
+	err := db.QueryRow(`SELECT trash_retention_days FROM servers WHERE id = $1`, serverID).Scan(&days)
+	return days, err
+}
+
+// CreateScanLog creates a new scan log entry
+func (db *DB) CreateScanLog(log *ScanLog) error {
+	query := `
+		INSERT INTO scan_logs (
+			id, server_id, scan_type, started_at, completed_at,
+			packages_found, packages_added, packages_updated, packages_removed,
+			signatures_checked, signatures_invalid, errors, status,
+			packages_skipped, packages_changed
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id`
+	
+	return db.QueryRow(query,
+		log.ID, log.ServerID, log.ScanType, log.StartedAt, log.CompletedAt,
+		log.PackagesFound, log.PackagesAdded, log.PackagesUpdated, log.PackagesRemoved,
+		log.SignaturesChecked, log.SignaturesInvalid, log.Errors, log.Status,
+		log.PackagesSkipped, log.PackagesChanged,
+	).Scan(&log.ID)
+}
+
+// UpdateScanLog updates an existing scan log
+func (db *DB) UpdateScanLog(log *ScanLog) error {
+	query := `
+		UPDATE scan_logs SET
+			completed_at = $1,
+			packages_found = $2,
+			packages_added = $3,
+			packages_updated = $4,
+			packages_removed = $5,
+			signatures_checked = $6,
+			signatures_invalid = $7,
+			errors = $8,
+			status = $9,
+			packages_skipped = $11,
+			packages_changed = $12
+		WHERE id = $10`
+	
+	_, err := db.Exec(query,
+		log.CompletedAt, log.PackagesFound, log.PackagesAdded,
+		log.PackagesUpdated, log.PackagesRemoved, log.SignaturesChecked, log.SignaturesInvalid,
+		log.Errors, log.Status, log.ID, log.PackagesSkipped, log.PackagesChanged,
+	)
+	return err
+}
+
+// GetLatestScanLog returns the most recent scan log for a server
+func (db *DB) GetLatestScanLog(serverID uuid.UUID) (*ScanLog, error) {
+	query := `
+		SELECT id, server_id, scan_type, started_at, completed_at,
+		       packages_found, packages_added, packages_updated, packages_removed,
+		       COALESCE(signatures_checked, 0), COALESCE(signatures_invalid, 0), errors, status,
+		       COALESCE(packages_skipped, 0), COALESCE(packages_changed, 0)
+		FROM scan_logs
+		WHERE server_id = $1
+		ORDER BY started_at DESC
+		LIMIT 1`
+	log := &ScanLog{}
+	err := db.QueryRow(query, serverID).Scan(
+		&log.ID, &log.ServerID, &log.ScanType, &log.StartedAt, &log.CompletedAt,
+		&log.PackagesFound, &log.PackagesAdded, &log.PackagesUpdated, &log.PackagesRemoved,
+		&log.SignaturesChecked, &log.SignaturesInvalid, &log.Errors, &log.Status,
+		&log.PackagesSkipped, &log.PackagesChanged,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// GetScanCache returns the cached file states of every package on a server, keyed by package path
+func (db *DB) GetScanCache(serverID uuid.UUID) (map[string]map[string]*ScanCacheEntry, error) {
+	rows, err := db.Query(`
+		SELECT package_path, file_path, COALESCE(inode, 0), COALESCE(size_bytes, 0), mod_time, COALESCE(xml_hash, '')
+		FROM scan_file_cache WHERE server_id = $1`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cache := make(map[string]map[string]*ScanCacheEntry)
+	for rows.Next() {
+		e := &ScanCacheEntry{ServerID: serverID}
+		var inode int64
+		if err := rows.Scan(&e.PackagePath, &e.FilePath, &inode, &e.Size, &e.ModTime, &e.XMLHash); err != nil {
+			return nil, err
+		}
+		e.Inode = uint64(inode)
+		if cache[e.PackagePath] == nil {
+			cache[e.PackagePath] = make(map[string]*ScanCacheEntry)
+		}
+		cache[e.PackagePath][e.FilePath] = e
+	}
+	return cache, rows.Err()
+}
+
+// ReplaceScanCachePackage replaces the cached file states of one package
+func (db *DB) ReplaceScanCachePackage(serverID uuid.UUID, packagePath string, entries []*ScanCacheEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM scan_file_cache WHERE server_id = $1 AND package_path = $2`, serverID, packagePath); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		_, err := tx.Exec(`
+			INSERT INTO scan_file_cache (server_id, package_path, file_path, inode, size_bytes, mod_time, xml_hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (server_id, file_path) DO UPDATE SET
+				package_path = EXCLUDED.package_path, inode = EXCLUDED.inode, size_bytes = EXCLUDED.size_bytes,
+				mod_time = EXCLUDED.mod_time, xml_hash = EXCLUDED.xml_hash, updated_at = CURRENT_TIMESTAMP`,
+			serverID, packagePath, e.FilePath, int64(e.Inode), e.Size, e.ModTime, e.XMLHash,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteScanCachePackage forgets the cached file states of a package that is gone
+func (db *DB) DeleteScanCachePackage(serverID uuid.UUID, packagePath string) error {
+	_, err := db.Exec(`DELETE FROM scan_file_cache WHERE server_id = $1 AND package_path = $2`, serverID, packagePath)
+	return err
+}
+
+// ReplaceArchiveMembers replaces the recorded archive members of one package
+func (db *DB) ReplaceArchiveMembers(serverID uuid.UUID, packagePath string, members []*ArchiveMember) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_archive_members WHERE server_id = $1 AND package_path = $2`, serverID, packagePath); err != nil {
+		return err
+	}
+	for _, m := range members {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_archive_members (server_id, package_id, package_path, archive_path, member_path, data_offset, size_bytes, mod_time)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (server_id, archive_path, member_path) DO UPDATE SET
+				package_id = EXCLUDED.package_id, package_path = EXCLUDED.package_path, data_offset = EXCLUDED.data_offset,
+				size_bytes = EXCLUDED.size_bytes, mod_time = EXCLUDED.mod_time, updated_at = CURRENT_TIMESTAMP`,
+			serverID, m.PackageID, packagePath, m.ArchivePath, m.MemberPath, m.DataOffset, m.Size, m.ModTime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteArchiveMembers forgets the archive members of a package that is gone
+func (db *DB) DeleteArchiveMembers(serverID uuid.UUID, packagePath string) error {
+	_, err := db.Exec(`DELETE FROM dcp_archive_members WHERE server_id = $1 AND package_path = $2`, serverID, packagePath)
+	return err
+}
+
+// FindAssetCopies returns the MXF files of a package that servers (all, or only serverID)
+// already hold with identical content in other packages, one copy per file and server. Copies
+// in multi-volume packages and in tar archives are left out as they cannot be linked.
+func (db *DB) FindAssetCopies(packageID uuid.UUID, serverID *uuid.UUID) ([]*AssetCopy, error) {
+	query := `
+		SELECT DISTINCT ON (a.id, inv.server_id)
+		       a.asset_uuid, a.file_path, a.size_bytes, a.hash_value,
+		       inv.server_id, o.package_id, op.package_name, inv.local_path, o.file_path
+		FROM dcp_assets a
+		JOIN dcp_assets o ON o.hash_value = a.hash_value AND o.size_bytes = a.size_bytes AND o.package_id <> a.package_id
+		JOIN dcp_packages op ON op.id = o.package_id AND COALESCE(op.volume_count, 1) <= 1
+		JOIN server_dcp_inventory inv ON inv.package_id = o.package_id AND inv.status = 'online'
+		WHERE a.package_id = $1 AND ($2::uuid IS NULL OR inv.server_id = $2)
+		  AND COALESCE(a.hash_value, '') <> '' AND a.size_bytes > 0
+		  AND LOWER(a.file_path) LIKE '%.mxf' AND COALESCE(o.file_path, '') <> ''
+		  AND NOT EXISTS (
+		      SELECT 1 FROM dcp_archive_members m
+		      WHERE m.server_id = inv.server_id AND m.package_path = inv.local_path)
+		ORDER BY a.id, inv.server_id, inv.last_verified DESC`
+
+	rows, err := db.Query(query, packageID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var copies []*AssetCopy
+	for rows.Next() {
+		c := &AssetCopy{}
+		var localPath, sourceFile string
+		if err := rows.Scan(&c.AssetUUID, &c.FilePath, &c.SizeBytes, &c.HashValue,
+			&c.ServerID, &c.SourcePackageID, &c.SourcePackageName, &localPath, &sourceFile); err != nil {
+			return nil, err
+		}
+		c.SourcePath = filepath.Join(localPath, filepath.FromSlash(sourceFile))
+		copies = append(copies, c)
+	}
+	return copies, rows.Err()
+}
+
+// GetBandwidthSchedule returns the bandwidth calendar of a server, nil if there is no such server
+func (db *DB) GetBandwidthSchedule(serverID uuid.UUID) (*BandwidthSchedule, error) {
+	sched := &BandwidthSchedule{ServerID: serverID}
+	err := db.QueryRow(`SELECT bandwidth_timezone, download_limit_bps, upload_limit_bps FROM servers WHERE id = $1`, serverID).
+		Scan(&sched.Timezone, &sched.DownloadLimitBps, &sched.UploadLimitBps)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, days_of_week, start_minute, end_minute, download_limit_bps, upload_limit_bps
+		FROM server_bandwidth_windows
+		WHERE server_id = $1
+		ORDER BY position, created_at`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		w := &BandwidthWindow{}
+		if err := rows.Scan(&w.ID, pq.Array(&w.DaysOfWeek), &w.StartMinute, &w.EndMinute,
+			&w.DownloadLimitBps, &w.UploadLimitBps); err != nil {
+			return nil, err
+		}
+		sched.Windows = append(sched.Windows, w)
+	}
+	return sched, rows.Err()
+}
+
+// ReplaceBandwidthSchedule stores a server's bandwidth calendar, replacing its windows
+func (db *DB) ReplaceBandwidthSchedule(sched *BandwidthSchedule) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE servers SET bandwidth_timezone = $2, download_limit_bps = $3, upload_limit_bps = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, sched.ServerID, sched.Timezone, sched.DownloadLimitBps, sched.UploadLimitBps)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM server_bandwidth_windows WHERE server_id = $1`, sched.ServerID); err != nil {
+		return err
+	}
+	for i, w := range sched.Windows {
+		if w.ID == uuid.Nil {
+			w.ID = uuid.New()
+		}
+		days := w.DaysOfWeek
+		if days == nil {
+			days = []int64{}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO server_bandwidth_windows (id, server_id, position, days_of_week, start_minute, end_minute, download_limit_bps, upload_limit_bps)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			w.ID, sched.ServerID, i, pq.Array(days), w.StartMinute, w.EndMinute, w.DownloadLimitBps, w.UploadLimitBps)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateScanLogProgress updates progress fields of a scan log during an in-progress scan
+func (db *DB) UpdateScanLogProgress(scanLogID uuid.UUID, packagesAdded, packagesUpdated int) error {
+	query := `UPDATE scan_logs SET packages_added = $1, packages_updated = $2 WHERE id = $3`
+	_, err := db.Exec(query, packagesAdded, packagesUpdated, scanLogID)
+	return err
+}
+
+// CountDCPPackages returns the total number of packages
+func (db *DB) CountDCPPackages() (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM dcp_packages").Scan(&count)
+	return count, err
+}
+
+// CreateDCPVerification inserts a new verification run
+func (db *DB) CreateDCPVerification(v *DCPVerification) error {
+	query := `
+		INSERT INTO dcp_verifications (id, package_id, server_id, status, started_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := db.Exec(query, v.ID, v.PackageID, v.ServerID, v.Status, v.StartedAt, v.CreatedAt)
+	return err
+}
+
+// UpdateDCPVerificationStatus changes the status of a run that has not produced results (e.g. dispatch failed)
+func (db *DB) UpdateDCPVerificationStatus(id uuid.UUID, status, errorMessage string) error {
+	query := `UPDATE dcp_verifications SET status = $1, error_message = NULLIF($2, ''),
+	          completed_at = CASE WHEN $1 IN ('passed', 'failed', 'error') THEN CURRENT_TIMESTAMP ELSE completed_at END
+	          WHERE id = $3`
+	_, err := db.Exec(query, status, errorMessage, id)
+	return err
+}
+
+// ExpireDCPVerifications marks runs still pending or running that started before the cutoff as
+// errored, so a client that went away mid-run does not leave them open forever. It returns the
+// number of runs expired.
+func (db *DB) ExpireDCPVerifications(before time.Time) (int64, error) {
+	res, err := db.Exec(`
+		UPDATE dcp_verifications SET status = 'error', completed_at = CURRENT_TIMESTAMP,
+		       error_message = 'No result reported before the verification timed out'
+		WHERE status IN ('pending', 'running') AND COALESCE(started_at, created_at) < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CompleteDCPVerification stores the verdict and per-asset results of a run. A run that reached a
+// verdict (passed or failed) also stamps dcp_packages.last_verified.
+func (db *DB) CompleteDCPVerification(v *DCPVerification, assets []*DCPVerificationAsset) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE dcp_verifications SET
+			status = $1, assets_total = $2, assets_passed = $3, assets_failed = $4,
+			bytes_total = $5, error_message = NULLIF($6, ''),
+			started_at = COALESCE($7, started_at), completed_at = $8
+		WHERE id = $9`,
+		v.Status, v.AssetsTotal, v.AssetsPassed, v.AssetsFailed,
+		v.BytesTotal, v.ErrorMessage, v.StartedAt, v.CompletedAt, v.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM dcp_verification_assets WHERE verification_id = $1`, v.ID); err != nil {
+		return err
+	}
+	for _, a := range assets {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_verification_assets (id, verification_id, asset_uuid, file_path, expected_size, actual_size, expected_hash, actual_hash, status, message)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))`,
+			a.ID, v.ID, a.AssetUUID, a.FilePath, a.ExpectedSize, a.ActualSize, a.ExpectedHash, a.ActualHash, a.Status, a.Message,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if v.Status == VerificationPassed || v.Status == VerificationFailed {
+		if _, err := tx.Exec(`UPDATE dcp_packages SET last_verified = $1 WHERE id = $2`, v.CompletedAt, v.PackageID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const dcpVerificationColumns = `id, package_id, server_id, status, COALESCE(assets_total, 0), COALESCE(assets_passed, 0),
+	COALESCE(assets_failed, 0), COALESCE(bytes_total, 0), COALESCE(error_message, ''),
+	started_at, completed_at, created_at`
+
+func scanDCPVerification(row interface{ Scan(...interface{}) error }) (*DCPVerification, error) {
+	v := &DCPVerification{}
+	err := row.Scan(&v.ID, &v.PackageID, &v.ServerID, &v.Status, &v.AssetsTotal, &v.AssetsPassed,
+		&v.AssetsFailed, &v.BytesTotal, &v.ErrorMessage,
+		&v.StartedAt, &v.CompletedAt, &v.CreatedAt)
+	return v, err
+}
+
+// GetDCPVerification retrieves a verification run by ID
+func (db *DB) GetDCPVerification(id uuid.UUID) (*DCPVerification, error) {
+	v, err := scanDCPVerification(db.QueryRow(`SELECT `+dcpVerificationColumns+` FROM dcp_verifications WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// GetLatestDCPVerification returns the most recent verification run of a package
+func (db *DB) GetLatestDCPVerification(packageID uuid.UUID) (*DCPVerification, error) {
+	v, err := scanDCPVerification(db.QueryRow(`SELECT `+dcpVerificationColumns+` FROM dcp_verifications
+		WHERE package_id = $1 ORDER BY created_at DESC LIMIT 1`, packageID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// GetDCPVerificationAssets returns the per-asset results of a run, failures first
+func (db *DB) GetDCPVerificationAssets(verificationID uuid.UUID) ([]*DCPVerificationAsset, error) {
+	query := `
+		SELECT id, verification_id, asset_uuid, COALESCE(file_path, ''), COALESCE(expected_size, 0), COALESCE(actual_size, 0),
+		       COALESCE(expected_hash, ''), COALESCE(actual_hash, ''), status, COALESCE(message, '')
+		FROM dcp_verification_assets
+		WHERE verification_id = $1
+		ORDER BY (status = 'pass'), file_path`
+
+	rows, err := db.Query(query, verificationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []*DCPVerificationAsset
+	for rows.Next() {
+		a := &DCPVerificationAsset{}
+		if err := rows.Scan(&a.ID, &a.VerificationID, &a.AssetUUID, &a.FilePath, &a.ExpectedSize, &a.ActualSize,
+			&a.ExpectedHash, &a.ActualHash, &a.Status, &a.Message); err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
+
+// ReplaceDCPValidationFindings replaces the validation findings of a package on a server
+func (db *DB) ReplaceDCPValidationFindings(packageID, serverID uuid.UUID, findings []*DCPValidationFinding) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_validation_findings WHERE package_id = $1 AND server_id = $2`, packageID, serverID); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_validation_findings (id, package_id, server_id, check_id, severity, subject, message, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			f.ID, packageID, serverID, f.CheckID, f.Severity, f.Subject, f.Message, f.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDCPValidationFindings returns the findings of a package on every server, errors first.
+// A nil serverID returns all servers.
+func (db *DB) GetDCPValidationFindings(packageID uuid.UUID, serverID *uuid.UUID) ([]*DCPValidationFinding, error) {
+	query := `
+		SELECT id, package_id, server_id, check_id, severity, COALESCE(subject, ''), COALESCE(message, ''), created_at
+		FROM dcp_validation_findings
+		WHERE package_id = $1 AND ($2::uuid IS NULL OR server_id = $2)
+		ORDER BY CASE severity WHEN 'error' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, server_id, check_id, subject`
+
+	rows, err := db.Query(query, packageID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []*DCPValidationFinding
+	for rows.Next() {
+		f := &DCPValidationFinding{}
+		if err := rows.Scan(&f.ID, &f.PackageID, &f.ServerID, &f.CheckID, &f.Severity,
+			&f.Subject, &f.Message, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// ListPackagesWithFindings returns the packages with at least one finding of the given
+// severity ("error" or "warning"; "warning" also includes packages with errors), worst first
+func (db *DB) ListPackagesWithFindings(severity string) ([]*PackageValidationSummary, error) {
+	query := `
+		SELECT p.id, p.assetmap_uuid, p.package_name,
+		       COUNT(*) FILTER (WHERE f.severity = 'error'),
+		       COUNT(*) FILTER (WHERE f.severity = 'warning'),
+		       COUNT(DISTINCT f.server_id) FILTER (WHERE f.severity IN ('error', 'warning')),
+		       MAX(f.created_at)
+		FROM dcp_validation_findings f
+		JOIN dcp_packages p ON p.id = f.package_id
+		GROUP BY p.id, p.assetmap_uuid, p.package_name
+		HAVING COUNT(*) FILTER (WHERE f.severity = 'error') > 0
+		    OR ($1 = 'warning' AND COUNT(*) FILTER (WHERE f.severity = 'warning') > 0)
+		ORDER BY 4 DESC, 5 DESC, p.package_name`
+
+	rows, err := db.Query(query, severity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*PackageValidationSummary
+	for rows.Next() {
+		v := &PackageValidationSummary{}
+		if err := rows.Scan(&v.PackageID, &v.AssetMapUUID, &v.PackageName,
+			&v.ErrorCount, &v.WarningCount, &v.ServerCount, &v.LastChecked); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, v)
+	}
+	return summaries, rows.Err()
+}
+
+// ReplaceDCPCompositionKeys replaces the KeyIds of a composition's encrypted track files
+func (db *DB) ReplaceDCPCompositionKeys(compositionID uuid.UUID, keys []*DCPCompositionKey) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM dcp_composition_keys WHERE composition_id = $1`, compositionID); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		_, err := tx.Exec(`
+			INSERT INTO dcp_composition_keys (id, composition_id, key_id, key_kind, reel_number)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (composition_id, key_id) DO NOTHING`,
+			k.ID, compositionID, k.KeyID, k.KeyKind, k.ReelNumber,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDCPCompositionKeysByCPLUUID returns the distinct KeyIds of a CPL. The same CPL may be indexed
+// in several packages (cross-site deliveries); its keys are identical in each.
+func (db *DB) GetDCPCompositionKeysByCPLUUID(cplUUID uuid.UUID) ([]*DCPCompositionKey, error) {
+	query := `
+		SELECT DISTINCT ON (k.key_id) k.id, k.composition_id, k.key_id, COALESCE(k.key_kind, ''), COALESCE(k.reel_number, 0)
+		FROM dcp_composition_keys k
+		JOIN dcp_compositions c ON c.id = k.composition_id
+		WHERE c.cpl_uuid = $1
+		ORDER BY k.key_id, k.reel_number`
+
+	rows, err := db.Query(query, cplUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*DCPCompositionKey
+	for rows.Next() {
+		k := &DCPCompositionKey{}
+		if err := rows.Scan(&k.ID, &k.CompositionID, &k.KeyID, &k.KeyKind, &k.ReelNumber); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// UpsertKDM stores a KDM and its KeyIdList, keyed by MessageId. Re-ingesting the same KDM keeps
+// the server it was first linked to unless a server is given.
+func (db *DB) UpsertKDM(k *KDM, keys []*KDMKey) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO kdms (
+			id, message_id, cpl_uuid, content_title_text, annotation_text, standard,
+			issue_date, signer_issuer, recipient_subject, recipient_thumbprint, recipient_serial,
+			device_thumbprints, not_valid_before, not_valid_after, server_id, source_path,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''), $17, $18)
+		ON CONFLICT (message_id) DO UPDATE SET
+			cpl_uuid = EXCLUDED.cpl_uuid,
+			content_title_text = EXCLUDED.content_title_text,
+			annotation_text = EXCLUDED.annotation_text,
+			standard = EXCLUDED.standard,
+			issue_date = EXCLUDED.issue_date,
+			signer_issuer = EXCLUDED.signer_issuer,
+			recipient_subject = EXCLUDED.recipient_subject,
+			recipient_thumbprint = EXCLUDED.recipient_thumbprint,
+			recipient_serial = EXCLUDED.recipient_serial,
+			device_thumbprints = EXCLUDED.device_thumbprints,
+			not_valid_before = EXCLUDED.not_valid_before,
+			not_valid_after = EXCLUDED.not_valid_after,
+			server_id = COALESCE(kdms.server_id, EXCLUDED.server_id),
+			source_path = COALESCE(kdms.source_path, EXCLUDED.source_path),
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id`,
+		k.ID, k.MessageID, k.CPLUUID, k.ContentTitleText, k.AnnotationText, k.Standard,
+		k.IssueDate, k.SignerIssuer, k.RecipientSubject, k.RecipientThumbprint, k.RecipientSerial,
+		k.DeviceThumbprints, k.NotValidBefore, k.NotValidAfter, k.ServerID, k.SourcePath,
+		k.CreatedAt, k.UpdatedAt,
+	).Scan(&k.ID)
+	if err != nil {
+		return err
+	}
+
+	// Every server holding the KDM keeps its own link and path
+	if k.ServerID != nil {
+		_, err := tx.Exec(`
+			INSERT INTO kdm_servers (kdm_id, server_id, source_path) VALUES ($1, $2, NULLIF($3, ''))
+			ON CONFLICT (kdm_id, server_id) DO UPDATE SET
+				source_path = COALESCE(EXCLUDED.source_path, kdm_servers.source_path),
+				updated_at = CURRENT_TIMESTAMP`,
+			k.ID, *k.ServerID, k.SourcePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM kdm_keys WHERE kdm_id = $1`, k.ID); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		_, err := tx.Exec(`
+			INSERT INTO kdm_keys (id, kdm_id, key_id, key_type)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (kdm_id, key_id) DO NOTHING`,
+			key.ID, k.ID, key.KeyID, key.KeyType,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const kdmColumns = `id, message_id, cpl_uuid, COALESCE(content_title_text, ''), COALESCE(annotation_text, ''),
+	COALESCE(standard, 'unknown'), issue_date, COALESCE(signer_issuer, ''), COALESCE(recipient_subject, ''),
+	COALESCE(recipient_thumbprint, ''), COALESCE(recipient_serial, ''), COALESCE(device_thumbprints, ''),
+	not_valid_before, not_valid_after, server_id, COALESCE(source_path, ''), created_at, updated_at`
+
+func scanKDM(row interface{ Scan(...interface{}) error }) (*KDM, error) {
+	k := &KDM{}
+	err := row.Scan(&k.ID, &k.MessageID, &k.CPLUUID, &k.ContentTitleText, &k.AnnotationText,
+		&k.Standard, &k.IssueDate, &k.SignerIssuer, &k.RecipientSubject,
+		&k.RecipientThumbprint, &k.RecipientSerial, &k.DeviceThumbprints,
+		&k.NotValidBefore, &k.NotValidAfter, &k.ServerID, &k.SourcePath, &k.CreatedAt, &k.UpdatedAt)
+	return k, err
+}
+
+func (db *DB) queryKDMs(query string, args ...interface{}) ([]*KDM, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kdms []*KDM
+	for rows.Next() {
+		k, err := scanKDM(rows)
+		if err != nil {
+			return nil, err
+		}
+		kdms = append(kdms, k)
+	}
+	return kdms, rows.Err()
+}
+
+// GetKDM retrieves a KDM by ID
+func (db *DB) GetKDM(id uuid.UUID) (*KDM, error) {
+	k, err := scanKDM(db.QueryRow(`SELECT `+kdmColumns+` FROM kdms WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return k, err
+}
+
+// ListKDMs returns KDMs ordered by the end of their key window, optionally restricted to a
+// server and/or a CPL
+func (db *DB) ListKDMs(serverID, cplUUID *uuid.UUID) ([]*KDM, error) {
+	return db.queryKDMs(`SELECT `+kdmColumns+` FROM kdms
+		WHERE ($1::uuid IS NULL OR EXISTS (SELECT 1 FROM kdm_servers ks WHERE ks.kdm_id = kdms.id AND ks.server_id = $1))
+		  AND ($2::uuid IS NULL OR cpl_uuid = $2)
+		ORDER BY not_valid_after`, serverID, cplUUID)
+}
+
+// GetExpiringKDMs returns the server's KDMs whose key window is open and closes before the given time
+func (db *DB) GetExpiringKDMs(serverID uuid.UUID, before time.Time) ([]*KDM, error) {
+	return db.queryKDMs(`SELECT `+kdmColumns+` FROM kdms
+		WHERE EXISTS (SELECT 1 FROM kdm_servers ks WHERE ks.kdm_id = kdms.id AND ks.server_id = $1)
+		  AND not_valid_before <= CURRENT_TIMESTAMP
+		  AND not_valid_after > CURRENT_TIMESTAMP AND not_valid_after <= $2
+		ORDER BY not_valid_after`, serverID, before)
+}
+
+// GetKDMKeys returns the KeyIdList of a KDM
+func (db *DB) GetKDMKeys(kdmID uuid.UUID) ([]*KDMKey, error) {
+	rows, err := db.Query(`SELECT id, kdm_id, key_id, COALESCE(key_type, '') FROM kdm_keys WHERE kdm_id = $1 ORDER BY key_type, key_id`, kdmID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*KDMKey
+	for rows.Next() {
+		k := &KDMKey{}
+		if err := rows.Scan(&k.ID, &k.KDMID, &k.KeyID, &k.KeyType); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// GetKDMServers returns the servers a KDM was found on or uploaded for
+func (db *DB) GetKDMServers(kdmID uuid.UUID) ([]*KDMServer, error) {
+	rows, err := db.Query(`
+		SELECT kdm_id, server_id, COALESCE(source_path, ''), created_at, updated_at
+		FROM kdm_servers WHERE kdm_id = $1 ORDER BY created_at`, kdmID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var servers []*KDMServer
+	for rows.Next() {
+		ks := &KDMServer{}
+		if err := rows.Scan(&ks.KDMID, &ks.ServerID, &ks.SourcePath, &ks.CreatedAt, &ks.UpdatedAt); err != nil {
+			return nil, err
+		}
+		servers = append(servers, ks)
+	}
+	return servers, rows.Err()
+}
+
+// DeleteKDM removes a KDM and its keys
+func (db *DB) DeleteKDM(id uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM kdms WHERE id = $1`, id)
+	return err
+}
+
+// GetMissingKDMs returns the encrypted compositions a server holds online for which it has no KDM
+// whose key window is open or still to come. A KDM that does not cover every KeyId of the CPL does
+// not count.
+func (db *DB) GetMissingKDMs(serverID uuid.UUID) ([]*MissingKDM, error) {
+	query := `
+		SELECT c.id, c.cpl_uuid, COALESCE(c.content_title_text, ''), p.id, p.package_name,
+		       (SELECT COUNT(*) FROM dcp_composition_keys ck WHERE ck.composition_id = c.id),
+		       (SELECT MAX(k.not_valid_after) FROM kdms k
+		        JOIN kdm_servers ks ON ks.kdm_id = k.id AND ks.server_id = $1
+		        WHERE k.cpl_uuid = c.cpl_uuid AND k.not_valid_after <= CURRENT_TIMESTAMP)
+		FROM server_dcp_inventory i
+		JOIN dcp_packages p ON p.id = i.package_id
+		JOIN dcp_compositions c ON c.package_id = p.id
+		WHERE i.server_id = $1 AND i.status = 'online'
+		  AND EXISTS (SELECT 1 FROM dcp_composition_keys ck WHERE ck.composition_id = c.id)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM kdms k
+		      JOIN kdm_servers ks ON ks.kdm_id = k.id AND ks.server_id = $1
+		      WHERE k.cpl_uuid = c.cpl_uuid AND k.not_valid_after > CURRENT_TIMESTAMP
+		        AND NOT EXISTS (
+		            SELECT 1 FROM dcp_composition_keys ck
+		            WHERE ck.composition_id = c.id
+		              AND NOT EXISTS (SELECT 1 FROM kdm_keys kk WHERE kk.kdm_id = k.id AND kk.key_id = ck.key_id)))
+		ORDER BY c.content_title_text`
+
+	rows, err := db.Query(query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []*MissingKDM
+	for rows.Next() {
+		m := &MissingKDM{}
+		if err := rows.Scan(&m.CompositionID, &m.CPLUUID, &m.ContentTitleText, &m.PackageID, &m.PackageName,
+			&m.KeyCount, &m.LastExpired); err != nil {
+			return nil, err
+		}
+		missing = append(missing, m)
+	}
+	return missing, rows.Err()
+}
+
+const reclamationPolicyColumns = `id, name, is_active, server_ids, min_fleet_copies, min_age_days,
+	free_space_threshold_percent, target_free_percent, created_at, updated_at`
+
+func scanReclamationPolicy(row interface{ Scan(...interface{}) error }) (*ReclamationPolicy, error) {
+	p := &ReclamationPolicy{}
+	var serverIDs []string
+	err := row.Scan(&p.ID, &p.Name, &p.IsActive, pq.Array(&serverIDs), &p.MinFleetCopies, &p.MinAgeDays,
+		&p.FreeSpaceThresholdPercent, &p.TargetFreePercent, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range serverIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.ServerIDs = append(p.ServerIDs, id)
+	}
+	return p, nil
+}
+
+func uuidArray(ids []uuid.UUID) interface{} {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	return pq.Array(strs)
+}
+
+// ListReclamationPolicies returns every reclamation policy, oldest first
+func (db *DB) ListReclamationPolicies() ([]*ReclamationPolicy, error) {
+	rows, err := db.Query(`SELECT ` + reclamationPolicyColumns + ` FROM reclamation_policies ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*ReclamationPolicy
+	for rows.Next() {
+		p, err := scanReclamationPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// GetReclamationPolicy retrieves a reclamation policy by ID
+func (db *DB) GetReclamationPolicy(id uuid.UUID) (*ReclamationPolicy, error) {
+	p, err := scanReclamationPolicy(db.QueryRow(`SELECT `+reclamationPolicyColumns+` FROM reclamation_policies WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// CreateReclamationPolicy stores a new reclamation policy
+func (db *DB) CreateReclamationPolicy(p *ReclamationPolicy) error {
+	return db.QueryRow(`
+		INSERT INTO reclamation_policies (name, is_active, server_ids, min_fleet_copies, min_age_days,
+			free_space_threshold_percent, target_free_percent)
+		VALUES ($1, $2, $3::uuid[], $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at`,
+		p.Name, p.IsActive, uuidArray(p.ServerIDs), p.MinFleetCopies, p.MinAgeDays,
+		p.FreeSpaceThresholdPercent, p.TargetFreePercent,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+}
+
+// UpdateReclamationPolicy saves the settings of a reclamation policy
+func (db *DB) UpdateReclamationPolicy(p *ReclamationPolicy) error {
+	_, err := db.Exec(`
+		UPDATE reclamation_policies
+		SET name = $2, is_active = $3, server_ids = $4::uuid[], min_fleet_copies = $5, min_age_days = $6,
+		    free_space_threshold_percent = $7, target_free_percent = $8
+		WHERE id = $1`,
+		p.ID, p.Name, p.IsActive, uuidArray(p.ServerIDs), p.MinFleetCopies, p.MinAgeDays,
+		p.FreeSpaceThresholdPercent, p.TargetFreePercent)
+	return err
+}
+
+// DeleteReclamationPolicy removes a reclamation policy; its plans are kept
+func (db *DB) DeleteReclamationPolicy(id uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM reclamation_policies WHERE id = $1`, id)
+	return err
+}
+
+// GetLibraryStorage sums the latest samples of a server's library locations reported within
+// the last day. Reports false when there is none.
+func (db *DB) GetLibraryStorage(serverID uuid.UUID) (total, free int64, ok bool, err error) {
+	var count int
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(total_bytes), 0), COALESCE(SUM(free_bytes), 0), COUNT(*)
+		FROM (
+			SELECT DISTINCT ON (path) total_bytes, free_bytes
+			FROM server_storage_samples
+			WHERE server_id = $1 AND kind = 'library' AND sampled_at > $2
+			ORDER BY path, sampled_at DESC
+		) latest`, serverID, time.Now().Add(-24*time.Hour)).Scan(&total, &free, &count)
+	return total, free, count > 0, err
+}
+
+// GetReclamationCandidates returns the packages a server holds online that arrived there before
+// a given time and have more than minFleetCopies online copies in the fleet, oldest and least
+// uploaded first. Packages the server is uploading right now and OV packages a VF it holds
+// online depends on are left out.
+func (db *DB) GetReclamationCandidates(serverID uuid.UUID, arrivedBefore time.Time, minFleetCopies int) ([]*ReclamationPlanItem, error) {
+	rows, err := db.Query(`
+		SELECT package_id, package_name, size_bytes, fleet_copies, last_arrived_at, uploaded_bytes
+		FROM (
+			SELECT p.id AS package_id, p.package_name, COALESCE(p.total_size_bytes, 0) AS size_bytes,
+			       (SELECT COUNT(*) FROM server_dcp_inventory o
+			        WHERE o.package_id = p.id AND o.status = 'online') AS fleet_copies,
+			       GREATEST(p.discovered_at, i.created_at,
+			                (SELECT MAX(t.completed_at) FROM transfers t
+			                 JOIN dcp_torrents dt ON dt.id = t.torrent_id
+			                 WHERE dt.package_id = p.id AND t.destination_server_id = i.server_id)) AS last_arrived_at,
+			       COALESCE((SELECT SUM(sts.uploaded_bytes) FROM server_torrent_stats sts
+			                 JOIN dcp_torrents dt ON dt.info_hash = sts.info_hash
+			                 WHERE dt.package_id = p.id AND sts.server_id = i.server_id), 0) AS uploaded_bytes
+			FROM server_dcp_inventory i
+			JOIN dcp_packages p ON p.id = i.package_id
+			WHERE i.server_id = $1 AND i.status = 'online'
+			  AND NOT EXISTS (
+			      SELECT 1 FROM server_torrent_stats sts
+			      JOIN dcp_torrents dt ON dt.info_hash = sts.info_hash
+			      WHERE dt.package_id = p.id AND sts.server_id = i.server_id AND sts.upload_speed_bps > 0)
+			  AND NOT EXISTS (
+			      SELECT 1 FROM dcp_package_dependencies d
+			      JOIN server_dcp_inventory vf ON vf.package_id = d.package_id
+			      WHERE d.ov_package_id = p.id AND vf.server_id = i.server_id AND vf.status = 'online')
+		) c
+		WHERE fleet_copies > $3 AND last_arrived_at < $2
+		ORDER BY last_arrived_at, uploaded_bytes`, serverID, arrivedBefore, minFleetCopies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*ReclamationPlanItem
+	for rows.Next() {
+		item := &ReclamationPlanItem{Status: "pending"}
+		if err := rows.Scan(&item.PackageID, &item.PackageName, &item.SizeBytes, &item.FleetCopies,
+			&item.LastArrivedAt, &item.UploadedBytes); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// CountRemainingCopies returns the online copies of a package in the fleet minus those queued for
+// deletion by reclamation plans
+func (db *DB) CountRemainingCopies(packageID uuid.UUID) (int, error) {
+	var copies int
+	err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM server_dcp_inventory WHERE package_id = $1 AND status = 'online')
+		     - (SELECT COUNT(*) FROM reclamation_plan_items WHERE package_id = $1 AND status = 'queued')`,
+		packageID).Scan(&copies)
+	return copies, err
+}
+
+// HasOpenReclamationPlan reports whether a server has a plan waiting for review or executing
+func (db *DB) HasOpenReclamationPlan(serverID uuid.UUID) (bool, error) {
+	var open bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM reclamation_plans WHERE server_id = $1 AND status IN ($2, $3))`,
+		serverID, ReclamationPlanProposed, ReclamationPlanExecuting).Scan(&open)
+	return open, err
+}
+
+// CreateReclamationPlan stores a proposed plan and its items
+func (db *DB) CreateReclamationPlan(plan *ReclamationPlan, items []*ReclamationPlanItem) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO reclamation_plans (policy_id, server_id, status, min_fleet_copies, total_bytes, free_bytes, bytes_to_free)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		plan.PolicyID, plan.ServerID, plan.Status, plan.MinFleetCopies, plan.TotalBytes, plan.FreeBytes, plan.BytesToFree,
+	).Scan(&plan.ID, &plan.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		item.PlanID = plan.ID
+		err := tx.QueryRow(`
+			INSERT INTO reclamation_plan_items (plan_id, package_id, package_name, size_bytes, fleet_copies,
+				last_arrived_at, uploaded_bytes, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id`,
+			item.PlanID, item.PackageID, item.PackageName, item.SizeBytes, item.FleetCopies,
+			item.LastArrivedAt, item.UploadedBytes, item.Status,
+		).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const reclamationPlanColumns = `id, policy_id, server_id, status, min_fleet_copies, total_bytes, free_bytes, bytes_to_free,
+	COALESCE(reviewed_by, ''), reviewed_at, completed_at, created_at`
+
+func scanReclamationPlan(row interface{ Scan(...interface{}) error }) (*ReclamationPlan, error) {
+	p := &ReclamationPlan{}
+	err := row.Scan(&p.ID, &p.PolicyID, &p.ServerID, &p.Status, &p.MinFleetCopies, &p.TotalBytes, &p.FreeBytes,
+		&p.BytesToFree, &p.ReviewedBy, &p.ReviewedAt, &p.CompletedAt, &p.CreatedAt)
+	return p, err
+}
+
+// ListReclamationPlans returns reclamation plans, newest first, optionally restricted to a status
+// and/or a server
+func (db *DB) ListReclamationPlans(status string, serverID *uuid.UUID) ([]*ReclamationPlan, error) {
+	rows, err := db.Query(`SELECT `+reclamationPlanColumns+` FROM reclamation_plans
+		WHERE ($1 = '' OR status = $1) AND ($2::uuid IS NULL OR server_id = $2)
+		ORDER BY created_at DESC`, status, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []*ReclamationPlan
+	for rows.Next() {
+		p, err := scanReclamationPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+// GetReclamationPlan retrieves a reclamation plan by ID
+func (db *DB) GetReclamationPlan(id uuid.UUID) (*ReclamationPlan, error) {
+	p, err := scanReclamationPlan(db.QueryRow(`SELECT `+reclamationPlanColumns+` FROM reclamation_plans WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// GetReclamationPlanItems returns the packages of a reclamation plan in the order they are deleted
+func (db *DB) GetReclamationPlanItems(planID uuid.UUID) ([]*ReclamationPlanItem, error) {
+	rows, err := db.Query(`
+		SELECT id, plan_id, package_id, package_name, size_bytes, fleet_copies, last_arrived_at,
+		       uploaded_bytes, content_command_id, status, result_message
+		FROM reclamation_plan_items
+		WHERE plan_id = $1
+		ORDER BY last_arrived_at, uploaded_bytes`, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*ReclamationPlanItem
+	for rows.Next() {
+		item := &ReclamationPlanItem{}
+		if err := rows.Scan(&item.ID, &item.PlanID, &item.PackageID, &item.PackageName, &item.SizeBytes,
+			&item.FleetCopies, &item.LastArrivedAt, &item.UploadedBytes, &item.ContentCommandID,
+			&item.Status, &item.ResultMessage); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ReviewReclamationPlan moves a proposed plan to a new status on behalf of a reviewer. Reports
+// false when the plan is no longer proposed.
+func (db *DB) ReviewReclamationPlan(id uuid.UUID, status, reviewedBy string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE reclamation_plans SET status = $2, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $4`, id, status, reviewedBy, ReclamationPlanProposed)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateReclamationPlanItem records the progress of one deletion of a plan
+func (db *DB) UpdateReclamationPlanItem(id uuid.UUID, status string, contentCommandID *uuid.UUID, message string) error {
+	_, err := db.Exec(`
+		UPDATE reclamation_plan_items
+		SET status = $2, content_command_id = COALESCE($3, content_command_id), result_message = $4
+		WHERE id = $1`, id, status, contentCommandID, message)
+	return err
+}
+
+// FinishReclamationPlan completes an executing plan once none of its deletions is pending or
+// queued; it failed if any of them did
+func (db *DB) FinishReclamationPlan(id uuid.UUID) error {
+	_, err := db.Exec(`
+		UPDATE reclamation_plans p
+		SET status = CASE WHEN EXISTS (SELECT 1 FROM reclamation_plan_items WHERE plan_id = p.id AND status = 'error')
+		                  THEN $2 ELSE $3 END,
+		    completed_at = CURRENT_TIMESTAMP
+		WHERE p.id = $1 AND p.status = $4
+		  AND NOT EXISTS (SELECT 1 FROM reclamation_plan_items WHERE plan_id = p.id AND status IN ('pending', 'queued'))`,
+		id, ReclamationPlanFailed, ReclamationPlanCompleted, ReclamationPlanExecuting)
+	return err
+}
+
+// CompleteReclamationCommand records the outcome of the content command a plan item was executed
+// with, and finishes its plan when it was the last one. Does nothing for other content commands.
+func (db *DB) CompleteReclamationCommand(contentCommandID uuid.UUID, status, message string) error {
+	var itemID, planID uuid.UUID
+	err := db.QueryRow(`SELECT id, plan_id FROM reclamation_plan_items WHERE content_command_id = $1`,
+		contentCommandID).Scan(&itemID, &planID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateReclamationPlanItem(itemID, status, nil, message); err != nil {
+		return err
+	}
+	return db.FinishReclamationPlan(planID)
+}
+
+// CreateCampaign stores a new campaign with its packages and targets
+func (db *DB) CreateCampaign(c *Campaign, packages []*CampaignPackage, targets []*CampaignTarget) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO distribution_campaigns (name, status, wave_size, advance_percent, priority, deliver_by, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		c.Name, c.Status, c.WaveSize, c.AdvancePercent, c.Priority, c.DeliverBy, c.CreatedBy,
+	).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range packages {
+		if _, err := tx.Exec(`INSERT INTO campaign_packages (campaign_id, package_id, torrent_id) VALUES ($1, $2, $3)`,
+			c.ID, p.PackageID, p.TorrentID); err != nil {
+			return err
+		}
+	}
+	for _, t := range targets {
+		err := tx.QueryRow(`
+			INSERT INTO campaign_targets (campaign_id, server_id, wave, position, released_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			c.ID, t.ServerID, t.Wave, t.Position, t.ReleasedAt,
+		).Scan(&t.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const campaignColumns = `id, name, status, wave_size, advance_percent, priority, deliver_by, created_by, created_at, completed_at`
+
+func scanCampaign(row interface{ Scan(...interface{}) error }) (*Campaign, error) {
+	c := &Campaign{}
+	err := row.Scan(&c.ID, &c.Name, &c.Status, &c.WaveSize, &c.AdvancePercent, &c.Priority, &c.DeliverBy,
+		&c.CreatedBy, &c.CreatedAt, &c.CompletedAt)
+	return c, err
+}
+
+// ListCampaigns returns campaigns, newest first, optionally restricted to a status
+func (db *DB) ListCampaigns(status string) ([]*Campaign, error) {
+	rows, err := db.Query(`SELECT `+campaignColumns+` FROM distribution_campaigns
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at DESC`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+// GetCampaign retrieves a campaign by ID
+func (db *DB) GetCampaign(id uuid.UUID) (*Campaign, error) {
+	c, err := scanCampaign(db.QueryRow(`SELECT `+campaignColumns+` FROM distribution_campaigns WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// GetCampaignPackages returns the packages a campaign sends
+func (db *DB) GetCampaignPackages(campaignID uuid.UUID) ([]*CampaignPackage, error) {
+	rows, err := db.Query(`
+		SELECT cp.package_id, cp.torrent_id, p.package_name, COALESCE(dt.total_size_bytes, p.total_size_bytes, 0)
+		FROM campaign_packages cp
+		JOIN dcp_packages p ON p.id = cp.package_id
+		JOIN dcp_torrents dt ON dt.id = cp.torrent_id
+		WHERE cp.campaign_id = $1
+		ORDER BY p.package_name`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var packages []*CampaignPackage
+	for rows.Next() {
+		p := &CampaignPackage{}
+		if err := rows.Scan(&p.PackageID, &p.TorrentID, &p.PackageName, &p.SizeBytes); err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
+
+// GetCampaignTargets returns the servers of a campaign in the order they are released
+func (db *DB) GetCampaignTargets(campaignID uuid.UUID) ([]*CampaignTarget, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.server_id, COALESCE(NULLIF(sv.display_name, ''), sv.name), t.wave, t.position, t.released_at
+		FROM campaign_targets t
+		JOIN servers sv ON sv.id = t.server_id
+		WHERE t.campaign_id = $1
+		ORDER BY t.wave, t.position`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []*CampaignTarget
+	for rows.Next() {
+		t := &CampaignTarget{}
+		if err := rows.Scan(&t.ID, &t.ServerID, &t.ServerName, &t.Wave, &t.Position, &t.ReleasedAt); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// GetCampaignTransfers returns the transfers of a campaign
+func (db *DB) GetCampaignTransfers(campaignID uuid.UUID) ([]*CampaignTransfer, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.destination_server_id, dt.package_id, COALESCE(t.status, ''),
+		       COALESCE(t.progress_percent, 0), COALESCE(t.downloaded_bytes, 0),
+		       COALESCE(dt.total_size_bytes, p.total_size_bytes, 0), COALESCE(t.download_speed_bps, 0),
+		       COALESCE(t.error_message, ''), t.completed_at
+		FROM transfers t
+		JOIN dcp_torrents dt ON dt.id = t.torrent_id
+		JOIN dcp_packages p ON p.id = dt.package_id
+		WHERE t.campaign_id = $1
+		ORDER BY t.created_at`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*CampaignTransfer
+	for rows.Next() {
+		t := &CampaignTransfer{}
+		if err := rows.Scan(&t.ID, &t.ServerID, &t.PackageID, &t.Status, &t.ProgressPercent, &t.DownloadedBytes,
+			&t.SizeBytes, &t.DownloadSpeedBps, &t.ErrorMessage, &t.CompletedAt); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+// ReleaseCampaignTarget records that the transfers of a campaign target were created
+func (db *DB) ReleaseCampaignTarget(id uuid.UUID) error {
+	_, err := db.Exec(`UPDATE campaign_targets SET released_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	return err
+}
+
+// FinishCampaign moves an active campaign to a final status. Reports false when the campaign is
+// no longer active.
+func (db *DB) FinishCampaign(id uuid.UUID, status string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE distribution_campaigns SET status = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3`, id, status, CampaignActive)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+const serverGroupColumns = `g.id, g.name, g.kind, g.description,
+	ARRAY(SELECT m.server_id::text FROM server_group_members m WHERE m.group_id = g.id ORDER BY m.added_at, m.server_id),
+	g.created_at, g.updated_at`
+
+func scanServerGroup(row interface{ Scan(...interface{}) error }) (*ServerGroup, error) {
+	g := &ServerGroup{}
+	var serverIDs []string
+	err := row.Scan(&g.ID, &g.Name, &g.Kind, &g.Description, pq.Array(&serverIDs), &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range serverIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		g.ServerIDs = append(g.ServerIDs, id)
+	}
+	return g, nil
+}
+
+// ListServerGroups returns every server group with its members, by kind and name
+func (db *DB) ListServerGroups() ([]*ServerGroup, error) {
+	rows, err := db.Query(`SELECT ` + serverGroupColumns + ` FROM server_groups g ORDER BY g.kind, g.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*ServerGroup
+	for rows.Next() {
+		g, err := scanServerGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// GetServerGroup retrieves a server group and its members by ID
+func (db *DB) GetServerGroup(id uuid.UUID) (*ServerGroup, error) {
+	g, err := scanServerGroup(db.QueryRow(`SELECT `+serverGroupColumns+` FROM server_groups g WHERE g.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// CreateServerGroup stores a new server group with its members
+func (db *DB) CreateServerGroup(g *ServerGroup) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO server_groups (name, kind, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at`,
+		g.Name, g.Kind, g.Description,
+	).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := addServerGroupMembers(tx, g.ID, g.ServerIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateServerGroup saves the name, kind and description of a server group
+func (db *DB) UpdateServerGroup(g *ServerGroup) error {
+	_, err := db.Exec(`
+		UPDATE server_groups SET name = $2, kind = $3, description = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		g.ID, g.Name, g.Kind, g.Description)
+	return err
+}
+
+// SetServerGroupMembers replaces the members of a server group
+func (db *DB) SetServerGroupMembers(groupID uuid.UUID, serverIDs []uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM server_group_members WHERE group_id = $1 AND NOT (server_id = ANY($2::uuid[]))`,
+		groupID, uuidArray(serverIDs)); err != nil {
+		return err
+	}
+	if err := addServerGroupMembers(tx, groupID, serverIDs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE server_groups SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, groupID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddServerGroupMembers adds servers to a server group; members already in it are kept
+func (db *DB) AddServerGroupMembers(groupID uuid.UUID, serverIDs []uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addServerGroupMembers(tx, groupID, serverIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addServerGroupMembers(tx *sql.Tx, groupID uuid.UUID, serverIDs []uuid.UUID) error {
+	for _, serverID := range serverIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO server_group_members (group_id, server_id) VALUES ($1, $2)
+			ON CONFLICT (group_id, server_id) DO NOTHING`, groupID, serverID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveServerGroupMember takes a server out of a server group. Reports false when it was not
+// a member.
+func (db *DB) RemoveServerGroupMember(groupID, serverID uuid.UUID) (bool, error) {
+	result, err := db.Exec(`DELETE FROM server_group_members WHERE group_id = $1 AND server_id = $2`, groupID, serverID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteServerGroup removes a server group; its servers are not affected
+func (db *DB) DeleteServerGroup(id uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM server_groups WHERE id = $1`, id)
+	return err
+}
+
+// GetServerTags returns the tags of every server that has any, sorted
+func (db *DB) GetServerTags() (map[uuid.UUID][]string, error) {
+	rows, err := db.Query(`SELECT server_id, tag FROM server_tags ORDER BY server_id, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[uuid.UUID][]string)
+	for rows.Next() {
+		var serverID uuid.UUID
+		var tag string
+		if err := rows.Scan(&serverID, &tag); err != nil {
+			return nil, err
+		}
+		tags[serverID] = append(tags[serverID], tag)
+	}
+	return tags, rows.Err()
+}
+
+// SetServerTags replaces the tags of a server
+func (db *DB) SetServerTags(serverID uuid.UUID, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM server_tags WHERE server_id = $1`, serverID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO server_tags (server_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			serverID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListServerTags returns every tag in use with the number of servers carrying it
+func (db *DB) ListServerTags() ([]*ServerTagCount, error) {
+	rows, err := db.Query(`SELECT tag, COUNT(*) FROM server_tags GROUP BY tag ORDER BY tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*ServerTagCount
+	for rows.Next() {
+		t := &ServerTagCount{}
+		if err := rows.Scan(&t.Tag, &t.Servers); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
 }
 
 // AuthenticateUser verifies username/password using salted SHA-256.
@@ -3,12 +3,13 @@ package parser
 import (
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
 )
 
 // ParseAssetMap reads and parses an ASSETMAP.xml file
 func ParseAssetMap(path string) (*AssetMap, error) {
-	data, err := ioutil.ReadFile(path)
+	data, err := archive.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read ASSETMAP file: %w", err)
 	}
@@ -17,6 +18,7 @@ func ParseAssetMap(path string) (*AssetMap, error) {
 	if err := xml.Unmarshal(data, &assetMap); err != nil {
 		return nil, fmt.Errorf("failed to parse ASSETMAP XML: %w", err)
 	}
+	assetMap.Standard = DetectStandard(assetMap.XMLName.Space)
 
 	return &assetMap, nil
 }
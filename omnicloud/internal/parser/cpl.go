@@ -3,12 +3,17 @@ package parser
 import (
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
+	"strings"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
 )
 
+// AtmosDataType is the AuxData DataType UL identifying Dolby Atmos (immersive audio) track files
+const AtmosDataType = "urn:smpte:ul:060e2b34.04010105.0e090604.00000000"
+
 // ParseCPL reads and parses a CPL (Composition Playlist) XML file
 func ParseCPL(path string) (*CompositionPlaylist, error) {
-	data, err := ioutil.ReadFile(path)
+	data, err := archive.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read CPL file: %w", err)
 	}
@@ -17,6 +22,8 @@ func ParseCPL(path string) (*CompositionPlaylist, error) {
 	if err := xml.Unmarshal(data, &cpl); err != nil {
 		return nil, fmt.Errorf("failed to parse CPL XML: %w", err)
 	}
+	cpl.Standard = DetectStandard(cpl.XMLName.Space)
+	cpl.Signature = CheckSignature(data)
 
 	return &cpl, nil
 }
@@ -30,8 +37,8 @@ func (cpl *CompositionPlaylist) GetReelCount() int {
 func (cpl *CompositionPlaylist) GetTotalDuration() int {
 	total := 0
 	for _, reel := range cpl.ReelList.Reels {
-		if reel.AssetList.MainPicture != nil {
-			total += int(reel.AssetList.MainPicture.Duration)
+		if pic := reel.AssetList.Picture(); pic != nil {
+			total += int(pic.Duration)
 		}
 	}
 	return total
@@ -57,3 +64,184 @@ func (cpl *CompositionPlaylist) GetMetadata() *Metadata {
 	}
 	return nil
 }
+
+// Picture returns the reel's picture asset, whether it is 2D (MainPicture) or 3D (MainStereoscopicPicture)
+func (al *AssetList) Picture() *MainPicture {
+	if al.MainPicture != nil {
+		return al.MainPicture
+	}
+	return al.MainStereoscopicPicture
+}
+
+// IsStereoscopic reports whether any reel carries a MainStereoscopicPicture
+func (cpl *CompositionPlaylist) IsStereoscopic() bool {
+	for _, reel := range cpl.ReelList.Reels {
+		if reel.AssetList.MainStereoscopicPicture != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAtmos reports whether any reel carries a Dolby Atmos AuxData track
+func (cpl *CompositionPlaylist) HasAtmos() bool {
+	for _, reel := range cpl.ReelList.Reels {
+		for _, aux := range reel.AssetList.AuxData {
+			if aux.IsAtmos() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasClosedCaptions reports whether any reel carries a MainClosedCaption track
+func (cpl *CompositionPlaylist) HasClosedCaptions() bool {
+	for _, reel := range cpl.ReelList.Reels {
+		if reel.AssetList.MainClosedCaption != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetContentVersions returns the primary ContentVersion followed by any ContentVersionList
+// entries, skipping empty and duplicate IDs
+func (cpl *CompositionPlaylist) GetContentVersions() []ContentVersion {
+	var versions []ContentVersion
+	seen := make(map[string]bool)
+	all := append([]ContentVersion{cpl.ContentVersion}, cpl.ContentVersionList.ContentVersions...)
+	for _, cv := range all {
+		if cv.ID == "" || seen[cv.ID] {
+			continue
+		}
+		seen[cv.ID] = true
+		versions = append(versions, cv)
+	}
+	return versions
+}
+
+// CompositionMarker is a marker resolved to its position in the whole composition
+type CompositionMarker struct {
+	Label         string
+	ReelNumber    int // 1-based
+	Offset        int // frames from the start of the reel
+	AbsoluteFrame int // frames from the start of the composition
+}
+
+// GetMarkers returns all MainMarkers entries with their composition-absolute frame positions.
+// Reel start positions are derived from the cumulative picture durations of preceding reels.
+func (cpl *CompositionPlaylist) GetMarkers() []CompositionMarker {
+	var markers []CompositionMarker
+	reelStart := 0
+	for i, reel := range cpl.ReelList.Reels {
+		if reel.AssetList.MainMarkers != nil {
+			for _, m := range reel.AssetList.MainMarkers.MarkerList.Markers {
+				markers = append(markers, CompositionMarker{
+					Label:         m.Label,
+					ReelNumber:    i + 1,
+					Offset:        int(m.Offset),
+					AbsoluteFrame: reelStart + int(m.Offset),
+				})
+			}
+		}
+		if pic := reel.AssetList.Picture(); pic != nil {
+			reelStart += int(pic.Duration)
+		}
+	}
+	return markers
+}
+
+// FindMarker returns the first marker with the given label (e.g. "FFEC"), or nil
+func (cpl *CompositionPlaylist) FindMarker(label string) *CompositionMarker {
+	for _, m := range cpl.GetMarkers() {
+		if m.Label == label {
+			return &m
+		}
+	}
+	return nil
+}
+
+// IsAtmos reports whether this AuxData track is Dolby Atmos
+func (aux *AuxData) IsAtmos() bool {
+	return aux.DataType == AtmosDataType
+}
+
+// ReferencedAsset is a track file referenced from a CPL reel
+type ReferencedAsset struct {
+	ID         string // bare UUID (urn:uuid: prefix removed)
+	Kind       string // picture, sound, subtitle, closed_caption or aux_data
+	ReelNumber int
+}
+
+// GetReferencedAssets returns every track file the CPL references, in reel order.
+// MainMarkers lives inside the CPL itself and is not included.
+func (cpl *CompositionPlaylist) GetReferencedAssets() []ReferencedAsset {
+	var assets []ReferencedAsset
+	add := func(id, kind string, reel int) {
+		if id = ExtractUUID(id); id != "" {
+			assets = append(assets, ReferencedAsset{ID: id, Kind: kind, ReelNumber: reel})
+		}
+	}
+	for i, reel := range cpl.ReelList.Reels {
+		al := reel.AssetList
+		if pic := al.Picture(); pic != nil {
+			add(pic.ID, "picture", i+1)
+		}
+		if al.MainSound != nil {
+			add(al.MainSound.ID, "sound", i+1)
+		}
+		if al.MainSubtitle != nil {
+			add(al.MainSubtitle.ID, "subtitle", i+1)
+		}
+		if al.MainClosedCaption != nil {
+			add(al.MainClosedCaption.ID, "closed_caption", i+1)
+		}
+		for _, aux := range al.AuxData {
+			add(aux.ID, "aux_data", i+1)
+		}
+	}
+	return assets
+}
+
+// ContentKey is the KeyId of an encrypted track file referenced from a CPL reel
+type ContentKey struct {
+	KeyID      string // bare UUID (urn:uuid: prefix removed)
+	Kind       string // picture, sound, subtitle, closed_caption or aux_data
+	ReelNumber int
+}
+
+// GetContentKeys returns the KeyId of every encrypted track file, in reel order.
+// Returns nil for an unencrypted composition.
+func (cpl *CompositionPlaylist) GetContentKeys() []ContentKey {
+	var keys []ContentKey
+	add := func(keyID, kind string, reel int) {
+		if keyID = ExtractUUID(strings.TrimSpace(keyID)); keyID != "" {
+			keys = append(keys, ContentKey{KeyID: keyID, Kind: kind, ReelNumber: reel})
+		}
+	}
+	for i, reel := range cpl.ReelList.Reels {
+		al := reel.AssetList
+		if pic := al.Picture(); pic != nil {
+			add(pic.KeyID, "picture", i+1)
+		}
+		if al.MainSound != nil {
+			add(al.MainSound.KeyID, "sound", i+1)
+		}
+		if al.MainSubtitle != nil {
+			add(al.MainSubtitle.KeyID, "subtitle", i+1)
+		}
+		if al.MainClosedCaption != nil {
+			add(al.MainClosedCaption.KeyID, "closed_caption", i+1)
+		}
+		for _, aux := range al.AuxData {
+			add(aux.KeyID, "aux_data", i+1)
+		}
+	}
+	return keys
+}
+
+// IsEncrypted reports whether any track file of the composition carries a KeyId
+func (cpl *CompositionPlaylist) IsEncrypted() bool {
+	return len(cpl.GetContentKeys()) > 0
+}
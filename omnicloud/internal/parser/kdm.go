@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// KDM namespaces. The KDMRequiredExtensions namespace identifies a SMPTE KDM; Interop KDMs
+// (MXF Interop) carry the same ETM layout under the digicine.com namespaces.
+const (
+	NamespaceSMPTEKDM   = "http://www.smpte-ra.org/schemas/430-1/2006/KDM"
+	NamespaceInteropKDM = "http://www.digicine.com/PROTO-ASDCP-KDM-20040311#"
+)
+
+// ParseKDM reads and parses a KDM (Key Delivery Message) XML file
+func ParseKDM(path string) (*KDM, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KDM file: %w", err)
+	}
+	return ParseKDMData(data)
+}
+
+// ParseKDMData parses KDM XML held in memory. A document that is not a DCinemaSecurityMessage
+// or has no CompositionPlaylistId is rejected.
+func ParseKDMData(data []byte) (*KDM, error) {
+	var kdm KDM
+	if err := xml.Unmarshal(data, &kdm); err != nil {
+		return nil, fmt.Errorf("failed to parse KDM XML: %w", err)
+	}
+	ext := kdm.Extensions()
+	if ext.CompositionPlaylistID == "" {
+		return nil, fmt.Errorf("KDM has no CompositionPlaylistId")
+	}
+	kdm.Standard = DetectStandard(ext.XMLName.Space)
+	if kdm.Standard == StandardUnknown {
+		kdm.Standard = DetectStandard(kdm.XMLName.Space)
+	}
+
+	return &kdm, nil
+}
+
+// IsKDMFile reports whether the file at path looks like a KDM, by checking the start of the
+// document for a DCinemaSecurityMessage root element. Used to pick KDMs out of library folders
+// without parsing every XML file.
+func IsKDMFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, 2048)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return bytes.Contains(head[:n], []byte("DCinemaSecurityMessage"))
+}
+
+// Extensions returns the KDMRequiredExtensions block, which carries everything except the keys
+func (kdm *KDM) Extensions() *KDMRequiredExtensions {
+	return &kdm.AuthenticatedPublic.RequiredExtensions.KDMRequiredExtensions
+}
+
+// MessageID returns the bare UUID of the KDM's MessageId
+func (kdm *KDM) MessageID() string {
+	return ExtractUUID(strings.TrimSpace(kdm.AuthenticatedPublic.MessageID))
+}
+
+// CPLID returns the bare UUID of the composition the KDM unlocks
+func (kdm *KDM) CPLID() string {
+	return ExtractUUID(strings.TrimSpace(kdm.Extensions().CompositionPlaylistID))
+}
+
+// RecipientThumbprint returns the dnQualifier of the recipient certificate's subject name,
+// which by SMPTE 430-2 is the base64 SHA-1 thumbprint of the certificate's public key.
+// Returns "" when the subject has no dnQualifier.
+func (kdm *KDM) RecipientThumbprint() string {
+	subject := kdm.Extensions().Recipient.X509SubjectName
+	for _, rdn := range splitDN(subject) {
+		eq := strings.Index(rdn, "=")
+		if eq < 0 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(rdn[:eq]), "dnQualifier") {
+			return strings.ReplaceAll(strings.TrimSpace(rdn[eq+1:]), `\`, "")
+		}
+	}
+	return ""
+}
+
+// splitDN splits an RFC 2253 distinguished name on unescaped commas. Thumbprints are base64 and
+// may contain '+' and '/', which some issuers escape with a backslash.
+func splitDN(dn string) []string {
+	var parts []string
+	var cur strings.Builder
+	escaped := false
+	for _, r := range dn {
+		switch {
+		case escaped:
+			cur.WriteRune('\\')
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// ValidityWindow returns the ContentKeysNotValidBefore / ContentKeysNotValidAfter window
+func (kdm *KDM) ValidityWindow() (notBefore, notAfter time.Time, err error) {
+	ext := kdm.Extensions()
+	notBefore, err = time.Parse(time.RFC3339, strings.TrimSpace(ext.ContentKeysNotValidBefore))
+	if err != nil {
+		return notBefore, notAfter, fmt.Errorf("invalid ContentKeysNotValidBefore: %w", err)
+	}
+	notAfter, err = time.Parse(time.RFC3339, strings.TrimSpace(ext.ContentKeysNotValidAfter))
+	if err != nil {
+		return notBefore, notAfter, fmt.Errorf("invalid ContentKeysNotValidAfter: %w", err)
+	}
+	return notBefore, notAfter, nil
+}
+
+// KeyIDs returns the KeyIdList entries with bare UUIDs and trimmed key types
+func (kdm *KDM) KeyIDs() []TypedKeyID {
+	var keys []TypedKeyID
+	for _, k := range kdm.Extensions().KeyIDList.TypedKeyIDs {
+		id := ExtractUUID(strings.TrimSpace(k.KeyID))
+		if id == "" {
+			continue
+		}
+		keys = append(keys, TypedKeyID{KeyType: strings.TrimSpace(k.KeyType), KeyID: id})
+	}
+	return keys
+}
@@ -0,0 +1,519 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
+)
+
+// Essence kinds of an MXF track file, derived from its descriptor (or essence container)
+const (
+	MXFEssencePicture   = "picture"
+	MXFEssenceSound     = "sound"
+	MXFEssenceTimedText = "timed_text"
+	MXFEssenceData      = "data"
+)
+
+const (
+	mxfMaxRunIn       = 65536   // SMPTE 377 allows up to 64 KiB before the header partition pack
+	mxfMaxHeaderBytes = 8 << 20 // header metadata read at most; DCP track files carry a few KiB
+)
+
+// MXFHeader holds the facts read from the header partition of an MXF track file. Only the
+// header metadata is read; the essence is never touched.
+type MXFHeader struct {
+	PackageUUID       string // material number of the file package UMID: the asset UUID in DCPs
+	EssenceContainer  string // essence container UL; for encrypted files the plaintext container
+	EssenceKind       string // MXFEssence*, "" when not recognised
+	Encrypted         bool
+	EditRate          string // descriptor sample rate, "24 1" like a CPL EditRate
+	ContainerDuration int64
+
+	// Picture descriptor
+	StoredWidth     int
+	StoredHeight    int
+	FrameLayout     string // full_frame, separate_fields, single_field, mixed_fields or segmented_frame
+	JPEG2000Profile string // "2K" or "4K" for DCI JPEG 2000, otherwise the Rsiz value
+	Stereoscopic    bool
+
+	// Sound descriptor
+	ChannelCount    int
+	AudioSampleRate int // Hz
+	BitDepth        int
+}
+
+// mxfUL is a SMPTE universal label
+type mxfUL [16]byte
+
+// String formats the label the way SMPTE registers print it (06.0e.2b.34....)
+func (ul mxfUL) String() string {
+	parts := make([]string, len(ul))
+	for i, b := range ul {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ".")
+}
+
+// matches compares two labels, ignoring the registry version byte
+func (ul mxfUL) matches(other mxfUL) bool {
+	for i := range ul {
+		if i != 7 && ul[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	mxfPartitionPrefix = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01}
+	mxfPrimerPack      = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x05, 0x01, 0x00}
+	mxfCryptoContext   = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x04, 0x01, 0x02, 0x02, 0x00, 0x00}
+
+	mxfEncryptedContainer = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x07, 0x0d, 0x01, 0x03, 0x01, 0x02, 0x0b, 0x01, 0x00}
+	mxfJPEG2000Container  = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x07, 0x0d, 0x01, 0x03, 0x01, 0x02, 0x0c, 0x01, 0x00}
+	mxfTimedTextContainer = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x0a, 0x0d, 0x01, 0x03, 0x01, 0x02, 0x13, 0x01, 0x01}
+
+	// Dynamic (primer-mapped) properties
+	mxfRsiz                   = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x01, 0x01, 0x0a, 0x04, 0x01, 0x06, 0x03, 0x01, 0x00, 0x00, 0x00}
+	mxfSourceEssenceContainer = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x01, 0x01, 0x09, 0x06, 0x01, 0x01, 0x02, 0x02, 0x00, 0x00, 0x00}
+)
+
+// Structural metadata sets, identified by byte 14 of 06.0e.2b.34.02.53.01.01.0d.01.01.01.01.01.xx.00
+const (
+	mxfSetSourcePackage       = 0x37
+	mxfSetPictureDescriptor   = 0x27
+	mxfSetCDCIDescriptor      = 0x28
+	mxfSetRGBADescriptor      = 0x29
+	mxfSetSoundDescriptor     = 0x42
+	mxfSetDataDescriptor      = 0x43
+	mxfSetAES3Descriptor      = 0x47
+	mxfSetWaveDescriptor      = 0x48
+	mxfSetJPEG2000SubDesc     = 0x5a
+	mxfSetStereoscopicSubDesc = 0x63
+	mxfSetTimedTextDescriptor = 0x64
+)
+
+// Local tags of the properties read
+const (
+	tagPackageUID        = 0x4401
+	tagDescriptor        = 0x4701
+	tagSampleRate        = 0x3001
+	tagContainerDuration = 0x3002
+	tagEssenceContainer  = 0x3004
+	tagStoredHeight      = 0x3202
+	tagStoredWidth       = 0x3203
+	tagFrameLayout       = 0x320c
+	tagPictureCoding     = 0x3201
+	tagQuantizationBits  = 0x3d01
+	tagAudioSamplingRate = 0x3d03
+	tagChannelCount      = 0x3d07
+)
+
+var mxfFrameLayouts = []string{"full_frame", "separate_fields", "single_field", "mixed_fields", "segmented_frame"}
+
+// mxfSet is a local set of the header metadata: its key and its properties by local tag
+type mxfSet struct {
+	key   mxfUL
+	props map[uint16][]byte
+}
+
+// kind returns byte 14 of a structural metadata set key, 0 for other sets
+func (s *mxfSet) kind() byte {
+	prefix := mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x01, 0x01, 0x01, 0x01}
+	for i := 0; i < 14; i++ {
+		if i != 7 && s.key[i] != prefix[i] {
+			return 0
+		}
+	}
+	return s.key[14]
+}
+
+// ReadMXFHeader reads the header partition of an MXF file and extracts the package UUID,
+// essence container, encryption flag and the picture or sound descriptor
+func ReadMXFHeader(path string) (*MXFHeader, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MXF file: %w", err)
+	}
+	defer f.Close()
+	return readMXFHeader(f)
+}
+
+func readMXFHeader(r io.ReaderAt) (*MXFHeader, error) {
+	hp, err := readHeaderPartition(r)
+	if err != nil {
+		return nil, err
+	}
+	return interpretMXFHeader(hp.containers, hp.primer, hp.sets), nil
+}
+
+// mxfHeaderPartition is the parsed header partition of an MXF file
+type mxfHeaderPartition struct {
+	containers []mxfUL          // essence containers listed by the partition pack
+	primer     map[uint16]mxfUL // local tag to property UL
+	sets       []*mxfSet        // header metadata sets
+	end        int64            // offset of the first KLV after the header metadata
+}
+
+func readHeaderPartition(r io.ReaderAt) (*mxfHeaderPartition, error) {
+	// Locate the header partition pack after the optional run-in
+	head := make([]byte, mxfMaxRunIn+len(mxfPartitionPrefix))
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read MXF header: %w", err)
+	}
+	start := bytes.Index(head[:n], mxfPartitionPrefix)
+	if start < 0 || n-start < 16 || head[start+13] != 0x02 {
+		return nil, errors.New("no MXF header partition found")
+	}
+
+	_, length, offset, err := readKLVHeader(r, int64(start))
+	if err != nil {
+		return nil, fmt.Errorf("invalid header partition pack: %w", err)
+	}
+	if length < 88 || length > 1<<16 {
+		return nil, fmt.Errorf("invalid header partition pack length %d", length)
+	}
+	partition := make([]byte, length)
+	if _, err := r.ReadAt(partition, offset); err != nil {
+		return nil, fmt.Errorf("failed to read header partition pack: %w", err)
+	}
+
+	hp := &mxfHeaderPartition{end: offset + length}
+	count := binary.BigEndian.Uint32(partition[80:84])
+	itemLen := binary.BigEndian.Uint32(partition[84:88])
+	if itemLen == 16 {
+		for i := 0; i < int(count) && 88+(i+1)*16 <= len(partition); i++ {
+			var ul mxfUL
+			copy(ul[:], partition[88+i*16:])
+			hp.containers = append(hp.containers, ul)
+		}
+	}
+
+	// Header metadata follows the partition pack; HeaderByteCount includes the trailing fill
+	headerBytes := int64(binary.BigEndian.Uint64(partition[32:40]))
+	if headerBytes > 0 && headerBytes <= mxfMaxHeaderBytes {
+		hp.end += headerBytes
+	} else {
+		headerBytes = mxfMaxHeaderBytes
+	}
+	metadata := make([]byte, headerBytes)
+	n, err = r.ReadAt(metadata, offset+length)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header metadata: %w", err)
+	}
+	hp.primer, hp.sets = parseHeaderMetadata(metadata[:n])
+	if len(hp.sets) == 0 {
+		return nil, errors.New("MXF header metadata holds no structural metadata")
+	}
+	return hp, nil
+}
+
+// readKLVHeader reads the key and BER length of the KLV triplet at offset. Returns the
+// key, the length and the offset of the value.
+func readKLVHeader(r io.ReaderAt, offset int64) (mxfUL, int64, int64, error) {
+	var key mxfUL
+	buf := make([]byte, 25)
+	n, err := r.ReadAt(buf, offset)
+	if n < 17 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return key, 0, 0, err
+	}
+	copy(key[:], buf)
+	length, size, ok := decodeBERLength(buf[16:n])
+	if !ok {
+		return key, 0, 0, errors.New("invalid BER length")
+	}
+	return key, length, offset + 16 + int64(size), nil
+}
+
+// decodeBERLength decodes a BER length. Returns the length and the bytes it occupies.
+func decodeBERLength(b []byte) (int64, int, bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	if b[0] < 0x80 {
+		return int64(b[0]), 1, true
+	}
+	size := int(b[0] & 0x7f)
+	if size == 0 || size > 8 || len(b) < 1+size {
+		return 0, 0, false
+	}
+	var length uint64
+	for _, c := range b[1 : 1+size] {
+		length = length<<8 | uint64(c)
+	}
+	if length > 1<<62 {
+		return 0, 0, false
+	}
+	return int64(length), 1 + size, true
+}
+
+// parseHeaderMetadata walks the KLV triplets of the header metadata, returning the primer
+// (local tag to property UL) and the local sets. Stops at the first truncated triplet.
+func parseHeaderMetadata(data []byte) (map[uint16]mxfUL, []*mxfSet) {
+	primer := make(map[uint16]mxfUL)
+	var sets []*mxfSet
+	for pos := 0; pos+17 <= len(data); {
+		var key mxfUL
+		copy(key[:], data[pos:])
+		length, size, ok := decodeBERLength(data[pos+16:])
+		if !ok || int64(len(data)-pos-16-size) < length {
+			break
+		}
+		value := data[pos+16+size : pos+16+size+int(length)]
+		pos += 16 + size + int(length)
+
+		if key[0] != 0x06 || key[1] != 0x0e || key[2] != 0x2b || key[3] != 0x34 {
+			break // not a KLV key: past the header metadata
+		}
+		switch {
+		case key.matches(mxfPrimerPack):
+			parsePrimer(value, primer)
+		case key[4] == 0x02 && key[5] == 0x53:
+			sets = append(sets, parseLocalSet(key, value))
+		}
+	}
+	return primer, sets
+}
+
+func parsePrimer(value []byte, primer map[uint16]mxfUL) {
+	if len(value) < 8 {
+		return
+	}
+	count := int(binary.BigEndian.Uint32(value[0:4]))
+	itemLen := int(binary.BigEndian.Uint32(value[4:8]))
+	if itemLen != 18 {
+		return
+	}
+	for i := 0; i < count && 8+(i+1)*18 <= len(value); i++ {
+		item := value[8+i*18:]
+		var ul mxfUL
+		copy(ul[:], item[2:18])
+		primer[binary.BigEndian.Uint16(item[0:2])] = ul
+	}
+}
+
+// parseLocalSet splits a local set with 2-byte tags and 2-byte lengths into its properties
+func parseLocalSet(key mxfUL, value []byte) *mxfSet {
+	set := &mxfSet{key: key, props: make(map[uint16][]byte)}
+	for pos := 0; pos+4 <= len(value); {
+		tag := binary.BigEndian.Uint16(value[pos:])
+		length := int(binary.BigEndian.Uint16(value[pos+2:]))
+		if pos+4+length > len(value) {
+			break
+		}
+		set.props[tag] = value[pos+4 : pos+4+length]
+		pos += 4 + length
+	}
+	return set
+}
+
+// interpretMXFHeader extracts the header facts from the partition essence containers and
+// the structural metadata sets
+func interpretMXFHeader(containers []mxfUL, primer map[uint16]mxfUL, sets []*mxfSet) *MXFHeader {
+	h := &MXFHeader{}
+
+	// Dynamic tags are assigned per file; resolve the ones read through the primer
+	dynamicTag := func(ul mxfUL) (uint16, bool) {
+		for tag, p := range primer {
+			if p.matches(ul) {
+				return tag, true
+			}
+		}
+		return 0, false
+	}
+
+	var essenceContainer, sourceContainer *mxfUL
+	filePackageFound := false
+	for _, set := range sets {
+		if set.key.matches(mxfCryptoContext) {
+			h.Encrypted = true
+			if tag, ok := dynamicTag(mxfSourceEssenceContainer); ok {
+				if ul, ok := propUL(set.props[tag]); ok {
+					sourceContainer = &ul
+				}
+			}
+			continue
+		}
+
+		switch kind := set.kind(); kind {
+		case mxfSetSourcePackage:
+			// The file package is the source package that carries the essence descriptor
+			_, hasDescriptor := set.props[tagDescriptor]
+			if umid := set.props[tagPackageUID]; len(umid) == 32 && (hasDescriptor || !filePackageFound) {
+				h.PackageUUID = formatUUID(umid[16:32])
+				filePackageFound = filePackageFound || hasDescriptor
+			}
+
+		case mxfSetPictureDescriptor, mxfSetCDCIDescriptor, mxfSetRGBADescriptor:
+			h.EssenceKind = MXFEssencePicture
+			readFileDescriptor(h, set, &essenceContainer)
+			h.StoredWidth = propInt(set.props[tagStoredWidth])
+			h.StoredHeight = propInt(set.props[tagStoredHeight])
+			if layout := set.props[tagFrameLayout]; len(layout) == 1 && int(layout[0]) < len(mxfFrameLayouts) {
+				h.FrameLayout = mxfFrameLayouts[layout[0]]
+			}
+			if coding, ok := propUL(set.props[tagPictureCoding]); ok && h.JPEG2000Profile == "" {
+				h.JPEG2000Profile = jpeg2000ProfileFromCoding(coding)
+			}
+
+		case mxfSetSoundDescriptor, mxfSetAES3Descriptor, mxfSetWaveDescriptor:
+			h.EssenceKind = MXFEssenceSound
+			readFileDescriptor(h, set, &essenceContainer)
+			h.ChannelCount = propInt(set.props[tagChannelCount])
+			h.BitDepth = propInt(set.props[tagQuantizationBits])
+			if num, den, ok := propRational(set.props[tagAudioSamplingRate]); ok && den > 0 {
+				h.AudioSampleRate = int(num / den)
+			}
+
+		case mxfSetTimedTextDescriptor:
+			h.EssenceKind = MXFEssenceTimedText
+			readFileDescriptor(h, set, &essenceContainer)
+
+		case mxfSetDataDescriptor:
+			if h.EssenceKind == "" {
+				h.EssenceKind = MXFEssenceData
+			}
+			readFileDescriptor(h, set, &essenceContainer)
+
+		case mxfSetJPEG2000SubDesc:
+			if tag, ok := dynamicTag(mxfRsiz); ok {
+				if rsiz := propInt(set.props[tag]); rsiz != 0 {
+					h.JPEG2000Profile = jpeg2000ProfileFromRsiz(rsiz)
+				}
+			}
+
+		case mxfSetStereoscopicSubDesc:
+			h.Stereoscopic = true
+		}
+	}
+
+	// The descriptor names the plaintext container; encrypted files list the encrypted
+	// container in the partition pack and the source container in the cryptographic context
+	for _, ul := range containers {
+		if ul.matches(mxfEncryptedContainer) {
+			h.Encrypted = true
+		}
+	}
+	if essenceContainer != nil && essenceContainer.matches(mxfEncryptedContainer) {
+		h.Encrypted = true
+		essenceContainer = nil
+	}
+	if essenceContainer == nil {
+		essenceContainer = sourceContainer
+	}
+	if essenceContainer == nil {
+		for i := range containers {
+			if !containers[i].matches(mxfEncryptedContainer) {
+				essenceContainer = &containers[i]
+				break
+			}
+		}
+	}
+	if essenceContainer != nil {
+		h.EssenceContainer = essenceContainer.String()
+		if h.EssenceKind == "" {
+			h.EssenceKind = essenceKindFromContainer(*essenceContainer)
+		}
+	}
+
+	return h
+}
+
+// readFileDescriptor reads the properties shared by every file descriptor
+func readFileDescriptor(h *MXFHeader, set *mxfSet, container **mxfUL) {
+	if num, den, ok := propRational(set.props[tagSampleRate]); ok {
+		h.EditRate = fmt.Sprintf("%d %d", num, den)
+	}
+	if d := set.props[tagContainerDuration]; len(d) == 8 {
+		h.ContainerDuration = int64(binary.BigEndian.Uint64(d))
+	}
+	if ul, ok := propUL(set.props[tagEssenceContainer]); ok {
+		*container = &ul
+	}
+}
+
+// essenceKindFromContainer classifies a track file without a recognised descriptor
+func essenceKindFromContainer(ul mxfUL) string {
+	switch {
+	case ul.matches(mxfJPEG2000Container):
+		return MXFEssencePicture
+	case ul.matches(mxfTimedTextContainer):
+		return MXFEssenceTimedText
+	}
+	// 06.0e.2b.34.04.01.01.xx.0d.01.03.01.02.06.xx.xx: Broadcast Wave (frame or clip wrapped)
+	bwf := mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x00, 0x0d, 0x01, 0x03, 0x01, 0x02, 0x06}
+	if bytes.Equal(ul[:7], bwf[:7]) && bytes.Equal(ul[8:14], bwf[8:14]) {
+		return MXFEssenceSound
+	}
+	return ""
+}
+
+// jpeg2000ProfileFromRsiz names the DCI profiles of a JPEG 2000 codestream Rsiz
+func jpeg2000ProfileFromRsiz(rsiz int) string {
+	switch rsiz {
+	case 3:
+		return "2K"
+	case 4:
+		return "4K"
+	}
+	return fmt.Sprintf("rsiz 0x%04x", rsiz)
+}
+
+// jpeg2000ProfileFromCoding names the DCI profiles of a JPEG 2000 picture coding UL
+// (06.0e.2b.34.04.01.01.xx.04.01.02.02.03.01.01.03 is 2K, ...04 is 4K)
+func jpeg2000ProfileFromCoding(ul mxfUL) string {
+	if ul[8] != 0x04 || ul[9] != 0x01 || ul[10] != 0x02 || ul[11] != 0x02 || ul[12] != 0x03 || ul[13] != 0x01 {
+		return ""
+	}
+	switch ul[15] {
+	case 0x03:
+		return "2K"
+	case 0x04:
+		return "4K"
+	}
+	return ""
+}
+
+func propUL(b []byte) (mxfUL, bool) {
+	var ul mxfUL
+	if len(b) != 16 {
+		return ul, false
+	}
+	copy(ul[:], b)
+	return ul, true
+}
+
+// propInt reads an unsigned integer property of 1, 2, 4 or 8 bytes
+func propInt(b []byte) int {
+	switch len(b) {
+	case 1:
+		return int(b[0])
+	case 2:
+		return int(binary.BigEndian.Uint16(b))
+	case 4:
+		return int(binary.BigEndian.Uint32(b))
+	case 8:
+		return int(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func propRational(b []byte) (int64, int64, bool) {
+	if len(b) != 8 {
+		return 0, 0, false
+	}
+	return int64(int32(binary.BigEndian.Uint32(b[0:4]))), int64(int32(binary.BigEndian.Uint32(b[4:8]))), true
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
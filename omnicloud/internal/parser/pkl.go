@@ -3,12 +3,13 @@ package parser
 import (
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
 )
 
 // ParsePKL reads and parses a PKL (Packing List) XML file
 func ParsePKL(path string) (*PackingList, error) {
-	data, err := ioutil.ReadFile(path)
+	data, err := archive.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read PKL file: %w", err)
 	}
@@ -17,6 +18,8 @@ func ParsePKL(path string) (*PackingList, error) {
 	if err := xml.Unmarshal(data, &pkl); err != nil {
 		return nil, fmt.Errorf("failed to parse PKL XML: %w", err)
 	}
+	pkl.Standard = DetectStandard(pkl.XMLName.Space)
+	pkl.Signature = CheckSignature(data)
 
 	return &pkl, nil
 }
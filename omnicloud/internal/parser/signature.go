@@ -0,0 +1,641 @@
+package parser
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1" // registers crypto.SHA1
+	_ "crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// XML-DSig identifiers used by signed Interop and SMPTE (ST 430-3) documents
+const (
+	NamespaceXMLDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algC14N             = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	algC14NWithComments = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"
+	algEnvelopedSig     = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA1          = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algRSASHA256        = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSHA1             = "http://www.w3.org/2000/09/xmldsig#sha1"
+	algSHA256           = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+	namespaceXML = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Signature verdicts
+const (
+	SignatureUnsigned     = "unsigned"      // the document carries no ds:Signature
+	SignatureValid        = "valid"         // digests, signature and certificate chain check out
+	SignatureInvalid      = "invalid"       // digest or signature mismatch: the document was modified after signing
+	SignatureExpired      = "expired"       // the signature matches but a certificate of the chain has expired
+	SignatureChainInvalid = "chain_invalid" // the signature matches but the certificate chain does not verify
+	SignatureError        = "error"         // malformed signature or unsupported algorithm
+)
+
+// SignatureCheck is the outcome of verifying the enveloped XML signature of a CPL or PKL
+type SignatureCheck struct {
+	Status        string
+	SignerSubject string     // subject of the signing (leaf) certificate
+	SignerIssuer  string     // issuer of the signing certificate
+	NotBefore     *time.Time // validity window of the whole chain (latest NotBefore, earliest NotAfter)
+	NotAfter      *time.Time
+	Message       string
+}
+
+// IsSigned reports whether the document carried a signature at all
+func (sc *SignatureCheck) IsSigned() bool {
+	return sc != nil && sc.Status != SignatureUnsigned
+}
+
+// dsigSignature is the ds:Signature element of a signed document
+type dsigSignature struct {
+	SignedInfo struct {
+		CanonicalizationMethod dsigAlgorithm   `xml:"CanonicalizationMethod"`
+		SignatureMethod        dsigAlgorithm   `xml:"SignatureMethod"`
+		References             []dsigReference `xml:"Reference"`
+	} `xml:"SignedInfo"`
+	SignatureValue string `xml:"SignatureValue"`
+	KeyInfo        struct {
+		X509Data []struct {
+			IssuerSerial X509IssuerSerial `xml:"X509IssuerSerial"`
+			Certificate  string           `xml:"X509Certificate"`
+		} `xml:"X509Data"`
+	} `xml:"KeyInfo"`
+}
+
+type dsigAlgorithm struct {
+	Algorithm string `xml:"Algorithm,attr"`
+}
+
+type dsigReference struct {
+	URI          string          `xml:"URI,attr"`
+	Transforms   []dsigAlgorithm `xml:"Transforms>Transform"`
+	DigestMethod dsigAlgorithm   `xml:"DigestMethod"`
+	DigestValue  string          `xml:"DigestValue"`
+}
+
+// CheckSignature verifies the enveloped ds:Signature of a CPL or PKL: every Reference digest is
+// recomputed over the canonicalised document, SignatureValue is checked against the signing
+// certificate, and the embedded X.509 chain is verified up to its self-signed root.
+// It never fails; problems are reported through the verdict and message.
+func CheckSignature(data []byte) *SignatureCheck {
+	check := &SignatureCheck{}
+	fail := func(status, format string, args ...interface{}) *SignatureCheck {
+		check.Status = status
+		check.Message = fmt.Sprintf(format, args...)
+		return check
+	}
+
+	doc, err := parseXMLTree(data)
+	if err != nil {
+		return fail(SignatureError, "failed to parse XML: %v", err)
+	}
+	sigNode := doc.findSignature()
+	if sigNode == nil {
+		check.Status = SignatureUnsigned
+		return check
+	}
+
+	var sig dsigSignature
+	if err := xml.Unmarshal(sigNode.render(), &sig); err != nil {
+		return fail(SignatureError, "failed to parse Signature: %v", err)
+	}
+
+	// The certificate chain is examined first so that the signer is reported whatever the verdict
+	chain, err := parseCertificates(&sig)
+	if err != nil {
+		return fail(SignatureError, "%v", err)
+	}
+	leaf := chain[0]
+	check.SignerSubject = leaf.Subject.String()
+	check.SignerIssuer = leaf.Issuer.String()
+	notBefore, notAfter := leaf.NotBefore, leaf.NotAfter
+	for _, cert := range chain[1:] {
+		if cert.NotBefore.After(notBefore) {
+			notBefore = cert.NotBefore
+		}
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	check.NotBefore = &notBefore
+	check.NotAfter = &notAfter
+
+	if len(sig.SignedInfo.References) == 0 {
+		return fail(SignatureError, "SignedInfo has no Reference")
+	}
+	for _, ref := range sig.SignedInfo.References {
+		if err := verifyReference(doc, sigNode, ref); err != nil {
+			if _, ok := err.(digestMismatch); ok {
+				return fail(SignatureInvalid, "%v", err)
+			}
+			return fail(SignatureError, "%v", err)
+		}
+	}
+
+	signedInfo := sigNode.child(NamespaceXMLDSig, "SignedInfo")
+	if signedInfo == nil {
+		return fail(SignatureError, "Signature has no SignedInfo")
+	}
+	var withComments bool
+	switch sig.SignedInfo.CanonicalizationMethod.Algorithm {
+	case algC14N:
+	case algC14NWithComments:
+		withComments = true
+	default:
+		return fail(SignatureError, "unsupported canonicalization method %q", sig.SignedInfo.CanonicalizationMethod.Algorithm)
+	}
+	canonical := canonicalize(signedInfo, nil, withComments)
+
+	var hash crypto.Hash
+	switch sig.SignedInfo.SignatureMethod.Algorithm {
+	case algRSASHA1:
+		hash = crypto.SHA1
+	case algRSASHA256:
+		hash = crypto.SHA256
+	default:
+		return fail(SignatureError, "unsupported signature method %q", sig.SignedInfo.SignatureMethod.Algorithm)
+	}
+	signatureValue, err := decodeBase64(sig.SignatureValue)
+	if err != nil {
+		return fail(SignatureError, "invalid SignatureValue: %v", err)
+	}
+	pub, ok := leaf.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fail(SignatureError, "signer certificate does not hold an RSA key")
+	}
+	h := hash.New()
+	h.Write(canonical)
+	if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signatureValue); err != nil {
+		return fail(SignatureInvalid, "SignatureValue does not match SignedInfo")
+	}
+
+	if err := verifyChain(chain); err != nil {
+		return fail(SignatureChainInvalid, "%v", err)
+	}
+
+	now := time.Now()
+	switch {
+	case now.After(notAfter):
+		return fail(SignatureExpired, "certificate chain expired on %s", notAfter.Format("2006-01-02"))
+	case now.Before(notBefore):
+		return fail(SignatureChainInvalid, "certificate chain is not valid before %s", notBefore.Format("2006-01-02"))
+	}
+
+	check.Status = SignatureValid
+	return check
+}
+
+// digestMismatch is returned when a Reference no longer matches the content it covers
+type digestMismatch struct {
+	uri string
+}
+
+func (e digestMismatch) Error() string {
+	if e.uri == "" {
+		return "document digest does not match: content was modified after signing"
+	}
+	return fmt.Sprintf("digest of %s does not match: content was modified after signing", e.uri)
+}
+
+// verifyReference recomputes the digest of a same-document Reference ("" or "#id")
+func verifyReference(doc, sigNode *xmlNode, ref dsigReference) error {
+	var target *xmlNode
+	switch {
+	case ref.URI == "":
+		target = doc
+	case strings.HasPrefix(ref.URI, "#"):
+		target = doc.findByID(ref.URI[1:])
+		if target == nil {
+			return fmt.Errorf("reference %s not found in the document", ref.URI)
+		}
+	default:
+		return fmt.Errorf("unsupported reference URI %q", ref.URI)
+	}
+
+	// Same-document references drop comments; an explicit c14n transform can only keep that
+	var exclude *xmlNode
+	for _, t := range ref.Transforms {
+		switch t.Algorithm {
+		case algEnvelopedSig:
+			exclude = sigNode
+		case algC14N, algC14NWithComments:
+		default:
+			return fmt.Errorf("unsupported transform %q", t.Algorithm)
+		}
+	}
+
+	var digest crypto.Hash
+	switch ref.DigestMethod.Algorithm {
+	case algSHA1:
+		digest = crypto.SHA1
+	case algSHA256:
+		digest = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported digest method %q", ref.DigestMethod.Algorithm)
+	}
+
+	expected, err := decodeBase64(ref.DigestValue)
+	if err != nil {
+		return fmt.Errorf("invalid DigestValue: %v", err)
+	}
+	h := digest.New()
+	h.Write(canonicalize(target, exclude, false))
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return digestMismatch{uri: ref.URI}
+	}
+	return nil
+}
+
+// parseCertificates decodes the X509Certificate blocks of KeyInfo and puts the signing (leaf)
+// certificate first: the one that did not issue any other certificate of the set.
+func parseCertificates(sig *dsigSignature) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, data := range sig.KeyInfo.X509Data {
+		if strings.TrimSpace(data.Certificate) == "" {
+			continue
+		}
+		der, err := decodeBase64(data.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid X509Certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid X509Certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("KeyInfo holds no X.509 certificate")
+	}
+
+	// A self-signed root is only taken as the signer when nothing else qualifies
+	leaf := -1
+	for i, cert := range certs {
+		issuer := false
+		for j, other := range certs {
+			if i != j && bytes.Equal(other.RawIssuer, cert.RawSubject) && !bytes.Equal(other.RawIssuer, other.RawSubject) {
+				issuer = true
+				break
+			}
+		}
+		if issuer {
+			continue
+		}
+		if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			leaf = i
+			break
+		}
+		if leaf < 0 {
+			leaf = i
+		}
+	}
+	if leaf < 0 {
+		leaf = 0
+	}
+	chain := append([]*x509.Certificate{certs[leaf]}, certs[:leaf]...)
+	return append(chain, certs[leaf+1:]...), nil
+}
+
+// verifyChain walks from the leaf to a self-signed root, checking each certificate's signature
+// with its issuer's key. SHA-1 signed chains are common in Interop deliveries and are accepted.
+func verifyChain(chain []*x509.Certificate) error {
+	cert := chain[0]
+	for depth := 0; depth <= len(chain); depth++ {
+		var parent *x509.Certificate
+		for _, c := range chain {
+			if bytes.Equal(c.RawSubject, cert.RawIssuer) {
+				parent = c
+				break
+			}
+		}
+		if parent == nil {
+			return fmt.Errorf("certificate chain is incomplete: issuer %q of %q not included", cert.Issuer.String(), cert.Subject.String())
+		}
+		if parent != cert && !parent.IsCA {
+			return fmt.Errorf("certificate %q is not a CA", parent.Subject.String())
+		}
+		if err := parent.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+			return fmt.Errorf("certificate %q is not signed by %q: %v", cert.Subject.String(), parent.Subject.String(), err)
+		}
+		if parent == cert {
+			return nil
+		}
+		cert = parent
+	}
+	return fmt.Errorf("certificate chain contains a loop")
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// Lightweight DOM keeping the lexical prefixes and namespace declarations that canonicalisation needs
+
+const (
+	nodeDocument = iota
+	nodeElement
+	nodeText
+	nodeComment
+	nodeProcInst
+)
+
+type xmlNode struct {
+	kind     int
+	prefix   string
+	local    string
+	attrs    []xml.Attr // as written: Name.Space holds the prefix
+	text     string     // character data, comment text or processing instruction
+	target   string     // processing instruction target
+	parent   *xmlNode
+	children []*xmlNode
+}
+
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	doc := &xmlNode{kind: nodeDocument}
+	current := doc
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{kind: nodeElement, prefix: t.Name.Space, local: t.Name.Local, parent: current}
+			n.attrs = append(n.attrs, t.Attr...)
+			current.children = append(current.children, n)
+			current = n
+		case xml.EndElement:
+			if current.parent == nil {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != doc {
+				current.children = append(current.children, &xmlNode{kind: nodeText, text: string(t), parent: current})
+			}
+		case xml.Comment:
+			current.children = append(current.children, &xmlNode{kind: nodeComment, text: string(t), parent: current})
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				current.children = append(current.children, &xmlNode{kind: nodeProcInst, target: t.Target, text: string(t.Inst), parent: current})
+			}
+		}
+	}
+	if current != doc {
+		return nil, fmt.Errorf("unexpected end of document")
+	}
+	return doc, nil
+}
+
+// declarations returns the namespace declarations made on an element (prefix -> URI, "" for the default)
+func (n *xmlNode) declarations() map[string]string {
+	decls := make(map[string]string)
+	for _, a := range n.attrs {
+		switch {
+		case a.Name.Space == "xmlns":
+			decls[a.Name.Local] = a.Value
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			decls[""] = a.Value
+		}
+	}
+	return decls
+}
+
+// scope returns the namespaces in scope on an element, inherited ones included
+func (n *xmlNode) scope() map[string]string {
+	var chain []*xmlNode
+	for e := n; e != nil && e.kind == nodeElement; e = e.parent {
+		chain = append(chain, e)
+	}
+	scope := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for p, uri := range chain[i].declarations() {
+			scope[p] = uri
+		}
+	}
+	return scope
+}
+
+func (n *xmlNode) namespace() string {
+	return n.scope()[n.prefix]
+}
+
+func (n *xmlNode) qname() string {
+	if n.prefix == "" {
+		return n.local
+	}
+	return n.prefix + ":" + n.local
+}
+
+// child returns the first child element with the given namespace and local name
+func (n *xmlNode) child(namespace, local string) *xmlNode {
+	for _, c := range n.children {
+		if c.kind == nodeElement && c.local == local && c.namespace() == namespace {
+			return c
+		}
+	}
+	return nil
+}
+
+// findSignature returns the ds:Signature enveloped in the document element
+func (n *xmlNode) findSignature() *xmlNode {
+	for _, c := range n.children {
+		if c.kind == nodeElement {
+			return c.child(NamespaceXMLDSig, "Signature")
+		}
+	}
+	return nil
+}
+
+// findByID returns the element carrying an Id (or ID) attribute with the given value
+func (n *xmlNode) findByID(id string) *xmlNode {
+	if n.kind == nodeElement {
+		for _, a := range n.attrs {
+			if a.Name.Space == "" && (a.Name.Local == "Id" || a.Name.Local == "ID") && a.Value == id {
+				return n
+			}
+		}
+	}
+	for _, c := range n.children {
+		if found := c.findByID(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// render serialises an element as standalone XML, declaring every namespace it inherits
+func (n *xmlNode) render() []byte {
+	return canonicalize(n, nil, true)
+}
+
+// canonicalize serialises a document or element subtree with Canonical XML 1.0, leaving out
+// the exclude subtree (the enveloped signature). For an element, namespaces inherited from
+// its ancestors are declared on it as the specification requires for a document subset.
+func canonicalize(n *xmlNode, exclude *xmlNode, withComments bool) []byte {
+	c := &canonicalizer{exclude: exclude, withComments: withComments}
+	if n.kind == nodeDocument {
+		// Nodes outside the document element are separated from it by a line feed
+		afterRoot := false
+		for _, child := range n.children {
+			switch {
+			case child.kind == nodeElement:
+				c.element(child, map[string]string{}, map[string]string{})
+				afterRoot = true
+			case child.kind == nodeProcInst || (child.kind == nodeComment && withComments):
+				if afterRoot {
+					c.buf.WriteByte('\n')
+				}
+				c.node(child, nil, nil)
+				if !afterRoot {
+					c.buf.WriteByte('\n')
+				}
+			}
+		}
+		return c.buf.Bytes()
+	}
+
+	inherited := map[string]string{}
+	if n.parent != nil && n.parent.kind == nodeElement {
+		inherited = n.parent.scope()
+	}
+	c.element(n, inherited, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf          bytes.Buffer
+	exclude      *xmlNode
+	withComments bool
+}
+
+func (c *canonicalizer) node(n *xmlNode, scope, rendered map[string]string) {
+	switch n.kind {
+	case nodeElement:
+		if n != c.exclude {
+			c.element(n, scope, rendered)
+		}
+	case nodeText:
+		c.buf.WriteString(escapeC14NText(n.text))
+	case nodeComment:
+		if c.withComments {
+			c.buf.WriteString("<!--" + n.text + "-->")
+		}
+	case nodeProcInst:
+		c.buf.WriteString("<?" + n.target)
+		if n.text != "" {
+			c.buf.WriteString(" " + n.text)
+		}
+		c.buf.WriteString("?>")
+	}
+}
+
+// element writes an element; scope holds the namespaces in scope on its parent and rendered
+// the declarations already written by its output ancestors
+func (c *canonicalizer) element(n *xmlNode, parentScope, rendered map[string]string) {
+	scope := make(map[string]string, len(parentScope))
+	for p, uri := range parentScope {
+		scope[p] = uri
+	}
+	for p, uri := range n.declarations() {
+		scope[p] = uri
+	}
+
+	var prefixes []string
+	for p, uri := range scope {
+		if p == "xml" {
+			continue
+		}
+		prev, ok := rendered[p]
+		if p == "" && uri == "" {
+			// xmlns="" is only needed to undo a default namespace written by an ancestor
+			if ok && prev != "" {
+				prefixes = append(prefixes, p)
+			}
+			continue
+		}
+		if !ok || prev != uri {
+			prefixes = append(prefixes, p)
+		}
+	}
+	sort.Strings(prefixes)
+
+	childRendered := rendered
+	if len(prefixes) > 0 {
+		childRendered = make(map[string]string, len(rendered)+len(prefixes))
+		for p, uri := range rendered {
+			childRendered[p] = uri
+		}
+	}
+
+	c.buf.WriteString("<" + n.qname())
+	for _, p := range prefixes {
+		childRendered[p] = scope[p]
+		if p == "" {
+			c.buf.WriteString(` xmlns="` + escapeC14NAttr(scope[p]) + `"`)
+		} else {
+			c.buf.WriteString(" xmlns:" + p + `="` + escapeC14NAttr(scope[p]) + `"`)
+		}
+	}
+
+	type attr struct {
+		namespace, local, qname, value string
+	}
+	var attrs []attr
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		a2 := attr{local: a.Name.Local, qname: a.Name.Local, value: a.Value}
+		if a.Name.Space != "" {
+			a2.qname = a.Name.Space + ":" + a.Name.Local
+			a2.namespace = scope[a.Name.Space]
+			if a.Name.Space == "xml" {
+				a2.namespace = namespaceXML
+			}
+		}
+		attrs = append(attrs, a2)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].namespace != attrs[j].namespace {
+			return attrs[i].namespace < attrs[j].namespace
+		}
+		return attrs[i].local < attrs[j].local
+	})
+	for _, a := range attrs {
+		c.buf.WriteString(" " + a.qname + `="` + escapeC14NAttr(a.value) + `"`)
+	}
+	c.buf.WriteByte('>')
+
+	for _, child := range n.children {
+		c.node(child, scope, childRendered)
+	}
+	c.buf.WriteString("</" + n.qname() + ">")
+}
+
+var (
+	c14nTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeC14NText(s string) string {
+	return c14nTextEscaper.Replace(s)
+}
+
+func escapeC14NAttr(s string) string {
+	return c14nAttrEscaper.Replace(s)
+}
@@ -0,0 +1,57 @@
+package parser
+
+import "strings"
+
+// Standard identifies which DCP specification a document was authored against
+type Standard string
+
+const (
+	StandardInterop Standard = "Interop"
+	StandardSMPTE   Standard = "SMPTE"
+	StandardUnknown Standard = "unknown"
+)
+
+// Root element namespaces for Interop (MXF Interop / ASDCP) and SMPTE (ST 429) documents
+const (
+	NamespaceInteropAssetMap = "http://www.digicine.com/PROTO-ASDCP-AM-20040311#"
+	NamespaceInteropPKL      = "http://www.digicine.com/PROTO-ASDCP-PKL-20040311#"
+	NamespaceInteropCPL      = "http://www.digicine.com/PROTO-ASDCP-CPL-20040511#"
+	NamespaceSMPTEAssetMap   = "http://www.smpte-ra.org/schemas/429-9/2007/AM"
+	NamespaceSMPTEPKL        = "http://www.smpte-ra.org/schemas/429-8/2007/PKL"
+	NamespaceSMPTECPL        = "http://www.smpte-ra.org/schemas/429-7/2006/CPL"
+)
+
+// DetectStandard maps a root element namespace to Interop or SMPTE.
+// Exact matches are checked first; unknown revisions are classified by namespace authority
+// (digicine.com is Interop, smpte-ra.org is SMPTE).
+func DetectStandard(namespace string) Standard {
+	switch strings.TrimSpace(namespace) {
+	case NamespaceInteropAssetMap, NamespaceInteropPKL, NamespaceInteropCPL, NamespaceInteropKDM:
+		return StandardInterop
+	case NamespaceSMPTEAssetMap, NamespaceSMPTEPKL, NamespaceSMPTECPL, NamespaceSMPTEKDM:
+		return StandardSMPTE
+	}
+
+	lower := strings.ToLower(namespace)
+	switch {
+	case strings.Contains(lower, "digicine.com"):
+		return StandardInterop
+	case strings.Contains(lower, "smpte-ra.org"):
+		return StandardSMPTE
+	}
+	return StandardUnknown
+}
+
+// ParseStandard normalises a user- or database-supplied standard name (case-insensitive).
+// Returns StandardUnknown and false for unrecognised values.
+func ParseStandard(s string) (Standard, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "interop", "iop":
+		return StandardInterop, true
+	case "smpte":
+		return StandardSMPTE, true
+	case "unknown":
+		return StandardUnknown, true
+	}
+	return StandardUnknown, false
+}
@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
+)
+
+// Kinds of subtitle events a timed text document holds
+const (
+	TimedTextKindText  = "text"  // rendered by the server from Text elements and fonts
+	TimedTextKindImage = "image" // pre-rendered PNG subtitles
+	TimedTextKindMixed = "mixed"
+	TimedTextKindEmpty = "empty" // no Subtitle events at all
+)
+
+const mxfMaxTimedTextBytes = 32 << 20 // largest timed text XML document read from an MXF
+
+var (
+	// Essence elements: 06.0e.2b.34.01.02.01.01.0d.01.03.01.xx...; the first one of a timed
+	// text track file is the XML document, fonts and PNGs follow in generic stream partitions
+	mxfEssenceElementPrefix = []byte{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x02, 0x01}
+	mxfEncryptedTriplet     = mxfUL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x04, 0x01, 0x07, 0x0d, 0x01, 0x03, 0x01, 0x02, 0x7e, 0x01, 0x00}
+)
+
+// DCTimedTextResourceSubDescriptor: one per font or PNG embedded in a SMPTE timed text MXF
+const mxfSetTimedTextResource = 0x65
+
+// TimedText describes the content of a subtitle or closed caption track: an Interop DCSubtitle
+// XML file or a SMPTE ST 428-7 SubtitleReel wrapped in MXF
+type TimedText struct {
+	Standard        Standard
+	Language        string
+	Kind            string // TimedTextKind*
+	EventCount      int
+	TextEventCount  int
+	ImageEventCount int
+	FirstTimeIn     string // TimeIn of the earliest event, as written in the document
+	LastTimeOut     string // TimeOut of the latest event
+	Fonts           []TimedTextFont
+}
+
+// TimedTextFont is a font a timed text document loads
+type TimedTextFont struct {
+	ID      string
+	URI     string // Interop: file name relative to the XML; SMPTE: urn:uuid of the MXF resource
+	Present bool   // the font file (Interop) or embedded resource (SMPTE) exists
+}
+
+// ParseTimedTextFile parses an Interop subtitle XML file. Fonts are looked up next to it.
+func ParseTimedTextFile(path string) (*TimedText, error) {
+	data, err := archive.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subtitle file: %w", err)
+	}
+	tt, err := ParseTimedText(data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for i, font := range tt.Fonts {
+		if font.URI == "" || strings.HasPrefix(strings.ToLower(font.URI), "urn:") {
+			continue
+		}
+		if _, err := archive.Stat(filepath.Join(dir, filepath.FromSlash(font.URI))); err == nil {
+			tt.Fonts[i].Present = true
+		}
+	}
+	return tt, nil
+}
+
+// ReadTimedTextMXF reads the SMPTE timed text document of an MXF track file. Fonts are present
+// when the file embeds a resource with the ID the document loads.
+func ReadTimedTextMXF(path string) (*TimedText, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MXF file: %w", err)
+	}
+	defer f.Close()
+
+	hp, err := readHeaderPartition(f)
+	if err != nil {
+		return nil, err
+	}
+	resources := make(map[string]bool)
+	for _, set := range hp.sets {
+		if set.kind() != mxfSetTimedTextResource {
+			continue
+		}
+		for tag, v := range set.props {
+			if len(v) == 16 && tag != 0x3c0a && tag != 0x0102 { // skip InstanceUID and GenerationUID
+				resources[formatUUID(v)] = true
+			}
+		}
+	}
+
+	doc, err := readFirstEssenceElement(f, hp.end)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := ParseTimedText(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, font := range tt.Fonts {
+		tt.Fonts[i].Present = resources[strings.ToLower(ExtractUUID(font.URI))]
+	}
+	return tt, nil
+}
+
+// readFirstEssenceElement walks the KLV triplets after the header metadata up to the first
+// essence element and returns its value
+func readFirstEssenceElement(r io.ReaderAt, offset int64) ([]byte, error) {
+	for i := 0; i < 4096; i++ {
+		key, length, valueOffset, err := readKLVHeader(r, offset)
+		if err != nil {
+			return nil, errors.New("no timed text essence found in MXF file")
+		}
+		if key.matches(mxfEncryptedTriplet) {
+			return nil, errors.New("timed text essence is encrypted")
+		}
+		if bytes.HasPrefix(key[:], mxfEssenceElementPrefix) && key[8] == 0x0d && key[10] == 0x03 {
+			if length > mxfMaxTimedTextBytes {
+				return nil, fmt.Errorf("timed text document too large (%d bytes)", length)
+			}
+			doc := make([]byte, length)
+			if _, err := r.ReadAt(doc, valueOffset); err != nil {
+				return nil, fmt.Errorf("failed to read timed text essence: %w", err)
+			}
+			return doc, nil
+		}
+		offset = valueOffset + length
+	}
+	return nil, errors.New("no timed text essence found in MXF file")
+}
+
+// ParseTimedText parses an Interop DCSubtitle or SMPTE SubtitleReel document, counting its
+// events and listing the fonts it loads
+func ParseTimedText(data []byte) (*TimedText, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+
+	tt := &TimedText{}
+	var (
+		depth        int
+		text         strings.Builder
+		inEvent      bool
+		hasText      bool
+		hasImage     bool
+		timeCodeRate int
+		first, last  float64
+		font         *TimedTextFont
+	)
+	type event struct{ in, out string }
+	var events []event
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timed text XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if depth == 0 {
+				switch name {
+				case "DCSubtitle":
+					tt.Standard = StandardInterop
+				case "SubtitleReel":
+					tt.Standard = StandardSMPTE
+				default:
+					return nil, fmt.Errorf("unexpected timed text root element %s", name)
+				}
+			}
+			depth++
+			text.Reset()
+
+			switch name {
+			case "LoadFont":
+				font = &TimedTextFont{ID: xmlAttr(t, "Id", "ID"), URI: xmlAttr(t, "URI")}
+			case "Subtitle":
+				inEvent, hasText, hasImage = true, false, false
+				events = append(events, event{xmlAttr(t, "TimeIn"), xmlAttr(t, "TimeOut")})
+			case "Text":
+				hasText = hasText || inEvent
+			case "Image":
+				hasImage = hasImage || inEvent
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			name := t.Name.Local
+			value := strings.TrimSpace(text.String())
+			switch {
+			case name == "Language" && depth == 2:
+				tt.Language = value
+			case name == "TimeCodeRate" && depth == 2:
+				timeCodeRate, _ = strconv.Atoi(value)
+			case name == "LoadFont" && font != nil:
+				if font.URI == "" {
+					font.URI = value // SMPTE: <LoadFont ID="f1">urn:uuid:...</LoadFont>
+				}
+				tt.Fonts = append(tt.Fonts, *font)
+				font = nil
+			case name == "Subtitle" && inEvent:
+				inEvent = false
+				tt.EventCount++
+				if hasText {
+					tt.TextEventCount++
+				}
+				if hasImage {
+					tt.ImageEventCount++
+				}
+			}
+			depth--
+			text.Reset()
+		}
+	}
+	if tt.Standard == "" {
+		return nil, errors.New("empty timed text document")
+	}
+
+	// Interop times count ticks of 4 ms; SMPTE times count frames at TimeCodeRate
+	for _, e := range events {
+		in, okIn := timedTextSeconds(e.in, tt.Standard, timeCodeRate)
+		out, okOut := timedTextSeconds(e.out, tt.Standard, timeCodeRate)
+		if okIn && (tt.FirstTimeIn == "" || in < first) {
+			tt.FirstTimeIn, first = e.in, in
+		}
+		if okOut && (tt.LastTimeOut == "" || out > last) {
+			tt.LastTimeOut, last = e.out, out
+		}
+	}
+
+	switch {
+	case tt.EventCount == 0:
+		tt.Kind = TimedTextKindEmpty
+	case tt.ImageEventCount == 0:
+		tt.Kind = TimedTextKindText
+	case tt.TextEventCount == 0:
+		tt.Kind = TimedTextKindImage
+	default:
+		tt.Kind = TimedTextKindMixed
+	}
+	return tt, nil
+}
+
+// xmlAttr returns the first of the named attributes present on an element
+func xmlAttr(el xml.StartElement, names ...string) string {
+	for _, name := range names {
+		for _, a := range el.Attr {
+			if a.Name.Local == name {
+				return strings.TrimSpace(a.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// timedTextSeconds converts a TimeIn/TimeOut value to seconds. Accepts HH:MM:SS:ff (ticks of
+// 4 ms for Interop, frames at timeCodeRate for SMPTE) and HH:MM:SS.sss.
+func timedTextSeconds(tc string, standard Standard, timeCodeRate int) (float64, bool) {
+	parts := strings.Split(tc, ":")
+	if len(parts) == 3 {
+		// HH:MM:SS.sss
+		h, err1 := strconv.Atoi(parts[0])
+		m, err2 := strconv.Atoi(parts[1])
+		sec, err3 := strconv.ParseFloat(parts[2], 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return 0, false
+		}
+		return float64(h*3600+m*60) + sec, true
+	}
+	if len(parts) != 4 {
+		return 0, false
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, false
+		}
+		v[i] = n
+	}
+	rate := 250.0
+	if standard == StandardSMPTE {
+		if timeCodeRate <= 0 {
+			return 0, false
+		}
+		rate = float64(timeCodeRate)
+	}
+	return float64(v[0]*3600+v[1]*60+v[2]) + float64(v[3])/rate, true
+}
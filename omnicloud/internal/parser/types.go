@@ -38,6 +38,7 @@ func (fi *FlexInt) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 // ASSETMAP structures
 type AssetMap struct {
 	XMLName     xml.Name `xml:"AssetMap"`
+	Standard    Standard `xml:"-"` // derived from the root namespace by ParseAssetMap
 	ID          string   `xml:"Id"`
 	Creator     string   `xml:"Creator"`
 	VolumeCount int      `xml:"VolumeCount"`
@@ -63,14 +64,23 @@ type Chunk struct {
 	Length      int64  `xml:"Length"`
 }
 
+// VolumeIndex structure (VOLINDEX / VOLINDEX.xml)
+type VolumeIndex struct {
+	XMLName  xml.Name `xml:"VolumeIndex"`
+	Standard Standard `xml:"-"` // derived from the root namespace by ParseVolumeIndex
+	Index    int      `xml:"Index"`
+}
+
 // PKL structures
 type PackingList struct {
-	XMLName        xml.Name `xml:"PackingList"`
-	ID             string   `xml:"Id"`
-	AnnotationText string   `xml:"AnnotationText"`
-	IssueDate      string   `xml:"IssueDate"`
-	Issuer         string   `xml:"Issuer"`
-	Creator        string   `xml:"Creator"`
+	XMLName        xml.Name        `xml:"PackingList"`
+	Standard       Standard        `xml:"-"` // derived from the root namespace by ParsePKL
+	Signature      *SignatureCheck `xml:"-"` // set by ParsePKL
+	ID             string          `xml:"Id"`
+	AnnotationText string          `xml:"AnnotationText"`
+	IssueDate      string          `xml:"IssueDate"`
+	Issuer         string          `xml:"Issuer"`
+	Creator        string          `xml:"Creator"`
 	AssetList      struct {
 		Assets []PKLAsset `xml:"Asset"`
 	} `xml:"AssetList"`
@@ -85,23 +95,41 @@ type PKLAsset struct {
 
 // CPL structures
 type CompositionPlaylist struct {
-	XMLName          xml.Name `xml:"CompositionPlaylist"`
-	ID               string   `xml:"Id"`
-	AnnotationText   string   `xml:"AnnotationText"`
-	IssueDate        string   `xml:"IssueDate"`
-	Issuer           string   `xml:"Issuer"`
-	Creator          string   `xml:"Creator"`
-	ContentTitleText string   `xml:"ContentTitleText"`
-	ContentKind      string   `xml:"ContentKind"`
-	ContentVersion   struct {
-		ID        string `xml:"Id"`
-		LabelText string `xml:"LabelText"`
-	} `xml:"ContentVersion"`
+	XMLName          xml.Name        `xml:"CompositionPlaylist"`
+	Standard         Standard        `xml:"-"` // derived from the root namespace by ParseCPL
+	Signature        *SignatureCheck `xml:"-"` // set by ParseCPL
+	ID               string          `xml:"Id"`
+	AnnotationText   string          `xml:"AnnotationText"`
+	IssueDate        string          `xml:"IssueDate"`
+	Issuer           string          `xml:"Issuer"`
+	Creator          string          `xml:"Creator"`
+	ContentTitleText string          `xml:"ContentTitleText"`
+	ContentKind      string          `xml:"ContentKind"`
+	ContentVersion   ContentVersion  `xml:"ContentVersion"`
+	// ContentVersionList is used by some mastering tools to carry additional versions
+	// alongside the primary ContentVersion.
+	ContentVersionList struct {
+		ContentVersions []ContentVersion `xml:"ContentVersion"`
+	} `xml:"ContentVersionList"`
+	RatingList struct {
+		Ratings []Rating `xml:"Rating"`
+	} `xml:"RatingList"`
 	ReelList struct {
 		Reels []Reel `xml:"Reel"`
 	} `xml:"ReelList"`
 }
 
+type ContentVersion struct {
+	ID        string `xml:"Id"`
+	LabelText string `xml:"LabelText"`
+}
+
+// Rating is a single entry of the CPL RatingList (e.g. Agency "http://www.mpaa.org/2003-ratings", Label "PG-13")
+type Rating struct {
+	Agency string `xml:"Agency"`
+	Label  string `xml:"Label"`
+}
+
 type Reel struct {
 	ID        string    `xml:"Id"`
 	AssetList AssetList `xml:"AssetList"`
@@ -112,6 +140,13 @@ type AssetList struct {
 	MainSound    *MainSound    `xml:"MainSound"`
 	MainSubtitle *MainSubtitle `xml:"MainSubtitle"`
 	Metadata     *Metadata     `xml:"CompositionMetadataAsset"`
+	// msp-cpl:MainStereoscopicPicture replaces MainPicture in 3D compositions
+	MainStereoscopicPicture *MainPicture `xml:"MainStereoscopicPicture"`
+	// cc-cpl:MainClosedCaption (Interop and SMPTE 429-12)
+	MainClosedCaption *MainSubtitle `xml:"MainClosedCaption"`
+	MainMarkers       *MainMarkers  `xml:"MainMarkers"`
+	// axd:AuxData tracks (Dolby Atmos, D-BOX, etc.), identified by DataType
+	AuxData []AuxData `xml:"AuxData"`
 }
 
 type MainPicture struct {
@@ -147,6 +182,34 @@ type MainSubtitle struct {
 	Language          string  `xml:"Language"`
 }
 
+type MainMarkers struct {
+	ID                string  `xml:"Id"`
+	EditRate          string  `xml:"EditRate"`
+	IntrinsicDuration FlexInt `xml:"IntrinsicDuration"`
+	EntryPoint        FlexInt `xml:"EntryPoint"`
+	Duration          FlexInt `xml:"Duration"`
+	MarkerList        struct {
+		Markers []Marker `xml:"Marker"`
+	} `xml:"MarkerList"`
+}
+
+// Marker is a reel-relative event such as FFOC, LFOC, FFEC or LFEC (SMPTE 429-7 Table 19)
+type Marker struct {
+	Label  string  `xml:"Label"`
+	Offset FlexInt `xml:"Offset"`
+}
+
+type AuxData struct {
+	ID                string  `xml:"Id"`
+	EditRate          string  `xml:"EditRate"`
+	IntrinsicDuration FlexInt `xml:"IntrinsicDuration"`
+	EntryPoint        FlexInt `xml:"EntryPoint"`
+	Duration          FlexInt `xml:"Duration"`
+	KeyID             string  `xml:"KeyId"`
+	Hash              string  `xml:"Hash"`
+	DataType          string  `xml:"DataType"`
+}
+
 type Metadata struct {
 	ID                       string  `xml:"Id"`
 	EditRate                 string  `xml:"EditRate"`
@@ -169,3 +232,53 @@ type Metadata struct {
 		Height int `xml:"Height"`
 	} `xml:"MainPictureActiveArea"`
 }
+
+// KDM structures (SMPTE ST 430-1 KDM in an ST 430-3 ETM). Only the AuthenticatedPublic part
+// is parsed; the encrypted content keys in AuthenticatedPrivate are not needed for tracking.
+type KDM struct {
+	XMLName             xml.Name `xml:"DCinemaSecurityMessage"`
+	Standard            Standard `xml:"-"` // derived from the KDMRequiredExtensions namespace by ParseKDM
+	AuthenticatedPublic struct {
+		MessageID          string           `xml:"MessageId"`
+		MessageType        string           `xml:"MessageType"`
+		AnnotationText     string           `xml:"AnnotationText"`
+		IssueDate          string           `xml:"IssueDate"`
+		Signer             X509IssuerSerial `xml:"Signer"`
+		RequiredExtensions struct {
+			KDMRequiredExtensions KDMRequiredExtensions `xml:"KDMRequiredExtensions"`
+		} `xml:"RequiredExtensions"`
+	} `xml:"AuthenticatedPublic"`
+}
+
+type X509IssuerSerial struct {
+	IssuerName   string `xml:"X509IssuerName"`
+	SerialNumber string `xml:"X509SerialNumber"`
+}
+
+type KDMRequiredExtensions struct {
+	XMLName   xml.Name `xml:"KDMRequiredExtensions"`
+	Recipient struct {
+		X509IssuerSerial X509IssuerSerial `xml:"X509IssuerSerial"`
+		X509SubjectName  string           `xml:"X509SubjectName"`
+	} `xml:"Recipient"`
+	CompositionPlaylistID     string `xml:"CompositionPlaylistId"`
+	ContentTitleText          string `xml:"ContentTitleText"`
+	ContentKeysNotValidBefore string `xml:"ContentKeysNotValidBefore"`
+	ContentKeysNotValidAfter  string `xml:"ContentKeysNotValidAfter"`
+	AuthorizedDeviceInfo      struct {
+		DeviceListIdentifier  string `xml:"DeviceListIdentifier"`
+		DeviceListDescription string `xml:"DeviceListDescription"`
+		DeviceList            struct {
+			CertificateThumbprints []string `xml:"CertificateThumbprint"`
+		} `xml:"DeviceList"`
+	} `xml:"AuthorizedDeviceInfo"`
+	KeyIDList struct {
+		TypedKeyIDs []TypedKeyID `xml:"TypedKeyId"`
+	} `xml:"KeyIdList"`
+}
+
+// TypedKeyID is a KeyIdList entry: the key type (MDIK, MDAK, MDSK, ...) and the KeyId it decrypts
+type TypedKeyID struct {
+	KeyType string `xml:"KeyType"`
+	KeyID   string `xml:"KeyId"`
+}
@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
+)
+
+// ParseVolumeIndex reads and parses a VOLINDEX file, which identifies the volume
+// of a multi-volume delivery held by a directory
+func ParseVolumeIndex(path string) (*VolumeIndex, error) {
+	data, err := archive.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VOLINDEX file: %w", err)
+	}
+
+	var volIndex VolumeIndex
+	if err := xml.Unmarshal(data, &volIndex); err != nil {
+		return nil, fmt.Errorf("failed to parse VOLINDEX XML: %w", err)
+	}
+	volIndex.Standard = DetectStandard(volIndex.XMLName.Space)
+	if volIndex.Index < 1 {
+		volIndex.Index = 1
+	}
+
+	return &volIndex, nil
+}
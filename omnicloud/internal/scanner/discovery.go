@@ -2,17 +2,20 @@ package scanner
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/omnicloud/omnicloud/internal/archive"
 	"github.com/omnicloud/omnicloud/internal/parser"
+	"github.com/omnicloud/omnicloud/internal/trash"
 )
 
 // DiscoverDCPPackages walks the archive directory and finds all DCP packages
 // A DCP package is identified by the presence of an ASSETMAP or ASSETMAP.xml file
+// Quarantined packages (in the trash directory) are not part of the library
 func DiscoverDCPPackages(rootPath string) ([]string, error) {
 	var packages []string
 	seen := make(map[string]bool)
@@ -33,6 +36,21 @@ func DiscoverDCPPackages(rootPath string) ([]string, error) {
 
 		// Skip if not a file
 		if info.IsDir() {
+			if info.Name() == trash.DirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Packages stored in a tar file are found from its headers without extracting it
+		if archive.IsArchive(info.Name()) && info.Mode().IsRegular() {
+			for _, packagePath := range discoverArchivePackages(path) {
+				if !seen[packagePath] {
+					seen[packagePath] = true
+					packages = append(packages, packagePath)
+					log.Printf("Found DCP package in archive: %s", packagePath)
+				}
+			}
 			return nil
 		}
 
@@ -59,6 +77,69 @@ func DiscoverDCPPackages(rootPath string) ([]string, error) {
 	return packages, nil
 }
 
+// discoverArchivePackages returns the paths of the packages inside a tar file: the archive
+// root or a directory of it holding an ASSETMAP
+func discoverArchivePackages(archivePath string) []string {
+	idx, err := archive.Load(archivePath)
+	if err != nil {
+		log.Printf("Warning: failed to index archive %s: %v", archivePath, err)
+		return nil
+	}
+
+	var packages []string
+	for _, m := range idx.Members {
+		fileName := strings.ToUpper(path.Base(m.Name))
+		if fileName != "ASSETMAP" && fileName != "ASSETMAP.XML" {
+			continue
+		}
+		packages = append(packages, archive.Join(archivePath, path.Dir(m.Name)))
+	}
+	return packages
+}
+
+// DiscoverKDMFiles walks a library location and finds KDM files (.xml or .kdm documents whose
+// root element is DCinemaSecurityMessage). Package XML files (ASSETMAP, PKL, CPL, VOLINDEX) are
+// skipped without being opened.
+func DiscoverKDMFiles(rootPath string) ([]string, error) {
+	var kdms []string
+
+	if _, err := os.Stat(rootPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("scan path does not exist: %s", rootPath)
+	}
+
+	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Continue walking despite errors
+		}
+		if info.IsDir() {
+			if info.Name() == trash.DirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		upperName := strings.ToUpper(info.Name())
+		if !strings.HasSuffix(upperName, ".XML") && !strings.HasSuffix(upperName, ".KDM") {
+			return nil
+		}
+		for _, prefix := range []string{"ASSETMAP", "VOLINDEX", "PKL", "CPL"} {
+			if strings.HasPrefix(upperName, prefix) {
+				return nil
+			}
+		}
+
+		if parser.IsKDMFile(path) {
+			kdms = append(kdms, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory tree: %w", err)
+	}
+
+	return kdms, nil
+}
+
 // FindAssetMapFile finds the ASSETMAP file in a package directory
 func FindAssetMapFile(packagePath string) (string, error) {
 	// Try both ASSETMAP.xml and ASSETMAP (without extension)
@@ -70,7 +151,7 @@ func FindAssetMapFile(packagePath string) (string, error) {
 	}
 	
 	for _, candidate := range candidates {
-		if _, err := os.Stat(candidate); err == nil {
+		if _, err := archive.Stat(candidate); err == nil {
 			return candidate, nil
 		}
 	}
@@ -78,11 +159,30 @@ func FindAssetMapFile(packagePath string) (string, error) {
 	return "", fmt.Errorf("ASSETMAP file not found in %s", packagePath)
 }
 
+// FindVolIndexFile finds the VOLINDEX file of a package directory. Single-volume packages
+// frequently ship without one, in which case an error is returned.
+func FindVolIndexFile(packagePath string) (string, error) {
+	candidates := []string{
+		filepath.Join(packagePath, "VOLINDEX.xml"),
+		filepath.Join(packagePath, "VOLINDEX"),
+		filepath.Join(packagePath, "volindex.xml"),
+		filepath.Join(packagePath, "volindex"),
+	}
+
+	for _, candidate := range candidates {
+		if _, err := archive.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("VOLINDEX file not found in %s", packagePath)
+}
+
 // FindCPLFiles finds all CPL XML files in a package directory
 func FindCPLFiles(packagePath string) ([]string, error) {
 	var cplFiles []string
 	
-	entries, err := ioutil.ReadDir(packagePath)
+	entries, err := archive.ReadDir(packagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read package directory: %w", err)
 	}
@@ -116,7 +216,7 @@ func FindCPLFiles(packagePath string) ([]string, error) {
 func FindPKLFiles(packagePath string) ([]string, error) {
 	var pklFiles []string
 	
-	entries, err := ioutil.ReadDir(packagePath)
+	entries, err := archive.ReadDir(packagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read package directory: %w", err)
 	}
@@ -153,7 +253,7 @@ func FindPKLFilesFromAssetMap(packagePath string, assetMap *parser.AssetMap) []s
 	for _, asset := range assetMap.AssetList.Assets {
 		if asset.PackingList && len(asset.ChunkList.Chunks) > 0 {
 			pklPath := filepath.Join(packagePath, asset.ChunkList.Chunks[0].Path)
-			if _, err := os.Stat(pklPath); err == nil {
+			if _, err := archive.Stat(pklPath); err == nil {
 				pklFiles = append(pklFiles, pklPath)
 			}
 		}
@@ -187,7 +287,7 @@ func FindCPLFilesFromAssetMap(packagePath string, assetMap *parser.AssetMap) []s
 			continue
 		}
 		fullPath := filepath.Join(packagePath, assetPath)
-		if _, err := os.Stat(fullPath); err == nil {
+		if _, err := archive.Stat(fullPath); err == nil {
 			cplFiles = append(cplFiles, fullPath)
 		}
 	}
@@ -199,7 +299,7 @@ func CalculateDirectorySize(path string) (int64, int, error) {
 	var totalSize int64
 	var fileCount int
 	
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+	err := archive.Walk(path, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Skip files we can't access
 		}
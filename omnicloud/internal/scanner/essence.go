@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// mxfHeaderResult caches the outcome of reading the header partition of one track file
+type mxfHeaderResult struct {
+	header *parser.MXFHeader
+	err    error
+}
+
+// MXFHeader reads the MXF header partition of an asset, once per scan. Returns nil without
+// error when the asset is not an MXF file or the volume holding its first chunk is missing.
+func (info *DCPPackageInfo) MXFHeader(assetID string) (*parser.MXFHeader, error) {
+	id := strings.ToLower(parser.ExtractUUID(assetID))
+	if res, ok := info.mxfHeaders[id]; ok {
+		return res.header, res.err
+	}
+
+	// The header partition starts the logical file, i.e. the first chunk
+	chunks := info.ResolveAssetChunks(id)
+	if len(chunks) == 0 || chunks[0].Path == "" || !strings.EqualFold(filepath.Ext(chunks[0].RelPath), ".mxf") {
+		return nil, nil
+	}
+	header, err := parser.ReadMXFHeader(chunks[0].Path)
+	if info.mxfHeaders == nil {
+		info.mxfHeaders = make(map[string]mxfHeaderResult)
+	}
+	info.mxfHeaders[id] = mxfHeaderResult{header: header, err: err}
+	return header, err
+}
+
+// TimedText reads the subtitle document of a timed text asset: a SMPTE MXF track file or an
+// Interop XML file. Returns nil without error when the asset is not held by this package or
+// the volume holding it is missing.
+func (info *DCPPackageInfo) TimedText(assetID string) (*parser.TimedText, error) {
+	chunks := info.ResolveAssetChunks(assetID)
+	if len(chunks) == 0 || chunks[0].Path == "" {
+		return nil, nil
+	}
+	switch strings.ToLower(filepath.Ext(chunks[0].RelPath)) {
+	case ".mxf":
+		return parser.ReadTimedTextMXF(chunks[0].Path)
+	case ".xml":
+		return parser.ParseTimedTextFile(chunks[0].Path)
+	}
+	return nil, nil
+}
+
+// essenceAssetRole maps the essence kind read from an MXF header to an asset role
+func essenceAssetRole(kind string) string {
+	switch kind {
+	case parser.MXFEssencePicture:
+		return "picture"
+	case parser.MXFEssenceSound:
+		return "sound"
+	case parser.MXFEssenceTimedText:
+		return "subtitle"
+	case parser.MXFEssenceData:
+		return "aux_data"
+	}
+	return ""
+}
+
+// setAssetEssence copies the facts of an MXF header onto an asset record, or the reason it
+// could not be read
+func setAssetEssence(asset *db.DCPAsset, header *parser.MXFHeader, readErr error) {
+	now := time.Now()
+	asset.MXFInspectedAt = &now
+	if readErr != nil {
+		asset.MXFError = readErr.Error()
+		return
+	}
+	asset.EssenceKind = header.EssenceKind
+	asset.EssenceContainerUL = header.EssenceContainer
+	if id, err := uuid.Parse(header.PackageUUID); err == nil {
+		asset.MXFPackageUUID = &id
+	}
+	asset.IsEncrypted = header.Encrypted
+	asset.MXFEditRate = header.EditRate
+	asset.MXFDuration = header.ContainerDuration
+	asset.StoredWidth = header.StoredWidth
+	asset.StoredHeight = header.StoredHeight
+	asset.FrameLayout = header.FrameLayout
+	asset.JPEG2000Profile = header.JPEG2000Profile
+	asset.IsStereoscopic = header.Stereoscopic
+	asset.ChannelCount = header.ChannelCount
+	asset.AudioSampleRate = header.AudioSampleRate
+	asset.BitDepth = header.BitDepth
+}
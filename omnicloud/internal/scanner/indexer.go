@@ -2,12 +2,15 @@ package scanner
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/omnicloud/omnicloud/internal/api"
+	"github.com/omnicloud/omnicloud/internal/archive"
 	"github.com/omnicloud/omnicloud/internal/db"
 	"github.com/omnicloud/omnicloud/internal/parser"
 )
@@ -86,7 +89,7 @@ func (idx *Indexer) IndexPackage(info *DCPPackageInfo) error {
 	// creating a new package + torrent, link this server's inventory to the existing
 	// canonical package and begin co-seeding its torrent (after replacing local XML files
 	// with the canonical ones so piece hashes align exactly).
-	if len(info.CPLs) > 0 && idx.settingsClient != nil {
+	if len(info.CPLs) > 0 && idx.settingsClient != nil && info.ExpectedVolumes() == 1 {
 		cplUUIDStr := parser.ExtractUUID(info.CPLs[0].ID)
 		if cplUUIDStr != "" {
 			cplUUID, parseErr := uuid.Parse(cplUUIDStr)
@@ -111,6 +114,13 @@ func (idx *Indexer) IndexPackage(info *DCPPackageInfo) error {
 		contentKind = info.CPLs[0].ContentKind
 	}
 
+	// The ASSETMAP namespace decides the package standard; fall back to the CPL when the
+	// ASSETMAP uses an unrecognised namespace (seen on some hand-built packages)
+	standard := info.AssetMap.Standard
+	if standard == parser.StandardUnknown && len(info.CPLs) > 0 {
+		standard = info.CPLs[0].Standard
+	}
+
 	// Create or update DCP package record
 	now := time.Now()
 	pkg := &db.DCPPackage{
@@ -123,11 +133,12 @@ func (idx *Indexer) IndexPackage(info *DCPPackageInfo) error {
 		Issuer:         info.AssetMap.Issuer,
 		Creator:        info.AssetMap.Creator,
 		AnnotationText: "",
-		VolumeCount:    info.AssetMap.VolumeCount,
+		VolumeCount:    info.ExpectedVolumes(),
 		TotalSizeBytes: info.TotalSize,
 		FileCount:      info.FileCount,
+		Standard:       string(standard),
 		DiscoveredAt:   info.DiscoveredAt,
-		LastVerified:   &now,
+		LastVerified:   nil, // only set by a PKL hash verification run
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
@@ -144,8 +155,9 @@ func (idx *Indexer) IndexPackage(info *DCPPackageInfo) error {
 	packageID := existingPkg.ID
 	
 	// Index all CPLs
+	ownAssets := info.packageAssetIDs()
 	for _, cpl := range info.CPLs {
-		if err := idx.indexComposition(packageID, cpl); err != nil {
+		if err := idx.indexComposition(packageID, info, cpl, ownAssets); err != nil {
 			log.Printf("Warning: failed to index CPL: %v", err)
 		}
 	}
@@ -161,25 +173,55 @@ func (idx *Indexer) IndexPackage(info *DCPPackageInfo) error {
 			log.Printf("Warning: failed to index assets: %v", err)
 		}
 	}
+
+	// Link VFs to the OVs that provide their external assets. Runs after the assets are stored
+	// so an OV indexed after its VFs resolves them too.
+	if err := idx.db.ResolveDCPDependencies([]uuid.UUID{packageID}); err != nil {
+		log.Printf("Warning: failed to resolve VF/OV dependencies: %v", err)
+	}
 	
-	// Update server inventory (normalize path so cleanup compares correctly across runs)
+	// Update server inventory (normalize path so cleanup compares correctly across runs).
+	// A multi-volume package stays "partial" until every volume is present.
+	status := "online"
+	if !info.IsComplete() {
+		status = "partial"
+		log.Printf("Package %s is %s, not marking it online", info.PackageName, info.VolumeStatus())
+	}
 	inventory := &db.ServerDCPInventory{
-		ID:           uuid.New(),
-		ServerID:     idx.serverID,
-		PackageID:    packageID,
-		LocalPath:    filepath.Clean(info.PackagePath),
-		Status:       "online",
-		LastVerified: now,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		ID:             uuid.New(),
+		ServerID:       idx.serverID,
+		PackageID:      packageID,
+		LocalPath:      filepath.Clean(info.PackagePath),
+		Status:         status,
+		VolumesPresent: info.PresentVolumes(),
+		LastVerified:   now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
 	}
 	
 	if err := idx.db.UpsertServerDCPInventory(inventory); err != nil {
 		return fmt.Errorf("failed to update inventory: %w", err)
 	}
 
-	// Check if torrent exists or needs to be generated
-	if idx.torrentQueue != nil {
+	// Packages stored in a tar archive are read in place; record where their files are
+	if err := idx.indexArchiveMembers(packageID, info); err != nil {
+		log.Printf("Warning: failed to record archive members of %s: %v", info.PackageName, err)
+	}
+
+	// Structural checks; the findings replace those of the previous scan of this package here
+	findings := ValidatePackage(info)
+	if err := idx.db.ReplaceDCPValidationFindings(packageID, idx.serverID, findings); err != nil {
+		log.Printf("Warning: failed to store validation findings for %s: %v", info.PackageName, err)
+	}
+	if errs, warnings := countFindings(findings); errs > 0 || warnings > 0 {
+		log.Printf("Validation of %s: %d error(s), %d warning(s)", info.PackageName, errs, warnings)
+	}
+
+	// Check if torrent exists or needs to be generated. Torrents are built from a single
+	// directory, so multi-volume deliveries are not distributed.
+	if info.ExpectedVolumes() > 1 {
+		log.Printf("Package %s spans %d volumes, skipping torrent generation", info.PackageName, info.ExpectedVolumes())
+	} else if idx.torrentQueue != nil {
 		if err := idx.checkTorrentStatus(packageID, assetMapUUID); err != nil {
 			log.Printf("Warning: failed to check torrent status for %s: %v", info.PackageName, err)
 		}
@@ -189,6 +231,26 @@ func (idx *Indexer) IndexPackage(info *DCPPackageInfo) error {
 	return nil
 }
 
+// IndexKDM stores a KDM found in a library location. Client servers send the document to the
+// main server, which parses it and links it to this server; the main server stores it directly.
+func (idx *Indexer) IndexKDM(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read KDM: %w", err)
+	}
+
+	if idx.settingsClient != nil {
+		return idx.settingsClient.ReportKDM(path, data)
+	}
+
+	kdm, keys, err := api.NewKDMRecord(data, path)
+	if err != nil {
+		return err
+	}
+	kdm.ServerID = &idx.serverID
+	return idx.db.UpsertKDM(kdm, keys)
+}
+
 // handleDuplicateByCPL checks whether the given CPL UUID is already in the system under a
 // different ASSETMAP UUID (i.e. the same film delivered to multiple sites by RosettaBridge).
 // If a match is found AND the canonical torrent already exists, it:
@@ -291,8 +353,48 @@ func (idx *Indexer) handleDuplicateByCPL(info *DCPPackageInfo, cplUUID, localAss
 	return true, nil
 }
 
-// indexComposition stores a CPL to the database
-func (idx *Indexer) indexComposition(packageID uuid.UUID, cpl *parser.CompositionPlaylist) error {
+// indexArchiveMembers records the offsets of the files of a package's volumes stored in tar
+// archives. Packages in ordinary directories have nothing to record.
+func (idx *Indexer) indexArchiveMembers(packageID uuid.UUID, info *DCPPackageInfo) error {
+	dirs := []string{info.PackagePath}
+	if len(info.Volumes) > 0 {
+		dirs = dirs[:0]
+		for _, vol := range info.Volumes {
+			dirs = append(dirs, vol.Path)
+		}
+	}
+
+	var members []*db.ArchiveMember
+	for _, dir := range dirs {
+		archivePath, member, ok := archive.Split(dir)
+		if !ok {
+			continue
+		}
+		index, err := archive.Load(archivePath)
+		if err != nil {
+			return err
+		}
+		for _, m := range index.Under(member) {
+			members = append(members, &db.ArchiveMember{
+				ServerID:    idx.serverID,
+				PackageID:   packageID,
+				ArchivePath: archivePath,
+				MemberPath:  m.Name,
+				DataOffset:  m.Offset,
+				Size:        m.Size,
+				ModTime:     m.ModTime,
+			})
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return idx.db.ReplaceArchiveMembers(idx.serverID, filepath.Clean(info.PackagePath), members)
+}
+
+// indexComposition stores a CPL to the database. ownAssets holds the asset IDs of the CPL's
+// package; referenced assets outside it are recorded as external (VF -> OV).
+func (idx *Indexer) indexComposition(packageID uuid.UUID, info *DCPPackageInfo, cpl *parser.CompositionPlaylist, ownAssets map[string]bool) error {
 	cplUUID, err := uuid.Parse(parser.ExtractUUID(cpl.ID))
 	if err != nil {
 		return fmt.Errorf("invalid CPL UUID: %w", err)
@@ -340,9 +442,22 @@ func (idx *Indexer) indexComposition(packageID uuid.UUID, cpl *parser.Compositio
 		Facility:            "",
 		ReelCount:           cpl.GetReelCount(),
 		TotalDurationFrames: cpl.GetTotalDuration(),
+		IsStereoscopic:      cpl.IsStereoscopic(),
+		HasAtmos:            cpl.HasAtmos(),
+		HasClosedCaptions:   cpl.HasClosedCaptions(),
+		Standard:            string(cpl.Standard),
+		SignatureStatus:     "unknown",
 		CreatedAt:           time.Now(),
 		UpdatedAt:           time.Now(),
 	}
+	if sig := cpl.Signature; sig != nil {
+		comp.SignatureStatus = sig.Status
+		comp.SignerSubject = sig.SignerSubject
+		comp.SignerIssuer = sig.SignerIssuer
+		comp.SignerNotBefore = sig.NotBefore
+		comp.SignerNotAfter = sig.NotAfter
+		comp.SignatureMessage = sig.Message
+	}
 	
 	// Extract metadata if available
 	if metadata != nil {
@@ -359,16 +474,19 @@ func (idx *Indexer) indexComposition(packageID uuid.UUID, cpl *parser.Compositio
 	// Extract from first reel if no metadata
 	if len(cpl.ReelList.Reels) > 0 {
 		firstReel := cpl.ReelList.Reels[0]
-		if firstReel.AssetList.MainPicture != nil {
-			comp.EditRate = firstReel.AssetList.MainPicture.EditRate
-			comp.FrameRate = firstReel.AssetList.MainPicture.FrameRate
-			comp.ScreenAspectRatio = firstReel.AssetList.MainPicture.ScreenAspectRatio
+		if pic := firstReel.AssetList.Picture(); pic != nil {
+			comp.EditRate = pic.EditRate
+			comp.FrameRate = pic.FrameRate
+			comp.ScreenAspectRatio = pic.ScreenAspectRatio
 		}
 	}
 	
 	if err := idx.db.InsertDCPComposition(comp); err != nil {
 		return err
 	}
+	if err := idx.db.SetDCPCompositionTitle(comp.ID, comp.ContentTitleText); err != nil {
+		log.Printf("Warning: failed to store decoded title of CPL %s: %v", cpl.ContentTitleText, err)
+	}
 	
 	// Index all reels
 	for i, reel := range cpl.ReelList.Reels {
@@ -376,10 +494,186 @@ func (idx *Indexer) indexComposition(packageID uuid.UUID, cpl *parser.Compositio
 			log.Printf("Warning: failed to index reel: %v", err)
 		}
 	}
+
+	if err := idx.indexCompositionExtensions(comp.ID, cpl); err != nil {
+		log.Printf("Warning: failed to index markers/ratings/versions/keys for CPL %s: %v", cplUUID, err)
+	}
+
+	if err := idx.indexExternalAssets(comp.ID, cpl, ownAssets); err != nil {
+		log.Printf("Warning: failed to index external assets for CPL %s: %v", cplUUID, err)
+	}
+
+	if err := idx.indexTimedText(comp.ID, info, cpl); err != nil {
+		log.Printf("Warning: failed to index timed text for CPL %s: %v", cplUUID, err)
+	}
 	
 	return nil
 }
 
+// indexTimedText inspects the subtitle and closed caption track files of every reel. Tracks
+// held by another package (VF -> OV) or on a missing volume are skipped.
+func (idx *Indexer) indexTimedText(compositionID uuid.UUID, info *DCPPackageInfo, cpl *parser.CompositionPlaylist) error {
+	now := time.Now()
+
+	var tracks []*db.DCPTimedText
+	for i, reel := range cpl.ReelList.Reels {
+		for _, t := range []struct {
+			kind string
+			sub  *parser.MainSubtitle
+		}{
+			{"subtitle", reel.AssetList.MainSubtitle},
+			{"closed_caption", reel.AssetList.MainClosedCaption},
+		} {
+			kind, sub := t.kind, t.sub
+			if sub == nil {
+				continue
+			}
+			assetUUID, err := uuid.Parse(parser.ExtractUUID(sub.ID))
+			if err != nil {
+				continue
+			}
+			tt, err := info.TimedText(assetUUID.String())
+			if tt == nil && err == nil {
+				continue
+			}
+
+			track := &db.DCPTimedText{
+				ID:            uuid.New(),
+				CompositionID: compositionID,
+				ReelNumber:    i + 1,
+				TrackKind:     kind,
+				AssetUUID:     assetUUID,
+				Language:      sub.Language,
+				CreatedAt:     now,
+			}
+			if err != nil {
+				track.Error = err.Error()
+				log.Printf("Warning: failed to read %s of CPL %s reel %d: %v", kind, cpl.ContentTitleText, i+1, err)
+			} else {
+				track.Standard = string(tt.Standard)
+				if tt.Language != "" {
+					track.Language = tt.Language
+				}
+				track.SubtitleKind = tt.Kind
+				track.EventCount = tt.EventCount
+				track.TextEventCount = tt.TextEventCount
+				track.ImageEventCount = tt.ImageEventCount
+				track.FirstTimeIn = tt.FirstTimeIn
+				track.LastTimeOut = tt.LastTimeOut
+				for _, f := range tt.Fonts {
+					track.Fonts = append(track.Fonts, &db.DCPTimedTextFont{FontID: f.ID, URI: f.URI, Present: f.Present})
+				}
+			}
+			tracks = append(tracks, track)
+		}
+	}
+
+	return idx.db.ReplaceDCPTimedText(compositionID, tracks)
+}
+
+// indexExternalAssets records the track files a CPL references that are not part of its own
+// package. A CPL with external assets is a Version File; the package providing them is its OV.
+func (idx *Indexer) indexExternalAssets(compositionID uuid.UUID, cpl *parser.CompositionPlaylist, ownAssets map[string]bool) error {
+	now := time.Now()
+	seen := make(map[string]bool)
+
+	var external []*db.DCPExternalAsset
+	for _, ref := range cpl.GetReferencedAssets() {
+		id := strings.ToLower(ref.ID)
+		if ownAssets[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		assetUUID, err := uuid.Parse(id)
+		if err != nil {
+			continue
+		}
+		external = append(external, &db.DCPExternalAsset{
+			ID:            uuid.New(),
+			CompositionID: compositionID,
+			AssetUUID:     assetUUID,
+			AssetKind:     ref.Kind,
+			CreatedAt:     now,
+		})
+	}
+
+	if len(external) > 0 {
+		log.Printf("CPL %s references %d asset(s) outside its package (VF)", cpl.ContentTitleText, len(external))
+	}
+	return idx.db.ReplaceDCPExternalAssets(compositionID, external)
+}
+
+// indexCompositionExtensions stores markers, ratings, content versions and content keys of a CPL.
+// Each list is replaced wholesale so a re-index never leaves stale entries behind.
+func (idx *Indexer) indexCompositionExtensions(compositionID uuid.UUID, cpl *parser.CompositionPlaylist) error {
+	now := time.Now()
+
+	var markers []*db.DCPMarker
+	for _, m := range cpl.GetMarkers() {
+		markers = append(markers, &db.DCPMarker{
+			ID:            uuid.New(),
+			CompositionID: compositionID,
+			ReelNumber:    m.ReelNumber,
+			Label:         m.Label,
+			OffsetFrames:  m.Offset,
+			AbsoluteFrame: m.AbsoluteFrame,
+			CreatedAt:     now,
+		})
+	}
+	if err := idx.db.ReplaceDCPMarkers(compositionID, markers); err != nil {
+		return fmt.Errorf("markers: %w", err)
+	}
+
+	var ratings []*db.DCPRating
+	for _, r := range cpl.RatingList.Ratings {
+		ratings = append(ratings, &db.DCPRating{
+			ID:            uuid.New(),
+			CompositionID: compositionID,
+			Agency:        r.Agency,
+			Label:         r.Label,
+			CreatedAt:     now,
+		})
+	}
+	if err := idx.db.ReplaceDCPRatings(compositionID, ratings); err != nil {
+		return fmt.Errorf("ratings: %w", err)
+	}
+
+	var versions []*db.DCPContentVersion
+	for _, cv := range cpl.GetContentVersions() {
+		versions = append(versions, &db.DCPContentVersion{
+			ID:               uuid.New(),
+			CompositionID:    compositionID,
+			ContentVersionID: cv.ID,
+			LabelText:        cv.LabelText,
+			CreatedAt:        now,
+		})
+	}
+	if err := idx.db.ReplaceDCPContentVersions(compositionID, versions); err != nil {
+		return fmt.Errorf("content versions: %w", err)
+	}
+
+	var keys []*db.DCPCompositionKey
+	for _, k := range cpl.GetContentKeys() {
+		keyID, err := uuid.Parse(k.KeyID)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &db.DCPCompositionKey{
+			ID:            uuid.New(),
+			CompositionID: compositionID,
+			KeyID:         keyID,
+			KeyKind:       k.Kind,
+			ReelNumber:    k.ReelNumber,
+		})
+	}
+	if err := idx.db.ReplaceDCPCompositionKeys(compositionID, keys); err != nil {
+		return fmt.Errorf("content keys: %w", err)
+	}
+
+	return nil
+}
+
 // indexReel stores a reel to the database
 func (idx *Indexer) indexReel(compositionID uuid.UUID, reelNumber int, reel *parser.Reel) error {
 	reelUUID, err := uuid.Parse(parser.ExtractUUID(reel.ID))
@@ -395,8 +689,8 @@ func (idx *Indexer) indexReel(compositionID uuid.UUID, reelNumber int, reel *par
 		CreatedAt:     time.Now(),
 	}
 	
-	if reel.AssetList.MainPicture != nil {
-		pic := reel.AssetList.MainPicture
+	if pic := reel.AssetList.Picture(); pic != nil {
+		dbReel.IsStereoscopic = reel.AssetList.MainPicture == nil
 		dbReel.DurationFrames = int(pic.Duration)
 		dbReel.PictureEditRate = pic.EditRate
 		dbReel.PictureEntryPoint = int(pic.EntryPoint)
@@ -424,6 +718,34 @@ func (idx *Indexer) indexReel(compositionID uuid.UUID, reelNumber int, reel *par
 		}
 		dbReel.SubtitleLanguage = sub.Language
 	}
+
+	if reel.AssetList.MainClosedCaption != nil {
+		cc := reel.AssetList.MainClosedCaption
+		if ccUUID, err := uuid.Parse(parser.ExtractUUID(cc.ID)); err == nil {
+			dbReel.ClosedCaptionAssetUUID = &ccUUID
+		}
+		dbReel.ClosedCaptionLanguage = cc.Language
+	}
+
+	if reel.AssetList.MainMarkers != nil {
+		if mkUUID, err := uuid.Parse(parser.ExtractUUID(reel.AssetList.MainMarkers.ID)); err == nil {
+			dbReel.MarkersAssetUUID = &mkUUID
+		}
+	}
+
+	// A reel rarely carries more than one AuxData track; prefer Atmos when it does
+	for i, aux := range reel.AssetList.AuxData {
+		if i > 0 && !aux.IsAtmos() {
+			continue
+		}
+		if auxUUID, err := uuid.Parse(parser.ExtractUUID(aux.ID)); err == nil {
+			dbReel.AuxDataAssetUUID = &auxUUID
+		}
+		dbReel.AuxDataType = aux.DataType
+		if aux.IsAtmos() {
+			break
+		}
+	}
 	
 	return idx.db.InsertDCPReel(dbReel)
 }
@@ -443,15 +765,24 @@ func (idx *Indexer) indexPackingList(packageID uuid.UUID, pkl *parser.PackingLis
 	}
 	
 	dbPKL := &db.DCPPackingList{
-		ID:             uuid.New(),
-		PackageID:      packageID,
-		PKLUUID:        pklUUID,
-		AnnotationText: pkl.AnnotationText,
-		IssueDate:      issueDate,
-		Issuer:         pkl.Issuer,
-		Creator:        pkl.Creator,
-		AssetCount:     pkl.GetAssetCount(),
-		CreatedAt:      time.Now(),
+		ID:              uuid.New(),
+		PackageID:       packageID,
+		PKLUUID:         pklUUID,
+		AnnotationText:  pkl.AnnotationText,
+		IssueDate:       issueDate,
+		Issuer:          pkl.Issuer,
+		Creator:         pkl.Creator,
+		AssetCount:      pkl.GetAssetCount(),
+		SignatureStatus: "unknown",
+		CreatedAt:       time.Now(),
+	}
+	if sig := pkl.Signature; sig != nil {
+		dbPKL.SignatureStatus = sig.Status
+		dbPKL.SignerSubject = sig.SignerSubject
+		dbPKL.SignerIssuer = sig.SignerIssuer
+		dbPKL.SignerNotBefore = sig.NotBefore
+		dbPKL.SignerNotAfter = sig.NotAfter
+		dbPKL.SignatureMessage = sig.Message
 	}
 	
 	return idx.db.InsertDCPPackingList(dbPKL)
@@ -459,6 +790,8 @@ func (idx *Indexer) indexPackingList(packageID uuid.UUID, pkl *parser.PackingLis
 
 // indexAssets stores assets from PKL and ASSETMAP to the database
 func (idx *Indexer) indexAssets(packageID uuid.UUID, info *DCPPackageInfo, pkl *parser.PackingList) error {
+	cplRoles := info.cplAssetRoles()
+
 	// Index assets from PKL (which has hash and size info)
 	for _, pklAsset := range pkl.AssetList.Assets {
 		assetUUID, err := uuid.Parse(parser.ExtractUUID(pklAsset.ID))
@@ -479,8 +812,19 @@ func (idx *Indexer) indexAssets(packageID uuid.UUID, info *DCPPackageInfo, pkl *
 			}
 		}
 		
-		// Determine asset role based on file name
-		assetRole := determineAssetRole(fileName)
+		// Derive the role from the CPL reels, then the PKL Type, then the MXF essence
+		// descriptor; the file name is only a last resort
+		header, mxfErr := info.MXFHeader(assetUUID.String())
+		role, ok := cplRoles[assetUUID.String()]
+		if !ok {
+			role = assetRole{Role: pklTypeRole(pklAsset.Type), Source: RoleSourcePKL}
+		}
+		if role.Role == "" && header != nil {
+			role = assetRole{Role: essenceAssetRole(header.EssenceKind), Source: RoleSourceMXF}
+		}
+		if role.Role == "" {
+			role = assetRole{Role: determineAssetRole(fileName), Source: RoleSourceFilename}
+		}
 		
 		dbAsset := &db.DCPAsset{
 			ID:            uuid.New(),
@@ -489,7 +833,9 @@ func (idx *Indexer) indexAssets(packageID uuid.UUID, info *DCPPackageInfo, pkl *
 			FilePath:      filePath,
 			FileName:      fileName,
 			AssetType:     pklAsset.Type,
-			AssetRole:     assetRole,
+			AssetRole:     role.Role,
+			RoleSource:    role.Source,
+			ReelNumber:    role.ReelNumber,
 			SizeBytes:     pklAsset.Size,
 			HashAlgorithm: "SHA1",
 			HashValue:     pklAsset.Hash,
@@ -497,16 +843,28 @@ func (idx *Indexer) indexAssets(packageID uuid.UUID, info *DCPPackageInfo, pkl *
 			ChunkLength:   pklAsset.Size,
 			CreatedAt:     time.Now(),
 		}
+		if cplUUID, err := uuid.Parse(role.CPLUUID); err == nil {
+			dbAsset.CPLUUID = &cplUUID
+		}
 		
 		if err := idx.db.InsertDCPAsset(dbAsset); err != nil {
 			log.Printf("Warning: failed to insert asset: %v", err)
 		}
+
+		// Facts of a previous scan are kept when the file cannot be reached this time
+		if header != nil || mxfErr != nil {
+			setAssetEssence(dbAsset, header, mxfErr)
+			if err := idx.db.UpdateDCPAssetEssence(dbAsset); err != nil {
+				log.Printf("Warning: failed to store MXF header of %s: %v", fileName, err)
+			}
+		}
 	}
 	
 	return nil
 }
 
-// determineAssetRole determines the role of an asset based on file name
+// determineAssetRole guesses the role of an asset from its file name. Only used when neither the
+// CPLs, the PKL Type nor the MXF header tell the role.
 func determineAssetRole(fileName string) string {
 	if fileName == "" {
 		return "unknown"
@@ -514,10 +872,10 @@ func determineAssetRole(fileName string) string {
 	
 	lower := filepath.Ext(fileName)
 	if lower == ".xml" {
-		if filepath.Base(fileName)[:3] == "CPL" {
+		if strings.HasPrefix(filepath.Base(fileName), "CPL") {
 			return "cpl"
 		}
-		if filepath.Base(fileName)[:3] == "PKL" {
+		if strings.HasPrefix(filepath.Base(fileName), "PKL") {
 			return "pkl"
 		}
 		return "metadata"
@@ -3,13 +3,18 @@ package scanner
 import (
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/omnicloud/omnicloud/internal/api"
 	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/parser"
+	"github.com/omnicloud/omnicloud/internal/trash"
 )
 
 // PeriodicScanner runs full scans on a schedule
@@ -28,8 +33,23 @@ type PeriodicScanner struct {
 	scanStarted   time.Time
 	scanPaths     string
 	packagesFound int
+
+	// Volumes of multi-volume packages found by the last full scan, keyed by package path
+	volumeSets map[string][]PackageVolume
+
+	// Library locations last resolved, and who follows them (the filesystem watcher)
+	libraryMu       sync.Mutex
+	libraryPaths    []string
+	libraryListener func(paths []string)
 }
 
+// How often library locations are re-read between full scans, so locations added or removed
+// while a client was not connected to the main server are picked up without a restart
+const libraryRefreshInterval = 5 * time.Minute
+
+// How often packages quarantined for longer than the server's retention are purged
+const trashPurgeInterval = time.Hour
+
 // NewPeriodicScanner creates a new periodic scanner
 func NewPeriodicScanner(scanPath string, intervalHours int, database *db.DB, serverID uuid.UUID) *PeriodicScanner {
 	return &PeriodicScanner{
@@ -47,17 +67,34 @@ func (ps *PeriodicScanner) SetSettingsClient(client *api.SettingsClient) {
 	ps.settingsClient = client
 }
 
+// SetLibraryListener sets a function called with the library locations whenever they change
+func (ps *PeriodicScanner) SetLibraryListener(listener func(paths []string)) {
+	ps.libraryListener = listener
+}
+
 // GetIndexer returns the indexer for configuration
 func (ps *PeriodicScanner) GetIndexer() *Indexer {
 	return ps.indexer
 }
 
+// VolumesFor returns the volumes of the package at packagePath as found by the last full scan,
+// or nil if the package is not a known multi-volume package
+func (ps *PeriodicScanner) VolumesFor(packagePath string) []PackageVolume {
+	ps.scanMu.RLock()
+	defer ps.scanMu.RUnlock()
+	volumes := ps.volumeSets[filepath.Clean(packagePath)]
+	if volumes == nil {
+		return nil
+	}
+	return append([]PackageVolume(nil), volumes...)
+}
+
 // Start begins the periodic scanning
 func (ps *PeriodicScanner) Start() {
 	log.Printf("Periodic scanner started (interval: %v)", ps.interval)
 
-	// Run initial full scan immediately
-	go ps.runFullScan()
+	// Run initial scan immediately (the scan cache persists across restarts)
+	go ps.runFullScan(false)
 
 	// Start periodic scanning
 	go ps.scheduleScans()
@@ -69,9 +106,15 @@ func (ps *PeriodicScanner) Stop() {
 	log.Println("Periodic scanner stopped")
 }
 
-// RunFullScan runs a full scan (exported for HTTP-triggered rescans)
+// RunFullScan runs a full scan that re-indexes every package, cached or not
 func (ps *PeriodicScanner) RunFullScan() {
-	ps.runFullScan()
+	ps.runFullScan(true)
+}
+
+// RunScan runs a scan (exported for HTTP-triggered rescans). Unless full is set, packages whose
+// files are unchanged since the previous scan are not re-indexed.
+func (ps *PeriodicScanner) RunScan(full bool) {
+	ps.runFullScan(full)
 }
 
 // IsScanning returns whether a scan is currently running
@@ -88,16 +131,38 @@ func (ps *PeriodicScanner) GetScanState() (bool, time.Time, string, int) {
 	return ps.isScanning, ps.scanStarted, ps.scanPaths, ps.packagesFound
 }
 
+// RefreshLibraries re-reads the library locations. When they changed since the last scan, the
+// listener is told and a full scan indexes new locations and drops packages of removed ones.
+func (ps *PeriodicScanner) RefreshLibraries() {
+	if ps.IsScanning() {
+		return // the running scan resolves them itself
+	}
+	if ps.resolveLibraryPaths() {
+		log.Println("Library locations changed, starting scan...")
+		ps.runFullScan(false)
+	}
+}
+
 // scheduleScans runs full scans on the configured interval
 func (ps *PeriodicScanner) scheduleScans() {
 	ticker := time.NewTicker(ps.interval)
 	defer ticker.Stop()
+	libraryTicker := time.NewTicker(libraryRefreshInterval)
+	defer libraryTicker.Stop()
+	trashTicker := time.NewTicker(trashPurgeInterval)
+	defer trashTicker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			log.Println("Starting scheduled full scan...")
-			ps.runFullScan()
+			log.Println("Starting scheduled scan...")
+			ps.runFullScan(false)
+
+		case <-libraryTicker.C:
+			ps.RefreshLibraries()
+
+		case <-trashTicker.C:
+			ps.purgeTrash()
 
 		case <-ps.stopChan:
 			return
@@ -105,23 +170,16 @@ func (ps *PeriodicScanner) scheduleScans() {
 	}
 }
 
-// runFullScan performs a complete scan of the archive
-func (ps *PeriodicScanner) runFullScan() {
-	startTime := time.Now()
-
-	// Track scan state for activity reporting
-	ps.scanMu.Lock()
-	ps.isScanning = true
-	ps.scanStarted = startTime
-	ps.packagesFound = 0
-	ps.scanMu.Unlock()
-	defer func() {
-		ps.scanMu.Lock()
-		ps.isScanning = false
-		ps.scanMu.Unlock()
-	}()
+// LibraryPaths returns the library locations resolved by the last scan or refresh
+func (ps *PeriodicScanner) LibraryPaths() []string {
+	ps.libraryMu.Lock()
+	defer ps.libraryMu.Unlock()
+	return append([]string(nil), ps.libraryPaths...)
+}
 
-	// Determine which library paths to scan
+// resolveLibraryPaths determines the library locations to scan and notifies the listener when
+// they differ from the previous ones. Reports whether they changed after the first resolution.
+func (ps *PeriodicScanner) resolveLibraryPaths() bool {
 	var scanPaths []string
 
 	// Try to fetch library locations from main server (for client sites)
@@ -129,27 +187,166 @@ func (ps *PeriodicScanner) runFullScan() {
 		locations, err := ps.settingsClient.GetLibraryLocations()
 		if err != nil {
 			log.Printf("Warning: Failed to fetch library locations from main server: %v", err)
+			// Keep following the last known locations rather than dropping back to the config path
+			if known := ps.LibraryPaths(); len(known) > 0 {
+				return false
+			}
 			log.Printf("Falling back to config file scan path: %s", ps.scanPath)
-			scanPaths = []string{ps.scanPath}
 		} else if len(locations) == 0 {
 			log.Printf("No library locations configured on main server, using config file path: %s", ps.scanPath)
-			scanPaths = []string{ps.scanPath}
 		} else {
-			log.Printf("Fetched %d library location(s) from main server", len(locations))
 			scanPaths = locations
 		}
 	} else {
-		// Main server or no settings client configured - use config file path
+		// Main server: its own library locations are in the local database
+		locations, err := ps.database.GetActiveLibraryPaths(ps.serverID)
+		if err != nil {
+			log.Printf("Warning: Failed to read library locations: %v", err)
+		}
+		scanPaths = locations
+		if len(scanPaths) == 0 {
+			log.Printf("No library locations configured, using config file path: %s", ps.scanPath)
+		}
+	}
+	if len(scanPaths) == 0 {
 		scanPaths = []string{ps.scanPath}
-		log.Printf("No settings client configured, using config file path: %s", ps.scanPath)
 	}
 
+	ps.libraryMu.Lock()
+	first := ps.libraryPaths == nil
+	changed := !samePaths(ps.libraryPaths, scanPaths)
+	if changed {
+		ps.libraryPaths = scanPaths
+	}
+	ps.libraryMu.Unlock()
+
+	if changed && ps.libraryListener != nil {
+		ps.libraryListener(scanPaths)
+	}
+	return changed && !first
+}
+
+// purgeTrash permanently removes the packages quarantined for longer than this server's
+// retention, from the quarantine areas of the library locations and of any other location
+// a quarantined package was deleted from, and drops their inventory entries
+func (ps *PeriodicScanner) purgeTrash() {
+	days, err := ps.trashRetentionDays()
+	if err != nil {
+		log.Printf("Warning: Failed to read trash retention, not purging quarantined packages: %v", err)
+		return
+	}
+	inventory, err := ps.database.GetServerInventory(ps.serverID)
+	if err != nil {
+		log.Printf("Error getting server inventory: %v", err)
+		return
+	}
+
+	roots := ps.LibraryPaths()
+	for _, inv := range inventory {
+		if root := trash.Root(inv.QuarantinePath); inv.Status == "quarantined" && root != "" {
+			roots = append(roots, root)
+		}
+	}
+
+	var purged []string
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+		removed, err := trash.Purge(root, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			log.Printf("Error purging quarantine area of %s: %v", root, err)
+		}
+		purged = append(purged, removed...)
+	}
+	if len(purged) == 0 {
+		return
+	}
+	log.Printf("Purged %d quarantine batch(es) older than %d day(s)", len(purged), days)
+
+	for _, inv := range inventory {
+		if inv.Status != "quarantined" {
+			continue
+		}
+		for _, dir := range purged {
+			if strings.HasPrefix(inv.QuarantinePath, dir+string(filepath.Separator)) {
+				if err := ps.database.DeleteServerDCPInventory(inv.ID); err != nil {
+					log.Printf("Error deleting inventory entry: %v", err)
+				} else {
+					log.Printf("Removed quarantined package %s from this server for good", inv.PackageID)
+				}
+				break
+			}
+		}
+	}
+}
+
+// trashRetentionDays returns how long this server keeps quarantined packages, as set on the
+// main server
+func (ps *PeriodicScanner) trashRetentionDays() (int, error) {
+	if ps.settingsClient != nil {
+		return ps.settingsClient.GetTrashRetentionDays()
+	}
+	return ps.database.GetTrashRetentionDays(ps.serverID)
+}
+
+// samePaths reports whether two lists hold the same locations, in any order
+func samePaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, p := range a {
+		seen[filepath.Clean(p)]++
+	}
+	for _, p := range b {
+		if seen[filepath.Clean(p)] == 0 {
+			return false
+		}
+		seen[filepath.Clean(p)]--
+	}
+	return true
+}
+
+// runFullScan performs a complete scan of the archive. Unless full is set, packages whose files
+// match the scan cache are counted but neither parsed nor re-indexed.
+func (ps *PeriodicScanner) runFullScan(full bool) {
+	startTime := time.Now()
+
+	// Track scan state for activity reporting; only one scan runs at a time
+	ps.scanMu.Lock()
+	if ps.isScanning {
+		ps.scanMu.Unlock()
+		log.Println("A scan is already running, not starting another")
+		return
+	}
+	ps.isScanning = true
+	ps.scanStarted = startTime
+	ps.packagesFound = 0
+	ps.scanMu.Unlock()
+	defer func() {
+		ps.scanMu.Lock()
+		ps.isScanning = false
+		ps.scanMu.Unlock()
+	}()
+
+	// Determine which library paths to scan
+	ps.resolveLibraryPaths()
+	scanPaths := ps.LibraryPaths()
+
 	// Update scan paths for activity reporting
 	ps.scanMu.Lock()
 	ps.scanPaths = fmt.Sprintf("%d locations", len(scanPaths))
 	ps.scanMu.Unlock()
 
-	log.Printf("=== Starting full scan of %d location(s) ===", len(scanPaths))
+	scanType := "incremental_scan"
+	if full {
+		scanType = "full_scan"
+	}
+	log.Printf("=== Starting %s of %d location(s) ===", strings.Replace(scanType, "_", " ", 1), len(scanPaths))
 	for i, p := range scanPaths {
 		log.Printf("  Location %d: %s", i+1, p)
 	}
@@ -158,7 +355,7 @@ func (ps *PeriodicScanner) runFullScan() {
 	scanLog := &db.ScanLog{
 		ID:        uuid.New(),
 		ServerID:  ps.serverID,
-		ScanType:  "full_scan",
+		ScanType:  scanType,
 		StartedAt: startTime,
 		Status:    "running",
 	}
@@ -182,9 +379,33 @@ func (ps *PeriodicScanner) runFullScan() {
 
 	log.Printf("Total packages discovered across all libraries: %d", len(allPackages))
 
+	// File states of the previous scan; unchanged packages this server still holds are skipped
+	cache, err := ps.database.GetScanCache(ps.serverID)
+	if err != nil {
+		log.Printf("Error loading scan cache, re-indexing every package: %v", err)
+	}
+	seen := make(map[string]bool)
+
+	// KDMs are delivered into the same library locations as the packages they unlock
+	ps.ingestKDMs(scanPaths, cache, seen)
+
+	// Volumes of a multi-volume delivery may sit on different drives / library locations;
+	// group them by ASSETMAP so each delivery is scanned and indexed once
+	packageGroups := GroupPackageVolumes(allPackages)
+	volumeSets := make(map[string][]PackageVolume)
+	for _, group := range packageGroups {
+		if len(group) > 1 {
+			volumeSets[filepath.Clean(group[0].Path)] = group
+		}
+	}
+	if len(packageGroups) != len(allPackages) {
+		log.Printf("Grouped %d package directories into %d packages (multi-volume deliveries)", len(allPackages), len(packageGroups))
+	}
+
 	// Update scan state for activity reporting
 	ps.scanMu.Lock()
-	ps.packagesFound = len(allPackages)
+	ps.packagesFound = len(packageGroups)
+	ps.volumeSets = volumeSets
 	ps.scanMu.Unlock()
 
 	if len(allPackages) == 0 {
@@ -193,19 +414,56 @@ func (ps *PeriodicScanner) runFullScan() {
 		return
 	}
 
-	scanLog.PackagesFound = len(allPackages)
-	log.Printf("Discovered %d DCP packages total", len(allPackages))
+	scanLog.PackagesFound = len(packageGroups)
+	log.Printf("Discovered %d DCP packages total", len(packageGroups))
+
+	held := make(map[string]bool)
+	settled := make(map[string]bool) // indexed here from complete files
+	if inventory, err := ps.database.GetServerInventory(ps.serverID); err == nil {
+		for _, inv := range inventory {
+			held[filepath.Clean(inv.LocalPath)] = true
+			if inv.Status == "online" {
+				settled[filepath.Clean(inv.LocalPath)] = true
+			}
+		}
+	}
 
 	// Scan and index each package
 	added := 0
 	updated := 0
 	errors := 0
 	torrentsQueued := 0
+	signaturesChecked := 0
+	signaturesInvalid := 0
+	copying := 0
+	skipped := 0
+	changed := 0
+
+	for i, volumes := range packageGroups {
+		packagePath := volumes[0].Path
+		cacheKey := filepath.Clean(packagePath)
+		seen[cacheKey] = true
+
+		files, filesChanged, cacheOutdated, err := packageFiles(cacheKey, volumes, cache[cacheKey])
+		if err != nil {
+			log.Printf("Error reading files of %s: %v", packagePath, err)
+		}
+		if !filesChanged && !full && held[cacheKey] {
+			if cacheOutdated {
+				if err := ps.database.ReplaceScanCachePackage(ps.serverID, cacheKey, files); err != nil {
+					log.Printf("Error updating scan cache for %s: %v", packagePath, err)
+				}
+			}
+			skipped++
+			continue
+		}
+		if filesChanged && cache[cacheKey] != nil {
+			changed++
+		}
 
-	for i, packagePath := range allPackages {
-		log.Printf("Scanning package %d/%d: %s", i+1, len(allPackages), filepath.Base(packagePath))
+		log.Printf("Scanning package %d/%d: %s", i+1, len(packageGroups), filepath.Base(packagePath))
 
-		info, err := ScanPackage(packagePath)
+		info, err := ScanPackageVolumes(volumes)
 		if err != nil {
 			log.Printf("Error scanning package %s: %v", packagePath, err)
 			errors++
@@ -220,6 +478,11 @@ func (ps *PeriodicScanner) runFullScan() {
 			continue
 		}
 
+		// Signatures were verified when the CPLs and PKLs were parsed
+		checked, invalid := countSignatures(info)
+		signaturesChecked += checked
+		signaturesInvalid += invalid
+
 		existing, err := ps.database.GetDCPPackageByAssetMapUUID(assetMapUUID)
 		if err != nil {
 			log.Printf("Error checking existing package: %v", err)
@@ -227,6 +490,17 @@ func (ps *PeriodicScanner) runFullScan() {
 			continue
 		}
 
+		// A package this server does not hold online yet may still be being copied, even when it
+		// is already known from another location or server; indexing it now would record wrong
+		// sizes and generate a torrent from partial data. The next scan (or the watcher) retries it.
+		if !settled[cacheKey] {
+			if reason := copyInProgress(info); reason != "" {
+				log.Printf("Skipping %s, copy in progress: %s", packagePath, reason)
+				copying++
+				continue
+			}
+		}
+
 		// Index the package (this also queues torrent generation if needed)
 		if err := ps.indexer.IndexPackage(info); err != nil {
 			log.Printf("Error indexing package %s: %v", packagePath, err)
@@ -241,13 +515,31 @@ func (ps *PeriodicScanner) runFullScan() {
 			updated++
 		}
 
+		if files != nil {
+			if err := ps.database.ReplaceScanCachePackage(ps.serverID, cacheKey, files); err != nil {
+				log.Printf("Error updating scan cache for %s: %v", packagePath, err)
+			}
+		}
+
 		// Update scan log progress every 10 packages so API can report live status
 		if (i+1)%10 == 0 {
 			if err := ps.database.UpdateScanLogProgress(scanLog.ID, added, updated); err != nil {
 				log.Printf("Error updating scan progress: %v", err)
 			}
 			log.Printf("Scan progress: %d/%d packages processed (new: %d, existing: %d, errors: %d, torrents queued: %d)",
-				i+1, len(allPackages), added, updated, errors, torrentsQueued)
+				i+1, len(packageGroups), added, updated, errors, torrentsQueued)
+		}
+	}
+
+	// Forget cached file states of packages that are gone
+	for cacheKey := range cache {
+		if !seen[cacheKey] {
+			if err := ps.database.DeleteScanCachePackage(ps.serverID, cacheKey); err != nil {
+				log.Printf("Error pruning scan cache for %s: %v", cacheKey, err)
+			}
+			if err := ps.database.DeleteArchiveMembers(ps.serverID, cacheKey); err != nil {
+				log.Printf("Error pruning archive members of %s: %v", cacheKey, err)
+			}
 		}
 	}
 
@@ -268,6 +560,10 @@ func (ps *PeriodicScanner) runFullScan() {
 	// Update scan log with results
 	scanLog.PackagesAdded = added
 	scanLog.PackagesUpdated = updated
+	scanLog.SignaturesChecked = signaturesChecked
+	scanLog.SignaturesInvalid = signaturesInvalid
+	scanLog.PackagesSkipped = skipped
+	scanLog.PackagesChanged = changed
 	scanLog.Status = "success"
 	if errors > 0 {
 		scanLog.Status = "partial"
@@ -275,16 +571,107 @@ func (ps *PeriodicScanner) runFullScan() {
 	}
 
 	duration := time.Since(startTime)
-	log.Printf("=== Full scan complete ===")
+	log.Printf("=== Scan complete (%s) ===", scanType)
 	log.Printf("  Locations scanned: %d", len(scanPaths))
 	log.Printf("  Packages found: %d (new: %d, existing: %d)", scanLog.PackagesFound, added, updated)
+	log.Printf("  Unchanged and skipped: %d, changed since last scan: %d", skipped, changed)
 	log.Printf("  Torrents queued for generation: %d", torrentsQueued)
+	log.Printf("  Skipped while still copying: %d", copying)
 	log.Printf("  Inventory removed: %d, Queue entries removed: %d", removed, queueRemoved)
+	log.Printf("  Signatures checked: %d, not valid: %d", signaturesChecked, signaturesInvalid)
 	log.Printf("  Errors: %d, Duration: %v", errors, duration)
 
 	ps.updateScanLog(scanLog, nil)
 }
 
+// copyInProgress tells why a package found by a full scan looks like a copy still in progress,
+// or "" when it can be indexed. Besides the checks of CopyInProgress, a file modified within
+// the quiet period means the copy may still be going. A package whose files have not changed
+// for CopyStalePeriod is indexed even when incomplete.
+func copyInProgress(info *DCPPackageInfo) string {
+	snapshot, err := SnapshotPackage(info)
+	if err != nil {
+		return err.Error()
+	}
+	age := snapshot.TakenAt.Sub(snapshot.Newest)
+	if age < CopyQuietPeriod {
+		return fmt.Sprintf("files modified %v ago", age.Round(time.Second))
+	}
+	if age >= CopyStalePeriod {
+		if reason := info.CopyInProgress(snapshot); reason != "" {
+			log.Printf("%s has looked incomplete for %v (%s), indexing it as it is", info.PackagePath, age.Round(time.Hour), reason)
+		}
+		return ""
+	}
+	return info.CopyInProgress(snapshot)
+}
+
+// countSignatures tallies the signed CPLs and PKLs of a package and logs those that do not verify
+func countSignatures(info *DCPPackageInfo) (checked, invalid int) {
+	count := func(kind, id string, sig *parser.SignatureCheck) {
+		if !sig.IsSigned() {
+			return
+		}
+		checked++
+		if sig.Status != parser.SignatureValid {
+			invalid++
+			log.Printf("Signature of %s %s in %s: %s (%s)", kind, ExtractUUID(id), info.PackageName, sig.Status, sig.Message)
+		}
+	}
+	for _, cpl := range info.CPLs {
+		count("CPL", cpl.ID, cpl.Signature)
+	}
+	for _, pkl := range info.PKLs {
+		count("PKL", pkl.ID, pkl.Signature)
+	}
+	return checked, invalid
+}
+
+// kdmCachePrefix keys the scan cache entries of KDM files. A KDM delivered inside a package
+// directory is also a file of that package, so it needs an entry of its own.
+const kdmCachePrefix = "kdm:"
+
+// ingestKDMs finds KDM files in the library locations and indexes the new or modified ones. Each
+// KDM is kept in the scan cache as a package of its own, so unchanged KDMs are not resent, not
+// even after a restart; it is marked seen so the cache entry survives the scan.
+func (ps *PeriodicScanner) ingestKDMs(scanPaths []string, cache map[string]map[string]*db.ScanCacheEntry, seen map[string]bool) {
+	found, ingested := 0, 0
+	for _, scanPath := range scanPaths {
+		paths, err := DiscoverKDMFiles(scanPath)
+		if err != nil {
+			log.Printf("Error discovering KDMs in %s: %v", scanPath, err)
+			continue
+		}
+		for _, path := range paths {
+			key := kdmCachePrefix + filepath.Clean(path)
+			found++
+			seen[key] = true
+			stat, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			e := &db.ScanCacheEntry{PackagePath: key, FilePath: key, Size: stat.Size(), ModTime: stat.ModTime()}
+			if st, ok := stat.Sys().(*syscall.Stat_t); ok {
+				e.Inode = uint64(st.Ino)
+			}
+			if prev := cache[key][key]; prev != nil && prev.Inode == e.Inode && prev.Size == e.Size && prev.ModTime.Equal(e.ModTime) {
+				continue
+			}
+			if err := ps.indexer.IndexKDM(path); err != nil {
+				log.Printf("Error indexing KDM %s: %v", path, err)
+				continue
+			}
+			if err := ps.database.ReplaceScanCachePackage(ps.serverID, key, []*db.ScanCacheEntry{e}); err != nil {
+				log.Printf("Error updating scan cache for KDM %s: %v", path, err)
+			}
+			ingested++
+		}
+	}
+	if found > 0 {
+		log.Printf("Found %d KDM(s), %d new or modified", found, ingested)
+	}
+}
+
 // updateScanLog updates the scan log with final results
 func (ps *PeriodicScanner) updateScanLog(scanLog *db.ScanLog, scanErr error) {
 	now := time.Now()
@@ -327,8 +714,12 @@ func (ps *PeriodicScanner) cleanupMissingPackages(currentPackages []string) (int
 
 	removed := 0
 
-	// Check each inventory entry (compare normalized paths)
+	// Check each inventory entry (compare normalized paths); quarantined packages are gone from
+	// their path on purpose and stay listed until purged from the trash
 	for _, inv := range allInventory {
+		if inv.Status == "quarantined" {
+			continue
+		}
 		invPathNorm := filepath.Clean(inv.LocalPath)
 		if !availablePackages[invPathNorm] {
 			log.Printf("Package no longer available on this server: %s (inventory: %s)", inv.LocalPath, inv.PackageID)
@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// Where an asset role was derived from, most reliable first
+const (
+	RoleSourceCPL      = "cpl"      // referenced from a CPL reel (or the CPL itself)
+	RoleSourcePKL      = "pkl"      // the PKL Type, e.g. application/mxf;asdcpKind=Picture
+	RoleSourceMXF      = "mxf"      // the essence descriptor of the MXF header
+	RoleSourceFilename = "filename" // file name heuristic
+)
+
+// assetRole is the role of an asset and, when a CPL references it, the first reference
+type assetRole struct {
+	Role       string
+	Source     string
+	CPLUUID    string // bare UUID of the referencing CPL
+	ReelNumber int    // 1-based; 0 for the CPL itself
+}
+
+// cplAssetRoles maps the lower-case ID of every asset the package's CPLs reference (and of the
+// CPLs themselves) to its role. The first CPL and reel referencing an asset wins.
+func (info *DCPPackageInfo) cplAssetRoles() map[string]assetRole {
+	roles := make(map[string]assetRole)
+	for _, cpl := range info.CPLs {
+		cplID := strings.ToLower(parser.ExtractUUID(cpl.ID))
+		if _, ok := roles[cplID]; !ok && cplID != "" {
+			roles[cplID] = assetRole{Role: "cpl", Source: RoleSourceCPL, CPLUUID: cplID}
+		}
+		for _, ref := range cpl.GetReferencedAssets() {
+			id := strings.ToLower(ref.ID)
+			if _, ok := roles[id]; !ok {
+				roles[id] = assetRole{Role: ref.Kind, Source: RoleSourceCPL, CPLUUID: cplID, ReelNumber: ref.ReelNumber}
+			}
+		}
+	}
+	return roles
+}
+
+// pklTypeRole derives a role from a PKL asset Type. Interop PKLs qualify MIME types with
+// asdcpKind (application/x-smpte-mxf;asdcpKind=Picture, text/xml;asdcpKind=CPL); SMPTE PKLs
+// use plain types, of which only fonts and images tell the role. Returns "" when it does not.
+func pklTypeRole(mimeType string) string {
+	parts := strings.Split(mimeType, ";")
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(kv[0], "asdcpKind") {
+			continue
+		}
+		switch strings.ToLower(strings.Trim(kv[1], `"`)) {
+		case "picture":
+			return "picture"
+		case "sound":
+			return "sound"
+		case "subtitle", "timedtext":
+			return "subtitle"
+		case "closedcaption":
+			return "closed_caption"
+		case "cpl":
+			return "cpl"
+		case "pkl":
+			return "pkl"
+		}
+	}
+
+	switch base := strings.ToLower(strings.TrimSpace(parts[0])); {
+	case strings.HasSuffix(base, "ttf"), strings.HasPrefix(base, "font/"):
+		return "font"
+	case strings.HasPrefix(base, "image/"):
+		return "image"
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
+	"github.com/omnicloud/omnicloud/internal/db"
+)
+
+// isPackageXML reports whether a package file is one of the XML documents that describe it
+// (ASSETMAP, VOLINDEX, CPLs, PKLs); their content is hashed so rewrites are noticed even
+// when size and modification time are preserved
+func isPackageXML(name string) bool {
+	upper := strings.ToUpper(name)
+	return upper == "ASSETMAP" || upper == "VOLINDEX" || strings.HasSuffix(upper, ".XML")
+}
+
+// packageFiles records the state of every file of a package's volumes. XML files are hashed
+// unless their cached state shows them unchanged. Reports whether anything differs from the
+// cached states (always true without a cache), and whether the cache is outdated although the
+// package is not: an XML file was touched or moved but its content is the same, so storing the
+// new entries spares hashing it again on the next scan.
+func packageFiles(packagePath string, volumes []PackageVolume, cached map[string]*db.ScanCacheEntry) (entries []*db.ScanCacheEntry, changed, outdated bool, err error) {
+	for _, vol := range volumes {
+		err = archive.Walk(vol.Path, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			e := &db.ScanCacheEntry{
+				PackagePath: packagePath,
+				FilePath:    path,
+				Size:        fi.Size(),
+				ModTime:     fi.ModTime(),
+			}
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				e.Inode = uint64(st.Ino)
+			}
+
+			prev := cached[path]
+			same := prev != nil && prev.Inode == e.Inode && prev.Size == e.Size && prev.ModTime.Equal(e.ModTime)
+			if isPackageXML(fi.Name()) {
+				if same {
+					e.XMLHash = prev.XMLHash
+				} else {
+					hash, err := hashFile(path)
+					if err != nil {
+						return err
+					}
+					e.XMLHash = hash
+					// A touched but identical XML file does not change the package, only its
+					// cached state
+					same = prev != nil && prev.XMLHash == hash
+					if same {
+						outdated = true
+					}
+				}
+			}
+			if !same {
+				changed = true
+			}
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			return nil, true, false, err
+		}
+	}
+	if len(entries) != len(cached) {
+		changed = true
+	}
+	return entries, changed, outdated, nil
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	f, err := archive.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/omnicloud/omnicloud/internal/archive"
 	"github.com/omnicloud/omnicloud/internal/parser"
 )
 
@@ -20,6 +21,10 @@ type DCPPackageInfo struct {
 	TotalSize      int64
 	FileCount      int
 	DiscoveredAt   time.Time
+	Volumes        []PackageVolume // volume directories present, lowest index first
+	ParseErrors    []string        // CPL/PKL files that were found but could not be parsed
+
+	mxfHeaders map[string]mxfHeaderResult // MXF headers read so far, by lower-case asset ID
 }
 
 // ScanPackage scans a single DCP package and extracts all metadata
@@ -28,8 +33,9 @@ func ScanPackage(packagePath string) (*DCPPackageInfo, error) {
 
 	info := &DCPPackageInfo{
 		PackagePath:  packagePath,
-		PackageName:  filepath.Base(packagePath),
+		PackageName:  archive.Name(packagePath),
 		DiscoveredAt: time.Now(),
+		Volumes:      []PackageVolume{{Path: packagePath, Index: ReadVolumeIndex(packagePath)}},
 	}
 
 	// Find and parse ASSETMAP
@@ -61,6 +67,7 @@ func ScanPackage(packagePath string) (*DCPPackageInfo, error) {
 		cpl, err := parser.ParseCPL(cplPath)
 		if err != nil {
 			log.Printf("Warning: failed to parse CPL %s: %v", cplPath, err)
+			info.ParseErrors = append(info.ParseErrors, fmt.Sprintf("%s: %v", filepath.Base(cplPath), err))
 			continue
 		}
 		info.CPLs = append(info.CPLs, cpl)
@@ -84,6 +91,7 @@ func ScanPackage(packagePath string) (*DCPPackageInfo, error) {
 		pkl, err := parser.ParsePKL(pklPath)
 		if err != nil {
 			log.Printf("Warning: failed to parse PKL %s: %v", pklPath, err)
+			info.ParseErrors = append(info.ParseErrors, fmt.Sprintf("%s: %v", filepath.Base(pklPath), err))
 			continue
 		}
 		info.PKLs = append(info.PKLs, pkl)
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// CopyQuietPeriod is how long the files of a new package must have been left untouched before
+// a full scan indexes it. The watcher uses it as the settle time between two snapshots.
+const CopyQuietPeriod = 2 * time.Minute
+
+// CopyStalePeriod is how long a package may keep looking like a copy in progress before it is
+// indexed as it is; by then the copy has stopped, and validation reports the missing or short files
+const CopyStalePeriod = 24 * time.Hour
+
+var (
+	// Files transfer tools write next to (or instead of) the final file while copying
+	transferArtefactSuffixes = []string{
+		".partial", ".part", ".filepart", ".crdownload", ".download",
+		".aspera-ckpt", ".aspx", ".aspera-meta", ".lftp-pget-status", ".!sync", ".tmp",
+	}
+	// rsync writes into a hidden temporary named .<file>.<6 random characters>
+	rsyncTempName = regexp.MustCompile(`^\..+\.[A-Za-z0-9]{6}$`)
+)
+
+// IsTransferArtefact reports whether a file name belongs to a copy still in progress
+func IsTransferArtefact(name string) bool {
+	lower := strings.ToLower(name)
+	for _, suffix := range transferArtefactSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return rsyncTempName.MatchString(name)
+}
+
+// fileState is the size and modification time of one file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// PackageSnapshot records the size and modification time of every file of a package's volumes
+type PackageSnapshot struct {
+	TakenAt   time.Time
+	Newest    time.Time // most recent modification time of any file
+	Artefacts []string  // transfer artefacts found
+	files     map[string]fileState
+}
+
+// SnapshotPackage stats every file in the volume directories of a package
+func SnapshotPackage(info *DCPPackageInfo) (*PackageSnapshot, error) {
+	dirs := []string{info.PackagePath}
+	if len(info.Volumes) > 0 {
+		dirs = dirs[:0]
+		for _, vol := range info.Volumes {
+			dirs = append(dirs, vol.Path)
+		}
+	}
+
+	snap := &PackageSnapshot{TakenAt: time.Now(), files: make(map[string]fileState)}
+	for _, dir := range dirs {
+		err := archive.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			if IsTransferArtefact(fi.Name()) {
+				snap.Artefacts = append(snap.Artefacts, path)
+			}
+			snap.files[path] = fileState{size: fi.Size(), modTime: fi.ModTime()}
+			if fi.ModTime().After(snap.Newest) {
+				snap.Newest = fi.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", dir, err)
+		}
+	}
+	return snap, nil
+}
+
+// Equal reports whether two snapshots hold the same files at the same sizes and times
+func (s *PackageSnapshot) Equal(other *PackageSnapshot) bool {
+	if s == nil || other == nil || len(s.files) != len(other.files) {
+		return false
+	}
+	for path, st := range s.files {
+		o, ok := other.files[path]
+		if !ok || o.size != st.size || !o.modTime.Equal(st.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// CopyInProgress tells why a package looks like it is still being copied, or "" when it does
+// not: transfer artefacts are present, or an asset the PKL lists is missing or not yet at its
+// PKL size on a volume that is present. Assets on volumes that are not present are skipped.
+func (info *DCPPackageInfo) CopyInProgress(snap *PackageSnapshot) string {
+	if len(snap.Artefacts) > 0 {
+		return fmt.Sprintf("transfer artefact %s", filepath.Base(snap.Artefacts[0]))
+	}
+
+	for _, pkl := range info.PKLs {
+		for _, pa := range pkl.AssetList.Assets {
+			if pa.Size <= 0 {
+				continue
+			}
+			id := strings.ToLower(parser.ExtractUUID(pa.ID))
+			chunks := info.ResolveAssetChunks(id)
+			for _, chunk := range chunks {
+				if chunk.Path == "" {
+					continue
+				}
+				st, ok := snap.files[chunk.Path]
+				if !ok {
+					return fmt.Sprintf("%s not present yet", chunk.RelPath)
+				}
+				want := chunk.Length
+				if len(chunks) == 1 {
+					want = pa.Size
+				}
+				if want > 0 && st.size < want {
+					return fmt.Sprintf("%s has %d of %d bytes", chunk.RelPath, st.size, want)
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,351 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnicloud/omnicloud/internal/archive"
+	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// Structural checks run by ValidatePackage
+const (
+	CheckXMLParse         = "xml_parse_failed"           // a CPL or PKL file could not be parsed
+	CheckNoCPL            = "cpl_missing"                // no composition playlist found
+	CheckNoPKL            = "pkl_missing"                // no packing list found
+	CheckMissingFile      = "assetmap_missing_file"      // ASSETMAP chunk path does not exist on disk
+	CheckNotInAssetMap    = "pkl_asset_not_in_assetmap"  // PKL asset has no ASSETMAP entry, so it cannot be located
+	CheckSizeMismatch     = "pkl_size_mismatch"          // file size on disk differs from the PKL Size
+	CheckCPLNotInPKL      = "cpl_not_in_pkl"             // the CPL itself is not listed in a PKL
+	CheckAssetNotInPKL    = "cpl_asset_not_in_pkl"       // CPL references an asset of this package the PKL does not list
+	CheckExternalAsset    = "cpl_external_asset"         // CPL references an asset of another package (VF)
+	CheckDurationExceeded = "duration_exceeds_intrinsic" // EntryPoint + Duration runs past the track file
+	CheckReelDuration     = "reel_duration_mismatch"     // tracks of a reel do not last the same
+	CheckEditRateMismatch = "edit_rate_mismatch"         // picture and sound of a reel use different edit rates
+	CheckSignature        = "signature"                  // CPL or PKL signature does not verify
+	CheckMXFUnreadable    = "mxf_header_unreadable"      // the MXF header partition of a track file could not be read
+	CheckMXFEssence       = "mxf_essence_mismatch"       // the MXF descriptor does not hold the essence the CPL track expects
+	CheckMXFPackageUUID   = "mxf_package_uuid_mismatch"  // the MXF file package UUID differs from the asset UUID
+	CheckMXFEncryption    = "mxf_encryption_mismatch"    // CPL KeyId and MXF encryption disagree
+	CheckMXFEditRate      = "mxf_edit_rate_mismatch"     // the MXF sample rate differs from the CPL EditRate
+	CheckMXFDuration      = "mxf_duration_mismatch"      // the MXF container duration differs from the CPL IntrinsicDuration
+)
+
+// ValidatePackage runs the structural checks on a scanned package: that every file the ASSETMAP
+// points at exists with the size declared by the PKL, that CPLs only reference assets the PKL
+// lists, that reel durations and edit rates are consistent, and that the MXF headers of the
+// track files match what the CPL declares. Chunks on volumes that are not present are skipped;
+// a partial package is reported through its volume status instead.
+func ValidatePackage(info *DCPPackageInfo) []*db.DCPValidationFinding {
+	var findings []*db.DCPValidationFinding
+	now := time.Now()
+	add := func(check, severity, subject, format string, args ...interface{}) {
+		findings = append(findings, &db.DCPValidationFinding{
+			ID:        uuid.New(),
+			CheckID:   check,
+			Severity:  severity,
+			Subject:   subject,
+			Message:   fmt.Sprintf(format, args...),
+			CreatedAt: now,
+		})
+	}
+
+	for _, msg := range info.ParseErrors {
+		add(CheckXMLParse, db.FindingError, strings.SplitN(msg, ":", 2)[0], "%s", msg)
+	}
+	if len(info.CPLs) == 0 {
+		add(CheckNoCPL, db.FindingError, "", "no composition playlist found in the package")
+	}
+	if len(info.PKLs) == 0 {
+		add(CheckNoPKL, db.FindingError, "", "no packing list found in the package")
+	}
+
+	assetMapIDs := make(map[string]bool)
+	if info.AssetMap != nil {
+		for _, a := range info.AssetMap.AssetList.Assets {
+			id := strings.ToLower(parser.ExtractUUID(a.ID))
+			assetMapIDs[id] = true
+			for _, chunk := range info.ResolveAssetChunks(id) {
+				if chunk.Path == "" {
+					continue
+				}
+				if _, err := archive.Stat(chunk.Path); err != nil {
+					add(CheckMissingFile, db.FindingError, chunk.RelPath, "asset %s: %s not found on disk", id, chunk.RelPath)
+				}
+			}
+		}
+	}
+
+	pklIDs := make(map[string]bool)
+	for _, pkl := range info.PKLs {
+		for _, pa := range pkl.AssetList.Assets {
+			id := strings.ToLower(parser.ExtractUUID(pa.ID))
+			pklIDs[id] = true
+			if !assetMapIDs[id] {
+				add(CheckNotInAssetMap, db.FindingError, id, "PKL asset %s (%s) is not listed in the ASSETMAP", id, pa.Type)
+				continue
+			}
+			if pa.Size <= 0 {
+				continue
+			}
+			if size, ok := assetSizeOnDisk(info, id); ok && size != pa.Size {
+				subject := id
+				if chunks := info.ResolveAssetChunks(id); len(chunks) > 0 {
+					subject = chunks[0].RelPath
+				}
+				add(CheckSizeMismatch, db.FindingError, subject, "PKL declares %d bytes, %d found on disk", pa.Size, size)
+			}
+		}
+		checkSignature(pkl.Signature, "PKL", pkl.ID, add)
+	}
+
+	for _, cpl := range info.CPLs {
+		cplID := strings.ToLower(parser.ExtractUUID(cpl.ID))
+		if len(info.PKLs) > 0 && !pklIDs[cplID] {
+			add(CheckCPLNotInPKL, db.FindingError, cplID, "CPL %s is not listed in any PKL", cplID)
+		}
+		for _, ref := range cpl.GetReferencedAssets() {
+			id := strings.ToLower(ref.ID)
+			switch {
+			case pklIDs[id]:
+			case assetMapIDs[id]:
+				add(CheckAssetNotInPKL, db.FindingError, id, "CPL %s reel %d references %s asset %s, which is not listed in the PKL",
+					cplID, ref.ReelNumber, ref.Kind, id)
+			default:
+				add(CheckExternalAsset, db.FindingInfo, id, "CPL %s reel %d references %s asset %s from another package",
+					cplID, ref.ReelNumber, ref.Kind, id)
+			}
+		}
+		for i, reel := range cpl.ReelList.Reels {
+			tracks := reelTracks(&reel)
+			subject := fmt.Sprintf("%s reel %d", cplID, i+1)
+			checkReel(subject, tracks, add)
+			checkTrackFiles(info, subject, tracks, add)
+		}
+		checkSignature(cpl.Signature, "CPL", cpl.ID, add)
+	}
+
+	return findings
+}
+
+// countFindings returns the number of errors and warnings among findings
+func countFindings(findings []*db.DCPValidationFinding) (errs, warnings int) {
+	for _, f := range findings {
+		switch f.Severity {
+		case db.FindingError:
+			errs++
+		case db.FindingWarning:
+			warnings++
+		}
+	}
+	return errs, warnings
+}
+
+type addFinding func(check, severity, subject, format string, args ...interface{})
+
+// reelTrack is one track file of a reel as the CPL declares it
+type reelTrack struct {
+	kind      string
+	id        string
+	keyID     string
+	editRate  string
+	entry     int
+	duration  int
+	intrinsic int
+
+	stereoscopic bool // MainStereoscopicPicture
+}
+
+// reelTracks lists the track files of a reel, picture first
+func reelTracks(reel *parser.Reel) []reelTrack {
+	var tracks []reelTrack
+	track := func(kind, id, keyID, editRate string, entry, duration, intrinsic parser.FlexInt) {
+		tracks = append(tracks, reelTrack{kind: kind, id: id, keyID: keyID, editRate: editRate,
+			entry: int(entry), duration: int(duration), intrinsic: int(intrinsic)})
+	}
+	al := reel.AssetList
+	if pic := al.Picture(); pic != nil {
+		track("picture", pic.ID, pic.KeyID, pic.EditRate, pic.EntryPoint, pic.Duration, pic.IntrinsicDuration)
+		tracks[0].stereoscopic = al.MainPicture == nil
+	}
+	if s := al.MainSound; s != nil {
+		track("sound", s.ID, s.KeyID, s.EditRate, s.EntryPoint, s.Duration, s.IntrinsicDuration)
+	}
+	if s := al.MainSubtitle; s != nil {
+		track("subtitle", s.ID, s.KeyID, s.EditRate, s.EntryPoint, s.Duration, s.IntrinsicDuration)
+	}
+	if s := al.MainClosedCaption; s != nil {
+		track("closed_caption", s.ID, s.KeyID, s.EditRate, s.EntryPoint, s.Duration, s.IntrinsicDuration)
+	}
+	for _, aux := range al.AuxData {
+		track("aux_data", aux.ID, aux.KeyID, aux.EditRate, aux.EntryPoint, aux.Duration, aux.IntrinsicDuration)
+	}
+	return tracks
+}
+
+// checkReel verifies that every track fits its track file, and that the tracks of the reel
+// share the picture's edit rate and duration
+func checkReel(subject string, tracks []reelTrack, add addFinding) {
+	for _, t := range tracks {
+		if t.intrinsic > 0 && t.entry+t.duration > t.intrinsic {
+			add(CheckDurationExceeded, db.FindingError, subject, "%s: EntryPoint %d + Duration %d exceeds IntrinsicDuration %d",
+				t.kind, t.entry, t.duration, t.intrinsic)
+		}
+	}
+
+	if len(tracks) == 0 || tracks[0].kind != "picture" {
+		return
+	}
+	picture := tracks[0]
+	for _, t := range tracks[1:] {
+		if t.editRate == "" || picture.editRate == "" {
+			continue
+		}
+		if !sameEditRate(picture.editRate, t.editRate) {
+			// Only sound must follow the picture rate; durations in other units are not comparable
+			if t.kind == "sound" {
+				add(CheckEditRateMismatch, db.FindingError, subject, "picture edit rate %s, sound edit rate %s", picture.editRate, t.editRate)
+			}
+			continue
+		}
+		if pd, td := picture.playable(), t.playable(); pd > 0 && td > 0 && pd != td {
+			add(CheckReelDuration, db.FindingError, subject, "picture lasts %d frames, %s lasts %d", pd, t.kind, td)
+		}
+	}
+}
+
+// trackEssence is the MXF essence kind each CPL track kind must carry
+var trackEssence = map[string]string{
+	"picture":        parser.MXFEssencePicture,
+	"sound":          parser.MXFEssenceSound,
+	"subtitle":       parser.MXFEssenceTimedText,
+	"closed_caption": parser.MXFEssenceTimedText,
+}
+
+// checkTrackFiles compares the MXF header of every track file of a reel with its CPL entry.
+// Interop subtitles (XML files) and track files on missing volumes have no header to compare.
+func checkTrackFiles(info *DCPPackageInfo, subject string, tracks []reelTrack, add addFinding) {
+	for _, t := range tracks {
+		id := strings.ToLower(parser.ExtractUUID(t.id))
+		header, err := info.MXFHeader(id)
+		if err != nil {
+			add(CheckMXFUnreadable, db.FindingWarning, id, "%s track file of %s: %v", t.kind, subject, err)
+			continue
+		}
+		if header == nil {
+			continue
+		}
+
+		if want := trackEssence[t.kind]; want != "" && header.EssenceKind != "" && header.EssenceKind != want {
+			add(CheckMXFEssence, db.FindingError, id, "%s: CPL %s track references a track file holding %s essence",
+				subject, t.kind, header.EssenceKind)
+			continue
+		}
+		if header.PackageUUID != "" && !strings.EqualFold(header.PackageUUID, id) {
+			add(CheckMXFPackageUUID, db.FindingWarning, id, "%s: track file package UUID is %s", subject, header.PackageUUID)
+		}
+		if encrypted := t.keyID != ""; encrypted != header.Encrypted {
+			if encrypted {
+				add(CheckMXFEncryption, db.FindingError, id, "%s: CPL %s track has a KeyId but the track file is not encrypted", subject, t.kind)
+			} else {
+				add(CheckMXFEncryption, db.FindingError, id, "%s: track file is encrypted but the CPL %s track has no KeyId", subject, t.kind)
+			}
+		}
+
+		// 3D track files interleave both eyes: twice the edit units of the CPL track
+		factor := 1
+		if header.Stereoscopic || t.stereoscopic {
+			factor = 2
+		}
+		if t.kind == "picture" || t.kind == "sound" {
+			if num, den, ok := parseEditRate(t.editRate); ok && header.EditRate != "" {
+				if !sameEditRate(header.EditRate, fmt.Sprintf("%d %d", num*int64(factor), den)) {
+					add(CheckMXFEditRate, db.FindingError, id, "%s: CPL %s EditRate %s, track file sample rate %s",
+						subject, t.kind, t.editRate, header.EditRate)
+				}
+			}
+			if t.intrinsic > 0 && header.ContainerDuration > 0 && header.ContainerDuration != int64(t.intrinsic*factor) {
+				add(CheckMXFDuration, db.FindingError, id, "%s: CPL %s IntrinsicDuration %d, track file holds %d edit units",
+					subject, t.kind, t.intrinsic, header.ContainerDuration)
+			}
+		}
+	}
+}
+
+// playable returns the number of edit units the track plays: Duration, or what remains of the
+// track file after EntryPoint when Duration is omitted
+func (t reelTrack) playable() int {
+	if t.duration > 0 {
+		return t.duration
+	}
+	if t.intrinsic > 0 {
+		return t.intrinsic - t.entry
+	}
+	return 0
+}
+
+// sameEditRate compares two "numerator denominator" edit rates by value ("24 1" equals "48 2")
+func sameEditRate(a, b string) bool {
+	an, ad, okA := parseEditRate(a)
+	bn, bd, okB := parseEditRate(b)
+	if !okA || !okB {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return an*bd == bn*ad
+}
+
+func parseEditRate(s string) (num, den int64, ok bool) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	num, err1 := strconv.ParseInt(fields[0], 10, 64)
+	den, err2 := strconv.ParseInt(fields[1], 10, 64)
+	if err1 != nil || err2 != nil || den == 0 {
+		return 0, 0, false
+	}
+	return num, den, true
+}
+
+// assetSizeOnDisk sums the sizes of an asset's chunks. Returns false when a chunk is missing
+// (reported separately) or its volume is not present.
+func assetSizeOnDisk(info *DCPPackageInfo, assetID string) (int64, bool) {
+	chunks := info.ResolveAssetChunks(assetID)
+	if len(chunks) == 0 {
+		return 0, false
+	}
+	var total int64
+	for _, chunk := range chunks {
+		if chunk.Path == "" {
+			return 0, false
+		}
+		stat, err := archive.Stat(chunk.Path)
+		if err != nil {
+			return 0, false
+		}
+		length := chunk.Length
+		if length <= 0 || len(chunks) == 1 {
+			length = stat.Size()
+		}
+		total += length
+	}
+	return total, true
+}
+
+// checkSignature reports CPL and PKL signatures that do not verify. A document modified after
+// signing is an error (servers refuse to ingest it); an expired or unverifiable chain is a warning.
+func checkSignature(sig *parser.SignatureCheck, kind, id string, add addFinding) {
+	if !sig.IsSigned() || sig.Status == parser.SignatureValid {
+		return
+	}
+	severity := db.FindingWarning
+	if sig.Status == parser.SignatureInvalid {
+		severity = db.FindingError
+	}
+	id = strings.ToLower(parser.ExtractUUID(id))
+	add(CheckSignature, severity, id, "%s signature %s: %s", kind, sig.Status, sig.Message)
+}
@@ -0,0 +1,289 @@
+package scanner
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnicloud/omnicloud/internal/db"
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// VerificationProgress is a snapshot of a running PKL hash verification
+type VerificationProgress struct {
+	PackageID   string
+	PackageName string
+	CurrentFile string
+	FilesDone   int
+	FilesTotal  int
+	BytesDone   int64
+	BytesTotal  int64
+	StartedAt   time.Time
+}
+
+// PackageVerifier checks packages on local disk against the Size and Hash of every PKL asset.
+// Each package can only be verified once at a time; progress is exposed for activity reporting.
+type PackageVerifier struct {
+	mu            sync.Mutex
+	active        map[string]*VerificationProgress // keyed by package ID
+	locateVolumes func(packagePath string) []PackageVolume
+}
+
+// NewPackageVerifier creates a new package verifier
+func NewPackageVerifier() *PackageVerifier {
+	return &PackageVerifier{
+		active: make(map[string]*VerificationProgress),
+	}
+}
+
+// SetVolumeLocator sets how the volumes of a multi-volume package are found from its
+// package path (see PeriodicScanner.VolumesFor). Without it only packagePath is read.
+func (pv *PackageVerifier) SetVolumeLocator(locate func(packagePath string) []PackageVolume) {
+	pv.locateVolumes = locate
+}
+
+// IsVerifying reports whether a verification of the package is currently running
+func (pv *PackageVerifier) IsVerifying(packageID string) bool {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	_, ok := pv.active[packageID]
+	return ok
+}
+
+// Active returns a snapshot of all running verifications
+func (pv *PackageVerifier) Active() []VerificationProgress {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	list := make([]VerificationProgress, 0, len(pv.active))
+	for _, p := range pv.active {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// verifyAsset is a PKL asset with its Size and Hash
+type verifyAsset struct {
+	assetID   string
+	assetUUID *uuid.UUID
+	relPath   string
+	size      int64
+	hash      string
+}
+
+// Verify streams every asset listed in the package's PKL(s) through SHA-1 and compares the
+// base64 digest and file size with the values declared in the PKL. The returned run carries
+// the package verdict ("passed" only if every asset passed); the run is marked "error" when
+// the package itself cannot be read (no ASSETMAP or no PKL).
+func (pv *PackageVerifier) Verify(packageID, packageName, packagePath string) (*db.DCPVerification, []*db.DCPVerificationAsset, error) {
+	pv.mu.Lock()
+	if _, running := pv.active[packageID]; running {
+		pv.mu.Unlock()
+		return nil, nil, fmt.Errorf("verification of %s is already running", packageName)
+	}
+	startedAt := time.Now()
+	progress := &VerificationProgress{
+		PackageID:   packageID,
+		PackageName: packageName,
+		StartedAt:   startedAt,
+	}
+	pv.active[packageID] = progress
+	pv.mu.Unlock()
+
+	defer func() {
+		pv.mu.Lock()
+		delete(pv.active, packageID)
+		pv.mu.Unlock()
+	}()
+
+	run := &db.DCPVerification{StartedAt: &startedAt}
+	finish := func(status, errMsg string) {
+		completedAt := time.Now()
+		run.Status = status
+		run.ErrorMessage = errMsg
+		run.CompletedAt = &completedAt
+	}
+
+	var volumes []PackageVolume
+	if pv.locateVolumes != nil {
+		volumes = pv.locateVolumes(packagePath)
+	}
+	if len(volumes) == 0 {
+		volumes = []PackageVolume{{Path: packagePath, Index: ReadVolumeIndex(packagePath)}}
+	}
+
+	info, assets, err := collectVerifyAssets(volumes)
+	if err != nil {
+		finish(db.VerificationError, err.Error())
+		log.Printf("[verify] %s: %v", packageName, err)
+		return run, nil, nil
+	}
+
+	var bytesTotal int64
+	for _, a := range assets {
+		bytesTotal += a.size
+	}
+	pv.mu.Lock()
+	progress.FilesTotal = len(assets)
+	progress.BytesTotal = bytesTotal
+	pv.mu.Unlock()
+
+	log.Printf("[verify] Verifying %s: %d asset(s), %d bytes", packageName, len(assets), bytesTotal)
+
+	var results []*db.DCPVerificationAsset
+	for _, a := range assets {
+		pv.mu.Lock()
+		progress.CurrentFile = a.relPath
+		pv.mu.Unlock()
+
+		result := pv.verifyFile(progress, info, a)
+		results = append(results, result)
+
+		run.AssetsTotal++
+		run.BytesTotal += result.ActualSize
+		if result.Status == db.AssetVerifyPass {
+			run.AssetsPassed++
+		} else {
+			run.AssetsFailed++
+			log.Printf("[verify] %s: %s %s (%s)", packageName, a.relPath, result.Status, result.Message)
+		}
+
+		pv.mu.Lock()
+		progress.FilesDone++
+		pv.mu.Unlock()
+	}
+
+	if run.AssetsFailed > 0 {
+		finish(db.VerificationFailed, fmt.Sprintf("%d of %d asset(s) failed verification", run.AssetsFailed, run.AssetsTotal))
+	} else {
+		finish(db.VerificationPassed, "")
+	}
+
+	log.Printf("[verify] %s: %s (%d passed, %d failed) in %v",
+		packageName, run.Status, run.AssetsPassed, run.AssetsFailed, run.CompletedAt.Sub(startedAt).Round(time.Second))
+
+	return run, results, nil
+}
+
+// verifyFile checks a single asset's size and SHA-1 digest. Chunked assets are read as one
+// logical stream across volumes.
+func (pv *PackageVerifier) verifyFile(progress *VerificationProgress, info *DCPPackageInfo, a verifyAsset) *db.DCPVerificationAsset {
+	result := &db.DCPVerificationAsset{
+		ID:           uuid.New(),
+		AssetUUID:    a.assetUUID,
+		FilePath:     a.relPath,
+		ExpectedSize: a.size,
+		ExpectedHash: a.hash,
+	}
+
+	// Keep the progress bar honest when an asset is skipped or only partially read
+	countedBytes := int64(0)
+	defer func() {
+		pv.mu.Lock()
+		progress.BytesDone += a.size - countedBytes
+		pv.mu.Unlock()
+	}()
+
+	f, size, err := info.OpenAsset(a.assetID)
+	if err != nil {
+		result.Status = db.AssetVerifyError
+		if errors.Is(err, os.ErrNotExist) {
+			result.Status = db.AssetVerifyMissing
+		}
+		result.Message = err.Error()
+		return result
+	}
+	defer f.Close()
+	result.ActualSize = size
+
+	if a.size > 0 && size != a.size {
+		result.Status = db.AssetVerifySizeMismatch
+		result.Message = fmt.Sprintf("expected %d bytes, found %d", a.size, size)
+		return result
+	}
+	if a.hash == "" {
+		result.Status = db.AssetVerifyError
+		result.Message = "PKL does not declare a hash for this asset"
+		return result
+	}
+
+	h := sha1.New()
+	counter := &progressWriter{onWrite: func(n int) {
+		pv.mu.Lock()
+		progress.BytesDone += int64(n)
+		pv.mu.Unlock()
+		countedBytes += int64(n)
+	}}
+	if _, err := io.CopyBuffer(io.MultiWriter(h, counter), f, make([]byte, 1<<20)); err != nil {
+		result.Status = db.AssetVerifyError
+		result.Message = fmt.Sprintf("read failed: %v", err)
+		return result
+	}
+
+	result.ActualHash = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if result.ActualHash != a.hash {
+		result.Status = db.AssetVerifyHashMismatch
+		result.Message = "SHA-1 digest does not match the PKL"
+		return result
+	}
+
+	result.Status = db.AssetVerifyPass
+	return result
+}
+
+// collectVerifyAssets scans the package volumes and lists every PKL asset with its declared Size and Hash
+func collectVerifyAssets(volumes []PackageVolume) (*DCPPackageInfo, []verifyAsset, error) {
+	info, err := ScanPackageVolumes(volumes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(info.PKLs) == 0 {
+		return nil, nil, fmt.Errorf("no PKL found in %s", info.PackagePath)
+	}
+
+	var assets []verifyAsset
+	seen := make(map[string]bool)
+	for _, pkl := range info.PKLs {
+		for _, pa := range pkl.AssetList.Assets {
+			id := strings.ToLower(parser.ExtractUUID(pa.ID))
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			a := verifyAsset{
+				assetID: id,
+				size:    pa.Size,
+				hash:    strings.TrimSpace(pa.Hash),
+			}
+			if chunks := info.ResolveAssetChunks(id); len(chunks) > 0 {
+				a.relPath = chunks[0].RelPath
+			}
+			if u, err := uuid.Parse(id); err == nil {
+				a.assetUUID = &u
+			}
+			assets = append(assets, a)
+		}
+	}
+	return info, assets, nil
+}
+
+// progressWriter reports the number of bytes written through it
+type progressWriter struct {
+	onWrite func(n int)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.onWrite(len(p))
+	return len(p), nil
+}
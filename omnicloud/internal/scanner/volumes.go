@@ -0,0 +1,317 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/omnicloud/omnicloud/internal/archive"
+	"github.com/omnicloud/omnicloud/internal/parser"
+)
+
+// PackageVolume is one directory holding all or part of a DCP delivery
+type PackageVolume struct {
+	Path  string
+	Index int // VOLINDEX number; 1 when the directory has no VOLINDEX
+}
+
+// ReadVolumeIndex returns the VOLINDEX number of a package directory (1 if absent or unreadable)
+func ReadVolumeIndex(packagePath string) int {
+	volIndexPath, err := FindVolIndexFile(packagePath)
+	if err != nil {
+		return 1
+	}
+	volIndex, err := parser.ParseVolumeIndex(volIndexPath)
+	if err != nil {
+		log.Printf("Warning: failed to parse VOLINDEX in %s: %v", packagePath, err)
+		return 1
+	}
+	return volIndex.Index
+}
+
+// GroupPackageVolumes groups discovered package directories by ASSETMAP UUID, so that the
+// volumes of a multi-volume delivery spread over several drives or library locations are
+// scanned as one package. Single-volume packages (and directories whose ASSETMAP cannot be
+// read, so ScanPackage reports the error) come back as one-element groups. Groups keep
+// discovery order; the volumes of a group are sorted by index and duplicates are dropped.
+func GroupPackageVolumes(packagePaths []string) [][]PackageVolume {
+	var groups [][]PackageVolume
+	byAssetMap := make(map[string]int)
+
+	for _, packagePath := range packagePaths {
+		vol := PackageVolume{Path: packagePath, Index: ReadVolumeIndex(packagePath)}
+
+		var assetMap *parser.AssetMap
+		assetMapPath, err := FindAssetMapFile(packagePath)
+		if err == nil {
+			assetMap, err = parser.ParseAssetMap(assetMapPath)
+		}
+		if err != nil || assetMap.VolumeCount <= 1 {
+			groups = append(groups, []PackageVolume{vol})
+			continue
+		}
+
+		key := strings.ToLower(parser.ExtractUUID(assetMap.ID))
+		if i, ok := byAssetMap[key]; ok {
+			groups[i] = append(groups[i], vol)
+			continue
+		}
+		byAssetMap[key] = len(groups)
+		groups = append(groups, []PackageVolume{vol})
+	}
+
+	for i, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(a, b int) bool { return group[a].Index < group[b].Index })
+		deduped := group[:1]
+		for _, vol := range group[1:] {
+			if vol.Index == deduped[len(deduped)-1].Index {
+				log.Printf("Warning: volume %d found twice (%s and %s), using the first", vol.Index, deduped[len(deduped)-1].Path, vol.Path)
+				continue
+			}
+			deduped = append(deduped, vol)
+		}
+		groups[i] = deduped
+	}
+
+	return groups
+}
+
+// ScanPackageVolumes scans a package made of one or more volumes. The volume with the lowest
+// index becomes the package path; CPLs and PKLs are collected from every volume present and
+// sizes are summed across volumes.
+func ScanPackageVolumes(volumes []PackageVolume) (*DCPPackageInfo, error) {
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("no volumes to scan")
+	}
+
+	info, err := ScanPackage(volumes[0].Path)
+	if err != nil {
+		return nil, err
+	}
+	info.Volumes = volumes
+
+	for _, vol := range volumes[1:] {
+		volInfo, err := ScanPackage(vol.Path)
+		if err != nil {
+			log.Printf("Warning: failed to scan volume %d of %s: %v", vol.Index, info.PackageName, err)
+			continue
+		}
+		info.CPLs = mergeCPLs(info.CPLs, volInfo.CPLs)
+		info.PKLs = mergePKLs(info.PKLs, volInfo.PKLs)
+		info.ParseErrors = append(info.ParseErrors, volInfo.ParseErrors...)
+		info.TotalSize += volInfo.TotalSize
+		info.FileCount += volInfo.FileCount
+	}
+
+	if info.ExpectedVolumes() > 1 {
+		log.Printf("Multi-volume package %s: %s", info.PackageName, info.VolumeStatus())
+	}
+
+	return info, nil
+}
+
+func mergeCPLs(into, from []*parser.CompositionPlaylist) []*parser.CompositionPlaylist {
+	for _, cpl := range from {
+		dup := false
+		for _, existing := range into {
+			if existing.ID == cpl.ID {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			into = append(into, cpl)
+		}
+	}
+	return into
+}
+
+func mergePKLs(into, from []*parser.PackingList) []*parser.PackingList {
+	for _, pkl := range from {
+		dup := false
+		for _, existing := range into {
+			if existing.ID == pkl.ID {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			into = append(into, pkl)
+		}
+	}
+	return into
+}
+
+// ExpectedVolumes returns the number of volumes declared by the ASSETMAP (at least 1)
+func (info *DCPPackageInfo) ExpectedVolumes() int {
+	if info.AssetMap == nil || info.AssetMap.VolumeCount < 1 {
+		return 1
+	}
+	return info.AssetMap.VolumeCount
+}
+
+// PresentVolumes returns the number of distinct volumes found on disk
+func (info *DCPPackageInfo) PresentVolumes() int {
+	if len(info.Volumes) == 0 {
+		return 1
+	}
+	seen := make(map[int]bool)
+	for _, vol := range info.Volumes {
+		seen[vol.Index] = true
+	}
+	return len(seen)
+}
+
+// IsComplete reports whether every volume declared by the ASSETMAP is present
+func (info *DCPPackageInfo) IsComplete() bool {
+	return info.PresentVolumes() >= info.ExpectedVolumes()
+}
+
+// VolumeStatus describes volume completeness, e.g. "complete" or "partial (2 of 3 volumes)"
+func (info *DCPPackageInfo) VolumeStatus() string {
+	if info.IsComplete() {
+		return "complete"
+	}
+	return fmt.Sprintf("partial (%d of %d volumes)", info.PresentVolumes(), info.ExpectedVolumes())
+}
+
+// packageAssetIDs returns the lower-case IDs of every asset the package's PKLs and ASSETMAP list
+func (info *DCPPackageInfo) packageAssetIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, pkl := range info.PKLs {
+		for _, a := range pkl.AssetList.Assets {
+			ids[strings.ToLower(parser.ExtractUUID(a.ID))] = true
+		}
+	}
+	if info.AssetMap != nil {
+		for _, a := range info.AssetMap.AssetList.Assets {
+			ids[strings.ToLower(parser.ExtractUUID(a.ID))] = true
+		}
+	}
+	return ids
+}
+
+// volumePath returns the directory of a present volume, or "" when it is missing
+func (info *DCPPackageInfo) volumePath(index int) string {
+	if len(info.Volumes) == 0 {
+		if index <= 1 {
+			return info.PackagePath
+		}
+		return ""
+	}
+	for _, vol := range info.Volumes {
+		if vol.Index == index {
+			return vol.Path
+		}
+	}
+	return ""
+}
+
+// AssetChunk is one chunk of an ASSETMAP asset resolved against the volumes present
+type AssetChunk struct {
+	Path        string // absolute file path; empty when the chunk's volume is missing
+	RelPath     string // path as written in the ASSETMAP
+	VolumeIndex int
+	Offset      int64 // position of the chunk within the logical asset
+	Length      int64 // 0 when the ASSETMAP omits it (the whole file)
+}
+
+// ResolveAssetChunks returns the chunks of an ASSETMAP asset in offset order.
+// Returns nil if the asset is not listed in the ASSETMAP.
+func (info *DCPPackageInfo) ResolveAssetChunks(assetID string) []AssetChunk {
+	if info.AssetMap == nil {
+		return nil
+	}
+	id := strings.ToLower(parser.ExtractUUID(assetID))
+
+	var chunks []AssetChunk
+	for _, asset := range info.AssetMap.AssetList.Assets {
+		if strings.ToLower(parser.ExtractUUID(asset.ID)) != id {
+			continue
+		}
+		for _, c := range asset.ChunkList.Chunks {
+			volumeIndex := c.VolumeIndex
+			if volumeIndex < 1 {
+				volumeIndex = 1
+			}
+			chunk := AssetChunk{
+				RelPath:     c.Path,
+				VolumeIndex: volumeIndex,
+				Offset:      c.Offset,
+				Length:      c.Length,
+			}
+			if dir := info.volumePath(volumeIndex); dir != "" {
+				chunk.Path = filepath.Join(dir, c.Path)
+			}
+			chunks = append(chunks, chunk)
+		}
+		break
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+	return chunks
+}
+
+// OpenAsset opens an ASSETMAP asset as a single logical stream, concatenating its chunks
+// across volumes. Returns the total size; a missing volume or file yields an error wrapping
+// os.ErrNotExist.
+func (info *DCPPackageInfo) OpenAsset(assetID string) (io.ReadCloser, int64, error) {
+	chunks := info.ResolveAssetChunks(assetID)
+	if len(chunks) == 0 {
+		return nil, 0, fmt.Errorf("asset %s is not listed in the ASSETMAP: %w", assetID, os.ErrNotExist)
+	}
+
+	var files multiFile
+	var readers []io.Reader
+	var total int64
+	for _, chunk := range chunks {
+		if chunk.Path == "" {
+			files.Close()
+			return nil, 0, fmt.Errorf("%s is on volume %d, which is not present: %w", chunk.RelPath, chunk.VolumeIndex, os.ErrNotExist)
+		}
+		f, err := archive.Open(chunk.Path)
+		if err != nil {
+			files.Close()
+			return nil, 0, err
+		}
+		files.files = append(files.files, f)
+
+		length := chunk.Length
+		if length <= 0 || len(chunks) == 1 {
+			stat, err := f.Stat()
+			if err != nil {
+				files.Close()
+				return nil, 0, err
+			}
+			length = stat.Size()
+		}
+		readers = append(readers, io.LimitReader(f, length))
+		total += length
+	}
+
+	files.Reader = io.MultiReader(readers...)
+	return &files, total, nil
+}
+
+// multiFile reads a sequence of chunk files and closes all of them together
+type multiFile struct {
+	io.Reader
+	files []archive.File
+}
+
+func (m *multiFile) Close() error {
+	var firstErr error
+	for _, f := range m.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,163 @@
+package torrent
+
+// ArchiveStorage is a read-only torrent storage for seeding DCPs kept in uncompressed tar
+// archives on library locations (cold storage on NAS). Every file of the torrent is a member
+// of the archive; its data is read at the member's offset in the tar file, so archived
+// packages are distributed without being extracted first.
+//
+// The package directory may be the archive root (/library/cold/FEATURE.tar) or a directory
+// inside it (/library/cold/FEATURE.tar/FEATURE_FTR); torrent file paths are relative to it.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/omnicloud/omnicloud/internal/archive"
+)
+
+// errArchiveReadOnly is returned when the torrent library tries to write to an archived package
+var errArchiveReadOnly = errors.New("archived packages are read-only")
+
+// NewArchiveStorage creates a storage ClientImpl that reads the files of a torrent from the
+// tar archive holding dataPath. completion is the piece completion tracker (PostgreSQL-backed).
+func NewArchiveStorage(dataPath string, completion storage.PieceCompletion) storage.ClientImplCloser {
+	return &archiveClientImpl{
+		dataPath:   dataPath,
+		completion: completion,
+	}
+}
+
+type archiveClientImpl struct {
+	dataPath   string
+	completion storage.PieceCompletion
+}
+
+func (a *archiveClientImpl) Close() error {
+	return a.completion.Close()
+}
+
+func (a *archiveClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	archivePath, dir, ok := archive.Split(a.dataPath)
+	if !ok {
+		return nil, fmt.Errorf("%s is not inside a tar archive", a.dataPath)
+	}
+	index, err := archive.Load(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", archivePath, err)
+	}
+
+	// Resolve every torrent file to its data in the archive once, up front
+	files := info.UpvertedFiles()
+	offsets := make([]int64, len(files))
+	for i, fi := range files {
+		name := path.Join(append([]string{dir}, fi.Path...)...)
+		m, ok := index.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("%s not found in %s", name, archivePath)
+		}
+		if m.Size != fi.Length {
+			return nil, fmt.Errorf("%s in %s has %d bytes, torrent expects %d", name, archivePath, m.Size, fi.Length)
+		}
+		offsets[i] = m.Offset
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveTorrentImpl{
+		info:       info,
+		infoHash:   infoHash,
+		file:       f,
+		files:      files,
+		offsets:    offsets,
+		completion: a.completion,
+	}, nil
+}
+
+type archiveTorrentImpl struct {
+	info       *metainfo.Info
+	infoHash   metainfo.Hash
+	file       *os.File // the tar archive, shared by all reads
+	files      []metainfo.FileInfo
+	offsets    []int64 // offset of each file's data in the archive
+	completion storage.PieceCompletion
+}
+
+func (t *archiveTorrentImpl) Piece(p metainfo.Piece) storage.PieceImpl {
+	return &archivePieceImpl{
+		torrent:      t,
+		piece:        p,
+		completionPK: metainfo.PieceKey{InfoHash: t.infoHash, Index: p.Index()},
+	}
+}
+
+func (t *archiveTorrentImpl) Close() error {
+	return t.file.Close()
+}
+
+type archivePieceImpl struct {
+	torrent      *archiveTorrentImpl
+	piece        metainfo.Piece
+	completionPK metainfo.PieceKey
+}
+
+func (p *archivePieceImpl) ReadAt(b []byte, pieceOffset int64) (int, error) {
+	// Walk the files from the absolute offset within the torrent's data stream, as
+	// splitPieceImpl does, reading each one at its position in the archive
+	absOff := p.piece.Offset() + pieceOffset
+	n := 0
+	remaining := b
+
+	for i, fi := range p.torrent.files {
+		if absOff >= fi.Length {
+			absOff -= fi.Length
+			continue
+		}
+
+		toRead := int64(len(remaining))
+		if toRead > fi.Length-absOff {
+			toRead = fi.Length - absOff
+		}
+
+		n1, err := p.torrent.file.ReadAt(remaining[:toRead], p.torrent.offsets[i]+absOff)
+		n += n1
+		remaining = remaining[n1:]
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if len(remaining) == 0 {
+			return n, nil
+		}
+		absOff = 0 // subsequent files start from offset 0
+	}
+
+	if len(remaining) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (p *archivePieceImpl) WriteAt(b []byte, pieceOffset int64) (int, error) {
+	return 0, errArchiveReadOnly
+}
+
+func (p *archivePieceImpl) MarkComplete() error {
+	p.torrent.completion.Set(p.completionPK, true)
+	return nil
+}
+
+func (p *archivePieceImpl) MarkNotComplete() error {
+	p.torrent.completion.Set(p.completionPK, false)
+	return nil
+}
+
+func (p *archivePieceImpl) Completion() storage.Completion {
+	c, err := p.torrent.completion.Get(p.completionPK)
+	return storage.Completion{Complete: c.Complete, Ok: err == nil}
+}
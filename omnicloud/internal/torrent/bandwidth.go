@@ -0,0 +1,233 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateBurst is the burst of the client's rate limiters. Uploads reserve a whole request (16 KiB)
+// at once, so it must not be smaller; larger reads are split to fit it.
+const rateBurst = 1 << 20
+
+// bandwidthRefreshInterval is how often the client fetches its bandwidth schedule again
+const bandwidthRefreshInterval = 5 * time.Minute
+
+// BandwidthWindow limits the transfer rates of a server during part of the day, e.g. to leave
+// the cinema's link to ticketing during opening hours. Limits are bytes/s; 0 means unlimited.
+type BandwidthWindow struct {
+	ID          string `json:"id,omitempty"`
+	Days        []int  `json:"days,omitempty"` // 0 = Sunday .. 6 = Saturday; empty = every day
+	Start       string `json:"start"`          // "HH:MM", local time of the server
+	End         string `json:"end"`            // exclusive; at or before Start runs past midnight
+	DownloadBps int64  `json:"download_limit_bps"`
+	UploadBps   int64  `json:"upload_limit_bps"`
+}
+
+// BandwidthSchedule is a server's bandwidth calendar: the limits of the first window a moment
+// falls in apply, the default limits outside every window. "Unlimited 00:00-08:00, 5 MB/s
+// otherwise" is a default download limit of 5000000 with one unlimited 00:00-08:00 window.
+type BandwidthSchedule struct {
+	Timezone    string            `json:"timezone,omitempty"` // IANA name; empty = local time of the server
+	DownloadBps int64             `json:"download_limit_bps"`
+	UploadBps   int64             `json:"upload_limit_bps"`
+	Windows     []BandwidthWindow `json:"windows"`
+}
+
+// ParseClock parses a "HH:MM" time of day into minutes after midnight ("24:00" is midnight at
+// the end of the day)
+func ParseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// FormatClock formats minutes after midnight as "HH:MM"
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// Validate checks the schedule's time zone, windows and limits
+func (s *BandwidthSchedule) Validate() error {
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", s.Timezone)
+		}
+	}
+	if s.DownloadBps < 0 || s.UploadBps < 0 {
+		return fmt.Errorf("rate limits must not be negative")
+	}
+	for i, w := range s.Windows {
+		if _, err := ParseClock(w.Start); err != nil {
+			return fmt.Errorf("window %d: %v", i+1, err)
+		}
+		if _, err := ParseClock(w.End); err != nil {
+			return fmt.Errorf("window %d: %v", i+1, err)
+		}
+		for _, d := range w.Days {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("window %d: day %d is not 0 (Sunday) to 6 (Saturday)", i+1, d)
+			}
+		}
+		if w.DownloadBps < 0 || w.UploadBps < 0 {
+			return fmt.Errorf("window %d: rate limits must not be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// location returns the time zone the schedule's windows are in
+func (s *BandwidthSchedule) location() *time.Location {
+	if s.Timezone != "" {
+		if loc, err := time.LoadLocation(s.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// Limits returns the download and upload limits (bytes/s, 0 = unlimited) in force at t
+func (s *BandwidthSchedule) Limits(t time.Time) (download, upload int64) {
+	if s == nil {
+		return 0, 0
+	}
+	t = t.In(s.location())
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	for _, w := range s.Windows {
+		if w.contains(day, minute) {
+			return w.DownloadBps, w.UploadBps
+		}
+	}
+	return s.DownloadBps, s.UploadBps
+}
+
+// contains reports whether a minute of a day falls in the window. A window running past
+// midnight belongs to the day it starts on.
+func (w BandwidthWindow) contains(day, minute int) bool {
+	start, err := ParseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(w.End)
+	if err != nil {
+		return false
+	}
+	if start < end {
+		return w.onDay(day) && minute >= start && minute < end
+	}
+	// Past midnight (or all day when start == end)
+	if minute >= start {
+		return w.onDay(day)
+	}
+	return minute < end && w.onDay((day+6)%7)
+}
+
+func (w BandwidthWindow) onDay(day int) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateCompletion predicts when remaining bytes arrive when the transfer runs at speed
+// (bytes/s) wherever the schedule allows it and at the schedule's download limit where that is
+// lower. The limits are stepped through a quarter of an hour at a time. Returns false when no
+// speed is known or the transfer would take longer than 60 days.
+func (s *BandwidthSchedule) EstimateCompletion(now time.Time, remaining, speed int64) (time.Time, bool) {
+	if remaining <= 0 {
+		return now, true
+	}
+	if speed <= 0 {
+		return time.Time{}, false
+	}
+	const step = 15 * time.Minute
+	left := float64(remaining)
+	t := now
+	for t.Sub(now) < 60*24*time.Hour {
+		bps := float64(speed)
+		if limit, _ := s.Limits(t); limit > 0 && float64(limit) < bps {
+			bps = float64(limit)
+		}
+		chunk := bps * step.Seconds()
+		if chunk >= left {
+			return t.Add(time.Duration(left / bps * float64(time.Second))), true
+		}
+		left -= chunk
+		t = t.Add(step)
+	}
+	return time.Time{}, false
+}
+
+// BandwidthScheduleSource returns the current bandwidth schedule of this server (nil for none)
+type BandwidthScheduleSource func() (*BandwidthSchedule, error)
+
+// toLimit converts a bytes/s limit (0 = unlimited) into a rate limiter limit
+func toLimit(bps int64) rate.Limit {
+	if bps <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bps)
+}
+
+// applyRateLimits sets the client-wide download and upload limits (bytes/s, 0 = unlimited)
+func (c *Client) applyRateLimits(download, upload int64) {
+	c.downloadLimiter.SetLimit(toLimit(download))
+	c.uploadLimiter.SetLimit(toLimit(upload))
+}
+
+// RunBandwidthSchedule applies the server's bandwidth schedule to all torrents until ctx is
+// cancelled: the schedule is fetched from source every few minutes and the limits in force are
+// re-evaluated every 30 seconds. When the schedule cannot be fetched the last one stays in force.
+func (c *Client) RunBandwidthSchedule(ctx context.Context, source BandwidthScheduleSource) {
+	var schedule *BandwidthSchedule
+	var fetchedAt time.Time
+	lastDown, lastUp := int64(-1), int64(-1)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		if fetchedAt.IsZero() || time.Since(fetchedAt) >= bandwidthRefreshInterval {
+			if s, err := source(); err != nil {
+				log.Printf("[bandwidth] Failed to fetch bandwidth schedule: %v", err)
+			} else {
+				schedule = s
+			}
+			fetchedAt = time.Now()
+		}
+
+		down, up := schedule.Limits(time.Now())
+		if down != lastDown || up != lastUp {
+			c.applyRateLimits(down, up)
+			log.Printf("[bandwidth] Rate limits now: download %s, upload %s", formatRate(down), formatRate(up))
+			lastDown, lastUp = down, up
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// formatRate formats a bytes/s limit for logging
+func formatRate(bps int64) string {
+	if bps <= 0 {
+		return "unlimited"
+	}
+	return formatBytes(bps) + "/s"
+}
@@ -18,6 +18,8 @@ import (
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
 	"github.com/google/uuid"
+	"github.com/omnicloud/omnicloud/internal/archive"
+	"golang.org/x/time/rate"
 )
 
 // speedSample tracks cumulative byte counters for speed calculation
@@ -52,6 +54,10 @@ type Client struct {
 
 	// Error reporting callback (set by TransferProcessor on client mode)
 	errorReporter TransferErrorReporter
+
+	// Client-wide rate limits, adjusted by the bandwidth schedule
+	downloadLimiter *rate.Limiter
+	uploadLimiter   *rate.Limiter
 }
 
 // ActiveTorrent represents a torrent being seeded or downloaded
@@ -110,6 +116,10 @@ type TorrentStats struct {
 // trackerAnnounceURL is the full external tracker URL (e.g. "http://dcp1.example.com:10851/announce").
 // It is used to fix .torrent files that were generated with a port-0 announce URL.
 func NewClient(cfg *torrent.ClientConfig, db *sql.DB, serverID, completionDir, scanPath, trackerAnnounceURL string, trackerPort int) (*Client, error) {
+	// Unlimited until a bandwidth schedule says otherwise; the limiters are changed in place
+	cfg.DownloadRateLimiter = rate.NewLimiter(rate.Inf, rateBurst)
+	cfg.UploadRateLimiter = rate.NewLimiter(rate.Inf, rateBurst)
+
 	cl, err := torrent.NewClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create torrent client: %w", err)
@@ -130,6 +140,8 @@ func NewClient(cfg *torrent.ClientConfig, db *sql.DB, serverID, completionDir, s
 		trackerAnnounceURL: trackerAnnounceURL,
 		torrents:           make(map[string]*ActiveTorrent),
 		speedSamples:       make(map[string]speedSample),
+		downloadLimiter:    cfg.DownloadRateLimiter,
+		uploadLimiter:      cfg.UploadRateLimiter,
 	}, nil
 }
 
@@ -254,13 +266,13 @@ func (c *Client) StartSeeding(torrentBytes []byte, dataPath, packageID, torrentI
 	// so the torrent client can find the data files on disk.
 	// dataPath is e.g. /APPBOX_DATA/storage/DCP/TESTLIBRARY/PackageName
 	// The torrent info.Name matches the directory name, so parent dir is the base.
-	parentDir := filepath.Dir(dataPath)
-
+	// Packages inside a tar archive are read in place from the archive instead.
+	//
 	// Use PostgreSQL for piece completion tracking instead of BoltDB.
 	// This avoids file locking issues when starting many torrents simultaneously,
 	// AND persists verification results across restarts (huge startup speedup for large DCPs).
 	completion := NewPostgresPieceCompletion(c.db, mi.HashInfoBytes())
-	torrentStorage := storage.NewFileWithCompletion(parentDir, completion)
+	torrentStorage := seedingStorage(dataPath, completion)
 
 	// Use localhost announce URL so the server can reach its own tracker
 	announceURL := c.localAnnounceURL(mi.Announce)
@@ -326,6 +338,15 @@ func (c *Client) StartSeeding(torrentBytes []byte, dataPath, packageID, torrentI
 	return c.registerSeeder(torrentID, dataPath, "seeding")
 }
 
+// seedingStorage returns the storage for a torrent whose data is at dataPath: the files under
+// its parent directory, or the tar archive holding it for archived packages
+func seedingStorage(dataPath string, completion storage.PieceCompletion) storage.ClientImplCloser {
+	if archive.Contains(dataPath) {
+		return NewArchiveStorage(dataPath, completion)
+	}
+	return storage.NewFileWithCompletion(filepath.Dir(dataPath), completion)
+}
+
 // SwitchSeedingPath drops a seeding torrent and re-adds it with a new data path.
 // Used when RosettaBridge ingests a DCP and the files move to a new location.
 // Piece completion data in PostgreSQL is keyed by (info_hash, piece_index), not path,
@@ -451,8 +472,10 @@ func (c *Client) StartSeedingWithSplitPath(torrentBytes []byte, mxfPath, xmlShad
 	return c.registerSeeder(torrentID, mxfPath, "seeding")
 }
 
-// StartDownload starts downloading a DCP via torrent
-func (c *Client) StartDownload(torrentBytes []byte, destPath, packageID, transferID string) error {
+// StartDownload starts downloading a DCP via torrent. localAssets are files this server
+// already holds in other packages; they are linked into the package and verified from disk
+// instead of downloaded.
+func (c *Client) StartDownload(torrentBytes []byte, destPath, packageID, transferID string, localAssets []LocalAsset) error {
 	log.Printf("[download] StartDownload called: packageID=%s transferID=%s dest=%s torrentBytes=%d",
 		packageID, transferID, destPath, len(torrentBytes))
 
@@ -564,6 +587,8 @@ func (c *Client) StartDownload(torrentBytes []byte, destPath, packageID, transfe
 	}
 	log.Printf("[download] %s: pre-created download directories under %s", infoHash[:12], parentDir)
 
+	linkedPieces := linkLocalAssets(t.Info(), dcpDir, localAssets)
+
 	// Store active torrent BEFORE setting up the error handler (handler references at)
 	at := &ActiveTorrent{
 		Torrent:       t,
@@ -652,8 +677,15 @@ func (c *Client) StartDownload(torrentBytes []byte, destPath, packageID, transfe
 		t.AllowDataDownload()
 	})
 
-	// Download all files
-	t.DownloadAll()
+	// Download all files. Pieces of linked files are verified first so they are not requested.
+	if len(linkedPieces) > 0 {
+		go func() {
+			verifyLinkedPieces(t, infoHash, linkedPieces)
+			t.DownloadAll()
+		}()
+	} else {
+		t.DownloadAll()
+	}
 
 	log.Printf("[download] %s: download started successfully, launching monitor goroutine", infoHash)
 
@@ -1334,7 +1366,7 @@ func (c *Client) SeedExisting() {
 		FROM dcp_torrents t
 		JOIN dcp_packages dp ON dp.id = t.package_id
 		JOIN server_dcp_inventory inv ON inv.package_id = t.package_id AND inv.server_id = $1
-		WHERE t.torrent_file IS NOT NULL
+		WHERE t.torrent_file IS NOT NULL AND inv.status <> 'quarantined'
 		ORDER BY t.created_at ASC
 	`
 
@@ -1426,7 +1458,7 @@ func (c *Client) ResumeDownloads() {
 		log.Printf("[resume-downloads] Found transfer %s: package=%q status=%s downloaded=%d bytes -> %s (torrent_file=%d bytes)",
 			transferID, packageName, status, downloadedBytes, destPath, len(torrentFile))
 
-		err := c.StartDownload(torrentFile, destPath, packageID, transferID)
+		err := c.StartDownload(torrentFile, destPath, packageID, transferID, nil)
 		if err != nil {
 			log.Printf("[resume-downloads] Failed to resume %s: %v", transferID, err)
 			failed++
@@ -1529,7 +1561,7 @@ func (c *Client) checkFileIntegrity() {
 		}
 
 		// Check if the data directory exists
-		if _, err := os.Stat(at.LocalPath); err != nil {
+		if _, err := archive.Stat(at.LocalPath); err != nil {
 			if !os.IsNotExist(err) {
 				continue
 			}
@@ -1628,9 +1660,8 @@ func (c *Client) reverifyTorrent(at *ActiveTorrent) {
 	t.Drop()
 
 	// Re-add with fresh storage
-	parentDir := filepath.Dir(at.LocalPath)
 	completion := NewPostgresPieceCompletion(c.db, t.InfoHash())
-	torrentStorage := storage.NewFileWithCompletion(parentDir, completion)
+	torrentStorage := seedingStorage(at.LocalPath, completion)
 
 	newT, _, err := c.client.AddTorrentSpec(&torrent.TorrentSpec{
 		InfoHash:  t.InfoHash(),
@@ -17,6 +17,7 @@ import (
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/google/uuid"
+	"github.com/omnicloud/omnicloud/internal/archive"
 )
 
 // Generator handles torrent file creation for DCPs
@@ -84,7 +85,7 @@ func (g *Generator) GenerateTorrent(ctx context.Context, packagePath, packageID,
 			return nil, "", fmt.Errorf("failed to get relative path: %w", err)
 		}
 		
-		fileInfo, err := os.Stat(f)
+		fileInfo, err := archive.Stat(f)
 		if err != nil {
 			return nil, "", fmt.Errorf("failed to stat file %s: %w", f, err)
 		}
@@ -95,8 +96,9 @@ func (g *Generator) GenerateTorrent(ctx context.Context, packagePath, packageID,
 		})
 	}
 
-	// Set torrent name to package directory name
-	info.Name = filepath.Base(packagePath)
+	// Set torrent name to package directory name (the archive name for a package at the
+	// root of a tar archive)
+	info.Name = archive.Name(packagePath)
 
 	// Generate pieces by hashing files (pass totalSize for within-file progress)
 	err = g.generatePieces(&info, packagePath, packageID, serverID, totalSize)
@@ -152,7 +154,7 @@ func (g *Generator) calculateDirectorySize(path string) (int64, int, error) {
 	var totalSize int64
 	var fileCount int
 
-	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+	err := archive.Walk(path, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -184,7 +186,7 @@ func (g *Generator) calculatePieceSize(totalSize int64) int {
 func (g *Generator) collectFiles(root string) ([]string, error) {
 	var files []string
 
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	err := archive.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -466,7 +468,7 @@ func (g *Generator) generatePieces(info *metainfo.Info, basePath, packageID, ser
 		fileName := file.DisplayPath(info)
 
 		filePath := filepath.Join(basePath, fileName)
-		f, err := os.Open(filePath)
+		f, err := archive.Open(filePath)
 		if err != nil {
 			readErr = fmt.Errorf("failed to open file %s: %w", filePath, err)
 			break
@@ -0,0 +1,162 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ficlone is the Linux FICLONE ioctl, which makes dst share src's extents (a reflink)
+const ficlone = 0x40049409
+
+// LocalAsset is a file of a package being downloaded that this server already holds with the
+// same content (same PKL hash and size) in another package. The main server lists them with
+// the pending transfer; they are linked into the new package instead of downloaded.
+type LocalAsset struct {
+	AssetUUID  string `json:"asset_uuid"`
+	FilePath   string `json:"file_path"`   // ASSETMAP path of the file in the new package
+	SourcePath string `json:"source_path"` // the identical file in the other package
+	SizeBytes  int64  `json:"size_bytes"`
+	Hash       string `json:"hash"`
+}
+
+// linkLocalAssets links the files this server already holds into the package directory of a
+// torrent being downloaded and returns the pieces that lie entirely within linked files
+func linkLocalAssets(info *metainfo.Info, dcpDir string, assets []LocalAsset) []int {
+	if len(assets) == 0 {
+		return nil
+	}
+	byPath := make(map[string]LocalAsset)
+	for _, a := range assets {
+		byPath[path.Clean(filepath.ToSlash(a.FilePath))] = a
+	}
+
+	// Mark the byte ranges of the torrent data stream that are linked
+	type span struct{ start, end int64 }
+	var linked []span
+	var linkedBytes int64
+	var offset int64
+	for _, fi := range info.UpvertedFiles() {
+		start := offset
+		offset += fi.Length
+
+		rel := path.Clean(strings.Join(fi.Path, "/"))
+		a, ok := byPath[rel]
+		if !ok || a.SizeBytes != fi.Length {
+			continue
+		}
+		dest := filepath.Join(dcpDir, filepath.FromSlash(rel))
+		method, err := linkFile(a.SourcePath, dest, fi.Length)
+		if err != nil {
+			log.Printf("[download] Not linking %s from %s: %v", rel, a.SourcePath, err)
+			continue
+		}
+		if method != "" {
+			log.Printf("[download] Linked %s from %s (%s, %s)", rel, a.SourcePath, method, formatBytes(fi.Length))
+		}
+		linked = append(linked, span{start, offset})
+		linkedBytes += fi.Length
+	}
+	if len(linked) == 0 {
+		return nil
+	}
+
+	// A piece can be verified from disk when linked files cover all of it
+	var pieces []int
+	for i := 0; i < info.NumPieces(); i++ {
+		p := info.Piece(i)
+		start, end := p.Offset(), p.Offset()+p.Length()
+		var covered int64
+		for _, s := range linked {
+			lo, hi := s.start, s.end
+			if lo < start {
+				lo = start
+			}
+			if hi > end {
+				hi = end
+			}
+			if hi > lo {
+				covered += hi - lo
+			}
+		}
+		if covered == end-start {
+			pieces = append(pieces, i)
+		}
+	}
+	log.Printf("[download] %s already held in other packages: %d file(s), %d piece(s) to verify from disk",
+		formatBytes(linkedBytes), len(linked), len(pieces))
+	return pieces
+}
+
+// linkFile makes dest hold the content of src without copying it: a reflink where the
+// filesystem supports them (the files stay independent), a hardlink otherwise. Both need
+// src and dest on the same filesystem. Returns "" when dest is already there at full size.
+func linkFile(src, dest string, size int64) (string, error) {
+	if fi, err := os.Stat(dest); err == nil {
+		if fi.Size() == size {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() != size {
+		return "", fmt.Errorf("source has %d bytes, expected %d", fi.Size(), size)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+
+	if err := reflink(src, dest); err == nil {
+		return "reflink", nil
+	}
+	if err := os.Link(src, dest); err != nil {
+		return "", err
+	}
+	return "hardlink", nil
+}
+
+// reflink clones src into a new file dest
+func reflink(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	out.Close()
+	if errno != 0 {
+		os.Remove(dest)
+		return errno
+	}
+	return nil
+}
+
+// verifyLinkedPieces hashes the pieces covered by linked files that are not complete yet, so
+// the torrent marks them complete instead of downloading them
+func verifyLinkedPieces(t *torrent.Torrent, infoHash string, pieces []int) {
+	verified := 0
+	for _, i := range pieces {
+		if t.PieceState(i).Complete {
+			continue
+		}
+		t.Piece(i).VerifyData()
+		if t.PieceState(i).Complete {
+			verified++
+		}
+	}
+	log.Printf("[download] %s: %d of %d linked piece(s) verified from disk", infoHash[:12], verified, len(pieces))
+}
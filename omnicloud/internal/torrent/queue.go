@@ -200,8 +200,9 @@ func (qm *QueueManager) resetStaleGeneratingItems() {
 }
 
 // markUnpickableQueuedItemsAsFailed marks queued items that have no server_dcp_inventory
-// entry (so getNextQueuedItem would never return them) as failed with a specific error
-// per package so the user sees the real reason (which package, and why it can't be hashed).
+// entry, or only a quarantined one (so getNextQueuedItem would never return them), as failed
+// with a specific error per package so the user sees the real reason (which package, and why
+// it can't be hashed).
 // Returns the number of items marked failed.
 func (qm *QueueManager) markUnpickableQueuedItemsAsFailed() int64 {
 	selQuery := `
@@ -213,6 +214,7 @@ func (qm *QueueManager) markUnpickableQueuedItemsAsFailed() int64 {
 		  AND NOT EXISTS (
 		    SELECT 1 FROM server_dcp_inventory inv
 		    WHERE inv.package_id = tq.package_id AND inv.server_id = tq.server_id
+		      AND inv.status <> 'quarantined'
 		  )
 	`
 	rows, err := qm.db.Query(selQuery, qm.serverID)
@@ -418,7 +420,7 @@ func (qm *QueueManager) getNextQueuedItem() (*QueueItem, error) {
 		FROM torrent_queue tq
 		JOIN dcp_packages dp ON tq.package_id = dp.id
 		JOIN server_dcp_inventory inv ON inv.package_id = tq.package_id AND inv.server_id = tq.server_id
-		WHERE tq.server_id = $1 AND tq.status = 'queued'
+		WHERE tq.server_id = $1 AND tq.status = 'queued' AND inv.status <> 'quarantined'
 		ORDER BY COALESCE(dp.total_size_bytes, 0) ASC, tq.queued_at ASC
 		LIMIT 1
 		FOR UPDATE OF tq SKIP LOCKED
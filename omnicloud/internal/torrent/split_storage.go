@@ -26,6 +26,7 @@ import (
 
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/omnicloud/omnicloud/internal/archive"
 )
 
 // NewSplitPathStorage creates a storage ClientImpl that reads:
@@ -147,7 +148,7 @@ func (p *splitPieceImpl) readFromFiles(b []byte, absOff int64) (int, error) {
 		}
 
 		fpath := p.torrent.resolveFile(fi)
-		f, err := os.OpenFile(fpath, os.O_RDONLY, 0)
+		f, err := archive.Open(fpath)
 		if err != nil {
 			return n, fmt.Errorf("open %s: %w", fpath, err)
 		}
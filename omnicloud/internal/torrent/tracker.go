@@ -54,9 +54,10 @@ type Tracker struct {
 
 // Swarm represents peers for a single torrent
 type Swarm struct {
-	InfoHash string
-	Peers    map[string]*Peer // key: peer_id
-	mu       sync.RWMutex
+	InfoHash  string
+	Peers     map[string]*Peer // key: peer_id
+	Completed int64            // "completed" events ever announced (scrape "downloaded")
+	mu        sync.RWMutex
 }
 
 // Peer represents a peer in a swarm
@@ -64,10 +65,19 @@ type Peer struct {
 	PeerID     string
 	IP         string
 	Port       int
-	Uploaded   int64
+	Uploaded   int64 // as announced, i.e. since the peer's session started
 	Downloaded int64
 	Left       int64
 	LastSeen   time.Time
+
+	// Over every session of the peer (kept in the database)
+	TotalUploaded   int64
+	TotalDownloaded int64
+	FirstSeen       time.Time
+
+	// restoredUntil keeps a peer restored from the database in its swarm until then, so it has
+	// time to re-announce after a restart
+	restoredUntil time.Time
 }
 
 // AnnounceResponse is the tracker response to an announce request
@@ -82,6 +92,20 @@ type AnnounceResponse struct {
 	RelayPort int    `bencode:"relay-port,omitempty"`
 }
 
+// ScrapeFile is the state of one torrent in a scrape response (BEP 48)
+type ScrapeFile struct {
+	Complete   int   `bencode:"complete"`   // Seeders
+	Incomplete int   `bencode:"incomplete"` // Leechers
+	Downloaded int64 `bencode:"downloaded"` // Times a peer completed the torrent
+}
+
+// ScrapeResponse is the tracker response to a scrape request. Files is keyed by the 20-byte
+// binary info hash.
+type ScrapeResponse struct {
+	Files         map[string]ScrapeFile `bencode:"files,omitempty"`
+	FailureReason string                `bencode:"failure reason,omitempty"`
+}
+
 // PeerCompact represents a peer in compact format
 type PeerCompact struct {
 	IP   [4]byte
@@ -98,6 +122,10 @@ type PeerSnapshot struct {
 	Left       int64     `json:"left"`
 	LastSeen   time.Time `json:"last_seen"`
 	IsSeeder   bool      `json:"is_seeder"`
+
+	TotalUploaded   int64     `json:"total_uploaded"`
+	TotalDownloaded int64     `json:"total_downloaded"`
+	FirstSeen       time.Time `json:"first_seen"`
 }
 
 // SwarmSnapshot is a read-only view of a tracker swarm.
@@ -106,6 +134,7 @@ type SwarmSnapshot struct {
 	Seeders      int            `json:"seeders"`
 	Leechers     int            `json:"leechers"`
 	PeersCount   int            `json:"peers_count"`
+	Completed    int64          `json:"completed"`
 	LastAnnounce *time.Time     `json:"last_announce,omitempty"`
 	Peers        []PeerSnapshot `json:"peers"`
 }
@@ -153,6 +182,11 @@ func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Path == "/scrape" {
+		t.HandleScrape(w, r)
+		return
+	}
+
 	// Only handle /announce endpoint
 	if r.URL.Path != "/announce" {
 		http.Error(w, "Not found", http.StatusNotFound)
@@ -235,39 +269,51 @@ func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (t *Tracker) handleAnnounce(infoHash, peerID, ip string, port int, uploaded, downloaded, left int64, event string) *AnnounceResponse {
 	// Get or create swarm
 	t.mu.Lock()
-	swarm, exists := t.swarms[infoHash]
-	if !exists {
-		swarm = &Swarm{
-			InfoHash: infoHash,
-			Peers:    make(map[string]*Peer),
-		}
-		t.swarms[infoHash] = swarm
-	}
+	swarm := t.swarm(infoHash)
 	t.mu.Unlock()
 
 	// Handle peer
 	swarm.mu.Lock()
-	defer swarm.mu.Unlock()
 
+	if event == "completed" {
+		swarm.Completed++
+	}
+
+	var saved Peer // state to persist once the swarm is unlocked
 	if event == "stopped" {
 		// Remove peer
 		delete(swarm.Peers, peerID)
 	} else {
 		// Add or update peer
+		now := time.Now()
 		peer, exists := swarm.Peers[peerID]
 		if !exists {
 			peer = &Peer{
-				PeerID: peerID,
-				IP:     ip,
-				Port:   port,
+				PeerID:    peerID,
+				IP:        ip,
+				Port:      port,
+				FirstSeen: now,
 			}
 			swarm.Peers[peerID] = peer
 		}
 
+		// The announced counters restart from zero with every session of the peer
+		if uploaded >= peer.Uploaded {
+			peer.TotalUploaded += uploaded - peer.Uploaded
+		} else {
+			peer.TotalUploaded += uploaded
+		}
+		if downloaded >= peer.Downloaded {
+			peer.TotalDownloaded += downloaded - peer.Downloaded
+		} else {
+			peer.TotalDownloaded += downloaded
+		}
+
 		peer.Uploaded = uploaded
 		peer.Downloaded = downloaded
 		peer.Left = left
-		peer.LastSeen = time.Now()
+		peer.LastSeen = now
+		saved = *peer
 	}
 
 	// Count seeders and leechers and build peer list in compact format
@@ -315,6 +361,7 @@ func (t *Tracker) handleAnnounce(infoHash, peerID, ip string, port int, uploaded
 		"peers_returned": len(peerList) / 6, "peer_ips": peerIPsIncluded,
 	})
 	// #endregion
+	swarm.mu.Unlock()
 
 	resp := &AnnounceResponse{
 		Interval:   t.interval,
@@ -329,9 +376,73 @@ func (t *Tracker) handleAnnounce(infoHash, peerID, ip string, port int, uploaded
 		resp.RelayPort = t.relayPort
 	}
 
+	// Persist without holding the swarm, so other announces of the torrent do not wait on the database
+	if event == "completed" {
+		t.saveCompleted(infoHash, swarm)
+	}
+	if event == "stopped" {
+		t.stopPeer(infoHash, peerID, uploaded, downloaded, left)
+	} else {
+		t.savePeer(infoHash, swarm, saved)
+	}
+
 	return resp
 }
 
+// HandleScrape answers a scrape request (BEP 48) with the seeders, leechers and completions of
+// the torrents named by the info_hash parameters, or of every torrent when there is none
+func (t *Tracker) HandleScrape(w http.ResponseWriter, r *http.Request) {
+	response := &ScrapeResponse{Files: make(map[string]ScrapeFile)}
+
+	rawHashes := r.URL.Query()["info_hash"]
+	if len(rawHashes) == 0 {
+		t.mu.RLock()
+		for hash := range t.swarms {
+			rawHashes = append(rawHashes, hash)
+		}
+		t.mu.RUnlock()
+		for _, hash := range rawHashes {
+			if b, err := hex.DecodeString(hash); err == nil {
+				response.Files[string(b)] = t.scrapeFile(hash)
+			}
+		}
+	} else {
+		for _, raw := range rawHashes {
+			infoHashBytes, err := parseInfoHash(raw)
+			if err != nil {
+				response = &ScrapeResponse{FailureReason: "Invalid info_hash"}
+				break
+			}
+			response.Files[string(infoHashBytes)] = t.scrapeFile(hex.EncodeToString(infoHashBytes))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	bencode.NewEncoder(w).Encode(response)
+}
+
+// scrapeFile returns the scrape counts of a torrent; all zero when the tracker does not know it
+func (t *Tracker) scrapeFile(infoHash string) ScrapeFile {
+	t.mu.RLock()
+	swarm, exists := t.swarms[infoHash]
+	t.mu.RUnlock()
+	if !exists {
+		return ScrapeFile{}
+	}
+
+	swarm.mu.RLock()
+	defer swarm.mu.RUnlock()
+	file := ScrapeFile{Downloaded: swarm.Completed}
+	for _, p := range swarm.Peers {
+		if p.Left == 0 {
+			file.Complete++
+		} else {
+			file.Incomplete++
+		}
+	}
+	return file
+}
+
 func (t *Tracker) logAnnounceAttempt(infoHash, peerID, ip string, port int, event, status, failureReason string) {
 	if t.db == nil {
 		return
@@ -543,14 +654,19 @@ func (t *Tracker) Start(addr string) error {
 	return http.ListenAndServe(addr, t)
 }
 
+// peerTimeout is how long a peer stays in its swarm without announcing
+const peerTimeout = 10 * time.Minute
+
 // cleanupPeers removes peers that haven't announced in a while
 func (t *Tracker) cleanupPeers() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		timeout := time.Now().Add(-10 * time.Minute)
+		now := time.Now()
+		timeout := now.Add(-peerTimeout)
 		removed := 0
+		expired := make(map[string][]string)
 		totalPeers := 0
 		totalSwarms := 0
 
@@ -560,7 +676,7 @@ func (t *Tracker) cleanupPeers() {
 			swarm.mu.Lock()
 			totalPeers += len(swarm.Peers)
 			for peerID, peer := range swarm.Peers {
-				if peer.LastSeen.Before(timeout) {
+				if peer.LastSeen.Before(timeout) && now.After(peer.restoredUntil) {
 					role := "leecher"
 					if peer.Left == 0 {
 						role = "SEEDER"
@@ -568,6 +684,7 @@ func (t *Tracker) cleanupPeers() {
 					log.Printf("[TRACKER] cleanupPeers: removing stale %s %s from swarm %s...%s (ip=%s:%d, lastSeen=%s ago)",
 						role, peerID, hash[:8], hash[len(hash)-4:], peer.IP, peer.Port, time.Since(peer.LastSeen).Round(time.Second))
 					delete(swarm.Peers, peerID)
+					expired[hash] = append(expired[hash], peerID)
 					removed++
 				}
 			}
@@ -575,11 +692,18 @@ func (t *Tracker) cleanupPeers() {
 		}
 		t.mu.RUnlock()
 
+		for hash, peerIDs := range expired {
+			t.expirePeers(hash, peerIDs, timeout)
+		}
+
 		log.Printf("[TRACKER] cleanupPeers: checked %d swarms, %d total peers, removed %d stale", totalSwarms, totalPeers, removed)
 		if removed > 0 {
 			// Dump swarms after cleanup so we can see the resulting state
 			t.DumpSwarms()
 		}
+
+		t.sampleSwarms()
+		t.pruneHistory()
 	}
 }
 
@@ -652,6 +776,7 @@ func (t *Tracker) GetSnapshot() TrackerSnapshot {
 			InfoHash:   hash,
 			Peers:      make([]PeerSnapshot, 0, len(swarm.Peers)),
 			PeersCount: len(swarm.Peers),
+			Completed:  swarm.Completed,
 		}
 		var latest time.Time
 		for _, peer := range swarm.Peers {
@@ -673,6 +798,10 @@ func (t *Tracker) GetSnapshot() TrackerSnapshot {
 				Left:       peer.Left,
 				LastSeen:   peer.LastSeen,
 				IsSeeder:   isSeeder,
+
+				TotalUploaded:   peer.TotalUploaded,
+				TotalDownloaded: peer.TotalDownloaded,
+				FirstSeen:       peer.FirstSeen,
 			})
 		}
 		swarm.mu.RUnlock()
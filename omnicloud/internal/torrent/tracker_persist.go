@@ -0,0 +1,265 @@
+package torrent
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// swarmRestoreMaxAge is how long ago a peer may have announced to be restored at startup
+	swarmRestoreMaxAge = 24 * time.Hour
+
+	// swarmRestoreGrace is how long a restored peer stays in its swarm without re-announcing
+	swarmRestoreGrace = 15 * time.Minute
+
+	// swarmSampleRetention is how long swarm health samples are kept
+	swarmSampleRetention = 30 * 24 * time.Hour
+
+	// trackerPeerRetention is how long the counters of a peer that stopped announcing are kept
+	trackerPeerRetention = 90 * 24 * time.Hour
+)
+
+// RestoreSwarms loads the peers that were in the tracker's swarms when it last ran, and the
+// completion counts of every torrent. Only peers that announced within peerTimeout of the last
+// announce the tracker handled are restored; older ones would have been dropped had it kept
+// running. Restored peers are handed out to other peers for swarmRestoreGrace; peers that do not
+// re-announce by then are dropped as usual. Call it before the tracker starts serving.
+func (t *Tracker) RestoreSwarms() error {
+	if t.db == nil {
+		return nil
+	}
+
+	// The last announce approximates when the tracker stopped
+	var lastAnnounce *time.Time
+	if err := t.db.QueryRow(`SELECT MAX(last_seen) FROM tracker_peers WHERE stopped_at IS NULL`).Scan(&lastAnnounce); err != nil {
+		return err
+	}
+	since := time.Now().Add(-swarmRestoreMaxAge)
+	if lastAnnounce != nil && lastAnnounce.Add(-peerTimeout).After(since) {
+		since = lastAnnounce.Add(-peerTimeout)
+	}
+
+	rows, err := t.db.Query(`
+		SELECT info_hash, peer_id, ip, port, uploaded, downloaded, left_bytes,
+		       total_uploaded, total_downloaded, first_seen, last_seen
+		FROM tracker_peers
+		WHERE stopped_at IS NULL AND last_seen > $1`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	restoredUntil := time.Now().Add(swarmRestoreGrace)
+	peers := 0
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for rows.Next() {
+		var infoHash string
+		p := &Peer{restoredUntil: restoredUntil}
+		if err := rows.Scan(&infoHash, &p.PeerID, &p.IP, &p.Port, &p.Uploaded, &p.Downloaded, &p.Left,
+			&p.TotalUploaded, &p.TotalDownloaded, &p.FirstSeen, &p.LastSeen); err != nil {
+			return err
+		}
+		t.swarm(infoHash).Peers[p.PeerID] = p
+		peers++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	statRows, err := t.db.Query(`SELECT info_hash, completed_count FROM tracker_torrent_stats`)
+	if err != nil {
+		return err
+	}
+	defer statRows.Close()
+	for statRows.Next() {
+		var infoHash string
+		var completed int64
+		if err := statRows.Scan(&infoHash, &completed); err != nil {
+			return err
+		}
+		t.swarm(infoHash).Completed = completed
+	}
+	if err := statRows.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("[TRACKER] Restored %d peer(s) in %d swarm(s); they are kept for %s unless they re-announce",
+		peers, len(t.swarms), swarmRestoreGrace)
+	return nil
+}
+
+// swarm returns the swarm of a torrent, creating it if needed. t.mu must be held for writing.
+func (t *Tracker) swarm(infoHash string) *Swarm {
+	swarm, exists := t.swarms[infoHash]
+	if !exists {
+		swarm = &Swarm{
+			InfoHash: infoHash,
+			Peers:    make(map[string]*Peer),
+		}
+		t.swarms[infoHash] = swarm
+	}
+	return swarm
+}
+
+// savePeer stores a peer's swarm membership after an announce and takes its cumulative counters
+// from the database, which also counts the sessions before the tracker last restarted. p is a
+// copy of the peer; the swarm's lock must not be held.
+func (t *Tracker) savePeer(infoHash string, swarm *Swarm, p Peer) {
+	if t.db == nil {
+		return
+	}
+	var totalUploaded, totalDownloaded int64
+	var firstSeen time.Time
+	err := t.db.QueryRow(`
+		INSERT INTO tracker_peers (info_hash, peer_id, ip, port, uploaded, downloaded, left_bytes,
+		                           total_uploaded, total_downloaded, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $5, $6, $8, $8)
+		ON CONFLICT (info_hash, peer_id) DO UPDATE SET
+		    ip = EXCLUDED.ip,
+		    port = EXCLUDED.port,
+		    total_uploaded = tracker_peers.total_uploaded + CASE
+		        WHEN tracker_peers.stopped_at IS NULL AND EXCLUDED.uploaded >= tracker_peers.uploaded
+		        THEN EXCLUDED.uploaded - tracker_peers.uploaded ELSE EXCLUDED.uploaded END,
+		    total_downloaded = tracker_peers.total_downloaded + CASE
+		        WHEN tracker_peers.stopped_at IS NULL AND EXCLUDED.downloaded >= tracker_peers.downloaded
+		        THEN EXCLUDED.downloaded - tracker_peers.downloaded ELSE EXCLUDED.downloaded END,
+		    uploaded = EXCLUDED.uploaded,
+		    downloaded = EXCLUDED.downloaded,
+		    left_bytes = EXCLUDED.left_bytes,
+		    last_seen = EXCLUDED.last_seen,
+		    stopped_at = NULL
+		RETURNING total_uploaded, total_downloaded, first_seen`,
+		infoHash, p.PeerID, p.IP, p.Port, p.Uploaded, p.Downloaded, p.Left, p.LastSeen,
+	).Scan(&totalUploaded, &totalDownloaded, &firstSeen)
+	if err != nil {
+		log.Printf("[TRACKER] Failed to save peer %s of swarm %s: %v", p.PeerID, infoHash, err)
+		return
+	}
+
+	swarm.mu.Lock()
+	if peer, ok := swarm.Peers[p.PeerID]; ok {
+		peer.TotalUploaded = totalUploaded
+		peer.TotalDownloaded = totalDownloaded
+		peer.FirstSeen = firstSeen
+	}
+	swarm.mu.Unlock()
+}
+
+// stopPeer records that a peer left a swarm, with the final counters of its session
+func (t *Tracker) stopPeer(infoHash, peerID string, uploaded, downloaded, left int64) {
+	if t.db == nil {
+		return
+	}
+	_, err := t.db.Exec(`
+		UPDATE tracker_peers SET
+		    total_uploaded = total_uploaded + CASE WHEN $3 >= uploaded THEN $3 - uploaded ELSE $3 END,
+		    total_downloaded = total_downloaded + CASE WHEN $4 >= downloaded THEN $4 - downloaded ELSE $4 END,
+		    uploaded = $3, downloaded = $4, left_bytes = $5,
+		    last_seen = NOW(), stopped_at = NOW()
+		WHERE info_hash = $1 AND peer_id = $2 AND stopped_at IS NULL`,
+		infoHash, peerID, uploaded, downloaded, left)
+	if err != nil {
+		log.Printf("[TRACKER] Failed to record peer %s leaving swarm %s: %v", peerID, infoHash, err)
+	}
+}
+
+// expirePeers records that peers of a swarm were dropped for not announcing since before, as of
+// their last announce, so they are not restored after a restart. A peer that announced again in
+// the meantime is left alone.
+func (t *Tracker) expirePeers(infoHash string, peerIDs []string, before time.Time) {
+	if t.db == nil {
+		return
+	}
+	for _, peerID := range peerIDs {
+		_, err := t.db.Exec(`
+			UPDATE tracker_peers SET stopped_at = last_seen
+			WHERE info_hash = $1 AND peer_id = $2 AND stopped_at IS NULL AND last_seen < $3`, infoHash, peerID, before)
+		if err != nil {
+			log.Printf("[TRACKER] Failed to record peer %s timing out of swarm %s: %v", peerID, infoHash, err)
+		}
+	}
+}
+
+// saveCompleted counts a completion of a torrent. The swarm's lock must not be held.
+func (t *Tracker) saveCompleted(infoHash string, swarm *Swarm) {
+	if t.db == nil {
+		return
+	}
+	var completed int64
+	err := t.db.QueryRow(`
+		INSERT INTO tracker_torrent_stats (info_hash, completed_count) VALUES ($1, 1)
+		ON CONFLICT (info_hash) DO UPDATE SET
+		    completed_count = tracker_torrent_stats.completed_count + 1, updated_at = NOW()
+		RETURNING completed_count`, infoHash).Scan(&completed)
+	if err != nil {
+		log.Printf("[TRACKER] Failed to count completion of %s: %v", infoHash, err)
+		return
+	}
+
+	swarm.mu.Lock()
+	swarm.Completed = completed
+	swarm.mu.Unlock()
+}
+
+// sampleSwarms records the number of seeders and leechers of every swarm, for the swarm
+// health history
+func (t *Tracker) sampleSwarms() {
+	if t.db == nil {
+		return
+	}
+
+	type sample struct {
+		infoHash          string
+		seeders, leechers int
+	}
+	var samples []sample
+	t.mu.RLock()
+	for hash, swarm := range t.swarms {
+		s := sample{infoHash: hash}
+		swarm.mu.RLock()
+		for _, p := range swarm.Peers {
+			if p.Left == 0 {
+				s.seeders++
+			} else {
+				s.leechers++
+			}
+		}
+		swarm.mu.RUnlock()
+		samples = append(samples, s)
+	}
+	t.mu.RUnlock()
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		log.Printf("[TRACKER] Failed to sample swarms: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	for _, s := range samples {
+		if _, err := tx.Exec(`INSERT INTO tracker_swarm_samples (info_hash, seeders, leechers, sampled_at) VALUES ($1, $2, $3, $4)`,
+			s.infoHash, s.seeders, s.leechers, now); err != nil {
+			log.Printf("[TRACKER] Failed to sample swarms: %v", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[TRACKER] Failed to sample swarms: %v", err)
+	}
+}
+
+// pruneHistory drops swarm health samples and peer counters past their retention
+func (t *Tracker) pruneHistory() {
+	if t.db == nil {
+		return
+	}
+	now := time.Now()
+	if _, err := t.db.Exec(`DELETE FROM tracker_swarm_samples WHERE sampled_at < $1`, now.Add(-swarmSampleRetention)); err != nil {
+		log.Printf("[TRACKER] Failed to prune swarm samples: %v", err)
+	}
+	if _, err := t.db.Exec(`DELETE FROM tracker_peers WHERE last_seen < $1`, now.Add(-trackerPeerRetention)); err != nil {
+		log.Printf("[TRACKER] Failed to prune peers: %v", err)
+	}
+}
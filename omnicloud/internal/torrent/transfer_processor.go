@@ -3,6 +3,7 @@ package torrent
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,10 +12,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/omnicloud/omnicloud/internal/trash"
+	"github.com/omnicloud/omnicloud/pkg/dcp"
 )
 
-// TransferProcessor polls the main server for pending transfers and initiates downloads
+// TransferProcessor runs the transfers and transfer/content commands of this server. The main
+// server pushes them over the websocket; they are polled for over HTTP while it is down.
 type TransferProcessor struct {
 	client        *Client
 	mainServerURL string
@@ -23,19 +30,53 @@ type TransferProcessor struct {
 	downloadDir   string // Base directory for downloads (cfg.ScanPath)
 	pollInterval  time.Duration
 	stopChan      chan struct{}
+	libraryPaths  func() []string // library locations whose quarantine areas deleted content goes to
+	pushActive    func() bool     // reports whether the main server can push work over the websocket
+	mu            sync.Mutex      // serialises pushed and polled work
 }
 
 // PendingTransfer represents a transfer waiting to be executed
 type PendingTransfer struct {
-	ID                  string `json:"id"`
-	TorrentID           string `json:"torrent_id"`
-	PackageID           string `json:"package_id"`
-	PackageName         string `json:"package_name"`
-	SourceServerID      string `json:"source_server_id"`
-	DestinationServerID string `json:"destination_server_id"`
-	Priority            int    `json:"priority"`
-	TotalSizeBytes      int64  `json:"total_size_bytes"`
-	TorrentFileURL      string `json:"torrent_file_url"`
+	ID                  string       `json:"id"`
+	TorrentID           string       `json:"torrent_id"`
+	PackageID           string       `json:"package_id"`
+	PackageName         string       `json:"package_name"`
+	SourceServerID      string       `json:"source_server_id"`
+	DestinationServerID string       `json:"destination_server_id"`
+	Priority            int          `json:"priority"`
+	TotalSizeBytes      int64        `json:"total_size_bytes"`
+	TorrentFileURL      string       `json:"torrent_file_url"`
+	Status              string       `json:"status"`
+	StorageReserveBytes int64        `json:"storage_reserve_bytes"`  // space to leave free on the download location
+	LocalAssets         []LocalAsset `json:"local_assets,omitempty"` // files already held in other packages
+}
+
+// neededBytes is the space a transfer takes on the download location: its size minus the
+// files linked from packages this server already holds. Links need the source on the same
+// filesystem as the download location; files elsewhere (e.g. a library on a NAS) are downloaded.
+func (tp *TransferProcessor) neededBytes(t PendingTransfer) int64 {
+	needed := t.TotalSizeBytes
+	if len(t.LocalAssets) == 0 {
+		return needed
+	}
+	dir, err := os.Stat(tp.downloadDir)
+	if err != nil {
+		return needed
+	}
+	dirStat, ok := dir.Sys().(*syscall.Stat_t)
+	if !ok {
+		return needed
+	}
+	for _, a := range t.LocalAssets {
+		src, err := os.Stat(a.SourcePath)
+		if err != nil {
+			continue
+		}
+		if st, ok := src.Sys().(*syscall.Stat_t); ok && st.Dev == dirStat.Dev {
+			needed -= a.SizeBytes
+		}
+	}
+	return needed
 }
 
 // NewTransferProcessor creates a new transfer processor
@@ -51,15 +92,18 @@ func NewTransferProcessor(client *Client, mainServerURL, serverID, macAddress, d
 	}
 }
 
-// Start begins polling for pending transfers
+// Start begins polling for pending transfers. While the websocket to the main server is up
+// the polls are skipped, as the main server pushes the same work.
 func (tp *TransferProcessor) Start(ctx context.Context) {
-	log.Printf("[transfer-processor] Started - polling %s every %s for server %s (download dir: %s)",
+	log.Printf("[transfer-processor] Started - polling %s every %s for server %s while the websocket is down (download dir: %s)",
 		tp.mainServerURL, tp.pollInterval, tp.serverID, tp.downloadDir)
 
 	// Initial check
-	tp.checkPendingTransfers()
-	tp.checkCancelledTransfers()
-	tp.checkContentCommands()
+	if !tp.pushing() {
+		tp.checkPendingTransfers()
+		tp.checkCancelledTransfers()
+		tp.checkContentCommands()
+	}
 
 	ticker := time.NewTicker(tp.pollInterval)
 	defer ticker.Stop()
@@ -71,10 +115,14 @@ func (tp *TransferProcessor) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ticker.C:
-			tp.checkPendingTransfers()
+			if !tp.pushing() {
+				tp.checkPendingTransfers()
+			}
 		case <-cancelTicker.C:
-			tp.checkCancelledTransfers()
-			tp.checkContentCommands()
+			if !tp.pushing() {
+				tp.checkCancelledTransfers()
+				tp.checkContentCommands()
+			}
 		case <-tp.stopChan:
 			log.Println("[transfer-processor] Stopped")
 			return
@@ -90,6 +138,26 @@ func (tp *TransferProcessor) Stop() {
 	close(tp.stopChan)
 }
 
+// SetLibraryLocator sets the function returning the library locations of this server
+func (tp *TransferProcessor) SetLibraryLocator(locator func() []string) {
+	tp.libraryPaths = locator
+}
+
+// SetPushChannel sets the function reporting whether the websocket to the main server is up,
+// i.e. whether transfers and commands are pushed rather than polled for
+func (tp *TransferProcessor) SetPushChannel(connected func() bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.pushActive = connected
+}
+
+// pushing reports whether the main server currently pushes transfers and commands
+func (tp *TransferProcessor) pushing() bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.pushActive != nil && tp.pushActive()
+}
+
 // ReportTransferError reports a transfer error to the main server via the API.
 // This is used by the torrent client's error reporter callback.
 func (tp *TransferProcessor) ReportTransferError(transferID, status, errorMessage string) error {
@@ -140,8 +208,18 @@ func (tp *TransferProcessor) checkPendingTransfers() {
 
 	log.Printf("[transfer-processor] Poll result: %d pending transfer(s) found", len(transfers))
 
+	tp.StartTransfers(transfers)
+}
+
+// StartTransfers starts the given pending transfers that are not running yet and fit the
+// download location, and returns how many it started. Called with the transfers polled from
+// the main server or pushed by it.
+func (tp *TransferProcessor) StartTransfers(transfers []PendingTransfer) int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
 	if len(transfers) == 0 {
-		return
+		return 0
 	}
 
 	// Log each transfer found
@@ -161,6 +239,8 @@ func (tp *TransferProcessor) checkPendingTransfers() {
 	log.Printf("[transfer-processor] Currently active torrents in client: %d", activeCount)
 
 	// Process each transfer (skip already-active ones)
+	var claimed int64 // space claimed by the new transfers started during this poll
+	started := 0
 	for _, transfer := range transfers {
 		// Extract info_hash from the torrent_file_url (format: /api/v1/torrents/<info_hash>/file)
 		// to check if we're already downloading it
@@ -179,11 +259,24 @@ func (tp *TransferProcessor) checkPendingTransfers() {
 			continue
 		}
 
+		// A new transfer must fit the download location, leaving the reserve free. Transfers
+		// being resumed have already claimed their space.
+		isNew := transfer.Status == "queued" || transfer.Status == "waiting_for_space"
+		if isNew && tp.holdForSpace(transfer, claimed) {
+			continue
+		}
+
 		log.Printf("[transfer-processor] Processing transfer %s (%s)...", transfer.ID, transfer.PackageName)
 		if err := tp.initiateTransfer(transfer); err != nil {
 			log.Printf("[transfer-processor] ERROR initiating transfer %s: %v", transfer.ID, err)
+			continue
+		}
+		started++
+		if isNew {
+			claimed += tp.neededBytes(transfer)
 		}
 	}
+	return started
 }
 
 // initiateTransfer downloads the torrent file and starts the download
@@ -215,7 +308,7 @@ func (tp *TransferProcessor) initiateTransfer(transfer PendingTransfer) error {
 
 	// Start download via torrent client
 	log.Printf("[transfer-processor] Calling StartDownload for transfer %s...", transfer.ID)
-	if err := tp.client.StartDownload(torrentBytes, destPath, transfer.PackageID, transfer.ID); err != nil {
+	if err := tp.client.StartDownload(torrentBytes, destPath, transfer.PackageID, transfer.ID, transfer.LocalAssets); err != nil {
 		log.Printf("[transfer-processor] FAILED StartDownload for %s: %v", transfer.ID, err)
 		tp.updateTransferStatus(transfer.ID, "failed")
 		return fmt.Errorf("failed to start download: %w", err)
@@ -225,6 +318,30 @@ func (tp *TransferProcessor) initiateTransfer(transfer PendingTransfer) error {
 	return nil
 }
 
+// holdForSpace reports whether a transfer does not fit the free space of the download location
+// minus the reserve and the space already claimed, and marks it waiting_for_space if so.
+// Files linked from packages already held take no space.
+func (tp *TransferProcessor) holdForSpace(transfer PendingTransfer, claimed int64) bool {
+	_, free, err := dcp.DiskUsage(tp.downloadDir)
+	if err != nil {
+		log.Printf("[transfer-processor] WARNING: cannot measure free space of %s: %v", tp.downloadDir, err)
+		return false
+	}
+	available := free - transfer.StorageReserveBytes - claimed
+	needed := tp.neededBytes(transfer)
+	if needed <= available {
+		return false
+	}
+
+	msg := fmt.Sprintf("Needs %s, %s free on %s with a reserve of %s", formatBytes(needed),
+		formatBytes(free-claimed), tp.downloadDir, formatBytes(transfer.StorageReserveBytes))
+	log.Printf("[transfer-processor] Holding transfer %s: %s", transfer.ID, msg)
+	if err := tp.updateTransferStatusWithError(transfer.ID, "waiting_for_space", msg); err != nil {
+		log.Printf("[transfer-processor] ERROR marking transfer %s waiting for space: %v", transfer.ID, err)
+	}
+	return true
+}
+
 // downloadTorrentFile downloads a torrent file from the main server
 func (tp *TransferProcessor) downloadTorrentFile(url string) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
@@ -344,12 +461,18 @@ func (tp *TransferProcessor) checkCancelledTransfers() {
 	for _, cmd := range commands {
 		log.Printf("[transfer-processor] Command received: %s for transfer=%s package=%q info_hash=%s",
 			cmd.Command, cmd.ID, cmd.PackageName, cmd.InfoHash)
-		tp.executeCommand(cmd)
+		result, message := tp.ExecuteCommand(cmd)
+		tp.acknowledgeCommand(cmd.ID, result, message)
 	}
 }
 
-// executeCommand processes a single transfer command
-func (tp *TransferProcessor) executeCommand(cmd TransferCommand) {
+// ExecuteCommand processes a single transfer command, polled from the main server or pushed by
+// it, and returns the result ("done", "deleted", "kept" or "error") and a message to
+// acknowledge it with
+func (tp *TransferProcessor) ExecuteCommand(cmd TransferCommand) (string, string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
 	var result, message string
 
 	switch cmd.Command {
@@ -451,8 +574,7 @@ func (tp *TransferProcessor) executeCommand(cmd TransferCommand) {
 		message = fmt.Sprintf("Unknown command: %s", cmd.Command)
 	}
 
-	// Acknowledge the command
-	tp.acknowledgeCommand(cmd.ID, result, message)
+	return result, message
 }
 
 // acknowledgeCommand tells the main server we've processed the command
@@ -489,11 +611,16 @@ func (tp *TransferProcessor) acknowledgeCommand(transferID, result, message stri
 }
 
 // DeleteContent performs a DCP deletion. Called both by the polling-based content command system
-// and by the WebSocket delete_content command handler.
-// Returns (result, message) where result is "deleted" or "error".
-func (tp *TransferProcessor) DeleteContent(packageID, packageName, infoHash, targetPath string) (string, string) {
+// and by the WebSocket delete_content command handler. The package is moved to the quarantine
+// area of its library location rather than removed; it is purged once the retention ends. With
+// purge (space reclamation) it is removed right away, and so is a copy deleted from a specific
+// target path: the inventory only tracks a package once per server, so such a copy could not be
+// restored or purged from quarantine.
+// Returns (result, message) where result is "quarantined", "deleted" or "error".
+func (tp *TransferProcessor) DeleteContent(packageID, packageName, infoHash, targetPath string, purge bool) (string, string) {
 	result := "deleted"
 	message := "Content deleted"
+	var trashPath string
 
 	// Determine which path to delete
 	var deletePath string
@@ -513,7 +640,7 @@ func (tp *TransferProcessor) DeleteContent(packageID, packageName, infoHash, tar
 		}
 	}
 
-	// Delete DCP data
+	// Move DCP data to quarantine
 	if deletePath != "" {
 		absPath, err := filepath.Abs(deletePath)
 		if err != nil {
@@ -532,7 +659,7 @@ func (tp *TransferProcessor) DeleteContent(packageID, packageName, infoHash, tar
 			} else if !info.IsDir() {
 				result = "error"
 				message = "Path is not a directory"
-			} else {
+			} else if purge || targetPath != "" {
 				if err := os.RemoveAll(absPath); err != nil {
 					log.Printf("[delete-content] ERROR deleting %s: %v", absPath, err)
 					result = "error"
@@ -541,6 +668,24 @@ func (tp *TransferProcessor) DeleteContent(packageID, packageName, infoHash, tar
 					log.Printf("[delete-content] DELETED: %s", absPath)
 					result = "deleted"
 					message = fmt.Sprintf("Deleted %s", absPath)
+					if !purge {
+						message += " (copies deleted from a specific location are not quarantined)"
+					}
+				}
+			} else {
+				var libraryPaths []string
+				if tp.libraryPaths != nil {
+					libraryPaths = tp.libraryPaths()
+				}
+				trashPath, err = trash.Quarantine(absPath, append(libraryPaths, tp.downloadDir))
+				if err != nil {
+					log.Printf("[delete-content] ERROR quarantining %s: %v", absPath, err)
+					result = "error"
+					message = fmt.Sprintf("Delete failed: %v", err)
+				} else {
+					log.Printf("[delete-content] QUARANTINED: %s -> %s", absPath, trashPath)
+					result = "quarantined"
+					message = fmt.Sprintf("Moved %s to quarantine (%s)", absPath, trashPath)
 				}
 			}
 		}
@@ -554,14 +699,60 @@ func (tp *TransferProcessor) DeleteContent(packageID, packageName, infoHash, tar
 		tp.client.db.Exec("DELETE FROM torrent_piece_completion WHERE info_hash = $1", infoHash)
 	}
 
-	// Remove from local inventory (only when not targeting a specific location)
+	// Mark quarantined in, or remove from, local inventory (only when not targeting a specific location)
 	if packageID != "" && tp.client.db != nil && targetPath == "" {
-		tp.client.db.Exec("DELETE FROM server_dcp_inventory WHERE server_id = $1 AND package_id = $2", tp.serverID, packageID)
+		if result == "quarantined" {
+			tp.client.db.Exec(`
+				UPDATE server_dcp_inventory
+				SET status = 'quarantined', quarantine_path = $3, quarantined_at = $4, updated_at = $4
+				WHERE server_id = $1 AND package_id = $2
+			`, tp.serverID, packageID, trashPath, time.Now())
+		} else {
+			tp.client.db.Exec("DELETE FROM server_dcp_inventory WHERE server_id = $1 AND package_id = $2", tp.serverID, packageID)
+		}
 	}
 
 	return result, message
 }
 
+// RestoreContent moves a quarantined package back to where it was deleted from and marks it
+// online again. Returns the restored path, which still needs to be re-indexed.
+func (tp *TransferProcessor) RestoreContent(packageID string) (string, error) {
+	if tp.client.db == nil {
+		return "", fmt.Errorf("no database")
+	}
+
+	var localPath, trashPath string
+	err := tp.client.db.QueryRow(`
+		SELECT local_path, COALESCE(quarantine_path, '')
+		FROM server_dcp_inventory
+		WHERE server_id = $1 AND package_id = $2 AND status = 'quarantined'
+	`, tp.serverID, packageID).Scan(&localPath, &trashPath)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("package %s is not quarantined on this server", packageID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if trashPath == "" {
+		return "", fmt.Errorf("quarantine location of package %s is unknown", packageID)
+	}
+
+	if err := trash.Restore(trashPath, localPath); err != nil {
+		return "", err
+	}
+	log.Printf("[restore-content] RESTORED: %s -> %s", trashPath, localPath)
+
+	if _, err := tp.client.db.Exec(`
+		UPDATE server_dcp_inventory
+		SET status = 'online', quarantine_path = NULL, quarantined_at = NULL, updated_at = $3
+		WHERE server_id = $1 AND package_id = $2
+	`, tp.serverID, packageID, time.Now()); err != nil {
+		log.Printf("[restore-content] Warning: failed to update inventory for %s: %v", packageID, err)
+	}
+	return localPath, nil
+}
+
 // ContentCommand represents a content management command from the main server
 type ContentCommand struct {
 	ID          string `json:"id"`
@@ -570,6 +761,7 @@ type ContentCommand struct {
 	InfoHash    string `json:"info_hash"`
 	Command     string `json:"command"`     // "delete"
 	TargetPath  string `json:"target_path"` // optional: specific path to delete from (e.g., RosettaBridge location)
+	Purge       bool   `json:"purge"`       // remove the package instead of quarantining it (space reclamation)
 }
 
 // checkContentCommands polls the main server for pending content commands (e.g., delete)
@@ -601,24 +793,28 @@ func (tp *TransferProcessor) checkContentCommands() {
 
 	for _, cmd := range commands {
 		log.Printf("[content-cmd] Received: %s for package=%q info_hash=%s", cmd.Command, cmd.PackageName, cmd.InfoHash)
-		tp.executeContentCommand(cmd)
+		result, message := tp.ExecuteContentCommand(cmd)
+		tp.acknowledgeContentCommand(cmd.ID, result, message)
 	}
 }
 
-// executeContentCommand processes a content management command
-func (tp *TransferProcessor) executeContentCommand(cmd ContentCommand) {
+// ExecuteContentCommand processes a content management command, polled from the main server or
+// pushed by it, and returns the result and a message to acknowledge it with
+func (tp *TransferProcessor) ExecuteContentCommand(cmd ContentCommand) (string, string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
 	var result, message string
 
 	switch cmd.Command {
 	case "delete":
-		result, message = tp.DeleteContent(cmd.PackageID, cmd.PackageName, cmd.InfoHash, cmd.TargetPath)
+		result, message = tp.DeleteContent(cmd.PackageID, cmd.PackageName, cmd.InfoHash, cmd.TargetPath, cmd.Purge)
 	default:
 		result = "error"
 		message = fmt.Sprintf("Unknown command: %s", cmd.Command)
 	}
 
-	// Acknowledge
-	tp.acknowledgeContentCommand(cmd.ID, result, message)
+	return result, message
 }
 
 // acknowledgeContentCommand tells the main server we've processed the content command
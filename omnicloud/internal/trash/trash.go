@@ -0,0 +1,116 @@
+package trash
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirName is the quarantine area created at the root of each library location. Deleted
+// packages are moved to DirName/<timestamp>/<package directory> until their retention ends.
+const DirName = ".omnicloud-trash"
+
+// timestampLayout names the directory holding the packages quarantined at one moment
+const timestampLayout = "20060102-150405"
+
+// Quarantine moves a package directory into the quarantine area of the library location that
+// holds it (or of its parent directory when it is in none of them) and returns the new path
+func Quarantine(packagePath string, libraryPaths []string) (string, error) {
+	packagePath = filepath.Clean(packagePath)
+	root := libraryRoot(packagePath, libraryPaths)
+
+	dir := filepath.Join(root, DirName, time.Now().UTC().Format(timestampLayout))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	dest := filepath.Join(dir, filepath.Base(packagePath))
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("%s is already in quarantine", dest)
+	}
+	if err := os.Rename(packagePath, dest); err != nil {
+		return "", fmt.Errorf("failed to move package to quarantine: %w", err)
+	}
+	return dest, nil
+}
+
+// Restore moves a quarantined package back to its original path
+func Restore(trashPath, originalPath string) error {
+	if !IsTrashPath(trashPath) {
+		return fmt.Errorf("%s is not in a quarantine area", trashPath)
+	}
+	if _, err := os.Stat(trashPath); err != nil {
+		return fmt.Errorf("quarantined package not found: %w", err)
+	}
+	if _, err := os.Stat(originalPath); err == nil {
+		return fmt.Errorf("%s already exists", originalPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(originalPath), err)
+	}
+	if err := os.Rename(trashPath, originalPath); err != nil {
+		return fmt.Errorf("failed to move package out of quarantine: %w", err)
+	}
+	os.Remove(filepath.Dir(trashPath)) // only succeeds once the timestamp directory is empty
+	return nil
+}
+
+// Purge permanently removes what was quarantined in a library location more than retention
+// ago and returns the removed timestamp directories
+func Purge(libraryPath string, retention time.Duration) ([]string, error) {
+	area := filepath.Join(libraryPath, DirName)
+	entries, err := ioutil.ReadDir(area)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		quarantinedAt, err := time.Parse(timestampLayout, entry.Name())
+		if !entry.IsDir() || err != nil || time.Since(quarantinedAt) < retention {
+			continue
+		}
+		dir := filepath.Join(area, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+// IsTrashPath reports whether a path lies inside a quarantine area
+func IsTrashPath(path string) bool {
+	return Root(path) != ""
+}
+
+// Root returns the directory whose quarantine area holds a quarantined path, or "" when the
+// path is not in a quarantine area
+func Root(trashPath string) string {
+	for dir := filepath.Clean(trashPath); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == DirName {
+			return filepath.Dir(dir)
+		}
+	}
+	return ""
+}
+
+// libraryRoot returns the deepest library location containing path
+func libraryRoot(path string, libraryPaths []string) string {
+	root := ""
+	for _, lib := range libraryPaths {
+		lib = filepath.Clean(lib)
+		if strings.HasPrefix(path, lib+string(filepath.Separator)) && len(lib) > len(root) {
+			root = lib
+		}
+	}
+	if root == "" {
+		return filepath.Dir(path)
+	}
+	return root
+}
@@ -1,7 +1,10 @@
 package watcher
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/omnicloud/omnicloud/internal/db"
@@ -10,17 +13,33 @@ import (
 
 // ScanHandler handles scan requests triggered by the watcher
 type ScanHandler struct {
-	database *db.DB
-	serverID uuid.UUID
-	indexer  *scanner.Indexer
+	database        *db.DB
+	serverID        uuid.UUID
+	indexer         *scanner.Indexer
+	triggerFullScan func() // multi-volume packages need every library location, so they go through a full scan
+
+	// Packages waiting to stabilise before they are indexed, keyed by package path.
+	// Only the scan worker goroutine touches it.
+	settleTime time.Duration
+	pending    map[string]*pendingPackage
+}
+
+// pendingPackage is a package the watcher saw change but that may still be being copied
+type pendingPackage struct {
+	firstSeen time.Time
+	lastCheck time.Time
+	snapshot  *scanner.PackageSnapshot // nil until the package could be scanned
+	reason    string                   // why it is not indexed yet
 }
 
 // NewScanHandler creates a new scan handler
 func NewScanHandler(database *db.DB, serverID uuid.UUID) *ScanHandler {
 	return &ScanHandler{
-		database: database,
-		serverID: serverID,
-		indexer:  scanner.NewIndexer(database, serverID),
+		database:   database,
+		serverID:   serverID,
+		indexer:    scanner.NewIndexer(database, serverID),
+		settleTime: scanner.CopyQuietPeriod,
+		pending:    make(map[string]*pendingPackage),
 	}
 }
 
@@ -29,16 +48,64 @@ func (h *ScanHandler) GetIndexer() *scanner.Indexer {
 	return h.indexer
 }
 
-// HandleScanRequest processes a scan request for a single package
+// SetFullScanTrigger sets the function used to hand multi-volume packages over to a full scan
+func (h *ScanHandler) SetFullScanTrigger(trigger func()) {
+	h.triggerFullScan = trigger
+}
+
+// HandleScanRequest processes a scan request for a single package. The package is indexed
+// (and queued for torrent generation) only once it is stable: no transfer artefacts, every PKL
+// asset present at its PKL size, and no file changed for the settle time.
 func (h *ScanHandler) HandleScanRequest(packagePath string) error {
 	log.Printf("Handling scan request for: %s", packagePath)
 
-	// Scan the package
+	// Scan the package; the ASSETMAP may not have been copied yet
 	info, err := scanner.ScanPackage(packagePath)
 	if err != nil {
-		return err
+		if _, statErr := os.Stat(packagePath); os.IsNotExist(statErr) {
+			if _, waiting := h.pending[packagePath]; waiting {
+				log.Printf("%s is gone, no longer waiting for it", packagePath)
+				delete(h.pending, packagePath)
+			}
+			return nil
+		}
+		h.deferPackage(packagePath, nil, err.Error())
+		return nil
 	}
 
+	// Other volumes may live in other library locations; only a full scan can group them
+	if info.ExpectedVolumes() > 1 && h.triggerFullScan != nil {
+		log.Printf("%s is one volume of a %d-volume package, running a full scan instead", packagePath, info.ExpectedVolumes())
+		h.triggerFullScan()
+		return nil
+	}
+
+	snapshot, err := scanner.SnapshotPackage(info)
+	if err != nil {
+		h.deferPackage(packagePath, nil, err.Error())
+		return nil
+	}
+	if reason := info.CopyInProgress(snapshot); reason != "" {
+		// Still incomplete after CopyStalePeriod: index it as it is, so validation records the
+		// missing or short files instead of the package never showing up
+		if p := h.pending[packagePath]; p != nil && time.Since(p.firstSeen) > scanner.CopyStalePeriod {
+			log.Printf("%s has looked incomplete for %v (%s), indexing it as it is", packagePath, scanner.CopyStalePeriod, reason)
+			delete(h.pending, packagePath)
+			return h.indexer.IndexPackage(info)
+		}
+		h.deferPackage(packagePath, snapshot, reason)
+		return nil
+	}
+	p := h.pending[packagePath]
+	if p == nil || !p.snapshot.Equal(snapshot) {
+		h.deferPackage(packagePath, snapshot, fmt.Sprintf("waiting %v for its files to settle", h.settleTime))
+		return nil
+	}
+	if snapshot.TakenAt.Sub(p.snapshot.TakenAt) < h.settleTime {
+		return nil // unchanged so far; checked again once the settle time has passed
+	}
+	delete(h.pending, packagePath)
+
 	// Index to database
 	if err := h.indexer.IndexPackage(info); err != nil {
 		return err
@@ -48,10 +115,48 @@ func (h *ScanHandler) HandleScanRequest(packagePath string) error {
 	return nil
 }
 
+// deferPackage records a package that is not ready to be indexed; it is checked again after
+// the settle time
+func (h *ScanHandler) deferPackage(packagePath string, snapshot *scanner.PackageSnapshot, reason string) {
+	now := time.Now()
+	p := h.pending[packagePath]
+	if p == nil {
+		p = &pendingPackage{firstSeen: now}
+		h.pending[packagePath] = p
+	}
+	// Packages that can be read are indexed as they are by then; this gives up on the others
+	if now.Sub(p.firstSeen) > scanner.CopyStalePeriod {
+		log.Printf("Giving up waiting for %s: %s", packagePath, reason)
+		delete(h.pending, packagePath)
+		return
+	}
+	if reason != p.reason {
+		log.Printf("Not indexing %s yet: %s", packagePath, reason)
+	}
+	p.lastCheck = now
+	p.snapshot = snapshot
+	p.reason = reason
+}
+
+// checkPendingPackages re-checks the packages whose settle time has passed
+func (h *ScanHandler) checkPendingPackages() {
+	for packagePath, p := range h.pending {
+		if time.Since(p.lastCheck) < h.settleTime {
+			continue
+		}
+		if err := h.HandleScanRequest(packagePath); err != nil {
+			log.Printf("Error processing scan request for %s: %v", packagePath, err)
+		}
+	}
+}
+
 // StartScanWorker starts a worker goroutine that processes scan requests
 func (h *ScanHandler) StartScanWorker(scanRequests <-chan string, stopChan <-chan struct{}) {
 	log.Println("Starting scan worker...")
 
+	ticker := time.NewTicker(h.settleTime / 4)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case packagePath := <-scanRequests:
@@ -59,6 +164,9 @@ func (h *ScanHandler) StartScanWorker(scanRequests <-chan string, stopChan <-cha
 				log.Printf("Error processing scan request for %s: %v", packagePath, err)
 			}
 
+		case <-ticker.C:
+			h.checkPendingPackages()
+
 		case <-stopChan:
 			log.Println("Scan worker stopped")
 			return
@@ -3,6 +3,7 @@ package watcher
 import (
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -11,19 +12,25 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
-// Watcher monitors filesystem changes
+// Watcher monitors filesystem changes under a set of library locations. Every directory below a
+// location is watched, so packages copied into nested folders are picked up too.
 type Watcher struct {
 	fsWatcher     *fsnotify.Watcher
-	scanPath      string
+	scanPaths     []string // library locations to watch once started
 	scanRequests  chan string
 	debounceTime  time.Duration
 	pendingEvents map[string]time.Time
 	eventMutex    sync.Mutex
 	stopChan      chan struct{}
+
+	// Watched directories, mapped to the library location they belong to
+	watchMu sync.Mutex
+	watched map[string]string
+	roots   map[string]bool
 }
 
-// NewWatcher creates a new filesystem watcher
-func NewWatcher(scanPath string, scanRequests chan string) (*Watcher, error) {
+// NewWatcher creates a new filesystem watcher for the given library locations
+func NewWatcher(scanPaths []string, scanRequests chan string) (*Watcher, error) {
 	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create fsnotify watcher: %w", err)
@@ -31,11 +38,13 @@ func NewWatcher(scanPath string, scanRequests chan string) (*Watcher, error) {
 
 	w := &Watcher{
 		fsWatcher:     fsWatcher,
-		scanPath:      scanPath,
+		scanPaths:     scanPaths,
 		scanRequests:  scanRequests,
 		debounceTime:  10 * time.Second, // Wait 10 seconds before triggering scan
 		pendingEvents: make(map[string]time.Time),
 		stopChan:      make(chan struct{}),
+		watched:       make(map[string]string),
+		roots:         make(map[string]bool),
 	}
 
 	return w, nil
@@ -43,13 +52,11 @@ func NewWatcher(scanPath string, scanRequests chan string) (*Watcher, error) {
 
 // Start begins watching the filesystem
 func (w *Watcher) Start() error {
-	// Add the root scan path to watch
-	if err := w.fsWatcher.Add(w.scanPath); err != nil {
-		return fmt.Errorf("failed to watch path %s: %w", w.scanPath, err)
+	// Locations that cannot be watched yet are retried on the next SetLocations
+	if n := w.SetLocations(w.scanPaths); n == 0 {
+		log.Printf("Warning: filesystem watcher has no library location to watch yet")
 	}
 
-	log.Printf("Filesystem watcher started for: %s", w.scanPath)
-
 	// Start event processing goroutine
 	go w.processEvents()
 
@@ -59,6 +66,124 @@ func (w *Watcher) Start() error {
 	return nil
 }
 
+// SetLocations replaces the watched library locations: watches below locations no longer in
+// the list are dropped and new locations are watched recursively. Safe to call while running.
+// Returns the number of locations being watched.
+func (w *Watcher) SetLocations(scanPaths []string) int {
+	wanted := make(map[string]bool)
+	for _, p := range scanPaths {
+		if p != "" {
+			wanted[filepath.Clean(p)] = true
+		}
+	}
+
+	w.watchMu.Lock()
+	defer w.watchMu.Unlock()
+
+	for root := range w.roots {
+		if wanted[root] {
+			continue
+		}
+		for dir, r := range w.watched {
+			if r == root {
+				w.fsWatcher.Remove(dir)
+				delete(w.watched, dir)
+			}
+		}
+		delete(w.roots, root)
+		log.Printf("Filesystem watcher stopped watching: %s", root)
+	}
+
+	for root := range wanted {
+		// A location whose directory went away (e.g. an unmounted drive) is watched again
+		if _, ok := w.watched[root]; ok {
+			continue
+		}
+		dirs, err := w.addTree(root, root)
+		if err != nil {
+			log.Printf("Warning: failed to watch library location %s: %v", root, err)
+			continue
+		}
+		w.roots[root] = true
+		log.Printf("Filesystem watcher started for: %s (%d directories)", root, dirs)
+	}
+	return len(w.roots)
+}
+
+// addTree watches dir and every directory below it as part of the library location root.
+// The caller holds watchMu.
+func (w *Watcher) addTree(root, dir string) (int, error) {
+	added := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // unreadable subdirectory: keep watching the rest
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, ok := w.watched[path]; ok {
+			return nil
+		}
+		if err := w.fsWatcher.Add(path); err != nil {
+			if path == dir {
+				return err
+			}
+			log.Printf("Warning: failed to watch %s: %v", path, err)
+			return nil
+		}
+		w.watched[path] = root
+		added++
+		return nil
+	})
+	return added, err
+}
+
+// watchNewDirectory starts watching a directory created below a watched one. Files may have
+// been written into it before the watch was in place, so DCP files already there are queued.
+// Hidden directories (such as the quarantine area) are skipped, as in addTree.
+func (w *Watcher) watchNewDirectory(dir string) {
+	if strings.HasPrefix(filepath.Base(dir), ".") {
+		return
+	}
+	w.watchMu.Lock()
+	root, ok := w.watched[filepath.Dir(dir)]
+	if ok {
+		if _, err := w.addTree(root, dir); err != nil {
+			log.Printf("Warning: failed to watch new directory %s: %v", dir, err)
+		}
+	}
+	w.watchMu.Unlock()
+	if !ok {
+		return
+	}
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && isDCPFile(info.Name()) {
+			w.markPending(filepath.Dir(path))
+		}
+		return nil
+	})
+}
+
+// forgetDirectory drops a removed or renamed directory and everything below it
+func (w *Watcher) forgetDirectory(dir string) {
+	w.watchMu.Lock()
+	defer w.watchMu.Unlock()
+	prefix := dir + string(filepath.Separator)
+	for d := range w.watched {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			w.fsWatcher.Remove(d)
+			delete(w.watched, d)
+		}
+	}
+}
+
 // Stop stops the watcher
 func (w *Watcher) Stop() {
 	close(w.stopChan)
@@ -90,18 +215,20 @@ func (w *Watcher) processEvents() {
 
 // handleEvent processes a single filesystem event
 func (w *Watcher) handleEvent(event fsnotify.Event) {
+	// New package folders (and folders inside them) need watches of their own
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			w.watchNewDirectory(event.Name)
+			return
+		}
+	}
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.forgetDirectory(filepath.Clean(event.Name))
+	}
+
 	// Only care about specific file types
 	fileName := filepath.Base(event.Name)
-	upperName := strings.ToUpper(fileName)
-
-	// Check if this is a DCP-related file
-	isDCPFile := upperName == "ASSETMAP" ||
-		upperName == "ASSETMAP.XML" ||
-		strings.HasPrefix(upperName, "CPL_") ||
-		strings.HasPrefix(upperName, "PKL_") ||
-		strings.HasSuffix(upperName, ".MXF")
-
-	if !isDCPFile {
+	if !isDCPFile(fileName) {
 		return
 	}
 
@@ -113,9 +240,7 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 		packagePath, event.Op.String(), fileName)
 
 	// Add to pending events with debounce
-	w.eventMutex.Lock()
-	w.pendingEvents[packagePath] = time.Now()
-	w.eventMutex.Unlock()
+	w.markPending(packagePath)
 
 	// Handle REMOVE events immediately
 	if event.Op&fsnotify.Remove == fsnotify.Remove {
@@ -124,6 +249,23 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 	}
 }
 
+// markPending (re)starts the debounce period of a package directory
+func (w *Watcher) markPending(packagePath string) {
+	w.eventMutex.Lock()
+	w.pendingEvents[packagePath] = time.Now()
+	w.eventMutex.Unlock()
+}
+
+// isDCPFile reports whether a file name belongs to a DCP
+func isDCPFile(fileName string) bool {
+	upperName := strings.ToUpper(fileName)
+	return upperName == "ASSETMAP" ||
+		upperName == "ASSETMAP.XML" ||
+		strings.HasPrefix(upperName, "CPL_") ||
+		strings.HasPrefix(upperName, "PKL_") ||
+		strings.HasSuffix(upperName, ".MXF")
+}
+
 // processPendingEvents checks for pending events and triggers scans after debounce period
 func (w *Watcher) processPendingEvents() {
 	ticker := time.NewTicker(2 * time.Second)
@@ -43,6 +43,15 @@ type ClientConnector struct {
 	onRescan          func() error
 	onStatusRequest   func() map[string]interface{}
 	onDeleteContent   func(packageID, packageName, infoHash, targetPath string) (result string, message string, err error)
+	onVerifyPackage   func(verificationID, packageID, packageName, localPath string) error
+	onLibraryChanged  func() error
+	onRestoreContent  func(packageID string) (message string, err error)
+	onStartTransfers  func(transfers json.RawMessage) (message string, err error)
+	onTransferCommand func(command json.RawMessage) (result string, message string, err error)
+	onContentCommand  func(command json.RawMessage) (result string, message string, err error)
+
+	// Measures the library and download locations for heartbeats
+	storageReporter func() []dcp.StorageUsage
 }
 
 // NewClientConnector creates a new WebSocket client connector
@@ -102,6 +111,48 @@ func (c *ClientConnector) SetOnDeleteContent(handler func(packageID, packageName
 	c.onDeleteContent = handler
 }
 
+// SetOnVerifyPackage sets the handler for verify package commands. The handler should start the
+// verification in the background and return immediately; results are reported separately.
+func (c *ClientConnector) SetOnVerifyPackage(handler func(verificationID, packageID, packageName, localPath string) error) {
+	c.onVerifyPackage = handler
+}
+
+// SetOnLibraryChanged sets the handler for library_changed commands, sent when the library
+// locations of this server were added, changed or removed on the main server
+func (c *ClientConnector) SetOnLibraryChanged(handler func() error) {
+	c.onLibraryChanged = handler
+}
+
+// SetOnRestoreContent sets the handler for restore_content commands, which move a quarantined
+// package back into its library location
+func (c *ClientConnector) SetOnRestoreContent(handler func(packageID string) (string, error)) {
+	c.onRestoreContent = handler
+}
+
+// SetOnStartTransfers sets the handler for start_transfers commands, which carry the transfers
+// this server is to run in the form the pending-transfers endpoint returns them
+func (c *ClientConnector) SetOnStartTransfers(handler func(transfers json.RawMessage) (string, error)) {
+	c.onStartTransfers = handler
+}
+
+// SetOnTransferCommand sets the handler for transfer_command commands (pause, resume or cancel
+// a transfer). The result is returned to the main server as its acknowledgement.
+func (c *ClientConnector) SetOnTransferCommand(handler func(command json.RawMessage) (string, string, error)) {
+	c.onTransferCommand = handler
+}
+
+// SetOnContentCommand sets the handler for content_command commands (delete a package). The
+// result is returned to the main server as its acknowledgement.
+func (c *ClientConnector) SetOnContentCommand(handler func(command json.RawMessage) (string, string, error)) {
+	c.onContentCommand = handler
+}
+
+// SetStorageReporter sets the function measuring the filesystem usage of the library and
+// download locations, sent with every heartbeat
+func (c *ClientConnector) SetStorageReporter(reporter func() []dcp.StorageUsage) {
+	c.storageReporter = reporter
+}
+
 // Start begins the WebSocket client connection
 func (c *ClientConnector) Start(ctx context.Context) {
 	log.Printf("[WS Client] Starting WebSocket connector to %s", c.mainServerURL)
@@ -299,7 +350,9 @@ func (c *ClientConnector) handleMessage(data []byte) {
 		}
 
 	case MessageTypeCommand:
-		c.handleCommand(data)
+		// Commands may take a while (starting pushed transfers fetches their torrent files), so
+		// they run off the read loop, which must keep reading pongs
+		go c.handleCommand(data)
 
 	case MessageTypeRequest:
 		c.handleRequest(msg)
@@ -322,6 +375,7 @@ func (c *ClientConnector) handleCommand(data []byte) {
 	var err error
 	var responseMsg string
 	var success bool
+	var payload interface{}
 
 	switch cmd.Command {
 	case CommandRestart:
@@ -342,13 +396,37 @@ func (c *ClientConnector) handleCommand(data []byte) {
 	case CommandDeleteContent:
 		responseMsg, success, err = c.handleDeleteContentCommand(cmd.Payload)
 
+	case CommandVerifyPackage:
+		responseMsg, success, err = c.handleVerifyPackageCommand(cmd.Payload)
+
+	case CommandLibraryChanged:
+		responseMsg, success, err = c.handleLibraryChangedCommand()
+
+	case CommandRestoreContent:
+		responseMsg, success, err = c.handleRestoreContentCommand(cmd.Payload)
+
+	case CommandStartTransfers:
+		responseMsg, success, err = c.handleStartTransfersCommand(cmd.Payload)
+
+	case CommandTransferCommand:
+		var result string
+		result, responseMsg, err = c.handleQueuedCommand("transfer_command", c.onTransferCommand, cmd.Payload)
+		success = err == nil && result != "error"
+		payload = map[string]interface{}{"result": result}
+
+	case CommandContentCommand:
+		var result string
+		result, responseMsg, err = c.handleQueuedCommand("content_command", c.onContentCommand, cmd.Payload)
+		success = err == nil && result != "error"
+		payload = map[string]interface{}{"result": result}
+
 	default:
 		responseMsg = fmt.Sprintf("Unknown command: %s", cmd.Command)
 		success = false
 	}
 
 	// Send response
-	response := NewResponseMessage(cmd.MessageID, success, responseMsg, err, nil)
+	response := NewResponseMessage(cmd.MessageID, success, responseMsg, err, payload)
 	if data, err := response.ToJSON(); err == nil {
 		c.send <- data
 	}
@@ -428,7 +506,36 @@ func (c *ClientConnector) handleDeleteContentCommand(payload interface{}) (strin
 		return message, false, err
 	}
 
-	return message, result == "deleted", nil
+	return message, result == "deleted" || result == "quarantined", nil
+}
+
+// handleVerifyPackageCommand handles verify package commands
+func (c *ClientConnector) handleVerifyPackageCommand(payload interface{}) (string, bool, error) {
+	log.Printf("[WS Client] Processing verify_package command")
+
+	payloadMap, ok := payload.(map[string]interface{})
+	if !ok {
+		return "Invalid payload", false, fmt.Errorf("invalid payload format")
+	}
+
+	verificationID, _ := payloadMap["verification_id"].(string)
+	packageID, _ := payloadMap["package_id"].(string)
+	packageName, _ := payloadMap["package_name"].(string)
+	localPath, _ := payloadMap["local_path"].(string)
+
+	if verificationID == "" || localPath == "" {
+		return "verification_id and local_path are required", false, fmt.Errorf("incomplete payload")
+	}
+
+	if c.onVerifyPackage == nil {
+		return "Verify package handler not configured", false, fmt.Errorf("no verify handler")
+	}
+
+	if err := c.onVerifyPackage(verificationID, packageID, packageName, localPath); err != nil {
+		return "Verification not started", false, err
+	}
+
+	return "Verification started", true, nil
 }
 
 // handleRescanCommand handles rescan commands
@@ -444,6 +551,92 @@ func (c *ClientConnector) handleRescanCommand() (string, bool, error) {
 	return "Rescan started", true, nil
 }
 
+// handleLibraryChangedCommand handles library_changed commands
+func (c *ClientConnector) handleLibraryChangedCommand() (string, bool, error) {
+	log.Printf("[WS Client] Processing library_changed command")
+
+	if c.onLibraryChanged != nil {
+		if err := c.onLibraryChanged(); err != nil {
+			return "Library reload failed", false, err
+		}
+	}
+
+	return "Library locations reloaded", true, nil
+}
+
+// handleRestoreContentCommand handles restore content commands
+func (c *ClientConnector) handleRestoreContentCommand(payload interface{}) (string, bool, error) {
+	log.Printf("[WS Client] Processing restore_content command")
+
+	payloadMap, ok := payload.(map[string]interface{})
+	if !ok {
+		return "Invalid payload", false, fmt.Errorf("invalid payload format")
+	}
+
+	packageID, _ := payloadMap["package_id"].(string)
+	if packageID == "" {
+		return "package_id is required", false, fmt.Errorf("incomplete payload")
+	}
+
+	if c.onRestoreContent == nil {
+		return "Restore content handler not configured", false, fmt.Errorf("no restore handler")
+	}
+
+	message, err := c.onRestoreContent(packageID)
+	if err != nil {
+		return err.Error(), false, err
+	}
+
+	return message, true, nil
+}
+
+// handleStartTransfersCommand handles start transfers commands
+func (c *ClientConnector) handleStartTransfersCommand(payload interface{}) (string, bool, error) {
+	log.Printf("[WS Client] Processing start_transfers command")
+
+	payloadMap, ok := payload.(map[string]interface{})
+	if !ok {
+		return "Invalid payload", false, fmt.Errorf("invalid payload format")
+	}
+
+	if c.onStartTransfers == nil {
+		return "Transfer handler not configured", false, fmt.Errorf("no transfer handler")
+	}
+
+	transfers, err := json.Marshal(payloadMap["transfers"])
+	if err != nil {
+		return "Invalid payload", false, err
+	}
+
+	message, err := c.onStartTransfers(transfers)
+	if err != nil {
+		return err.Error(), false, err
+	}
+
+	return message, true, nil
+}
+
+// handleQueuedCommand hands a transfer or content command to its handler and returns the
+// handler's result ("done", "deleted", "error", ...)
+func (c *ClientConnector) handleQueuedCommand(name string, handler func(json.RawMessage) (string, string, error), payload interface{}) (string, string, error) {
+	log.Printf("[WS Client] Processing %s command", name)
+
+	if _, ok := payload.(map[string]interface{}); !ok {
+		return "error", "Invalid payload", fmt.Errorf("invalid payload format")
+	}
+
+	if handler == nil {
+		return "error", name + " handler not configured", fmt.Errorf("no %s handler", name)
+	}
+
+	command, err := json.Marshal(payload)
+	if err != nil {
+		return "error", "Invalid payload", err
+	}
+
+	return handler(command)
+}
+
 // heartbeatLoop sends periodic heartbeats to the server
 func (c *ClientConnector) heartbeatLoop(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
@@ -492,7 +685,7 @@ func (c *ClientConnector) sendHeartbeat() {
 		apiURL = fmt.Sprintf("http://%s:10858", publicIP)
 	}
 
-	heartbeat := NewMessage(MessageTypeHeartbeat, map[string]interface{}{
+	payload := map[string]interface{}{
 		"server_id":           c.serverID.String(),
 		"server_name":         c.serverName,
 		"mac_address":         c.macAddress,
@@ -501,7 +694,11 @@ func (c *ClientConnector) sendHeartbeat() {
 		"package_count":       packageCount,
 		"public_ip":           publicIP,
 		"api_url":             apiURL,
-	})
+	}
+	if c.storageReporter != nil {
+		payload["storage"] = c.storageReporter()
+	}
+	heartbeat := NewMessage(MessageTypeHeartbeat, payload)
 
 	data, err := heartbeat.ToJSON()
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/omnicloud/omnicloud/pkg/dcp"
 )
 
 // Client represents a connected client
@@ -54,6 +55,12 @@ type Hub struct {
 	// Response channels for synchronous command-response flows
 	responseChs   map[string]chan *ResponseMessage
 	responseChsMu sync.Mutex
+
+	// Stores the filesystem usage clients report in heartbeats
+	storageRecorder func(serverID uuid.UUID, usage []dcp.StorageUsage)
+
+	// Called in the background whenever a client connects
+	onConnect func(serverID uuid.UUID)
 }
 
 type unicastMessage struct {
@@ -75,6 +82,17 @@ func NewHub(db *sql.DB) *Hub {
 	}
 }
 
+// SetStorageRecorder sets the function storing the filesystem usage clients report in heartbeats
+func (h *Hub) SetStorageRecorder(recorder func(serverID uuid.UUID, usage []dcp.StorageUsage)) {
+	h.storageRecorder = recorder
+}
+
+// SetOnConnect sets the function called whenever a client connects, e.g. to push the work
+// that was queued for it while it was offline
+func (h *Hub) SetOnConnect(handler func(serverID uuid.UUID)) {
+	h.onConnect = handler
+}
+
 // Run starts the hub's main loop
 func (h *Hub) Run() {
 	// Periodic cleanup and status update
@@ -121,6 +139,10 @@ func (h *Hub) registerClient(client *Client) {
 
 	// Update server status to online
 	h.updateServerOnlineStatus(client.ServerID, true)
+
+	if h.onConnect != nil {
+		go h.onConnect(client.ServerID)
+	}
 }
 
 // unregisterClient removes a client from the hub
@@ -535,4 +557,12 @@ func (c *Client) handleHeartbeat(payload map[string]interface{}) {
 		log.Printf("[WS Client] Heartbeat from %s: %.2fTB, %s, %d packages, IP: %s",
 			c.ServerName, storageCapacity, softwareVersion, int(packageCount), publicIP)
 	}
+
+	// Convert to JSON and back to get typed storage usage
+	if storageRaw, ok := payload["storage"]; ok && c.Hub.storageRecorder != nil {
+		var usage []dcp.StorageUsage
+		if jsonBytes, err := json.Marshal(storageRaw); err == nil && json.Unmarshal(jsonBytes, &usage) == nil {
+			c.Hub.storageRecorder(c.ServerID, usage)
+		}
+	}
 }
@@ -3,6 +3,8 @@ package websocket
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/omnicloud/omnicloud/pkg/dcp"
 )
 
 // MessageType defines the type of WebSocket message
@@ -43,6 +45,16 @@ const (
 	CommandRescan         CommandType = "rescan"
 	CommandStatusUpdate   CommandType = "status_update"
 	CommandDeleteContent  CommandType = "delete_content"
+	CommandVerifyPackage  CommandType = "verify_package"
+	CommandLibraryChanged CommandType = "library_changed"
+	CommandRestoreContent CommandType = "restore_content"
+
+	// Transfer dispatch: the main server pushes the transfers a client is to run and the
+	// commands for them as they are queued. Clients poll for them over HTTP only while
+	// their websocket is down.
+	CommandStartTransfers  CommandType = "start_transfers"
+	CommandTransferCommand CommandType = "transfer_command"
+	CommandContentCommand  CommandType = "content_command"
 )
 
 // Message represents a WebSocket message
@@ -72,6 +84,8 @@ type HeartbeatPayload struct {
 	PackageCount      int     `json:"package_count"`
 	PublicIP          string  `json:"public_ip,omitempty"`
 	APIURL            string  `json:"api_url,omitempty"`
+
+	Storage []dcp.StorageUsage `json:"storage,omitempty"` // filesystem usage of library and download locations
 }
 
 // ActivityReport represents a live activity update from a client server
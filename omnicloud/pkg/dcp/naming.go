@@ -0,0 +1,298 @@
+package dcp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentTitle is a ContentTitleText decomposed along the Digital Cinema Naming Convention:
+//
+//	FilmTitle_ContentType_Aspect_Language_Territory-Rating_Audio_Resolution_Studio_Date_Facility_Standard_Package
+//
+// e.g. StarWars_FTR-2_S_EN-XX_US-PG13_51_2K_DI_20241201_DLX_SMPTE_OV. Fields that are absent
+// or not recognised are left empty.
+type ContentTitle struct {
+	Raw              string
+	FilmTitle        string
+	ContentType      string // FTR, TLR, TSR, RTG-F, ...
+	ContentVersion   int    // numeric version following the content type, 0 when absent
+	AspectRatio      string // projector aspect: F (flat), S (scope) or C (full container)
+	ImageAspect      string // image aspect within the container, e.g. 178 in F-178
+	AudioLanguage    string
+	SubtitleLanguage string // empty for XX (no subtitles)
+	Captions         string // CCAP or OCAP
+	Territory        string
+	Rating           string
+	AudioFormat      string // e.g. 51, 71-HI-VI, ATMOS
+	Resolution       string // 2K, 4K
+	Studio           string
+	Date             *time.Time
+	Facility         string
+	Standard         string // IOP or SMPTE
+	PackageType      string // OV or VF
+	Conforming       bool   // every field matched its slot in convention order
+}
+
+// Fields of the naming convention, in the order they appear
+const (
+	slotTitle = iota
+	slotContentType
+	slotAspect
+	slotLanguage
+	slotTerritory
+	slotAudio
+	slotResolution
+	slotStudio
+	slotDate
+	slotFacility
+	slotStandard
+	slotPackage
+)
+
+var (
+	contentTypes = map[string]bool{
+		"FTR": true, "TLR": true, "TSR": true, "PRO": true, "TST": true, "RTG": true,
+		"SHR": true, "ADV": true, "XSN": true, "PSA": true, "POL": true, "CLP": true,
+		"PRM": true, "EPS": true, "TRN": true,
+	}
+	audioTokens = map[string]bool{
+		"10": true, "20": true, "51": true, "61": true, "71": true, "MOS": true,
+		"ATMOS": true, "IAB": true, "AURO": true, "DTS": true, "DTSX": true,
+		"HI": true, "VI": true, "DBOX": true, "SL": true,
+	}
+	// reservedTokens look like language or country codes but belong to other fields
+	reservedTokens = map[string]bool{
+		"OV": true, "VF": true, "HI": true, "VI": true, "SL": true, "IOP": true,
+		"MOS": true, "IAB": true, "CCAP": true, "OCAP": true,
+	}
+	languageNames = map[string]string{
+		"ENGLISH": "EN", "FRENCH": "FR", "GERMAN": "DE", "SPANISH": "ES", "ITALIAN": "IT",
+		"DUTCH": "NL", "PORTUGUESE": "PT", "RUSSIAN": "RU", "POLISH": "PL", "CZECH": "CS",
+		"SWEDISH": "SV", "DANISH": "DA", "NORWEGIAN": "NO", "FINNISH": "FI", "GREEK": "EL",
+		"TURKISH": "TR", "HUNGARIAN": "HU", "ARABIC": "AR", "HEBREW": "HE", "HINDI": "HI",
+		"JAPANESE": "JA", "KOREAN": "KO", "CHINESE": "ZH", "MANDARIN": "ZH", "CANTONESE": "YUE",
+		"THAI": "TH", "VIETNAMESE": "VI", "UKRAINIAN": "UK", "ROMANIAN": "RO", "BULGARIAN": "BG",
+	}
+
+	codeToken        = regexp.MustCompile(`^[A-Z]{2,3}$`)
+	versionToken     = regexp.MustCompile(`^[0-9]{1,2}$`)
+	imageAspectToken = regexp.MustCompile(`^[0-9]{3}$`)
+	resolutionToken  = regexp.MustCompile(`^[248]K$`)
+	packageToken     = regexp.MustCompile(`^(OV|VF[0-9]*)$`)
+	nameToken        = regexp.MustCompile(`^[A-Z0-9]*[A-Z][A-Z0-9]*$`)
+)
+
+// ParseContentTitle decodes a ContentTitleText. Titles that follow the convention are matched
+// field by field; the fields of titles that bend it (reordered, merged or spelled out, e.g.
+// TheBatman_OV-ENGLISH-OCAP_2D-4K_51-71-VI_SMPTE) are recognised token by token.
+func ParseContentTitle(s string) *ContentTitle {
+	ct := &ContentTitle{Raw: s}
+	fields := strings.Split(strings.TrimSpace(s), "_")
+	ct.FilmTitle = fields[0]
+	if len(fields) == 1 {
+		return ct
+	}
+
+	slot := slotTitle
+	conforming := true
+	for _, field := range fields[1:] {
+		tokens := strings.Split(strings.ToUpper(field), "-")
+		if next, ok := ct.matchField(tokens, slot); ok {
+			slot = next
+			continue
+		}
+		conforming = false
+		for _, tok := range tokens {
+			ct.matchToken(tok)
+		}
+	}
+	ct.Conforming = conforming && ct.ContentType != ""
+	return ct
+}
+
+// matchField assigns a whole field to the first slot after the previous one it fits, and
+// returns that slot. Studio and facility codes cannot be told apart from noise, so they only
+// match right where the convention puts them.
+func (ct *ContentTitle) matchField(tokens []string, prev int) (int, bool) {
+	for slot := prev + 1; slot <= slotPackage; slot++ {
+		switch slot {
+		case slotContentType:
+			if contentTypes[tokens[0]] {
+				ct.ContentType = tokens[0]
+				rest := tokens[1:]
+				// RTG-F, RTG-T: the rating card kind is part of the type
+				if tokens[0] == "RTG" && len(rest) > 0 && (rest[0] == "F" || rest[0] == "T") {
+					ct.ContentType += "-" + rest[0]
+					rest = rest[1:]
+				}
+				if len(rest) > 0 && versionToken.MatchString(rest[0]) {
+					ct.ContentVersion, _ = strconv.Atoi(rest[0])
+				}
+				return slot, true
+			}
+		case slotAspect:
+			if len(tokens) <= 2 && (tokens[0] == "F" || tokens[0] == "S" || tokens[0] == "C") &&
+				(len(tokens) == 1 || imageAspectToken.MatchString(tokens[1])) {
+				ct.AspectRatio = tokens[0]
+				if len(tokens) == 2 {
+					ct.ImageAspect = tokens[1]
+				}
+				return slot, true
+			}
+		case slotLanguage:
+			if ct.matchLanguage(tokens) {
+				return slot, true
+			}
+		case slotTerritory:
+			if len(tokens) <= 2 && isCode(tokens[0]) && (len(tokens) == 1 || nameToken.MatchString(tokens[1]) || versionToken.MatchString(tokens[1])) {
+				ct.Territory = tokens[0]
+				if len(tokens) == 2 {
+					ct.Rating = tokens[1]
+				}
+				return slot, true
+			}
+		case slotAudio:
+			if allTokens(tokens, func(t string) bool { return audioTokens[t] }) {
+				ct.AudioFormat = strings.Join(tokens, "-")
+				return slot, true
+			}
+		case slotResolution:
+			if len(tokens) == 1 && resolutionToken.MatchString(tokens[0]) {
+				ct.Resolution = tokens[0]
+				return slot, true
+			}
+		case slotStudio:
+			if prev >= slotAudio && len(tokens) == 1 && nameToken.MatchString(tokens[0]) &&
+				!packageToken.MatchString(tokens[0]) && !isStandard(tokens[0]) {
+				ct.Studio = tokens[0]
+				return slot, true
+			}
+		case slotDate:
+			if len(tokens) == 1 {
+				if d, ok := parseDate(tokens[0]); ok {
+					ct.Date = &d
+					return slot, true
+				}
+			}
+		case slotFacility:
+			if prev == slotDate && len(tokens) == 1 && nameToken.MatchString(tokens[0]) &&
+				!packageToken.MatchString(tokens[0]) && !isStandard(tokens[0]) {
+				ct.Facility = tokens[0]
+				return slot, true
+			}
+		case slotStandard:
+			if isStandard(tokens[0]) {
+				ct.Standard = normalizeStandard(tokens[0])
+				return slot, true
+			}
+		case slotPackage:
+			if len(tokens) == 1 && packageToken.MatchString(tokens[0]) {
+				ct.PackageType = tokens[0][:2]
+				return slot, true
+			}
+		}
+	}
+	return prev, false
+}
+
+// matchLanguage matches AUDIO[-SUBTITLE][-CCAP|OCAP]
+func (ct *ContentTitle) matchLanguage(tokens []string) bool {
+	var codes []string
+	captions := ""
+	for i, t := range tokens {
+		switch {
+		case (t == "CCAP" || t == "OCAP") && i == len(tokens)-1 && i > 0:
+			captions = t
+		case isCode(t) && captions == "":
+			codes = append(codes, t)
+		default:
+			return false
+		}
+	}
+	if len(codes) == 0 || len(codes) > 2 {
+		return false
+	}
+	ct.AudioLanguage = codes[0]
+	if len(codes) == 2 && codes[1] != "XX" {
+		ct.SubtitleLanguage = codes[1]
+	}
+	ct.Captions = captions
+	return true
+}
+
+// matchToken files a single token of a field that fits no slot under the field it belongs
+// to. The first language found is the audio language, the second the subtitle language.
+func (ct *ContentTitle) matchToken(tok string) {
+	switch {
+	case contentTypes[tok] && ct.ContentType == "":
+		ct.ContentType = tok
+	case packageToken.MatchString(tok):
+		ct.PackageType = tok[:2]
+	case tok == "CCAP" || tok == "OCAP":
+		ct.Captions = tok
+	case resolutionToken.MatchString(tok):
+		ct.Resolution = tok
+	case isStandard(tok):
+		ct.Standard = normalizeStandard(tok)
+	case audioTokens[tok]:
+		if ct.AudioFormat == "" {
+			ct.AudioFormat = tok
+		} else {
+			ct.AudioFormat += "-" + tok
+		}
+	case languageNames[tok] != "":
+		ct.addLanguage(languageNames[tok])
+	default:
+		if d, ok := parseDate(tok); ok && ct.Date == nil {
+			ct.Date = &d
+		}
+	}
+}
+
+func (ct *ContentTitle) addLanguage(code string) {
+	switch {
+	case ct.AudioLanguage == "":
+		ct.AudioLanguage = code
+	case ct.SubtitleLanguage == "" && code != ct.AudioLanguage:
+		ct.SubtitleLanguage = code
+	}
+}
+
+// isCode reports whether a token can be a language or country code
+func isCode(tok string) bool {
+	return codeToken.MatchString(tok) && !reservedTokens[tok] && !audioTokens[tok] && !contentTypes[tok]
+}
+
+func isStandard(tok string) bool {
+	return tok == "SMPTE" || tok == "IOP" || tok == "INTEROP"
+}
+
+func normalizeStandard(tok string) string {
+	if tok == "INTEROP" {
+		return "IOP"
+	}
+	return tok
+}
+
+// parseDate parses a YYYYMMDD date
+func parseDate(tok string) (time.Time, bool) {
+	if len(tok) != 8 {
+		return time.Time{}, false
+	}
+	d, err := time.Parse("20060102", tok)
+	if err != nil || d.Year() < 1990 {
+		return time.Time{}, false
+	}
+	return d, true
+}
+
+func allTokens(tokens []string, fn func(string) bool) bool {
+	for _, t := range tokens {
+		if !fn(t) {
+			return false
+		}
+	}
+	return true
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -100,3 +101,41 @@ func CalculateDirectorySize(path string) (int64, error) {
 	})
 	return size, err
 }
+
+// StorageUsage is the filesystem usage of a library or download location
+type StorageUsage struct {
+	Path       string `json:"path"`
+	Kind       string `json:"kind"` // "library" or "download"
+	TotalBytes int64  `json:"total_bytes"`
+	FreeBytes  int64  `json:"free_bytes"` // available to unprivileged users
+}
+
+// DiskUsage returns the size and the available space of the filesystem holding path
+func DiskUsage(path string) (total, free int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// MeasureStorage returns the filesystem usage of each library location and of the download
+// location. Locations that cannot be read are left out.
+func MeasureStorage(libraryPaths []string, downloadPath string) []StorageUsage {
+	var usage []StorageUsage
+	measure := func(path, kind string) {
+		if path == "" {
+			return
+		}
+		total, free, err := DiskUsage(path)
+		if err != nil {
+			return
+		}
+		usage = append(usage, StorageUsage{Path: path, Kind: kind, TotalBytes: total, FreeBytes: free})
+	}
+	for _, path := range libraryPaths {
+		measure(path, "library")
+	}
+	measure(downloadPath, "download")
+	return usage
+}